@@ -22,6 +22,8 @@ require (
 	github.com/pressly/goose/v3 v3.13.4
 	github.com/rjeczalik/notify v0.9.3
 	github.com/simukti/sqldb-logger v0.0.0-20230108155151-646c1a075551
+	golang.org/x/image v0.14.0
+	golang.org/x/time v0.5.0
 )
 
 require (
@@ -58,7 +60,6 @@ require (
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
 	golang.org/x/mod v0.13.0 // indirect
-	golang.org/x/time v0.5.0 // indirect
 	golang.org/x/tools v0.14.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	gotest.tools/v3 v3.0.2 // indirect
@@ -28,6 +28,9 @@ type (
 		BroadcastWorkflowUpdate(id uuid.UUID) error
 		BroadcastMediaUpdate(id uuid.UUID) error
 		BroadcastIngestUpdate(id uuid.UUID) error
+		BroadcastMissingEpisode(seriesID uuid.UUID) error
+		BroadcastDownloadUpdate(id uuid.UUID) error
+		BroadcastDownloadProgressUpdate(id uuid.UUID) error
 	}
 
 	eventKey struct {
@@ -59,8 +62,8 @@ func (service *activityService) Run(ctx context.Context) error {
 	messageChan := make(chan event.HandlerEvent, channelBufferSize)
 	service.eventBus.RegisterHandlerChannel(messageChan,
 		event.IngestUpdateEvent, event.IngestCompleteEvent, event.TranscodeUpdateEvent,
-		event.TranscodeTaskProgressEvent, event.TranscodeCompleteEvent, event.WorkflowUpdateEvent,
-		event.DownloadUpdateEvent, event.DownloadCompleteEvent, event.DownloadProgressEvent)
+		event.TranscodeTaskProgressEvent, event.TranscodeCompleteEvent, event.WorkflowUpdateEvent, event.UpdateMediaEvent,
+		event.ReplaceMediaEvent, event.MissingEpisodeEvent, event.DownloadUpdateEvent, event.DownloadCompleteEvent, event.DownloadProgressEvent)
 
 	log.Emit(logger.NEW, "Activity service started\n")
 	for {
@@ -100,14 +103,20 @@ func (service *activityService) handleEvent(ev event.HandlerEvent) error {
 		service.scheduleEventBroadcast(resourceKey, service.BroadcastWorkflowUpdate)
 	case event.NewMediaEvent:
 		service.scheduleEventBroadcast(resourceKey, service.BroadcastMediaUpdate)
+	case event.UpdateMediaEvent:
+		service.scheduleEventBroadcast(resourceKey, service.BroadcastMediaUpdate)
+	case event.ReplaceMediaEvent:
+		service.scheduleEventBroadcast(resourceKey, service.BroadcastMediaUpdate)
 	case event.DeleteMediaEvent:
 		service.scheduleEventBroadcast(resourceKey, service.BroadcastMediaUpdate)
+	case event.MissingEpisodeEvent:
+		service.scheduleEventBroadcast(resourceKey, service.BroadcastMissingEpisode)
 	case event.DownloadUpdateEvent:
 		fallthrough
 	case event.DownloadCompleteEvent:
-		fallthrough
+		service.scheduleEventBroadcast(resourceKey, service.BroadcastDownloadUpdate)
 	case event.DownloadProgressEvent:
-		return nil
+		service.scheduleRapidEventBroadcast(resourceKey, service.BroadcastDownloadProgressUpdate)
 	}
 
 	return errors.New("unknown event type")
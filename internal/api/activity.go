@@ -1,39 +1,257 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/controllers/downloads"
 	"github.com/hbomb79/Thea/internal/api/controllers/ingests"
 	"github.com/hbomb79/Thea/internal/api/controllers/transcodes"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
 	"github.com/hbomb79/Thea/internal/http/websocket"
+	"github.com/hbomb79/Thea/internal/user/permissions"
+	"github.com/labstack/echo/v4"
 )
 
 const (
 	TitleIngestUpdate            = "INGEST_UPDATE"
 	TitleTranscodeUpdate         = "TRANSCODE_TASK_UPDATE"
 	TitleTranscodeProgressUpdate = "TRANSCODE_TASK_PROGRESS_UPDATE"
+	TitleMissingEpisode          = "SERIES_MISSING_EPISODE"
+	TitleDownloadUpdate          = "DOWNLOAD_UPDATE"
+	TitleDownloadProgressUpdate  = "DOWNLOAD_PROGRESS_UPDATE"
 )
 
-type broadcaster struct {
-	socketHub        *websocket.SocketHub
-	ingestService    ingests.IngestService
-	transcodeService TranscodeService
-	store            Store
-}
+const (
+	// activityAccessCacheTTL is how long the accessibility of media (to an activity
+	// subscriber) is cached for, as many updates (e.g. progress) concern the same media.
+	activityAccessCacheTTL = time.Minute
+
+	// activityRevalidateInterval is how often the authentication of an activity subscriber is
+	// re-checked. Subscribers whose session is revoked, or whose permissions (or restrictions) have
+	// changed, are disconnected, and must reconnect using refreshed tokens.
+	activityRevalidateInterval = time.Second * 30
+)
+
+type (
+	broadcaster struct {
+		*sync.Mutex
+		socketHub        *websocket.SocketHub
+		ingestService    ingests.IngestService
+		transcodeService TranscodeService
+		downloadService  DownloadService
+		store            Store
+		authProvider     activityAuthProvider
+		subscribers      map[*activitySubscriber]struct{}
+	}
+
+	activityAuthProvider interface {
+		GetAuthenticatedUserFromContext(ec echo.Context) (*jwt.AuthenticatedUser, error)
+		RevalidateAuthenticatedUser(authUser *jwt.AuthenticatedUser) error
+	}
+
+	// broadcastScope describes who may receive a broadcast: only users with the permission
+	// provided, and (if set) only users who can access the media/series provided.
+	broadcastScope struct {
+		permission string
+		mediaID    *uuid.UUID
+		seriesID   *uuid.UUID
+	}
+
+	// broadcastRecipients is the scope of a message sent to the socket hub, containing the
+	// subscribers which are allowed to receive the broadcast. The recipients are resolved before
+	// the message is sent to the hub, so that the hub's event loop is never blocked by the database.
+	broadcastRecipients map[*activitySubscriber]struct{}
+
+	// activitySubscriber is the user of an open activity websocket.
+	activitySubscriber struct {
+		*sync.Mutex
+		user        *jwt.AuthenticatedUser
+		close       context.CancelFunc
+		validatedAt time.Time
+		accessible  map[uuid.UUID]cachedAccess
+	}
+
+	cachedAccess struct {
+		accessible bool
+		checkedAt  time.Time
+	}
+
+	// activityConnectionClosed is returned once an activity websocket closes. The
+	// connection has been hijacked by the websocket, so no response is written.
+	activityConnectionClosed struct{}
+)
 
 func newBroadcaster(
 	socketHub *websocket.SocketHub,
 	ingestService ingests.IngestService,
 	transcodeService TranscodeService,
+	downloadService DownloadService,
 	store Store,
+	authProvider activityAuthProvider,
 ) *broadcaster {
-	return &broadcaster{socketHub, ingestService, transcodeService, store}
+	return &broadcaster{
+		Mutex:            &sync.Mutex{},
+		socketHub:        socketHub,
+		ingestService:    ingestService,
+		transcodeService: transcodeService,
+		downloadService:  downloadService,
+		store:            store,
+		authProvider:     authProvider,
+		subscribers:      make(map[*activitySubscriber]struct{}),
+	}
+}
+
+// ConnectActivity upgrades the request to a websocket, over which the broadcasts which
+// the authenticated user is allowed to receive are sent. Blocks until the client disconnects,
+// or until the connection is closed because the authentication of the user is no longer current.
+func (hub *broadcaster) ConnectActivity(ec echo.Context, _ gen.ConnectActivityRequestObject) (gen.ConnectActivityResponseObject, error) {
+	user, err := hub.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	ctx, cancel := context.WithCancel(ec.Request().Context())
+	defer cancel()
+
+	subscriber := &activitySubscriber{
+		Mutex:       &sync.Mutex{},
+		user:        user,
+		close:       cancel,
+		validatedAt: time.Now(),
+		accessible:  make(map[uuid.UUID]cachedAccess),
+	}
+
+	hub.Lock()
+	hub.subscribers[subscriber] = struct{}{}
+	hub.Unlock()
+	defer func() {
+		hub.Lock()
+		delete(hub.subscribers, subscriber)
+		hub.Unlock()
+	}()
+
+	hub.socketHub.UpgradeToSocket(ctx, ec.Response(), ec.Request(), subscriber.filter)
+	return activityConnectionClosed{}, nil
+}
+
+func (activityConnectionClosed) VisitConnectActivityResponse(_ http.ResponseWriter) error {
+	return nil
+}
+
+// filter is the websocket message filter of the subscriber, which only accepts
+// broadcasts which the subscriber has been resolved as a recipient of.
+func (subscriber *activitySubscriber) filter(message *websocket.SocketMessage) bool {
+	recipients, ok := message.Scope.(broadcastRecipients)
+	if !ok {
+		return true
+	}
+
+	_, ok = recipients[subscriber]
+	return ok
+}
+
+// resolveRecipients returns the subscribers which are allowed to receive a broadcast
+// with the scope provided.
+func (hub *broadcaster) resolveRecipients(scope *broadcastScope) broadcastRecipients {
+	hub.Lock()
+	subscribers := make([]*activitySubscriber, 0, len(hub.subscribers))
+	for subscriber := range hub.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+	hub.Unlock()
+
+	recipients := make(broadcastRecipients)
+	for _, subscriber := range subscribers {
+		if hub.isRecipient(subscriber, scope) {
+			recipients[subscriber] = struct{}{}
+		}
+	}
+
+	return recipients
+}
+
+// isRecipient returns true if the subscriber provided is allowed to receive a broadcast
+// with the scope provided (see broadcastScope). If the authentication of the subscriber
+// is no longer current, the subscriber is disconnected.
+func (hub *broadcaster) isRecipient(subscriber *activitySubscriber, scope *broadcastScope) bool {
+	subscriber.Lock()
+	defer subscriber.Unlock()
+
+	if time.Since(subscriber.validatedAt) > activityRevalidateInterval {
+		if err := hub.authProvider.RevalidateAuthenticatedUser(subscriber.user); err != nil {
+			log.Infof("Closing activity connection of user %s: %v\n", subscriber.user.UserID, err)
+			subscriber.close()
+			return false
+		}
+
+		subscriber.validatedAt = time.Now()
+	}
+
+	// Users which must change their password (or enrol in MFA) are restricted to endpoints
+	// requiring no permissions, and so are not sent any permission-scoped broadcasts.
+	user := subscriber.user
+	if user.PasswordChangeRequired || user.MFAEnrolmentRequired || !slices.Contains(user.Permissions, scope.permission) {
+		return false
+	}
+
+	accessFilter := user.MediaAccessFilter()
+	if accessFilter == nil {
+		return true
+	}
+
+	if scope.mediaID != nil && !subscriber.isAccessible(*scope.mediaID, func(id uuid.UUID) (bool, error) { return hub.store.IsMediaAccessible(id, accessFilter) }) {
+		return false
+	}
+
+	if scope.seriesID != nil && !subscriber.isAccessible(*scope.seriesID, func(id uuid.UUID) (bool, error) { return hub.store.IsSeriesAccessible(id, accessFilter) }) {
+		return false
+	}
+
+	return true
+}
+
+// isAccessible returns the (cached) result of the accessibility check provided.
+//
+// Note: The caller must hold the mutex of the subscriber.
+func (subscriber *activitySubscriber) isAccessible(id uuid.UUID, check func(uuid.UUID) (bool, error)) bool {
+	if cached, ok := subscriber.accessible[id]; ok && time.Since(cached.checkedAt) < activityAccessCacheTTL {
+		return cached.accessible
+	}
+
+	ok, err := check(id)
+	if err != nil {
+		log.Warnf("Failed to check accessibility of %s for user %s: %v\n", id, subscriber.user.UserID, err)
+		return false
+	}
+
+	// Expired entries are removed as they're encountered, to stop the cache
+	// growing unbounded for long-lived connections.
+	for key, cached := range subscriber.accessible {
+		if time.Since(cached.checkedAt) >= activityAccessCacheTTL {
+			delete(subscriber.accessible, key)
+		}
+	}
+
+	subscriber.accessible[id] = cachedAccess{accessible: ok, checkedAt: time.Now()}
+	return ok
 }
 
 func (hub *broadcaster) BroadcastTranscodeUpdate(id uuid.UUID) error {
 	item := hub.transcodeService.Task(id)
-	hub.broadcast(TitleTranscodeUpdate, map[string]interface{}{
+	scope := &broadcastScope{permission: permissions.AccessTranscodePermission}
+	if item != nil {
+		mediaID := item.Media().ID()
+		scope.mediaID = &mediaID
+	}
+
+	hub.broadcast(TitleTranscodeUpdate, scope, map[string]interface{}{
 		"id":        id,
 		"transcode": nullsafeNewDto(item, transcodes.NewDtoFromTask),
 	})
@@ -46,7 +264,8 @@ func (hub *broadcaster) BroadcastTaskProgressUpdate(id uuid.UUID) error {
 		return nil
 	}
 
-	hub.broadcast(TitleTranscodeProgressUpdate, map[string]interface{}{
+	mediaID := item.Media().ID()
+	hub.broadcast(TitleTranscodeProgressUpdate, &broadcastScope{permission: permissions.AccessTranscodePermission, mediaID: &mediaID}, map[string]interface{}{
 		"transcode_id": id,
 		"progress":     item.LastProgress(),
 	})
@@ -55,18 +274,55 @@ func (hub *broadcaster) BroadcastTaskProgressUpdate(id uuid.UUID) error {
 
 func (hub *broadcaster) BroadcastIngestUpdate(id uuid.UUID) error {
 	item := hub.ingestService.GetIngest(id)
-	hub.broadcast(TitleIngestUpdate, map[string]interface{}{
+	hub.broadcast(TitleIngestUpdate, &broadcastScope{permission: permissions.AccessIngestsPermission}, map[string]interface{}{
 		"ingest_id": id,
 		"ingest":    nullsafeNewDto(item, ingests.NewDto),
 	})
 	return nil
 }
 
-func (hub *broadcaster) broadcast(title string, update map[string]interface{}) {
+func (hub *broadcaster) BroadcastDownloadUpdate(id uuid.UUID) error {
+	item := hub.downloadService.GetDownload(id)
+	var dto any
+	if item != nil {
+		dto = downloads.NewDto(item, hub.downloadService.GetProgress(id))
+	}
+
+	hub.broadcast(TitleDownloadUpdate, &broadcastScope{permission: permissions.AccessDownloadPermission}, map[string]interface{}{
+		"download_id": id,
+		"download":    dto,
+	})
+	return nil
+}
+
+func (hub *broadcaster) BroadcastDownloadProgressUpdate(id uuid.UUID) error {
+	progress := hub.downloadService.GetProgress(id)
+	if progress == nil {
+		return nil
+	}
+
+	hub.broadcast(TitleDownloadProgressUpdate, &broadcastScope{permission: permissions.AccessDownloadPermission}, map[string]interface{}{
+		"download_id": id,
+		"progress":    downloads.ProgressToDto(progress),
+	})
+	return nil
+}
+
+// BroadcastMissingEpisode notifies clients that a newly aired episode of
+// the series provided is not present in Thea.
+func (hub *broadcaster) BroadcastMissingEpisode(seriesID uuid.UUID) error {
+	hub.broadcast(TitleMissingEpisode, &broadcastScope{permission: permissions.AccessMediaPermission, seriesID: &seriesID}, map[string]interface{}{
+		"series_id": seriesID,
+	})
+	return nil
+}
+
+func (hub *broadcaster) broadcast(title string, scope *broadcastScope, update map[string]interface{}) {
 	hub.socketHub.Send(&websocket.SocketMessage{
 		Title: title,
 		Body:  update,
 		Type:  websocket.Update,
+		Scope: hub.resolveRecipients(scope),
 	})
 }
 
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/controllers/auditlog"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/audit"
+	"github.com/hbomb79/Thea/internal/database"
+	"github.com/hbomb79/Thea/internal/ffmpeg"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/internal/token"
+	"github.com/hbomb79/Thea/internal/user"
+	"github.com/hbomb79/Thea/internal/workflow"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	AuditService interface {
+		auditlog.AuditService
+		Record(entry *audit.Entry) error
+	}
+
+	// auditStore is the subset of the store used to capture snapshots of the
+	// resources targeted by audited actions.
+	auditStore interface {
+		GetUserWithID(userID uuid.UUID) (*user.User, error)
+		GetRole(roleID uuid.UUID) (*user.Role, error)
+		GetWorkflow(workflowID uuid.UUID) *workflow.Workflow
+		GetTarget(targetID uuid.UUID) *ffmpeg.Target
+		GetMovie(movieID uuid.UUID) (*media.Movie, error)
+		GetSeries(seriesID uuid.UUID) (*media.Series, error)
+		GetSeason(seasonID uuid.UUID) (*media.Season, error)
+		GetEpisode(episodeID uuid.UUID) (*media.Episode, error)
+		GetMediaFile(fileID uuid.UUID) (*media.MediaFile, error)
+		GetSession(sessionID uuid.UUID) (*token.Session, error)
+		GetAPIKey(keyID uuid.UUID) (*token.APIKey, error)
+	}
+
+	auditAuthProvider interface {
+		GetAuthenticatedUserFromContext(ec echo.Context) (*jwt.AuthenticatedUser, error)
+	}
+
+	// auditedOperation describes the resource targeted by an operation.
+	auditedOperation struct {
+		resourceType string
+
+		// idField is the path (e.g. 'ApiKey.Id') to the ID of the target resource, which
+		// is looked up on the request object, and then the response object (for operations
+		// which create the resource). Empty if the operation does not target a single resource.
+		idField string
+
+		// targetsActor indicates that the target of the operation is the authenticated user
+		targetsActor bool
+	}
+)
+
+// unauditedOperations are the mutating operations which are not recorded in the audit log,
+// either because they are performed before authentication, or because they're too frequent
+// to be useful (e.g. each chunk of an upload).
+var unauditedOperations = map[string]struct{}{
+	"Login":       {},
+	"LoginMfa":    {},
+	"Refresh":     {},
+	"UploadChunk": {},
+}
+
+// auditedOperations maps the ID of each operation to the resource it targets. Mutating
+// operations absent from this map are still audited, but without a target resource.
+var auditedOperations = map[string]auditedOperation{
+	"ChangePassword":          {resourceType: "user", targetsActor: true},
+	"BeginTotpEnrolment":      {resourceType: "user", targetsActor: true},
+	"ConfirmTotpEnrolment":    {resourceType: "user", targetsActor: true},
+	"RegenerateRecoveryCodes": {resourceType: "user", targetsActor: true},
+	"DisableMfa":              {resourceType: "user", targetsActor: true},
+	"RevokeSession":           {resourceType: "session", idField: "Id"},
+	"CreateApiKey":            {resourceType: "api_key", idField: "ApiKey.Id"},
+	"RevokeApiKey":            {resourceType: "api_key", idField: "Id"},
+	"RotateSigningKeys":       {resourceType: "signing_key"},
+
+	"CreateUser":             {resourceType: "user", idField: "Id"},
+	"DeleteUser":             {resourceType: "user", idField: "Id"},
+	"RenameUser":             {resourceType: "user", idField: "Id"},
+	"ResetUserMfa":           {resourceType: "user", idField: "Id"},
+	"UnlockUser":             {resourceType: "user", idField: "Id"},
+	"SetUserPassword":        {resourceType: "user", idField: "Id"},
+	"UpdateUserPermissions":  {resourceType: "user", idField: "Id"},
+	"UpdateUserRestrictions": {resourceType: "user", idField: "Id"},
+	"UpdateUserRoles":        {resourceType: "user", idField: "Id"},
+	"RevokeUserSessions":     {resourceType: "user", idField: "Id"},
+	"RevokeUserApiKey":       {resourceType: "api_key", idField: "ApiKeyId"},
+	"RevokeUserSession":      {resourceType: "session", idField: "SessionId"},
+
+	"CreateRole": {resourceType: "role", idField: "Id"},
+	"UpdateRole": {resourceType: "role", idField: "Id"},
+	"DeleteRole": {resourceType: "role", idField: "Id"},
+
+	"DeleteMovie":     {resourceType: "movie", idField: "Id"},
+	"RefreshMovie":    {resourceType: "movie", idField: "Id"},
+	"RematchMovie":    {resourceType: "movie", idField: "Id"},
+	"DeleteSeries":    {resourceType: "series", idField: "Id"},
+	"RefreshSeries":   {resourceType: "series", idField: "Id"},
+	"DeleteSeason":    {resourceType: "season", idField: "Id"},
+	"RefreshSeason":   {resourceType: "season", idField: "Id"},
+	"DeleteEpisode":   {resourceType: "episode", idField: "Id"},
+	"RefreshEpisode":  {resourceType: "episode", idField: "Id"},
+	"RematchEpisode":  {resourceType: "episode", idField: "Id"},
+	"UpdateMediaFile": {resourceType: "media_file", idField: "Id"},
+
+	"CreateIngests":         {resourceType: "ingest"},
+	"DeleteIngest":          {resourceType: "ingest", idField: "Id"},
+	"ResolveIngest":         {resourceType: "ingest", idField: "Id"},
+	"ResolveIngests":        {resourceType: "ingest"},
+	"PollIngests":           {resourceType: "ingest"},
+	"DeleteIngestTitleRule": {resourceType: "title_rule", idField: "Id"},
+	"CreateUpload":          {resourceType: "upload", idField: "Id"},
+	"AbortUpload":           {resourceType: "upload", idField: "Id"},
+
+	"CreateDownload": {resourceType: "download", idField: "Id"},
+	"CancelDownload": {resourceType: "download", idField: "Id"},
+	"PauseDownload":  {resourceType: "download", idField: "Id"},
+	"ResumeDownload": {resourceType: "download", idField: "Id"},
+
+	"CreateTranscodeTask": {resourceType: "transcode"},
+	"DeleteTranscodeTask": {resourceType: "transcode", idField: "Id"},
+	"PauseTranscodeTask":  {resourceType: "transcode", idField: "Id"},
+	"ResumeTranscodeTask": {resourceType: "transcode", idField: "Id"},
+
+	"CreateWorkflow": {resourceType: "workflow"},
+	"UpdateWorkflow": {resourceType: "workflow", idField: "Id"},
+	"DeleteWorkflow": {resourceType: "workflow", idField: "Id"},
+	"CreateTarget":   {resourceType: "target", idField: "Id"},
+	"UpdateTarget":   {resourceType: "target", idField: "Id"},
+	"DeleteTarget":   {resourceType: "target", idField: "Id"},
+
+	"RunReconciliation": {resourceType: "reconciliation"},
+}
+
+// newAuditMiddleware returns a strict middleware which records an audit entry for every
+// mutating operation performed by an authenticated user. The entry is recorded once the
+// response status is known (including error responses), and contains snapshots of the target
+// resource before and after the operation, where the resource can be captured.
+//
+// Strict middleware is applied in order, with later middleware wrapping earlier middleware. This
+// middleware is applied before the request body validator, and so requests which are rejected
+// by validation (or rejected by the security middleware) never reach it, and are not audited.
+func newAuditMiddleware(auditService AuditService, store auditStore, authProvider auditAuthProvider) gen.StrictMiddlewareFunc {
+	return func(f gen.StrictHandlerFunc, operationID string) gen.StrictHandlerFunc {
+		if _, ok := unauditedOperations[operationID]; ok {
+			return f
+		}
+
+		operation, isKnown := auditedOperations[operationID]
+		action := strings.ToLower(operationID[:1]) + operationID[1:]
+		return func(ec echo.Context, request interface{}) (interface{}, error) {
+			method := ec.Request().Method
+			if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+				return f(ec, request)
+			}
+
+			authUser, err := authProvider.GetAuthenticatedUserFromContext(ec)
+			if err != nil {
+				return f(ec, request)
+			}
+
+			entry := &audit.Entry{
+				ActorUserID:   authUser.UserID,
+				ActorAPIKeyID: authUser.APIKeyID,
+				Action:        action,
+				RequestBody:   audit.Snapshot(requestBody(request)),
+				RequestMethod: method,
+				RequestPath:   ec.Request().URL.Path,
+				IPAddress:     optionalString(ec.RealIP()),
+				UserAgent:     optionalString(ec.Request().UserAgent()),
+			}
+			if authUser.APIKeyID == nil && authUser.SessionID != uuid.Nil {
+				entry.ActorSessionID = &authUser.SessionID
+			}
+
+			var resourceID *uuid.UUID
+			if isKnown {
+				entry.ResourceType = &operation.resourceType
+				if operation.targetsActor {
+					resourceID = &authUser.UserID
+				} else if id, ok := fieldUUID(request, operation.idField); ok {
+					resourceID = &id
+				}
+
+				if resourceID != nil {
+					entry.Before = snapshotResource(store, operation.resourceType, *resourceID)
+				}
+			}
+
+			// The entry is recorded when the response is written, as the status of error
+			// responses is unknown until the error has been handled by Echo.
+			ec.Response().Before(func() {
+				if resourceID != nil {
+					idStr := resourceID.String()
+					entry.ResourceID = &idStr
+				}
+
+				entry.StatusCode = ec.Response().Status
+				if err := auditService.Record(entry); err != nil {
+					log.Warnf("Failed to record audit entry for %s by user %s: %v\n", action, authUser.UserID, err)
+				}
+			})
+
+			response, err := f(ec, request)
+			if isKnown && err == nil {
+				if resourceID == nil && !operation.targetsActor {
+					if id, ok := fieldUUID(response, operation.idField); ok {
+						resourceID = &id
+					}
+				}
+
+				if resourceID != nil {
+					entry.After = snapshotResource(store, operation.resourceType, *resourceID)
+				}
+			}
+
+			return response, err
+		}
+	}
+}
+
+// snapshotResource returns a snapshot of the resource with the type and ID provided. Nil
+// is returned if the resource does not exist, or if the type of resource cannot be captured.
+func snapshotResource(store auditStore, resourceType string, id uuid.UUID) database.JSONColumn[map[string]any] {
+	var (
+		resource any
+		err      error
+	)
+	switch resourceType {
+	case "user":
+		resource, err = store.GetUserWithID(id)
+	case "role":
+		resource, err = store.GetRole(id)
+	case "workflow":
+		resource = store.GetWorkflow(id)
+	case "target":
+		resource = store.GetTarget(id)
+	case "movie":
+		resource, err = store.GetMovie(id)
+	case "series":
+		resource, err = store.GetSeries(id)
+	case "season":
+		resource, err = store.GetSeason(id)
+	case "episode":
+		resource, err = store.GetEpisode(id)
+	case "media_file":
+		resource, err = store.GetMediaFile(id)
+	case "session":
+		resource, err = store.GetSession(id)
+	case "api_key":
+		resource, err = store.GetAPIKey(id)
+	}
+
+	if err != nil {
+		return audit.Snapshot(nil)
+	}
+
+	return audit.Snapshot(resource)
+}
+
+// requestBody returns the body of the strict request object provided, or nil if it has none.
+func requestBody(request interface{}) any {
+	value := reflect.Indirect(reflect.ValueOf(request))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	body := value.FieldByName("Body")
+	if !body.IsValid() || !body.CanInterface() {
+		return nil
+	}
+
+	return body.Interface()
+}
+
+// fieldUUID returns the UUID found at the (dot-separated) field path of the value provided.
+func fieldUUID(value interface{}, path string) (uuid.UUID, bool) {
+	if path == "" || value == nil {
+		return uuid.Nil, false
+	}
+
+	current := reflect.ValueOf(value)
+	for _, name := range strings.Split(path, ".") {
+		current = reflect.Indirect(current)
+		if current.Kind() != reflect.Struct {
+			return uuid.Nil, false
+		}
+
+		current = current.FieldByName(name)
+		if !current.IsValid() {
+			return uuid.Nil, false
+		}
+	}
+
+	id, ok := current.Interface().(uuid.UUID)
+	return id, ok && id != uuid.Nil
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+
+	return &s
+}
@@ -0,0 +1,68 @@
+package auditlog
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/util"
+	"github.com/hbomb79/Thea/internal/audit"
+	"github.com/hbomb79/Thea/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultAuditLogLimit = 100
+	maxAuditLogLimit     = 1000
+)
+
+var log = logger.Get("AuditLogController")
+
+type (
+	AuditService interface {
+		ListEntries(filter audit.Filter) ([]*audit.Entry, error)
+	}
+
+	AuditLogController struct {
+		auditService AuditService
+	}
+)
+
+func New(auditService AuditService) *AuditLogController {
+	return &AuditLogController{auditService: auditService}
+}
+
+func (controller *AuditLogController) ListAuditLog(ec echo.Context, request gen.ListAuditLogRequestObject) (gen.ListAuditLogResponseObject, error) {
+	filter := audit.Filter{
+		ActorUserID:  request.Params.ActorId,
+		Action:       request.Params.Action,
+		ResourceType: request.Params.ResourceType,
+		ResourceID:   request.Params.ResourceId,
+		Since:        request.Params.Since,
+		Until:        request.Params.Until,
+		Limit:        defaultAuditLogLimit,
+	}
+
+	if request.Params.Limit != nil {
+		if *request.Params.Limit < 1 || *request.Params.Limit > maxAuditLogLimit {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLogLimit))
+		}
+
+		filter.Limit = uint64(*request.Params.Limit)
+	}
+	if request.Params.Offset != nil {
+		if *request.Params.Offset < 0 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "offset must not be negative")
+		}
+
+		filter.Offset = uint64(*request.Params.Offset)
+	}
+
+	entries, err := controller.auditService.ListEntries(filter)
+	if err != nil {
+		log.Errorf("Failed to list audit entries: %v\n", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError)
+	}
+
+	return gen.ListAuditLog200JSONResponse(util.ApplyConversion(entries, auditEntryToDto)), nil
+}
@@ -0,0 +1,28 @@
+package auditlog
+
+import (
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/audit"
+)
+
+func auditEntryToDto(entry *audit.Entry) gen.AuditEntry {
+	return gen.AuditEntry{
+		Id:             entry.ID,
+		CreatedAt:      entry.CreatedAt,
+		ActorUserId:    entry.ActorUserID,
+		ActorSessionId: entry.ActorSessionID,
+		ActorApiKeyId:  entry.ActorAPIKeyID,
+		Action:         entry.Action,
+		ResourceType:   entry.ResourceType,
+		ResourceId:     entry.ResourceID,
+		Before:         entry.Before.Get(),
+		After:          entry.After.Get(),
+		Changes:        entry.Changes.Get(),
+		RequestBody:    entry.RequestBody.Get(),
+		RequestMethod:  entry.RequestMethod,
+		RequestPath:    entry.RequestPath,
+		IpAddress:      entry.IPAddress,
+		UserAgent:      entry.UserAgent,
+		StatusCode:     entry.StatusCode,
+	}
+}
@@ -1,16 +1,33 @@
 package auth
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/controllers/users"
 	"github.com/hbomb79/Thea/internal/api/gen"
 	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/api/util"
+	"github.com/hbomb79/Thea/internal/http/oidc"
+	"github.com/hbomb79/Thea/internal/token"
 	"github.com/hbomb79/Thea/internal/user"
 	"github.com/hbomb79/Thea/pkg/logger"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	defaultFailedLoginsLimit = 100
+	maxFailedLoginsLimit     = 1000
+)
+
 var (
 	errUnauthorized = echo.NewHTTPError(http.StatusUnauthorized)
 	log             = logger.Get("AuthController")
@@ -22,40 +39,115 @@ type (
 		RecordUserRefresh(userID uuid.UUID) error
 		GetUserWithUsernameAndPassword(username []byte, rawPassword []byte) (*user.User, error)
 		GetUserWithID(ID uuid.UUID) (*user.User, error)
+		ListActiveSessionsForUser(userID uuid.UUID) ([]*token.Session, error)
+		GetSession(sessionID uuid.UUID) (*token.Session, error)
+		RevokeSession(sessionID uuid.UUID) error
+		VerifyUserPassword(userID uuid.UUID, password []byte) error
+		UpdateUserPassword(userID uuid.UUID, password []byte, passwordChangeRequired bool) error
+		SaveAPIKey(key *token.APIKey) error
+		ListAPIKeysForUser(userID uuid.UUID) ([]*token.APIKey, error)
+		GetAPIKey(keyID uuid.UUID) (*token.APIKey, error)
+		RevokeAPIKey(keyID uuid.UUID) error
+		RevokeAPIKeysForUser(userID uuid.UUID) error
+		GetUserWithUsername(username []byte) (*user.User, error)
+		GetUserWithIdentity(issuer string, subject string) (*user.User, error)
+		LinkUserIdentity(userID uuid.UUID, issuer string, subject string) error
+		CreateUserWithIdentity(username []byte, password []byte, issuer string, subject string) (*user.User, error)
+		ListRoles() ([]*user.Role, error)
+		UpdateUserRoles(userID uuid.UUID, roleIDs []uuid.UUID) error
+		ListUserDirectPermissions(userID uuid.UUID) ([]string, error)
+		UpdateUserPermissions(userID uuid.UUID, newPermissions []string) error
+		RecordFailedLogin(attempt *user.FailedLogin, policy user.LoginPolicy) error
+		ListFailedLogins(userID *uuid.UUID, limit uint64) ([]*user.FailedLogin, error)
+		BeginTOTPEnrolment(userID uuid.UUID, secret []byte) error
+		ConfirmTOTPEnrolment(userID uuid.UUID, code string) ([]string, error)
+		VerifyMFACode(userID uuid.UUID, code string) error
+		RegenerateRecoveryCodes(userID uuid.UUID) ([]string, error)
+		CountUnusedRecoveryCodes(userID uuid.UUID) (int, error)
+		DeleteUserMFA(userID uuid.UUID) error
 	}
 
 	AuthProvider interface {
-		RefreshTokens(allegedRefreshToken string) (*http.Cookie, *http.Cookie, error)
-		GenerateTokenCookies(userID uuid.UUID) (*http.Cookie, *http.Cookie, error)
+		RefreshTokens(allegedRefreshToken string, client token.Client) (*http.Cookie, *http.Cookie, error)
+		GenerateTokenCookies(userID uuid.UUID, client token.Client) (*http.Cookie, *http.Cookie, error)
+		GenerateMFAChallenge(userID uuid.UUID) (string, time.Time, error)
+		ValidateMFAChallenge(challenge string) (uuid.UUID, error)
 		GetAuthenticatedUserFromContext(ec echo.Context) (*jwt.AuthenticatedUser, error)
-		RevokeTokensInContext(ec echo.Context) (*http.Cookie, *http.Cookie)
-		RevokeAllForUser(userID uuid.UUID) (*http.Cookie, *http.Cookie)
+		RevokeTokensInContext(ec echo.Context) (*http.Cookie, *http.Cookie, error)
+		RevokeAllForUser(userID uuid.UUID) (*http.Cookie, *http.Cookie, error)
+		ListSigningKeys() []*token.SigningKey
+		RotateSigningKeys() error
+	}
+
+	OIDCProvider interface {
+		Enabled() bool
+		Config() oidc.Config
+		AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error)
+		Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*oidc.Identity, error)
 	}
 
 	AuthController struct {
-		store        Store
-		authProvider AuthProvider
+		store          Store
+		authProvider   AuthProvider
+		passwordPolicy user.PasswordPolicy
+		loginPolicy    user.LoginPolicy
+		mfaPolicy      user.MFAPolicy
+		loginThrottle  *loginThrottle
+		oidcProvider   OIDCProvider
 	}
 )
 
-func New(authProvider AuthProvider, store Store) *AuthController {
-	return &AuthController{store, authProvider}
+func New(authProvider AuthProvider, store Store, passwordPolicy user.PasswordPolicy, loginPolicy user.LoginPolicy, mfaPolicy user.MFAPolicy, oidcProvider OIDCProvider) *AuthController {
+	return &AuthController{
+		store:          store,
+		authProvider:   authProvider,
+		passwordPolicy: passwordPolicy,
+		loginPolicy:    loginPolicy,
+		mfaPolicy:      mfaPolicy,
+		loginThrottle:  newLoginThrottle(loginPolicy.ThrottleThreshold, time.Duration(loginPolicy.ThrottleMaxDelaySeconds)*time.Second),
+		oidcProvider:   oidcProvider,
+	}
 }
 
 // Login accepts a POST request containing the
 // alleged username and password in the body and:
 //   - Asserts that the user with the username provided exists
 //   - The provided password is valid
-//   - Generates an auth token, and a refresh token, and stores
-//     these in the requests cookies
+//   - Creates a new session for the user, and generates an auth
+//     token and a refresh token which are stored in the requests cookies
+//
+// Repeated failed logins from the same IP address, or for the same username,
+// are throttled, and failed logins are recorded (which may cause the user to be locked).
+//
+// If the user has enrolled in two-factor authentication, no tokens are issued. Instead,
+// an MFA challenge token is returned which must be provided to LoginMfa along with a valid code.
 func (controller *AuthController) Login(ec echo.Context, request gen.LoginRequestObject) (gen.LoginResponseObject, error) {
+	client := clientFromRequest(ec, request.Body.Device)
+	ipThrottleKey, usernameThrottleKey := "ip:"+*client.IPAddress, "username:"+strings.ToLower(request.Body.Username)
+	if wait := controller.loginThrottle.RetryAfter(ipThrottleKey, usernameThrottleKey); wait > 0 {
+		return gen.Login429Response{Headers: gen.Login429ResponseHeaders{RetryAfter: int(math.Ceil(wait.Seconds()))}}, nil
+	}
+
 	user, err := controller.store.GetUserWithUsernameAndPassword([]byte(request.Body.Username), []byte(request.Body.Password))
 	if err != nil {
 		log.Warnf("Failed to authenticate due to error: %v\n", err)
+		controller.recordFailedLogin(request.Body.Username, client, err)
+		controller.loginThrottle.RecordFailure(ipThrottleKey, usernameThrottleKey)
 		return nil, errUnauthorized
 	}
+	controller.loginThrottle.Reset(usernameThrottleKey)
 
-	authTokenCookie, refreshTokenCookie, err := controller.authProvider.GenerateTokenCookies(user.ID)
+	if user.MFAEnabled {
+		challenge, expiresAt, err := controller.authProvider.GenerateMFAChallenge(user.ID)
+		if err != nil {
+			log.Warnf("Failed to authenticate due to error: %v\n", err)
+			return nil, errUnauthorized
+		}
+
+		return gen.Login202JSONResponse{ChallengeToken: challenge, ExpiresAt: expiresAt}, nil
+	}
+
+	authTokenCookie, refreshTokenCookie, err := controller.authProvider.GenerateTokenCookies(user.ID, client)
 	if err != nil {
 		log.Warnf("Failed to authenticate due to error: %v\n", err)
 		return nil, errUnauthorized
@@ -64,7 +156,11 @@ func (controller *AuthController) Login(ec echo.Context, request gen.LoginReques
 }
 
 func (controller *AuthController) LogoutSession(ec echo.Context, request gen.LogoutSessionRequestObject) (gen.LogoutSessionResponseObject, error) {
-	auth, refresh := controller.authProvider.RevokeTokensInContext(ec)
+	auth, refresh, err := controller.authProvider.RevokeTokensInContext(ec)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
 	return SetTokenCookiesResponse{*auth, *refresh}, nil
 }
 
@@ -74,20 +170,25 @@ func (controller *AuthController) LogoutAll(ec echo.Context, request gen.LogoutA
 		return nil, echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
-	authTokenCookie, refreshTokenCookie := controller.authProvider.RevokeAllForUser(user.UserID)
+	authTokenCookie, refreshTokenCookie, err := controller.authProvider.RevokeAllForUser(user.UserID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
 	return SetTokenCookiesResponse{*authTokenCookie, *refreshTokenCookie}, nil
 }
 
 // Refresh allows a client to obtain a new auth and Refresh token by
 // providing a valid Refresh token. The new tokens are added
-// to the responses cookies, same as login.
+// to the responses cookies, same as login. Refresh tokens can
+// only be used once, see jwtAuthProvider.RefreshTokens.
 func (controller *AuthController) Refresh(ec echo.Context, request gen.RefreshRequestObject) (gen.RefreshResponseObject, error) {
 	cookieToken, err := ec.Cookie(jwt.RefreshTokenCookieName)
 	if err != nil {
 		return nil, echo.ErrUnauthorized
 	}
 
-	authTokenCookie, refreshTokenCookie, err := controller.authProvider.RefreshTokens(cookieToken.Value)
+	authTokenCookie, refreshTokenCookie, err := controller.authProvider.RefreshTokens(cookieToken.Value, clientFromRequest(ec, nil))
 	if err != nil {
 		log.Errorf("Failed to refresh: %s\n", err)
 		return nil, echo.ErrForbidden
@@ -111,3 +212,251 @@ func (controller *AuthController) GetCurrentUser(ec echo.Context, request gen.Ge
 
 	return gen.GetCurrentUser200JSONResponse(userToDto(u)), nil
 }
+
+// ChangePassword changes the password of the current user, after verifying the
+// current password they provided (see verifyCurrentPassword). As the password of the user may have been compromised,
+// all existing sessions and API keys of the user are revoked, and a new session is created for this client.
+func (controller *AuthController) ChangePassword(ec echo.Context, request gen.ChangePasswordRequestObject) (gen.ChangePasswordResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	u, err := controller.store.GetUserWithID(authUser.UserID)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	if err := controller.verifyCurrentPassword(ec, u, request.Body.CurrentPassword); err != nil {
+		return nil, err
+	}
+
+	newPassword := []byte(request.Body.NewPassword)
+	if err := controller.passwordPolicy.Validate(u.Username, newPassword); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := controller.store.UpdateUserPassword(u.ID, newPassword, false); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if _, _, err := controller.authProvider.RevokeAllForUser(u.ID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if err := controller.store.RevokeAPIKeysForUser(u.ID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	authTokenCookie, refreshTokenCookie, err := controller.authProvider.GenerateTokenCookies(u.ID, clientFromRequest(ec, nil))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return SetTokenCookiesResponse{*authTokenCookie, *refreshTokenCookie}, nil
+}
+
+// ListSessions returns the active sessions of the current user.
+func (controller *AuthController) ListSessions(ec echo.Context, _ gen.ListSessionsRequestObject) (gen.ListSessionsResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	sessions, err := controller.store.ListActiveSessionsForUser(authUser.UserID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	dtos := make([]gen.Session, len(sessions))
+	for k, v := range sessions {
+		current := v.ID == authUser.SessionID
+		dtos[k] = users.SessionToDto(v)
+		dtos[k].Current = &current
+	}
+
+	return gen.ListSessions200JSONResponse(dtos), nil
+}
+
+// RevokeSession revokes the session of the current user with the ID provided.
+func (controller *AuthController) RevokeSession(ec echo.Context, request gen.RevokeSessionRequestObject) (gen.RevokeSessionResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	session, err := controller.store.GetSession(request.Id)
+	if err != nil || session.UserID != authUser.UserID || !session.IsActive() {
+		return nil, echo.ErrNotFound
+	}
+
+	if err := controller.store.RevokeSession(session.ID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RevokeSession200Response{}, nil
+}
+
+// ListApiKeys returns the API keys of the current user which have not been revoked.
+func (controller *AuthController) ListApiKeys(ec echo.Context, _ gen.ListApiKeysRequestObject) (gen.ListApiKeysResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	keys, err := controller.store.ListAPIKeysForUser(authUser.UserID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.ListApiKeys200JSONResponse(util.ApplyConversion(keys, users.APIKeyToDto)), nil
+}
+
+// CreateApiKey creates a new API key for the current user. The key can only be
+// scoped to permissions which the user has.
+func (controller *AuthController) CreateApiKey(ec echo.Context, request gen.CreateApiKeyRequestObject) (gen.CreateApiKeyResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	for _, perm := range request.Body.Permissions {
+		if !slices.Contains(authUser.Permissions, perm) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Cannot create API key with permission '%s' which the user does not have", perm))
+		}
+	}
+	if request.Body.ExpiresAt != nil && !request.Body.ExpiresAt.After(time.Now()) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "API key expiry must be in the future")
+	}
+
+	apiKey, key, err := token.NewAPIKey(authUser.UserID, request.Body.Label, request.Body.Permissions, request.Body.ExpiresAt)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if err := controller.store.SaveAPIKey(apiKey); err != nil {
+		if errors.Is(err, token.ErrAPIKeyPermissionsInvalid) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.CreateApiKey201JSONResponse{ApiKey: users.APIKeyToDto(apiKey), Key: key}, nil
+}
+
+// RevokeApiKey revokes the API key of the current user with the ID provided.
+func (controller *AuthController) RevokeApiKey(ec echo.Context, request gen.RevokeApiKeyRequestObject) (gen.RevokeApiKeyResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	key, err := controller.store.GetAPIKey(request.Id)
+	if err != nil || key.UserID != authUser.UserID || key.RevokedAt != nil {
+		return nil, echo.ErrNotFound
+	}
+
+	if err := controller.store.RevokeAPIKey(key.ID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RevokeApiKey200Response{}, nil
+}
+
+// ListSigningKeys returns the keys used to sign auth and refresh tokens,
+// including retired keys. The secrets of the keys are never returned.
+func (controller *AuthController) ListSigningKeys(ec echo.Context, _ gen.ListSigningKeysRequestObject) (gen.ListSigningKeysResponseObject, error) {
+	return gen.ListSigningKeys200JSONResponse(signingKeysToDto(controller.authProvider.ListSigningKeys())), nil
+}
+
+// RotateSigningKeys generates new signing keys for auth and refresh tokens, retiring the
+// existing keys, and returns the resulting keys.
+func (controller *AuthController) RotateSigningKeys(ec echo.Context, _ gen.RotateSigningKeysRequestObject) (gen.RotateSigningKeysResponseObject, error) {
+	if err := controller.authProvider.RotateSigningKeys(); err != nil {
+		log.Errorf("Failed to rotate signing keys: %v\n", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RotateSigningKeys200JSONResponse(signingKeysToDto(controller.authProvider.ListSigningKeys())), nil
+}
+
+// ListFailedLogins returns the most recent failed logins, optionally
+// filtered to only those which attempted to login as a specific user.
+func (controller *AuthController) ListFailedLogins(ec echo.Context, request gen.ListFailedLoginsRequestObject) (gen.ListFailedLoginsResponseObject, error) {
+	limit := uint64(defaultFailedLoginsLimit)
+	if request.Params.Limit != nil {
+		if *request.Params.Limit < 1 || *request.Params.Limit > maxFailedLoginsLimit {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxFailedLoginsLimit))
+		}
+
+		limit = uint64(*request.Params.Limit)
+	}
+
+	attempts, err := controller.store.ListFailedLogins(request.Params.UserId, limit)
+	if err != nil {
+		log.Errorf("Failed to list failed logins: %v\n", err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError)
+	}
+
+	return gen.ListFailedLogins200JSONResponse(util.ApplyConversion(attempts, failedLoginToDto)), nil
+}
+
+// recordFailedLogin records the failed login for the username provided. Failure to record
+// the login is logged, but does not otherwise affect the response to the login.
+func (controller *AuthController) recordFailedLogin(username string, client token.Client, loginErr error) {
+	reason := user.FailedLoginInvalidCredentials
+	if errors.Is(loginErr, user.ErrUserLocked) {
+		reason = user.FailedLoginUserLocked
+	} else if errors.Is(loginErr, user.ErrMFACodeInvalid) {
+		reason = user.FailedLoginInvalidMFACode
+	}
+
+	attempt := &user.FailedLogin{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		Username:  username,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		Reason:    reason,
+	}
+	if err := controller.store.RecordFailedLogin(attempt, controller.loginPolicy); err != nil {
+		log.Errorf("Failed to record failed login for username %s: %v\n", username, err)
+	}
+}
+
+// verifyCurrentPassword verifies the password provided by the current user, which is required to
+// confirm sensitive changes to their account. Verification is throttled, and failures are recorded
+// (counting towards the lockout of the user) in the same way as failed logins, so that a stolen
+// session cannot be used to brute-force the password of the user.
+func (controller *AuthController) verifyCurrentPassword(ec echo.Context, usr *user.User, password string) error {
+	client := clientFromRequest(ec, nil)
+	ipThrottleKey, usernameThrottleKey := "ip:"+*client.IPAddress, "username:"+strings.ToLower(usr.Username)
+	if wait := controller.loginThrottle.RetryAfter(ipThrottleKey, usernameThrottleKey); wait > 0 {
+		ec.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return echo.NewHTTPError(http.StatusTooManyRequests)
+	}
+
+	if usr.IsLocked() {
+		controller.recordFailedLogin(usr.Username, client, user.ErrUserLocked)
+		return echo.NewHTTPError(http.StatusForbidden, user.ErrUserLocked.Error())
+	}
+
+	if err := controller.store.VerifyUserPassword(usr.ID, []byte(password)); err != nil {
+		if errors.Is(err, user.ErrPasswordIncorrect) {
+			controller.recordFailedLogin(usr.Username, client, err)
+			controller.loginThrottle.RecordFailure(ipThrottleKey, usernameThrottleKey)
+			return echo.NewHTTPError(http.StatusBadRequest, "Current password is incorrect")
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	controller.loginThrottle.Reset(usernameThrottleKey)
+
+	return nil
+}
+
+// clientFromRequest returns the client information of the request, which is
+// stored against the session the request creates/uses.
+func clientFromRequest(ec echo.Context, device *string) token.Client {
+	userAgent := ec.Request().UserAgent()
+	ipAddress := ec.RealIP()
+	return token.Client{Device: device, UserAgent: &userAgent, IPAddress: &ipAddress}
+}
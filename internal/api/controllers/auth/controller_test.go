@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/token"
+	"github.com/hbomb79/Thea/internal/user"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeStore implements the parts of the Store used by the tests of this package. Calls to
+// any other method of the Store will panic, as the embedded interface is nil.
+type fakeStore struct {
+	Store
+	users        map[string]*user.User
+	passwords    map[string]string
+	failedLogins []*user.FailedLogin
+	loginPolicy  user.LoginPolicy
+
+	revokedAPIKeysFor []uuid.UUID
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{users: make(map[string]*user.User), passwords: make(map[string]string)}
+}
+
+func (store *fakeStore) addUser(username string, password string) *user.User {
+	usr := &user.User{}
+	usr.ID = uuid.New()
+	usr.Username = username
+
+	store.users[username] = usr
+	store.passwords[username] = password
+	return usr
+}
+
+func (store *fakeStore) GetUserWithUsernameAndPassword(username []byte, rawPassword []byte) (*user.User, error) {
+	usr, ok := store.users[string(username)]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	} else if usr.IsLocked() {
+		return nil, user.ErrUserLocked
+	} else if store.passwords[string(username)] != string(rawPassword) {
+		return nil, user.ErrPasswordIncorrect
+	}
+
+	return usr, nil
+}
+
+func (store *fakeStore) GetUserWithID(userID uuid.UUID) (*user.User, error) {
+	for _, usr := range store.users {
+		if usr.ID == userID {
+			return usr, nil
+		}
+	}
+
+	return nil, user.ErrUserNotFound
+}
+
+func (store *fakeStore) VerifyUserPassword(userID uuid.UUID, password []byte) error {
+	usr, err := store.GetUserWithID(userID)
+	if err != nil {
+		return err
+	} else if store.passwords[usr.Username] != string(password) {
+		return user.ErrPasswordIncorrect
+	}
+
+	return nil
+}
+
+func (store *fakeStore) UpdateUserPassword(userID uuid.UUID, password []byte, _ bool) error {
+	usr, err := store.GetUserWithID(userID)
+	if err != nil {
+		return err
+	}
+
+	store.passwords[usr.Username] = string(password)
+	return nil
+}
+
+func (store *fakeStore) RevokeAPIKeysForUser(userID uuid.UUID) error {
+	store.revokedAPIKeysFor = append(store.revokedAPIKeysFor, userID)
+	return nil
+}
+
+func (store *fakeStore) RecordFailedLogin(attempt *user.FailedLogin, policy user.LoginPolicy) error {
+	store.failedLogins = append(store.failedLogins, attempt)
+	store.loginPolicy = policy
+	return nil
+}
+
+// fakeAuthProvider issues placeholder token cookies, and authenticates
+// all requests as the authenticated user (if set).
+type fakeAuthProvider struct {
+	AuthProvider
+	issuedFor     []uuid.UUID
+	authenticated *uuid.UUID
+	revokedFor    []uuid.UUID
+}
+
+func (provider *fakeAuthProvider) GetAuthenticatedUserFromContext(_ echo.Context) (*jwt.AuthenticatedUser, error) {
+	if provider.authenticated == nil {
+		return nil, errors.New("request is not authenticated")
+	}
+
+	return &jwt.AuthenticatedUser{UserID: *provider.authenticated}, nil
+}
+
+func (provider *fakeAuthProvider) RevokeAllForUser(userID uuid.UUID) (*http.Cookie, *http.Cookie, error) {
+	provider.revokedFor = append(provider.revokedFor, userID)
+	return &http.Cookie{Name: "auth-token"}, &http.Cookie{Name: "refresh-token"}, nil
+}
+
+func (provider *fakeAuthProvider) GenerateTokenCookies(userID uuid.UUID, client token.Client) (*http.Cookie, *http.Cookie, error) {
+	provider.issuedFor = append(provider.issuedFor, userID)
+	return &http.Cookie{Name: "auth-token"}, &http.Cookie{Name: "refresh-token"}, nil
+}
+
+func newTestController(store Store, authProvider AuthProvider, loginPolicy user.LoginPolicy) *AuthController {
+	return New(authProvider, store, user.PasswordPolicy{}, loginPolicy, user.MFAPolicy{}, nil)
+}
+
+func login(controller *AuthController, username string, password string) (gen.LoginResponseObject, error) {
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	ec := echo.New().NewContext(req, httptest.NewRecorder())
+
+	return controller.Login(ec, gen.LoginRequestObject{Body: &gen.LoginJSONRequestBody{Username: username, Password: password}})
+}
+
+func TestLogin_ThrottlesRepeatedFailures(t *testing.T) {
+	store := newFakeStore()
+	store.addUser("alice", "correct")
+	controller := newTestController(store, &fakeAuthProvider{}, user.LoginPolicy{ThrottleThreshold: 2, ThrottleMaxDelaySeconds: 60})
+
+	for i := 0; i < 2; i++ {
+		if _, err := login(controller, "alice", "wrong"); !errors.Is(err, errUnauthorized) {
+			t.Fatalf("attempt %d: expected unauthorized error, got %v", i+1, err)
+		}
+	}
+
+	// Once throttled, even the correct password is not checked until the delay has passed
+	response, err := login(controller, "alice", "correct")
+	if err != nil {
+		t.Fatalf("expected throttled response, got error %v", err)
+	}
+	throttled, ok := response.(gen.Login429Response)
+	if !ok {
+		t.Fatalf("expected throttled response, got %T", response)
+	}
+	if throttled.Headers.RetryAfter != 1 {
+		t.Errorf("expected Retry-After of 1 second, got %d", throttled.Headers.RetryAfter)
+	}
+	if len(store.failedLogins) != 2 {
+		t.Errorf("expected throttled attempt to not be recorded as a failed login, got %d failed logins", len(store.failedLogins))
+	}
+}
+
+func TestLogin_SuccessResetsUsernameThrottle(t *testing.T) {
+	store := newFakeStore()
+	store.addUser("alice", "correct")
+	controller := newTestController(store, &fakeAuthProvider{}, user.LoginPolicy{ThrottleThreshold: 3, ThrottleMaxDelaySeconds: 60})
+
+	for i := 0; i < 2; i++ {
+		if _, err := login(controller, "alice", "wrong"); !errors.Is(err, errUnauthorized) {
+			t.Fatalf("attempt %d: expected unauthorized error, got %v", i+1, err)
+		}
+	}
+
+	if _, err := login(controller, "alice", "correct"); err != nil {
+		t.Fatalf("expected login to succeed, got %v", err)
+	}
+
+	if wait := controller.loginThrottle.RetryAfter("username:alice"); wait != 0 {
+		t.Errorf("expected username throttle to be reset, got wait of %s", wait)
+	}
+	if _, ok := controller.loginThrottle.entries["username:alice"]; ok {
+		t.Errorf("expected failures for username to be forgotten after successful login")
+	}
+	if _, ok := controller.loginThrottle.entries["ip:192.0.2.1"]; !ok {
+		t.Errorf("expected failures for IP address to be retained after successful login")
+	}
+}
+
+func TestLogin_LockedUser(t *testing.T) {
+	store := newFakeStore()
+	alice := store.addUser("alice", "correct")
+	lockedUntil := time.Now().Add(time.Minute)
+	alice.LockedUntil = &lockedUntil
+
+	authProvider := &fakeAuthProvider{}
+	policy := user.LoginPolicy{MaxFailedAttempts: 3, LockoutMinutes: 15}
+	controller := newTestController(store, authProvider, policy)
+
+	if _, err := login(controller, "alice", "correct"); !errors.Is(err, errUnauthorized) {
+		t.Fatalf("expected locked user to be unable to login, got %v", err)
+	}
+	if len(authProvider.issuedFor) != 0 {
+		t.Errorf("expected no tokens to be issued to locked user")
+	}
+
+	if len(store.failedLogins) != 1 || store.failedLogins[0].Reason != user.FailedLoginUserLocked {
+		t.Fatalf("expected a single failed login with reason %s, got %v", user.FailedLoginUserLocked, store.failedLogins)
+	}
+	if store.loginPolicy != policy {
+		t.Errorf("expected failed login to be recorded with the login policy of the controller")
+	}
+
+	// Once the lock has expired, the user can login again
+	expired := time.Now().Add(-time.Second)
+	alice.LockedUntil = &expired
+	if _, err := login(controller, "alice", "correct"); err != nil {
+		t.Fatalf("expected login to succeed once lock has expired, got %v", err)
+	}
+	if len(authProvider.issuedFor) != 1 || authProvider.issuedFor[0] != alice.ID {
+		t.Errorf("expected tokens to be issued to user once lock has expired")
+	}
+}
+
+func TestLogin_FailureReasons(t *testing.T) {
+	store := newFakeStore()
+	store.addUser("alice", "correct")
+	controller := newTestController(store, &fakeAuthProvider{}, user.LoginPolicy{})
+
+	for _, username := range []string{"alice", "bob"} {
+		if _, err := login(controller, username, "wrong"); !errors.Is(err, errUnauthorized) {
+			t.Fatalf("expected unauthorized error for %s, got %v", username, err)
+		}
+	}
+
+	for i, username := range []string{"alice", "bob"} {
+		attempt := store.failedLogins[i]
+		if attempt.Username != username || attempt.Reason != user.FailedLoginInvalidCredentials {
+			t.Errorf("expected failed login for %s with reason %s, got %s with reason %s", username, user.FailedLoginInvalidCredentials, attempt.Username, attempt.Reason)
+		}
+		if attempt.IPAddress == nil || *attempt.IPAddress != "192.0.2.1" {
+			t.Errorf("expected failed login to record IP address of client, got %v", attempt.IPAddress)
+		}
+	}
+}
+
+func changePassword(controller *AuthController, currentPassword string) (gen.ChangePasswordResponseObject, *httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodPost, "/auth/change-password", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	ec := echo.New().NewContext(req, rec)
+
+	response, err := controller.ChangePassword(ec, gen.ChangePasswordRequestObject{
+		Body: &gen.ChangePasswordJSONRequestBody{CurrentPassword: currentPassword, NewPassword: "new password"},
+	})
+	return response, rec, err
+}
+
+func httpStatus(err error) int {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+
+	return 0
+}
+
+func TestChangePassword_ThrottlesIncorrectPasswords(t *testing.T) {
+	store := newFakeStore()
+	alice := store.addUser("alice", "correct")
+	authProvider := &fakeAuthProvider{authenticated: &alice.ID}
+	controller := newTestController(store, authProvider, user.LoginPolicy{ThrottleThreshold: 2, ThrottleMaxDelaySeconds: 60})
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := changePassword(controller, "wrong"); httpStatus(err) != http.StatusBadRequest {
+			t.Fatalf("attempt %d: expected bad request, got %v", i+1, err)
+		}
+	}
+	if len(store.failedLogins) != 2 || store.failedLogins[0].Username != "alice" || store.failedLogins[0].Reason != user.FailedLoginInvalidCredentials {
+		t.Fatalf("expected incorrect passwords to be recorded as failed logins, got %v", store.failedLogins)
+	}
+
+	// Once throttled, the password is not checked until the delay has passed
+	_, rec, err := changePassword(controller, "correct")
+	if httpStatus(err) != http.StatusTooManyRequests {
+		t.Fatalf("expected too many requests, got %v", err)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After of 1 second, got %q", rec.Header().Get("Retry-After"))
+	}
+	if store.passwords["alice"] != "correct" {
+		t.Errorf("expected password to be unchanged while throttled")
+	}
+
+	// The throttle is shared with logins for the same username
+	if response, err := login(controller, "alice", "correct"); err != nil {
+		t.Fatalf("expected throttled login response, got error %v", err)
+	} else if _, ok := response.(gen.Login429Response); !ok {
+		t.Fatalf("expected login to be throttled, got %T", response)
+	}
+}
+
+func TestChangePassword_LockedUser(t *testing.T) {
+	store := newFakeStore()
+	alice := store.addUser("alice", "correct")
+	lockedUntil := time.Now().Add(time.Minute)
+	alice.LockedUntil = &lockedUntil
+
+	authProvider := &fakeAuthProvider{authenticated: &alice.ID}
+	controller := newTestController(store, authProvider, user.LoginPolicy{MaxFailedAttempts: 3, LockoutMinutes: 15})
+
+	if _, _, err := changePassword(controller, "correct"); httpStatus(err) != http.StatusForbidden {
+		t.Fatalf("expected locked user to be forbidden from changing password, got %v", err)
+	}
+	if store.passwords["alice"] != "correct" || len(authProvider.revokedFor) != 0 || len(store.revokedAPIKeysFor) != 0 {
+		t.Errorf("expected password and sessions of locked user to be unchanged")
+	}
+	if len(store.failedLogins) != 1 || store.failedLogins[0].Reason != user.FailedLoginUserLocked {
+		t.Errorf("expected attempt by locked user to be recorded, got %v", store.failedLogins)
+	}
+}
+
+func TestChangePassword_ResetsThrottleOnSuccess(t *testing.T) {
+	store := newFakeStore()
+	alice := store.addUser("alice", "correct")
+	authProvider := &fakeAuthProvider{authenticated: &alice.ID}
+	controller := newTestController(store, authProvider, user.LoginPolicy{ThrottleThreshold: 3, ThrottleMaxDelaySeconds: 60})
+
+	if _, _, err := changePassword(controller, "wrong"); httpStatus(err) != http.StatusBadRequest {
+		t.Fatalf("expected bad request, got %v", err)
+	}
+	if _, _, err := changePassword(controller, "correct"); err != nil {
+		t.Fatalf("expected password change to succeed, got %v", err)
+	}
+
+	if _, ok := controller.loginThrottle.entries["username:alice"]; ok {
+		t.Errorf("expected failures for username to be forgotten after successful verification")
+	}
+	if store.passwords["alice"] != "new password" || len(authProvider.revokedFor) != 1 || len(store.revokedAPIKeysFor) != 1 {
+		t.Errorf("expected password to be changed, and sessions and API keys revoked")
+	}
+}
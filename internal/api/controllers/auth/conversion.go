@@ -1,18 +1,56 @@
 package auth
 
 import (
+	"time"
+
 	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/token"
 	"github.com/hbomb79/Thea/internal/user"
 )
 
 func userToDto(u *user.User) gen.User {
+	var lockedUntil *time.Time
+	if u.IsLocked() {
+		lockedUntil = u.LockedUntil
+	}
+
 	return gen.User{
-		Id:          u.ID,
-		Username:    u.Username,
-		Permissions: u.Permissions,
-		CreatedAt:   u.CreatedAt,
-		UpdatedAt:   u.UpdatedAt,
-		LastLogin:   u.LastLoginAt,
-		LastRefresh: u.LastRefreshAt,
+		Id:                     u.ID,
+		Username:               u.Username,
+		Permissions:            u.Permissions,
+		Roles:                  u.Roles,
+		CreatedAt:              u.CreatedAt,
+		UpdatedAt:              u.UpdatedAt,
+		LastLogin:              u.LastLoginAt,
+		LastRefresh:            u.LastRefreshAt,
+		PasswordChangeRequired: u.PasswordChangeRequired,
+		LockedUntil:            lockedUntil,
+		MfaEnabled:             u.MFAEnabled,
+	}
+}
+
+func signingKeysToDto(keys []*token.SigningKey) []gen.SigningKey {
+	dtos := make([]gen.SigningKey, len(keys))
+	for k, v := range keys {
+		dtos[k] = gen.SigningKey{
+			Id:        v.ID,
+			TokenType: string(v.TokenType),
+			CreatedAt: v.CreatedAt,
+			RetiredAt: v.RetiredAt,
+		}
+	}
+
+	return dtos
+}
+
+func failedLoginToDto(attempt *user.FailedLogin) gen.FailedLogin {
+	return gen.FailedLogin{
+		Id:        attempt.ID,
+		CreatedAt: attempt.CreatedAt,
+		Username:  attempt.Username,
+		UserId:    attempt.UserID,
+		IpAddress: attempt.IPAddress,
+		UserAgent: attempt.UserAgent,
+		Reason:    gen.FailedLoginReason(attempt.Reason),
 	}
 }
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/user"
+	"github.com/hbomb79/Thea/pkg/totp"
+	"github.com/labstack/echo/v4"
+)
+
+// totpIssuer is the issuer included in TOTP provisioning URIs, which
+// authenticator apps display alongside the username of the user.
+const totpIssuer = "Thea"
+
+// LoginMfa completes the login of a user which has enrolled in two-factor authentication. The
+// MFA challenge token (issued by Login) identifies the user, and the code provided must be a valid
+// TOTP code (or an unused recovery code) for the user. Rejected codes are throttled, and count
+// towards the lockout of the user, in the same way as failed logins.
+func (controller *AuthController) LoginMfa(ec echo.Context, request gen.LoginMfaRequestObject) (gen.LoginMfaResponseObject, error) {
+	userID, err := controller.authProvider.ValidateMFAChallenge(request.Body.ChallengeToken)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+
+	client := clientFromRequest(ec, request.Body.Device)
+	ipThrottleKey, mfaThrottleKey := "ip:"+*client.IPAddress, "mfa:"+userID.String()
+	if wait := controller.loginThrottle.RetryAfter(ipThrottleKey, mfaThrottleKey); wait > 0 {
+		return gen.LoginMfa429Response{Headers: gen.LoginMfa429ResponseHeaders{RetryAfter: int(math.Ceil(wait.Seconds()))}}, nil
+	}
+
+	usr, err := controller.store.GetUserWithID(userID)
+	if err != nil {
+		return nil, errUnauthorized
+	}
+	if usr.IsLocked() {
+		controller.recordFailedLogin(usr.Username, client, user.ErrUserLocked)
+		return nil, errUnauthorized
+	}
+
+	if err := controller.store.VerifyMFACode(usr.ID, request.Body.Code); err != nil {
+		log.Warnf("Failed to authenticate user %s due to error: %v\n", usr.ID, err)
+		if errors.Is(err, user.ErrMFACodeInvalid) {
+			controller.recordFailedLogin(usr.Username, client, err)
+			controller.loginThrottle.RecordFailure(ipThrottleKey, mfaThrottleKey)
+		}
+
+		return nil, errUnauthorized
+	}
+	controller.loginThrottle.Reset(mfaThrottleKey)
+
+	authTokenCookie, refreshTokenCookie, err := controller.authProvider.GenerateTokenCookies(usr.ID, client)
+	if err != nil {
+		log.Warnf("Failed to authenticate due to error: %v\n", err)
+		return nil, errUnauthorized
+	}
+
+	return LoginResponse{User: userToDto(usr), AuthToken: *authTokenCookie, RefreshToken: *refreshTokenCookie}, nil
+}
+
+func (controller *AuthController) GetMfaStatus(ec echo.Context, _ gen.GetMfaStatusRequestObject) (gen.GetMfaStatusResponseObject, error) {
+	usr, err := controller.currentUser(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := 0
+	if usr.MFAEnabled {
+		if remaining, err = controller.store.CountUnusedRecoveryCodes(usr.ID); err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+	}
+
+	return gen.GetMfaStatus200JSONResponse{
+		Enabled:                usr.MFAEnabled,
+		Required:               controller.mfaPolicy.Requires(usr.Permissions),
+		RecoveryCodesRemaining: remaining,
+	}, nil
+}
+
+// BeginTotpEnrolment generates a new TOTP secret for the current user, which
+// must be confirmed (see ConfirmTotpEnrolment) before it's required at login.
+func (controller *AuthController) BeginTotpEnrolment(ec echo.Context, _ gen.BeginTotpEnrolmentRequestObject) (gen.BeginTotpEnrolmentResponseObject, error) {
+	usr, err := controller.currentUser(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := controller.store.BeginTOTPEnrolment(usr.ID, secret); err != nil {
+		if errors.Is(err, user.ErrMFAAlreadyEnrolled) {
+			return gen.BeginTotpEnrolment409Response{}, nil
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.BeginTotpEnrolment200JSONResponse{
+		Secret:          totp.EncodeSecret(secret),
+		ProvisioningUri: totp.ProvisioningURI(totpIssuer, usr.Username, secret),
+	}, nil
+}
+
+// ConfirmTotpEnrolment completes the pending TOTP enrolment of the current user, returning
+// their recovery codes. The tokens of the user must be refreshed, as the claims of the
+// current tokens may restrict the user until they've enrolled.
+func (controller *AuthController) ConfirmTotpEnrolment(ec echo.Context, request gen.ConfirmTotpEnrolmentRequestObject) (gen.ConfirmTotpEnrolmentResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	codes, err := controller.store.ConfirmTOTPEnrolment(authUser.UserID, request.Body.Code)
+	if err != nil {
+		return nil, mfaErrorToHTTP(err)
+	}
+
+	log.Infof("User %s has enrolled in two-factor authentication\n", authUser.UserID)
+	return gen.ConfirmTotpEnrolment200JSONResponse{RecoveryCodes: codes}, nil
+}
+
+func (controller *AuthController) RegenerateRecoveryCodes(ec echo.Context, request gen.RegenerateRecoveryCodesRequestObject) (gen.RegenerateRecoveryCodesResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := controller.store.VerifyMFACode(authUser.UserID, request.Body.Code); err != nil {
+		return nil, mfaErrorToHTTP(err)
+	}
+
+	codes, err := controller.store.RegenerateRecoveryCodes(authUser.UserID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RegenerateRecoveryCodes200JSONResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableMfa removes the two-factor authentication of the current user, which requires their
+// password (see verifyCurrentPassword) and a valid code. Users which are required to use two-factor authentication by
+// the MFA policy cannot disable it.
+func (controller *AuthController) DisableMfa(ec echo.Context, request gen.DisableMfaRequestObject) (gen.DisableMfaResponseObject, error) {
+	usr, err := controller.currentUser(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	if controller.mfaPolicy.Requires(usr.Permissions) {
+		return nil, echo.NewHTTPError(http.StatusForbidden, "two-factor authentication is required for this user")
+	}
+
+	if err := controller.verifyCurrentPassword(ec, usr, request.Body.Password); err != nil {
+		return nil, err
+	}
+
+	if err := controller.store.VerifyMFACode(usr.ID, request.Body.Code); err != nil {
+		return nil, mfaErrorToHTTP(err)
+	}
+
+	if err := controller.store.DeleteUserMFA(usr.ID); err != nil {
+		return nil, mfaErrorToHTTP(err)
+	}
+
+	log.Infof("User %s has disabled two-factor authentication\n", usr.ID)
+	return gen.DisableMfa204Response{}, nil
+}
+
+func (controller *AuthController) currentUser(ec echo.Context) (*user.User, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	usr, err := controller.store.GetUserWithID(authUser.UserID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return usr, nil
+}
+
+func mfaErrorToHTTP(err error) error {
+	switch {
+	case errors.Is(err, user.ErrMFANotEnrolled):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, user.ErrMFAAlreadyEnrolled):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, user.ErrMFACodeInvalid):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/http/oidc"
+	"github.com/hbomb79/Thea/internal/user"
+	"github.com/hbomb79/Thea/internal/user/permissions"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	oidcFlowCookieName = "oidc-flow"
+	oidcFlowExpiry     = time.Minute * 10
+)
+
+// oidcFlow is the state of an in-progress OIDC login, which is stored in a
+// cookie (scoped to the OIDC endpoints) between the login and the callback.
+type oidcFlow struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// OidcLogin begins a login via the configured OpenID Connect identity provider. A
+// random state, nonce and PKCE code verifier are generated and stored in the flow
+// cookie, and the user is redirected to the identity provider to authenticate.
+func (controller *AuthController) OidcLogin(ec echo.Context, _ gen.OidcLoginRequestObject) (gen.OidcLoginResponseObject, error) {
+	if !controller.oidcProvider.Enabled() {
+		return gen.OidcLogin404Response{}, nil
+	}
+
+	state, err := oidc.RandomValue()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	nonce, err := oidc.RandomValue()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	verifier, challenge, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	authURL, err := controller.oidcProvider.AuthCodeURL(ec.Request().Context(), state, nonce, challenge)
+	if err != nil {
+		log.Errorf("Failed to begin OIDC login: %v\n", err)
+		return nil, echo.NewHTTPError(http.StatusBadGateway, "identity provider is unavailable")
+	}
+
+	flow, err := json.Marshal(oidcFlow{State: state, Nonce: nonce, CodeVerifier: verifier})
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	flowCookie := createOidcFlowCookie(ec, base64.RawURLEncoding.EncodeToString(flow), time.Now().Add(oidcFlowExpiry))
+	return RedirectResponse{Location: authURL, Cookies: []http.Cookie{*flowCookie}}, nil
+}
+
+// OidcCallback completes a login via the configured OpenID Connect identity provider. The
+// state returned by the provider must match the state in the flow cookie, after which the
+// authorization code is exchanged for an ID token. The identity asserted by the ID token
+// is used to find the Thea user (linking or provisioning the user if configured to do so), and
+// the usual auth and refresh tokens are issued. Two-factor authentication for logins via the
+// identity provider is the responsibility of the identity provider.
+func (controller *AuthController) OidcCallback(ec echo.Context, request gen.OidcCallbackRequestObject) (gen.OidcCallbackResponseObject, error) {
+	if !controller.oidcProvider.Enabled() {
+		return gen.OidcCallback404Response{}, nil
+	}
+
+	if request.Params.Error != nil {
+		log.Warnf("OIDC login rejected by identity provider: %s\n", *request.Params.Error)
+		return nil, errUnauthorized
+	}
+	if request.Params.Code == nil || request.Params.State == nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "code and state must be provided")
+	}
+
+	flow, err := oidcFlowFromRequest(ec)
+	if err != nil {
+		log.Warnf("OIDC callback rejected: %v\n", err)
+		return nil, errUnauthorized
+	}
+	if subtle.ConstantTimeCompare([]byte(flow.State), []byte(*request.Params.State)) != 1 {
+		log.Warnf("OIDC callback rejected: state mismatch\n")
+		return nil, errUnauthorized
+	}
+
+	identity, err := controller.oidcProvider.Exchange(ec.Request().Context(), *request.Params.Code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		log.Warnf("OIDC callback rejected: %v\n", err)
+		return nil, errUnauthorized
+	}
+
+	user, err := controller.userForIdentity(identity)
+	if err != nil {
+		log.Warnf("OIDC login for subject %s (issuer %s) rejected: %v\n", identity.Subject, identity.Issuer, err)
+		return nil, errUnauthorized
+	}
+
+	if err := controller.syncGroupMappings(user, identity.Groups); err != nil {
+		log.Errorf("Failed to apply OIDC group mappings to user %s: %v\n", user.ID, err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError)
+	}
+
+	authTokenCookie, refreshTokenCookie, err := controller.authProvider.GenerateTokenCookies(user.ID, clientFromRequest(ec, nil))
+	if err != nil {
+		log.Warnf("Failed to authenticate due to error: %v\n", err)
+		return nil, errUnauthorized
+	}
+
+	expiredFlowCookie := createOidcFlowCookie(ec, "", time.Unix(0, 0))
+	return RedirectResponse{
+		Location: controller.oidcProvider.Config().PostLoginRedirectURL,
+		Cookies:  []http.Cookie{*authTokenCookie, *refreshTokenCookie, *expiredFlowCookie},
+	}, nil
+}
+
+// userForIdentity returns the Thea user linked to the identity provided. If no user has been
+// linked, the identity is linked to the user whose username is the verified email address of the
+// identity (if LinkByEmail is enabled), or a new user is provisioned (if AutoProvision is enabled).
+func (controller *AuthController) userForIdentity(identity *oidc.Identity) (*user.User, error) {
+	existingUser, err := controller.store.GetUserWithIdentity(identity.Issuer, identity.Subject)
+	if err == nil {
+		return existingUser, nil
+	} else if !errors.Is(err, user.ErrUserNotFound) {
+		return nil, err
+	}
+
+	if identity.Username == "" {
+		return nil, errors.New("identity has no username")
+	}
+
+	config := controller.oidcProvider.Config()
+	if config.LinkByEmail && identity.Email != "" && identity.EmailVerified {
+		existingUser, err := controller.store.GetUserWithUsername([]byte(identity.Email))
+		if err == nil {
+			if err := controller.store.LinkUserIdentity(existingUser.ID, identity.Issuer, identity.Subject); err != nil {
+				return nil, err
+			}
+
+			log.Infof("Linked OIDC subject %s (issuer %s) to existing user %s\n", identity.Subject, identity.Issuer, existingUser.ID)
+			return existingUser, nil
+		} else if !errors.Is(err, user.ErrUserNotFound) {
+			return nil, err
+		}
+	}
+
+	if !config.AutoProvision {
+		return nil, errors.New("identity is not linked to a user, and auto-provisioning is disabled")
+	}
+
+	// Provisioned users login via the identity provider, so their password
+	// is a random value which is never disclosed.
+	password, err := oidc.RandomValue()
+	if err != nil {
+		return nil, err
+	}
+
+	newUser, err := controller.store.CreateUserWithIdentity([]byte(identity.Username), []byte(password), identity.Issuer, identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Provisioned new user %s for OIDC subject %s (issuer %s)\n", newUser.ID, identity.Subject, identity.Issuer)
+	return newUser, nil
+}
+
+// syncGroupMappings replaces the roles and/or permissions of the user with those
+// mapped from the groups provided, if the respective mappings have been configured. The
+// roles/permissions are only updated if they differ from those the user already has, as
+// updating them invalidates the auth tokens of all the sessions of the user. Note that
+// any direct permissions granted to the user manually are overwritten.
+func (controller *AuthController) syncGroupMappings(usr *user.User, groups []string) error {
+	config := controller.oidcProvider.Config()
+	if len(config.GroupRoles) > 0 {
+		roleLabels := mapGroups(config.GroupRoles, groups)
+		if !equalSets(roleLabels, usr.Roles) {
+			roles, err := controller.store.ListRoles()
+			if err != nil {
+				return err
+			}
+
+			roleIDs := make([]uuid.UUID, 0, len(roleLabels))
+			for _, role := range roles {
+				if slices.Contains(roleLabels, role.Label) {
+					roleIDs = append(roleIDs, role.ID)
+				}
+			}
+			if len(roleIDs) != len(roleLabels) {
+				log.Warnf("OIDC group role mappings reference unknown roles, which will be ignored (mapped roles: %v)\n", roleLabels)
+			}
+
+			if err := controller.store.UpdateUserRoles(usr.ID, roleIDs); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(config.GroupPermissions) > 0 {
+		mappedPermissions := mapGroups(config.GroupPermissions, groups)
+		knownPermissions := permissions.Set()
+		grantedPermissions := make([]string, 0, len(mappedPermissions))
+		for _, permission := range mappedPermissions {
+			if _, ok := knownPermissions[permission]; ok {
+				grantedPermissions = append(grantedPermissions, permission)
+			}
+		}
+		if len(grantedPermissions) != len(mappedPermissions) {
+			log.Warnf("OIDC group permission mappings reference unknown permissions, which will be ignored (mapped permissions: %v)\n", mappedPermissions)
+		}
+
+		directPermissions, err := controller.store.ListUserDirectPermissions(usr.ID)
+		if err != nil {
+			return err
+		}
+
+		if !equalSets(grantedPermissions, directPermissions) {
+			if err := controller.store.UpdateUserPermissions(usr.ID, grantedPermissions); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func oidcFlowFromRequest(ec echo.Context) (*oidcFlow, error) {
+	cookie, err := ec.Cookie(oidcFlowCookieName)
+	if err != nil {
+		return nil, errors.New("flow cookie is missing")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, errors.New("flow cookie is malformed")
+	}
+
+	var flow oidcFlow
+	if err := json.Unmarshal(raw, &flow); err != nil || flow.State == "" {
+		return nil, errors.New("flow cookie is malformed")
+	}
+
+	return &flow, nil
+}
+
+// createOidcFlowCookie creates the flow cookie, scoped to the OIDC endpoints. The cookie
+// must use the Lax SameSite mode as it is sent on the redirect from the identity provider.
+func createOidcFlowCookie(ec echo.Context, value string, expiration time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcFlowCookieName,
+		Value:    value,
+		Path:     path.Dir(ec.Request().URL.Path),
+		Expires:  expiration,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// mapGroups returns the unique values mapped from the groups provided.
+func mapGroups(mapping map[string][]string, groups []string) []string {
+	output := make([]string, 0)
+	for _, group := range groups {
+		for _, value := range mapping[group] {
+			if !slices.Contains(output, value) {
+				output = append(output, value)
+			}
+		}
+	}
+
+	return output
+}
+
+func equalSets(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for _, v := range a {
+		if !slices.Contains(b, v) {
+			return false
+		}
+	}
+
+	return true
+}
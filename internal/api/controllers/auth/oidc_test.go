@@ -0,0 +1,536 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/http/oidc"
+	"github.com/hbomb79/Thea/internal/user"
+	"github.com/hbomb79/Thea/internal/user/permissions"
+	"github.com/labstack/echo/v4"
+)
+
+const testIssuer = "https://idp.example.com"
+
+// fakeOIDCProvider returns the identity provided from every exchange.
+type fakeOIDCProvider struct {
+	config   oidc.Config
+	identity *oidc.Identity
+
+	codeChallenge string
+	exchanges     []oidcFlow
+}
+
+func (provider *fakeOIDCProvider) Enabled() bool       { return provider.config.Enabled }
+func (provider *fakeOIDCProvider) Config() oidc.Config { return provider.config }
+
+func (provider *fakeOIDCProvider) AuthCodeURL(_ context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	provider.codeChallenge = codeChallenge
+	return testIssuer + "/authorize?state=" + state, nil
+}
+
+func (provider *fakeOIDCProvider) Exchange(_ context.Context, code string, codeVerifier string, nonce string) (*oidc.Identity, error) {
+	provider.exchanges = append(provider.exchanges, oidcFlow{State: code, Nonce: nonce, CodeVerifier: codeVerifier})
+	if provider.identity == nil {
+		return nil, oidc.ErrIDTokenInvalid
+	}
+
+	return provider.identity, nil
+}
+
+// fakeOIDCStore extends fakeStore with the user identities, roles and permissions used by OIDC logins.
+type fakeOIDCStore struct {
+	*fakeStore
+	identities        map[string]*user.User
+	roles             []*user.Role
+	directPermissions map[uuid.UUID][]string
+
+	linked             []*user.User
+	created            []*user.User
+	updatedRoles       map[uuid.UUID][]uuid.UUID
+	updatedPermissions map[uuid.UUID][]string
+}
+
+func newFakeOIDCStore() *fakeOIDCStore {
+	return &fakeOIDCStore{
+		fakeStore:          newFakeStore(),
+		identities:         make(map[string]*user.User),
+		directPermissions:  make(map[uuid.UUID][]string),
+		updatedRoles:       make(map[uuid.UUID][]uuid.UUID),
+		updatedPermissions: make(map[uuid.UUID][]string),
+	}
+}
+
+func (store *fakeOIDCStore) addRole(label string) *user.Role {
+	role := &user.Role{}
+	role.ID = uuid.New()
+	role.Label = label
+
+	store.roles = append(store.roles, role)
+	return role
+}
+
+func (store *fakeOIDCStore) GetUserWithIdentity(issuer string, subject string) (*user.User, error) {
+	if usr, ok := store.identities[issuer+"|"+subject]; ok {
+		return usr, nil
+	}
+
+	return nil, user.ErrUserNotFound
+}
+
+func (store *fakeOIDCStore) GetUserWithUsername(username []byte) (*user.User, error) {
+	if usr, ok := store.users[string(username)]; ok {
+		return usr, nil
+	}
+
+	return nil, user.ErrUserNotFound
+}
+
+func (store *fakeOIDCStore) LinkUserIdentity(userID uuid.UUID, issuer string, subject string) error {
+	for _, usr := range store.users {
+		if usr.ID == userID {
+			store.identities[issuer+"|"+subject] = usr
+			store.linked = append(store.linked, usr)
+			return nil
+		}
+	}
+
+	return user.ErrUserNotFound
+}
+
+func (store *fakeOIDCStore) CreateUserWithIdentity(username []byte, password []byte, issuer string, subject string) (*user.User, error) {
+	if len(password) == 0 {
+		return nil, errors.New("password must be provided")
+	}
+
+	usr := store.addUser(string(username), string(password))
+	store.identities[issuer+"|"+subject] = usr
+	store.created = append(store.created, usr)
+	return usr, nil
+}
+
+func (store *fakeOIDCStore) ListRoles() ([]*user.Role, error) { return store.roles, nil }
+
+func (store *fakeOIDCStore) UpdateUserRoles(userID uuid.UUID, roleIDs []uuid.UUID) error {
+	store.updatedRoles[userID] = roleIDs
+	return nil
+}
+
+func (store *fakeOIDCStore) ListUserDirectPermissions(userID uuid.UUID) ([]string, error) {
+	return store.directPermissions[userID], nil
+}
+
+func (store *fakeOIDCStore) UpdateUserPermissions(userID uuid.UUID, newPermissions []string) error {
+	store.updatedPermissions[userID] = newPermissions
+	store.directPermissions[userID] = newPermissions
+	return nil
+}
+
+func newTestOIDCController(store *fakeOIDCStore, provider *fakeOIDCProvider) (*AuthController, *fakeAuthProvider) {
+	authProvider := &fakeAuthProvider{}
+	return New(authProvider, store, user.PasswordPolicy{}, user.LoginPolicy{}, user.MFAPolicy{}, provider), authProvider
+}
+
+func TestUserForIdentity(t *testing.T) {
+	tests := []struct {
+		name          string
+		linkByEmail   bool
+		autoProvision bool
+		identity      oidc.Identity
+
+		// The expected user: "linked" for the user already linked to the identity, "alice" for
+		// the existing user whose username is the email address, "new" for a newly provisioned user
+		// and "" for no user.
+		expected string
+	}{
+		{
+			name:     "identity already linked",
+			identity: oidc.Identity{Subject: "linked-subject", Username: "someone", Email: "alice@example.com"},
+			expected: "linked",
+		},
+		{
+			name:        "links verified email",
+			linkByEmail: true,
+			identity:    oidc.Identity{Subject: "subject", Username: "alice", Email: "alice@example.com", EmailVerified: true},
+			expected:    "alice",
+		},
+		{
+			name:        "does not link unverified email",
+			linkByEmail: true,
+			identity:    oidc.Identity{Subject: "subject", Username: "alice", Email: "alice@example.com"},
+			expected:    "",
+		},
+		{
+			name:          "provisions user instead of linking unverified email",
+			linkByEmail:   true,
+			autoProvision: true,
+			identity:      oidc.Identity{Subject: "subject", Username: "alice-idp", Email: "alice@example.com"},
+			expected:      "new",
+		},
+		{
+			name:     "does not link when linking disabled",
+			identity: oidc.Identity{Subject: "subject", Username: "alice", Email: "alice@example.com", EmailVerified: true},
+			expected: "",
+		},
+		{
+			name:        "does not link by username",
+			linkByEmail: true,
+			identity:    oidc.Identity{Subject: "subject", Username: "alice@example.com", EmailVerified: true},
+			expected:    "",
+		},
+		{
+			name:          "provisions user without matching email",
+			linkByEmail:   true,
+			autoProvision: true,
+			identity:      oidc.Identity{Subject: "subject", Username: "bob", Email: "bob@example.com", EmailVerified: true},
+			expected:      "new",
+		},
+		{
+			name:          "rejects identity without username",
+			autoProvision: true,
+			identity:      oidc.Identity{Subject: "subject"},
+			expected:      "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newFakeOIDCStore()
+			alice := store.addUser("alice@example.com", "password")
+			linked := store.addUser("linked", "password")
+			store.identities[testIssuer+"|linked-subject"] = linked
+
+			provider := &fakeOIDCProvider{config: oidc.Config{Enabled: true, LinkByEmail: test.linkByEmail, AutoProvision: test.autoProvision}}
+			controller, _ := newTestOIDCController(store, provider)
+
+			test.identity.Issuer = testIssuer
+			usr, err := controller.userForIdentity(&test.identity)
+
+			switch test.expected {
+			case "":
+				if err == nil {
+					t.Fatalf("expected identity to be rejected, got user %s", usr.Username)
+				}
+				if len(store.linked) != 0 || len(store.created) != 0 {
+					t.Errorf("expected rejected identity to not be linked or provisioned")
+				}
+			case "linked", "alice":
+				expected := map[string]*user.User{"linked": linked, "alice": alice}[test.expected]
+				if err != nil || usr != expected {
+					t.Fatalf("expected user %s, got %v (err %v)", expected.Username, usr, err)
+				}
+				if test.expected == "alice" && (len(store.linked) != 1 || store.identities[testIssuer+"|subject"] != alice) {
+					t.Errorf("expected identity to be linked to existing user")
+				}
+				if len(store.created) != 0 {
+					t.Errorf("expected no user to be provisioned")
+				}
+			case "new":
+				if err != nil {
+					t.Fatalf("expected user to be provisioned, got %v", err)
+				}
+				if len(store.created) != 1 || usr != store.created[0] || usr.Username != test.identity.Username {
+					t.Fatalf("expected new user %s to be provisioned, got %v", test.identity.Username, usr)
+				}
+				if len(store.linked) != 0 {
+					t.Errorf("expected no existing user to be linked")
+				}
+			}
+		})
+	}
+}
+
+func TestSyncGroupMappings_Roles(t *testing.T) {
+	store := newFakeOIDCStore()
+	admin, viewer := store.addRole("admin"), store.addRole("viewer")
+	usr := store.addUser("alice", "password")
+
+	provider := &fakeOIDCProvider{config: oidc.Config{
+		Enabled: true,
+		GroupRoles: map[string][]string{
+			"admins":  {"admin", "viewer"},
+			"users":   {"viewer"},
+			"unknown": {"missing-role"},
+		},
+	}}
+	controller, _ := newTestOIDCController(store, provider)
+
+	if err := controller.syncGroupMappings(usr, []string{"admins", "users", "unknown", "unmapped"}); err != nil {
+		t.Fatalf("failed to sync group mappings: %v", err)
+	}
+
+	roleIDs := store.updatedRoles[usr.ID]
+	if len(roleIDs) != 2 || !slices.Contains(roleIDs, admin.ID) || !slices.Contains(roleIDs, viewer.ID) {
+		t.Errorf("expected roles to be updated to admin and viewer (ignoring unknown roles), got %v", roleIDs)
+	}
+	if _, ok := store.updatedPermissions[usr.ID]; ok {
+		t.Errorf("expected permissions to be untouched without a permission mapping")
+	}
+
+	// Roles which already match are not updated, as doing so invalidates the sessions of the user
+	delete(store.updatedRoles, usr.ID)
+	usr.Roles = []string{"viewer"}
+	if err := controller.syncGroupMappings(usr, []string{"users"}); err != nil {
+		t.Fatalf("failed to sync group mappings: %v", err)
+	}
+	if _, ok := store.updatedRoles[usr.ID]; ok {
+		t.Errorf("expected unchanged roles to not be updated")
+	}
+}
+
+func TestSyncGroupMappings_Permissions(t *testing.T) {
+	provider := &fakeOIDCProvider{config: oidc.Config{
+		Enabled: true,
+		GroupPermissions: map[string][]string{
+			"admins": {permissions.DeleteMediaPermission, permissions.AccessMediaPermission},
+			"users":  {permissions.AccessMediaPermission, "not:a-permission"},
+		},
+	}}
+
+	tests := []struct {
+		name              string
+		groups            []string
+		directPermissions []string
+		userPermissions   []string
+		expected          []string // nil if the permissions should not be updated
+	}{
+		{
+			name:     "grants mapped permissions",
+			groups:   []string{"admins"},
+			expected: []string{permissions.DeleteMediaPermission, permissions.AccessMediaPermission},
+		},
+		{
+			name:     "ignores unknown permissions",
+			groups:   []string{"users"},
+			expected: []string{permissions.AccessMediaPermission},
+		},
+		{
+			name:              "overwrites manually granted permissions",
+			groups:            []string{"users"},
+			directPermissions: []string{permissions.AccessMediaPermission, permissions.CreateDownloadPermission},
+			expected:          []string{permissions.AccessMediaPermission},
+		},
+		{
+			name:              "revokes all permissions without mapped groups",
+			groups:            []string{"unmapped"},
+			directPermissions: []string{permissions.AccessMediaPermission},
+			expected:          []string{},
+		},
+		{
+			name:              "skips update when direct permissions are unchanged",
+			groups:            []string{"admins", "users"},
+			directPermissions: []string{permissions.AccessMediaPermission, permissions.DeleteMediaPermission},
+			expected:          nil,
+		},
+		{
+			// The effective permissions include those of the roles of the user, so only
+			// the direct permissions are compared
+			name:              "compares direct permissions, not effective permissions",
+			groups:            []string{"users"},
+			directPermissions: []string{permissions.AccessMediaPermission},
+			userPermissions:   []string{permissions.AccessMediaPermission, permissions.CreateDownloadPermission},
+			expected:          nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := newFakeOIDCStore()
+			usr := store.addUser("alice", "password")
+			usr.Permissions = test.userPermissions
+			store.directPermissions[usr.ID] = test.directPermissions
+
+			controller, _ := newTestOIDCController(store, provider)
+			if err := controller.syncGroupMappings(usr, test.groups); err != nil {
+				t.Fatalf("failed to sync group mappings: %v", err)
+			}
+
+			updated, ok := store.updatedPermissions[usr.ID]
+			if test.expected == nil {
+				if ok {
+					t.Fatalf("expected permissions to not be updated, got %v", updated)
+				}
+				return
+			}
+
+			if !ok || !equalSets(updated, test.expected) {
+				t.Errorf("expected permissions to be updated to %v, got %v", test.expected, updated)
+			}
+			if _, ok := store.updatedRoles[usr.ID]; ok {
+				t.Errorf("expected roles to be untouched without a role mapping")
+			}
+		})
+	}
+}
+
+// oidcCallback performs a callback request with the flow cookie provided (if any).
+func oidcCallback(controller *AuthController, flow *oidcFlow, params gen.OidcCallbackParams) (gen.OidcCallbackResponseObject, error) {
+	req := httptest.NewRequest(http.MethodGet, "/api/thea/v1/auth/oidc/callback", nil)
+	if flow != nil {
+		encoded, _ := json.Marshal(flow)
+		req.AddCookie(&http.Cookie{Name: oidcFlowCookieName, Value: base64.RawURLEncoding.EncodeToString(encoded)})
+	}
+
+	ec := echo.New().NewContext(req, httptest.NewRecorder())
+	return controller.OidcCallback(ec, gen.OidcCallbackRequestObject{Params: params})
+}
+
+func TestOidcLogin(t *testing.T) {
+	provider := &fakeOIDCProvider{config: oidc.Config{Enabled: true}}
+	controller, _ := newTestOIDCController(newFakeOIDCStore(), provider)
+
+	ec := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/thea/v1/auth/oidc/login", nil), httptest.NewRecorder())
+	response, err := controller.OidcLogin(ec, gen.OidcLoginRequestObject{})
+	if err != nil {
+		t.Fatalf("failed to begin OIDC login: %v", err)
+	}
+
+	redirect, ok := response.(RedirectResponse)
+	if !ok || len(redirect.Cookies) != 1 {
+		t.Fatalf("expected redirect with flow cookie, got %+v", response)
+	}
+
+	cookie := redirect.Cookies[0]
+	if cookie.Name != oidcFlowCookieName || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/api/thea/v1/auth/oidc" {
+		t.Errorf("unexpected flow cookie %+v", cookie)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		t.Fatalf("failed to decode flow cookie: %v", err)
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal(raw, &flow); err != nil {
+		t.Fatalf("failed to decode flow cookie: %v", err)
+	}
+	if flow.State == "" || flow.Nonce == "" || flow.CodeVerifier == "" {
+		t.Fatalf("expected flow to contain state, nonce and code verifier, got %+v", flow)
+	}
+	if redirect.Location != testIssuer+"/authorize?state="+flow.State {
+		t.Errorf("expected redirect to identity provider with flow state, got %s", redirect.Location)
+	}
+
+	challenge := sha256.Sum256([]byte(flow.CodeVerifier))
+	if provider.codeChallenge != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+		t.Errorf("expected code challenge to be derived from code verifier of flow")
+	}
+}
+
+func TestOidcCallback(t *testing.T) {
+	store := newFakeOIDCStore()
+	provider := &fakeOIDCProvider{
+		config: oidc.Config{
+			Enabled:              true,
+			AutoProvision:        true,
+			PostLoginRedirectURL: "/home",
+			GroupPermissions:     map[string][]string{"users": {permissions.AccessMediaPermission}},
+		},
+		identity: &oidc.Identity{Issuer: testIssuer, Subject: "subject", Username: "alice", Groups: []string{"users"}},
+	}
+	controller, authProvider := newTestOIDCController(store, provider)
+
+	flow := &oidcFlow{State: "state", Nonce: "nonce", CodeVerifier: "verifier"}
+	response, err := oidcCallback(controller, flow, gen.OidcCallbackParams{Code: ptr("code"), State: ptr("state")})
+	if err != nil {
+		t.Fatalf("failed to complete OIDC login: %v", err)
+	}
+
+	if len(provider.exchanges) != 1 || !reflect.DeepEqual(provider.exchanges[0], oidcFlow{State: "code", Nonce: "nonce", CodeVerifier: "verifier"}) {
+		t.Fatalf("expected code to be exchanged with the nonce and code verifier of the flow, got %+v", provider.exchanges)
+	}
+	if len(store.created) != 1 || len(authProvider.issuedFor) != 1 || authProvider.issuedFor[0] != store.created[0].ID {
+		t.Fatalf("expected tokens to be issued to provisioned user")
+	}
+	if !equalSets(store.updatedPermissions[store.created[0].ID], []string{permissions.AccessMediaPermission}) {
+		t.Errorf("expected group mappings to be applied to provisioned user, got %v", store.updatedPermissions)
+	}
+
+	redirect, ok := response.(RedirectResponse)
+	if !ok || redirect.Location != "/home" {
+		t.Fatalf("expected redirect to post-login URL, got %+v", response)
+	}
+	if len(redirect.Cookies) != 3 || redirect.Cookies[2].Name != oidcFlowCookieName || !redirect.Cookies[2].Expires.Before(time.Now()) {
+		t.Errorf("expected token cookies and an expired flow cookie, got %+v", redirect.Cookies)
+	}
+}
+
+func TestOidcCallback_Rejected(t *testing.T) {
+	validFlow := &oidcFlow{State: "state", Nonce: "nonce", CodeVerifier: "verifier"}
+	tests := []struct {
+		name      string
+		flow      *oidcFlow
+		params    gen.OidcCallbackParams
+		identity  *oidc.Identity
+		exchanged bool
+	}{
+		{
+			name:   "error from identity provider",
+			flow:   validFlow,
+			params: gen.OidcCallbackParams{Error: ptr("access_denied"), State: ptr("state")},
+		},
+		{
+			name:   "missing flow cookie",
+			params: gen.OidcCallbackParams{Code: ptr("code"), State: ptr("state")},
+		},
+		{
+			name:   "state mismatch",
+			flow:   validFlow,
+			params: gen.OidcCallbackParams{Code: ptr("code"), State: ptr("another-state")},
+		},
+		{
+			name:      "invalid ID token",
+			flow:      validFlow,
+			params:    gen.OidcCallbackParams{Code: ptr("code"), State: ptr("state")},
+			exchanged: true,
+		},
+		{
+			name:      "unknown user",
+			flow:      validFlow,
+			params:    gen.OidcCallbackParams{Code: ptr("code"), State: ptr("state")},
+			identity:  &oidc.Identity{Issuer: testIssuer, Subject: "subject", Username: "alice"},
+			exchanged: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &fakeOIDCProvider{config: oidc.Config{Enabled: true}, identity: test.identity}
+			controller, authProvider := newTestOIDCController(newFakeOIDCStore(), provider)
+
+			if _, err := oidcCallback(controller, test.flow, test.params); !errors.Is(err, errUnauthorized) {
+				t.Fatalf("expected unauthorized error, got %v", err)
+			}
+			if exchanged := len(provider.exchanges) > 0; exchanged != test.exchanged {
+				t.Errorf("expected code exchange to be performed: %v, got %v", test.exchanged, exchanged)
+			}
+			if len(authProvider.issuedFor) != 0 {
+				t.Errorf("expected no tokens to be issued")
+			}
+		})
+	}
+}
+
+func TestOidcDisabled(t *testing.T) {
+	controller, _ := newTestOIDCController(newFakeOIDCStore(), &fakeOIDCProvider{})
+	ec := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+
+	if response, err := controller.OidcLogin(ec, gen.OidcLoginRequestObject{}); err != nil || response != (gen.OidcLogin404Response{}) {
+		t.Errorf("expected not found response from login, got %+v (err %v)", response, err)
+	}
+	if response, err := controller.OidcCallback(ec, gen.OidcCallbackRequestObject{}); err != nil || response != (gen.OidcCallback404Response{}) {
+		t.Errorf("expected not found response from callback, got %+v (err %v)", response, err)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
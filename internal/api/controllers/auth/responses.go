@@ -32,6 +32,10 @@ func (response LoginResponse) VisitLoginResponse(w http.ResponseWriter) error {
 	return json.NewEncoder(w).Encode(response.User)
 }
 
+func (response LoginResponse) VisitLoginMfaResponse(w http.ResponseWriter) error {
+	return response.VisitLoginResponse(w)
+}
+
 func (response SetTokenCookiesResponse) setTokensInResponse(w http.ResponseWriter) error {
 	http.SetCookie(w, &response.AuthToken)
 	http.SetCookie(w, &response.RefreshToken)
@@ -51,3 +55,32 @@ func (response SetTokenCookiesResponse) VisitLogoutSessionResponse(w http.Respon
 func (response SetTokenCookiesResponse) VisitLogoutAllResponse(w http.ResponseWriter) error {
 	return response.setTokensInResponse(w)
 }
+
+func (response SetTokenCookiesResponse) VisitChangePasswordResponse(w http.ResponseWriter) error {
+	return response.setTokensInResponse(w)
+}
+
+// RedirectResponse redirects the client to the location provided,
+// setting the cookies provided in the response.
+type RedirectResponse struct {
+	Location string
+	Cookies  []http.Cookie
+}
+
+func (response RedirectResponse) redirect(w http.ResponseWriter) error {
+	for i := range response.Cookies {
+		http.SetCookie(w, &response.Cookies[i])
+	}
+	w.Header().Set("Location", response.Location)
+	w.WriteHeader(http.StatusFound)
+
+	return nil
+}
+
+func (response RedirectResponse) VisitOidcLoginResponse(w http.ResponseWriter) error {
+	return response.redirect(w)
+}
+
+func (response RedirectResponse) VisitOidcCallbackResponse(w http.ResponseWriter) error {
+	return response.redirect(w)
+}
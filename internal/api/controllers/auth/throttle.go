@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// The consecutive failures for a key are forgotten once
+	// no failures have occurred for this long.
+	throttleResetAfter = time.Hour
+
+	// The number of keys tracked before stale keys are first pruned. Subsequent
+	// prunes occur once the number of keys has doubled since the last prune.
+	throttlePruneThreshold = 1024
+
+	// The maximum number of keys tracked. If pruning stale keys is not enough to remain
+	// within this limit, the keys with the oldest failures are evicted (in batches, so that
+	// the keys are not sorted on every failure once the limit has been reached).
+	throttleMaxEntries = 16384
+)
+
+type (
+	throttleEntry struct {
+		failures    int
+		lastFailure time.Time
+	}
+
+	// loginThrottle tracks consecutive failed logins by key (e.g. the IP address, or username,
+	// of the login). Once the number of failures for a key exceeds the threshold, further logins
+	// for the key are delayed exponentially (starting at one second, and doubling with each failure).
+	loginThrottle struct {
+		*sync.Mutex
+		threshold int
+		maxDelay  time.Duration
+		entries   map[string]*throttleEntry
+		pruneAt   int
+	}
+)
+
+func newLoginThrottle(threshold int, maxDelay time.Duration) *loginThrottle {
+	return &loginThrottle{
+		Mutex:     &sync.Mutex{},
+		threshold: threshold,
+		maxDelay:  maxDelay,
+		entries:   make(map[string]*throttleEntry),
+		pruneAt:   throttlePruneThreshold,
+	}
+}
+
+// RetryAfter returns how long the caller must wait before attempting
+// a login for the keys provided. Zero is returned if no wait is required.
+func (throttle *loginThrottle) RetryAfter(keys ...string) time.Duration {
+	throttle.Lock()
+	defer throttle.Unlock()
+
+	var wait time.Duration
+	for _, key := range keys {
+		if entry, ok := throttle.entries[key]; ok {
+			wait = max(wait, time.Until(entry.lastFailure.Add(throttle.delay(entry.failures))))
+		}
+	}
+
+	return wait
+}
+
+// RecordFailure records a failed login for each of the keys provided.
+func (throttle *loginThrottle) RecordFailure(keys ...string) {
+	throttle.Lock()
+	defer throttle.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		entry, ok := throttle.entries[key]
+		if !ok || now.Sub(entry.lastFailure) > throttleResetAfter {
+			entry = &throttleEntry{}
+			throttle.entries[key] = entry
+		}
+
+		entry.failures++
+		entry.lastFailure = now
+	}
+
+	if len(throttle.entries) > throttle.pruneAt {
+		throttle.prune(now)
+		if len(throttle.entries) > throttleMaxEntries {
+			throttle.evictOldest(len(throttle.entries) - throttleMaxEntries + throttlePruneThreshold)
+		}
+
+		throttle.pruneAt = min(max(throttlePruneThreshold, 2*len(throttle.entries)), throttleMaxEntries)
+	}
+}
+
+// Reset forgets the failed logins for the key provided.
+func (throttle *loginThrottle) Reset(key string) {
+	throttle.Lock()
+	defer throttle.Unlock()
+
+	delete(throttle.entries, key)
+}
+
+// delay returns the delay required after the number of failures provided.
+//
+// NB: The caller must hold the lock of the throttle.
+func (throttle *loginThrottle) delay(failures int) time.Duration {
+	exponent := failures - throttle.threshold
+	if throttle.threshold <= 0 || exponent < 0 {
+		return 0
+	}
+
+	// Avoid overflowing the duration for large numbers of failures
+	if exponent >= 32 {
+		return throttle.maxDelay
+	}
+
+	return min(time.Second<<exponent, throttle.maxDelay)
+}
+
+// prune removes all entries which no longer affect logins.
+//
+// NB: The caller must hold the lock of the throttle.
+func (throttle *loginThrottle) prune(now time.Time) {
+	for key, entry := range throttle.entries {
+		if now.Sub(entry.lastFailure) > throttleResetAfter {
+			delete(throttle.entries, key)
+		}
+	}
+}
+
+// evictOldest removes the entries with the oldest failures, until n entries have been removed.
+//
+// NB: The caller must hold the lock of the throttle.
+func (throttle *loginThrottle) evictOldest(n int) {
+	keys := make([]string, 0, len(throttle.entries))
+	for key := range throttle.entries {
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, func(a, b string) int {
+		return throttle.entries[a].lastFailure.Compare(throttle.entries[b].lastFailure)
+	})
+	for _, key := range keys[:min(n, len(keys))] {
+		delete(throttle.entries, key)
+	}
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLoginThrottle_Delay(t *testing.T) {
+	tests := []struct {
+		threshold int
+		failures  int
+		expected  time.Duration
+	}{
+		{3, 0, 0},
+		{3, 2, 0},
+		{3, 3, time.Second},
+		{3, 4, 2 * time.Second},
+		{3, 5, 4 * time.Second},
+		{3, 6, 8 * time.Second},
+		{3, 7, 10 * time.Second},
+		{3, 1000, 10 * time.Second},
+		{0, 1000, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("threshold %d with %d failures", test.threshold, test.failures), func(t *testing.T) {
+			throttle := newLoginThrottle(test.threshold, 10*time.Second)
+			if got := throttle.delay(test.failures); got != test.expected {
+				t.Errorf("expected delay %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoginThrottle_RetryAfter(t *testing.T) {
+	throttle := newLoginThrottle(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		throttle.RecordFailure("ip:a", "username:alice")
+		if wait := throttle.RetryAfter("ip:a", "username:alice"); wait != 0 {
+			t.Fatalf("failure %d: expected no wait below threshold, got %s", i+1, wait)
+		}
+	}
+
+	throttle.RecordFailure("ip:a", "username:alice")
+	if wait := throttle.RetryAfter("ip:a", "username:alice"); wait <= 0 || wait > time.Second {
+		t.Fatalf("expected wait of up to one second at threshold, got %s", wait)
+	}
+
+	throttle.RecordFailure("ip:a", "username:alice")
+	if wait := throttle.RetryAfter("ip:a"); wait <= time.Second || wait > 2*time.Second {
+		t.Fatalf("expected wait to double after further failure, got %s", wait)
+	}
+
+	// Unrelated keys are unaffected
+	if wait := throttle.RetryAfter("ip:b", "username:bob"); wait != 0 {
+		t.Fatalf("expected no wait for unrelated keys, got %s", wait)
+	}
+
+	// The longest wait of all keys is required
+	if wait := throttle.RetryAfter("ip:b", "username:alice"); wait <= time.Second {
+		t.Fatalf("expected wait of throttled key to apply, got %s", wait)
+	}
+}
+
+func TestLoginThrottle_DelayElapses(t *testing.T) {
+	throttle := newLoginThrottle(1, time.Minute)
+	throttle.RecordFailure("ip:a")
+
+	// Backdate the failure beyond the delay it incurred
+	throttle.entries["ip:a"].lastFailure = time.Now().Add(-2 * time.Second)
+	if wait := throttle.RetryAfter("ip:a"); wait > 0 {
+		t.Fatalf("expected no wait once the delay has elapsed, got %s", wait)
+	}
+}
+
+func TestLoginThrottle_Reset(t *testing.T) {
+	throttle := newLoginThrottle(1, time.Minute)
+	throttle.RecordFailure("ip:a", "username:alice")
+
+	throttle.Reset("username:alice")
+	if wait := throttle.RetryAfter("username:alice"); wait != 0 {
+		t.Errorf("expected no wait after reset, got %s", wait)
+	}
+	if wait := throttle.RetryAfter("ip:a"); wait == 0 {
+		t.Errorf("expected reset to only forget the key provided")
+	}
+
+	// Failures after a reset are counted from zero
+	throttle.RecordFailure("username:alice")
+	if failures := throttle.entries["username:alice"].failures; failures != 1 {
+		t.Errorf("expected 1 failure after reset, got %d", failures)
+	}
+}
+
+func TestLoginThrottle_FailuresForgottenAfterResetPeriod(t *testing.T) {
+	throttle := newLoginThrottle(3, time.Minute)
+	for i := 0; i < 5; i++ {
+		throttle.RecordFailure("ip:a")
+	}
+
+	throttle.entries["ip:a"].lastFailure = time.Now().Add(-throttleResetAfter - time.Second)
+	throttle.RecordFailure("ip:a")
+	if failures := throttle.entries["ip:a"].failures; failures != 1 {
+		t.Errorf("expected stale failures to be forgotten, got %d failures", failures)
+	}
+}
+
+func TestLoginThrottle_Prune(t *testing.T) {
+	throttle := newLoginThrottle(3, time.Minute)
+	throttle.RecordFailure("stale")
+	throttle.entries["stale"].lastFailure = time.Now().Add(-throttleResetAfter - time.Second)
+
+	for i := 0; i < throttlePruneThreshold; i++ {
+		throttle.RecordFailure(fmt.Sprintf("ip:%d", i))
+	}
+
+	if _, ok := throttle.entries["stale"]; ok {
+		t.Errorf("expected stale entry to be pruned")
+	}
+	if len(throttle.entries) != throttlePruneThreshold {
+		t.Errorf("expected %d entries to remain, got %d", throttlePruneThreshold, len(throttle.entries))
+	}
+}
+
+func TestLoginThrottle_MaxEntries(t *testing.T) {
+	throttle := newLoginThrottle(3, time.Minute)
+	throttle.RecordFailure("oldest")
+	throttle.entries["oldest"].lastFailure = time.Now().Add(-time.Minute)
+
+	for i := 0; i < throttleMaxEntries; i++ {
+		throttle.RecordFailure(fmt.Sprintf("ip:%d", i))
+	}
+
+	if len(throttle.entries) > throttleMaxEntries {
+		t.Errorf("expected at most %d entries, got %d", throttleMaxEntries, len(throttle.entries))
+	}
+	if _, ok := throttle.entries["oldest"]; ok {
+		t.Errorf("expected entry with the oldest failure to be evicted")
+	}
+	if _, ok := throttle.entries[fmt.Sprintf("ip:%d", throttleMaxEntries-1)]; !ok {
+		t.Errorf("expected entry with the newest failure to be retained")
+	}
+}
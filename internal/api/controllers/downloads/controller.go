@@ -0,0 +1,103 @@
+package downloads
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/download"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	DownloadService interface {
+		CreateDownload(url string, fileName *string, checksum *string, tmdbID *string) (*download.Download, error)
+		GetDownload(downloadID uuid.UUID) *download.Download
+		GetAllDownloads() []*download.Download
+		GetProgress(downloadID uuid.UUID) *download.Progress
+		PauseDownload(downloadID uuid.UUID) error
+		ResumeDownload(downloadID uuid.UUID) error
+		CancelDownload(downloadID uuid.UUID) error
+	}
+
+	// DownloadsController is responsible for the downloads of remote media,
+	// which are queued for ingestion once complete.
+	DownloadsController struct {
+		service DownloadService
+	}
+)
+
+func New(service DownloadService) *DownloadsController {
+	return &DownloadsController{service: service}
+}
+
+func (controller *DownloadsController) ListDownloads(ec echo.Context, _ gen.ListDownloadsRequestObject) (gen.ListDownloadsResponseObject, error) {
+	downloads := controller.service.GetAllDownloads()
+	dtos := make([]gen.Download, len(downloads))
+	for k, v := range downloads {
+		dtos[k] = NewDto(v, controller.service.GetProgress(v.ID))
+	}
+
+	return gen.ListDownloads200JSONResponse(dtos), nil
+}
+
+func (controller *DownloadsController) CreateDownload(ec echo.Context, request gen.CreateDownloadRequestObject) (gen.CreateDownloadResponseObject, error) {
+	body := request.Body
+	model, err := controller.service.CreateDownload(body.Url, body.FileName, body.Checksum, body.TmdbId)
+	if err != nil {
+		return nil, downloadError(err)
+	}
+
+	return gen.CreateDownload201JSONResponse(NewDto(model, nil)), nil
+}
+
+func (controller *DownloadsController) GetDownload(ec echo.Context, request gen.GetDownloadRequestObject) (gen.GetDownloadResponseObject, error) {
+	model := controller.service.GetDownload(request.Id)
+	if model == nil {
+		return nil, echo.ErrNotFound
+	}
+
+	return gen.GetDownload200JSONResponse(NewDto(model, controller.service.GetProgress(model.ID))), nil
+}
+
+func (controller *DownloadsController) CancelDownload(ec echo.Context, request gen.CancelDownloadRequestObject) (gen.CancelDownloadResponseObject, error) {
+	if err := controller.service.CancelDownload(request.Id); err != nil {
+		return nil, downloadError(err)
+	}
+
+	return gen.CancelDownload200Response{}, nil
+}
+
+func (controller *DownloadsController) PauseDownload(ec echo.Context, request gen.PauseDownloadRequestObject) (gen.PauseDownloadResponseObject, error) {
+	if err := controller.service.PauseDownload(request.Id); err != nil {
+		return nil, downloadError(err)
+	}
+
+	return gen.PauseDownload200Response{}, nil
+}
+
+func (controller *DownloadsController) ResumeDownload(ec echo.Context, request gen.ResumeDownloadRequestObject) (gen.ResumeDownloadResponseObject, error) {
+	if err := controller.service.ResumeDownload(request.Id); err != nil {
+		return nil, downloadError(err)
+	}
+
+	return gen.ResumeDownload200Response{}, nil
+}
+
+// downloadError converts an error returned by the download service in to an
+// HTTP error with an appropriate status code.
+func downloadError(err error) error {
+	switch {
+	case errors.Is(err, download.ErrDownloadNotFound):
+		return echo.ErrNotFound
+	case errors.Is(err, download.ErrInvalidURL),
+		errors.Is(err, download.ErrInvalidFileName),
+		errors.Is(err, download.ErrInvalidChecksum):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, download.ErrIllegalTransition):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+
+	return echo.NewHTTPError(http.StatusInternalServerError, err)
+}
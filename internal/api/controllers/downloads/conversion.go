@@ -0,0 +1,60 @@
+package downloads
+
+import (
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/download"
+)
+
+// NewDto creates a Download DTO using the download model, and
+// it's progress (if the download is underway).
+func NewDto(model *download.Download, progress *download.Progress) gen.Download {
+	return gen.Download{
+		Id:        model.ID,
+		Url:       model.URL,
+		FileName:  model.FileName,
+		State:     downloadStateToDto(model.State),
+		Size:      model.Size,
+		Checksum:  model.Checksum,
+		TmdbId:    model.TmdbID,
+		Error:     model.Error,
+		IngestId:  model.IngestID,
+		Progress:  progressToDto(progress),
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+	}
+}
+
+func ProgressToDto(progress *download.Progress) gen.DownloadProgress {
+	return gen.DownloadProgress{
+		DownloadedBytes: progress.DownloadedBytes,
+		TotalBytes:      progress.TotalBytes,
+		BytesPerSecond:  progress.BytesPerSecond,
+	}
+}
+
+func progressToDto(progress *download.Progress) *gen.DownloadProgress {
+	if progress == nil {
+		return nil
+	}
+
+	dto := ProgressToDto(progress)
+	return &dto
+}
+
+func downloadStateToDto(state download.DownloadState) gen.DownloadState {
+	//exhaustive:enforce
+	switch state {
+	case download.Queued:
+		return gen.QUEUED
+	case download.Downloading:
+		return gen.DOWNLOADING
+	case download.Paused:
+		return gen.PAUSED
+	case download.Failed:
+		return gen.FAILED
+	case download.Complete:
+		return gen.COMPLETED
+	}
+
+	panic("unreachable")
+}
@@ -0,0 +1,59 @@
+package images
+
+import (
+	"errors"
+	"net/http"
+	"os"
+
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/artwork"
+	"github.com/labstack/echo/v4"
+)
+
+// imageCacheControl instructs clients to cache images for a year. Images
+// are content-addressed, so the content for a given ID/width never changes.
+const imageCacheControl = "private, max-age=31536000, immutable"
+
+type (
+	ImageCache interface {
+		Get(imageID string, width int) (*artwork.Image, error)
+	}
+
+	ImageController struct{ cache ImageCache }
+)
+
+func New(cache ImageCache) *ImageController {
+	return &ImageController{cache: cache}
+}
+
+func (controller *ImageController) GetImage(ec echo.Context, request gen.GetImageRequestObject) (gen.GetImageResponseObject, error) {
+	width := 0
+	if request.Params.Width != nil {
+		width = *request.Params.Width
+	}
+
+	image, err := controller.cache.Get(request.Id, width)
+	if err != nil {
+		if errors.Is(err, artwork.ErrImageNotFound) {
+			return gen.GetImage404Response{}, nil
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if request.Params.IfNoneMatch != nil && *request.Params.IfNoneMatch == image.ETag() {
+		return gen.GetImage304Response{}, nil
+	}
+
+	file, err := os.Open(image.Path)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.GetImage200ImageResponse{
+		Body:          file,
+		ContentType:   image.ContentType,
+		ContentLength: image.Size,
+		Headers:       gen.GetImage200ResponseHeaders{CacheControl: imageCacheControl, ETag: image.ETag()},
+	}, nil
+}
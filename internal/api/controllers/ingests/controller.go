@@ -1,6 +1,8 @@
 package ingests
 
 import (
+	"errors"
+	"io/fs"
 	"net/http"
 
 	"github.com/google/uuid"
@@ -16,7 +18,11 @@ type (
 		GetIngest(ingestID uuid.UUID) *ingest.IngestItem
 		RemoveIngest(ingestID uuid.UUID) error
 		DiscoverNewFiles()
-		ResolveTroubledIngest(itemID uuid.UUID, method ingest.ResolutionType, context map[string]string) error
+		ResolveTroubledIngest(itemID uuid.UUID, method ingest.ResolutionType, context map[string]string, remember bool) error
+		ResolveTroubledIngests(filter ingest.TroubleFilter, method ingest.ResolutionType, context map[string]string, remember bool) ([]uuid.UUID, []uuid.UUID, error)
+		ListTitleRules() ([]*ingest.TitleRule, error)
+		DeleteTitleRule(ruleID uuid.UUID) error
+		IngestPath(path string, hints ingest.IngestHints) ([]*ingest.IngestItem, error)
 	}
 
 	// IngestsController is the struct which is responsible for defining the
@@ -44,6 +50,40 @@ func (controller *IngestsController) ListIngests(ec echo.Context, _ gen.ListInge
 	return gen.ListIngests200JSONResponse(dtos), nil
 }
 
+// CreateIngests queues the server-side path provided in the request body for ingestion,
+// returning DTOs for the ingests created.
+func (controller *IngestsController) CreateIngests(ec echo.Context, request gen.CreateIngestsRequestObject) (gen.CreateIngestsResponseObject, error) {
+	body := request.Body
+	hints := ingest.IngestHints{
+		Episodic:       body.Episodic,
+		TmdbID:         body.TmdbId,
+		SeasonNumber:   body.SeasonNumber,
+		EpisodeNumber:  body.EpisodeNumber,
+		SkipImportHold: body.SkipImportHold != nil && *body.SkipImportHold,
+	}
+
+	items, err := controller.service.IngestPath(body.Path, hints)
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case errors.Is(err, ingest.ErrPathAlreadyKnown):
+			return nil, echo.NewHTTPError(http.StatusConflict, err.Error())
+		case errors.Is(err, ingest.ErrPathNotInLibrary), errors.Is(err, ingest.ErrIncompatibleHints):
+			return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	dtos := make([]gen.Ingest, len(items))
+	for k, v := range items {
+		dtos[k] = NewDto(v)
+	}
+
+	return gen.CreateIngests201JSONResponse(dtos), nil
+}
+
 // GetIngest uses the 'id' path param from the context and retrieves the ingest from the
 // underlying store. If found, a DTO representing the ingest is returned.
 func (controller *IngestsController) GetIngest(ec echo.Context, request gen.GetIngestRequestObject) (gen.GetIngestResponseObject, error) {
@@ -77,6 +117,7 @@ func (controller *IngestsController) ResolveIngest(ec echo.Context, request gen.
 		request.Id,
 		troubleResolutionDtoMethodToModel(request.Body.Method),
 		request.Body.Context,
+		request.Body.Remember != nil && *request.Body.Remember,
 	); err != nil {
 		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
@@ -84,6 +125,60 @@ func (controller *IngestsController) ResolveIngest(ec echo.Context, request gen.
 	return gen.ResolveIngest200Response{}, nil
 }
 
+// ResolveIngests applies the same trouble resolution to all the troubled ingests which
+// match the filter criteria provided in the request body.
+func (controller *IngestsController) ResolveIngests(ec echo.Context, request gen.ResolveIngestsRequestObject) (gen.ResolveIngestsResponseObject, error) {
+	body := request.Body
+	if body.Method == "" {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "JSON body missing mandatory 'method' field")
+	}
+
+	filter := ingest.TroubleFilter{Title: body.Title}
+	if body.Ids != nil {
+		filter.IDs = *body.Ids
+	}
+	if body.TroubleType != nil {
+		troubleType := troubleTypeDtoToModel(*body.TroubleType)
+		filter.TroubleType = &troubleType
+	}
+
+	resolved, skipped, err := controller.service.ResolveTroubledIngests(
+		filter,
+		troubleResolutionDtoMethodToModel(body.Method),
+		body.Context,
+		body.Remember != nil && *body.Remember,
+	)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	return gen.ResolveIngests200JSONResponse{Resolved: resolved, Skipped: skipped}, nil
+}
+
+// ListIngestTitleRules returns all the title rules remembered when resolving troubled ingests.
+func (controller *IngestsController) ListIngestTitleRules(ec echo.Context, _ gen.ListIngestTitleRulesRequestObject) (gen.ListIngestTitleRulesResponseObject, error) {
+	rules, err := controller.service.ListTitleRules()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	dtos := make([]gen.IngestTitleRule, len(rules))
+	for k, v := range rules {
+		dtos[k] = titleRuleToDto(v)
+	}
+
+	return gen.ListIngestTitleRules200JSONResponse(dtos), nil
+}
+
+// DeleteIngestTitleRule deletes the title rule with the ID provided.
+func (controller *IngestsController) DeleteIngestTitleRule(ec echo.Context, request gen.DeleteIngestTitleRuleRequestObject) (gen.DeleteIngestTitleRuleResponseObject, error) {
+	if err := controller.service.DeleteTitleRule(request.Id); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.DeleteIngestTitleRule200Response{}, nil
+}
+
 func (controller *IngestsController) PollIngests(ec echo.Context, _ gen.PollIngestsRequestObject) (gen.PollIngestsResponseObject, error) {
 	controller.service.DiscoverNewFiles()
 
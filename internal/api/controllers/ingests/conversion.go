@@ -65,8 +65,18 @@ func ExtractTroubleContext(trouble *ingest.Trouble) (map[string]any, error) {
 
 		context := map[string]any{"choices": dtoChoices}
 		return context, nil
+	case ingest.DuplicateSource:
+		// Return a context which contains the source of the existing media, so the client
+		// can decide which of the two files to keep.
+		existingPath := trouble.GetDuplicateSourcePath()
+		if existingPath == nil {
+			return nil, fmt.Errorf("failed to extract trouble context for %w. Type mandates presence of context which is not present, resulting trouble context will be missing expected information", trouble)
+		}
+
+		context := map[string]any{"existing_source_path": *existingPath}
+		return context, nil
 	default:
-		// Only multi-choice TMDB errors have context, all other ingestion errors are (at the moment)
+		// Only multi-choice TMDB and duplicate source errors have context, all other ingestion errors are (at the moment)
 		// context-free (i.e. the message and allowed actions alone should suffice).
 		return map[string]any{}, nil
 	}
@@ -86,6 +96,8 @@ func scrapedMetadataToDto(metadata *media.FileMediaMetadata) *gen.FileMetadata {
 		Episodic:      metadata.Episodic,
 		FrameHeight:   metadata.FrameH,
 		FrameWidth:    metadata.FrameW,
+		VideoCodec:    &metadata.VideoCodec,
+		Bitrate:       metadata.Bitrate,
 		Path:          metadata.Path,
 		Runtime:       metadata.Runtime,
 		SeasonNumber:  metadata.SeasonNumber,
@@ -103,6 +115,12 @@ func troubleResolutionDtoMethodToModel(method gen.IngestTroubleResolutionType) i
 		return ingest.SpecifyTmdbID
 	case gen.RETRY:
 		return ingest.Retry
+	case gen.KEEPEXISTING:
+		return ingest.KeepExisting
+	case gen.REPLACEEXISTING:
+		return ingest.ReplaceExisting
+	case gen.KEEPBOTH:
+		return ingest.KeepBoth
 	}
 
 	panic("unreachable")
@@ -117,6 +135,12 @@ func troubleResolutionModelMethodToDto(model ingest.ResolutionType) gen.IngestTr
 		return gen.SPECIFYTMDBID
 	case ingest.Retry:
 		return gen.RETRY
+	case ingest.KeepExisting:
+		return gen.KEEPEXISTING
+	case ingest.ReplaceExisting:
+		return gen.REPLACEEXISTING
+	case ingest.KeepBoth:
+		return gen.KEEPBOTH
 	}
 
 	panic("unreachable")
@@ -135,11 +159,44 @@ func TroubleTypeModelToDto(troubleType ingest.TroubleType) gen.IngestTroubleType
 		return gen.TMDBFAILUREMULTIRESULT
 	case ingest.UnknownFailure:
 		return gen.UNKNOWNFAILURE
+	case ingest.DuplicateSource:
+		return gen.DUPLICATESOURCE
+	}
+
+	panic("unreachable")
+}
+
+func troubleTypeDtoToModel(troubleType gen.IngestTroubleType) ingest.TroubleType {
+	//exhaustive:enforce
+	switch troubleType {
+	case gen.METADATAFAILURE:
+		return ingest.MetadataFailure
+	case gen.TMDBFAILUREUNKNOWN:
+		return ingest.TmdbFailureUnknown
+	case gen.TMDBFAILURENORESULT:
+		return ingest.TmdbFailureNoResults
+	case gen.TMDBFAILUREMULTIRESULT:
+		return ingest.TmdbFailureMultipleResults
+	case gen.UNKNOWNFAILURE:
+		return ingest.UnknownFailure
+	case gen.DUPLICATESOURCE:
+		return ingest.DuplicateSource
 	}
 
 	panic("unreachable")
 }
 
+func titleRuleToDto(rule *ingest.TitleRule) gen.IngestTitleRule {
+	return gen.IngestTitleRule{
+		Id:        rule.ID,
+		CreatedAt: rule.CreatedAt,
+		UpdatedAt: rule.UpdatedAt,
+		Title:     rule.Title,
+		Episodic:  rule.Episodic,
+		TmdbId:    rule.TmdbID,
+	}
+}
+
 func IngestStateModelToDto(modelType ingest.IngestItemState) gen.IngestState {
 	//exhaustive:enforce
 	switch modelType {
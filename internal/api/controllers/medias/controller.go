@@ -5,10 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/completeness"
 	"github.com/hbomb79/Thea/internal/ffmpeg"
 	"github.com/hbomb79/Thea/internal/media"
 	"github.com/hbomb79/Thea/internal/transcode"
@@ -19,12 +22,36 @@ type (
 	Store interface {
 		GetMovie(movieID uuid.UUID) (*media.Movie, error)
 		GetEpisode(episodeID uuid.UUID) (*media.Episode, error)
-		GetInflatedSeries(seriesID uuid.UUID) (*media.InflatedSeries, error)
+		GetInflatedSeries(seriesID uuid.UUID, accessFilter *media.AccessFilter) (*media.InflatedSeries, error)
 		GetTranscodesForMedia(mediaID uuid.UUID) ([]*transcode.Transcode, error)
 		GetAllTargets() []*ffmpeg.Target
-
-		ListMedia(includeTypes []media.MediaListType, titleFilter string, includeGenres []int, orderBy []media.MediaListOrderBy, offset int, limit int) ([]*media.MediaListResult, error)
+		GetFilesForMedia(mediaID uuid.UUID) ([]*media.MediaFile, error)
+		UpdateMediaFileLabel(fileID uuid.UUID, label *string) (*media.MediaFile, error)
+
+		ListMedia(
+			includeTypes []media.MediaListType,
+			titleFilter string,
+			includeGenres []int,
+			includePeople []uuid.UUID,
+			collapseCollections bool,
+			orderBy []media.MediaListOrderBy,
+			accessFilter *media.AccessFilter,
+			offset int,
+			limit int,
+		) ([]*media.MediaListResult, error)
 		ListGenres() ([]*media.Genre, error)
+		ListCollections(accessFilter *media.AccessFilter) ([]*media.CollectionStub, error)
+		GetInflatedCollection(collectionID uuid.UUID, accessFilter *media.AccessFilter) (*media.InflatedCollection, error)
+
+		IsMediaAccessible(mediaID uuid.UUID, accessFilter *media.AccessFilter) (bool, error)
+		IsSeriesAccessible(seriesID uuid.UUID, accessFilter *media.AccessFilter) (bool, error)
+		FilterAccessibleMedia(mediaIDs []uuid.UUID, accessFilter *media.AccessFilter) ([]uuid.UUID, error)
+		FilterAccessibleSeries(seriesIDs []uuid.UUID, accessFilter *media.AccessFilter) ([]uuid.UUID, error)
+
+		GetCreditsForMedia(mediaID uuid.UUID) ([]*media.MediaCredit, error)
+		GetCreditsForSeries(seriesID uuid.UUID) ([]*media.MediaCredit, error)
+		GetPerson(personID uuid.UUID) (*media.Person, error)
+		GetCreditsForPerson(personID uuid.UUID) ([]*media.PersonCredit, error)
 
 		DeleteEpisode(episodeID uuid.UUID) error
 		DeleteSeries(seriesID uuid.UUID) error
@@ -36,16 +63,41 @@ type (
 		ActiveTasksForMedia(mediaID uuid.UUID) []*transcode.TranscodeTask
 	}
 
+	RefreshService interface {
+		RefreshMovie(movieID uuid.UUID) error
+		RefreshSeries(seriesID uuid.UUID) error
+		RefreshSeason(seasonID uuid.UUID) error
+		RefreshEpisode(episodeID uuid.UUID) error
+		RematchMovie(movieID uuid.UUID, tmdbID string) error
+		RematchEpisode(episodeID uuid.UUID, seriesTmdbID string, seasonNumber int, episodeNumber int) error
+	}
+
+	CompletenessService interface {
+		GetSeriesCompleteness(seriesID uuid.UUID, includeSpecials bool) (*completeness.SeriesCompleteness, error)
+		ListSeriesCompleteness(includeSpecials bool) ([]*completeness.SeriesCompleteness, error)
+	}
+
+	AuthProvider interface {
+		GetAuthenticatedUserFromContext(ec echo.Context) (*jwt.AuthenticatedUser, error)
+	}
+
+	// MediaController is responsible for the endpoints which expose media. The media visible
+	// to each user is restricted by their access restrictions (if any), however endpoints
+	// which modify media are NOT restricted as they require elevated permissions.
 	MediaController struct {
-		store            Store
-		transcodeService TranscodeService
+		store               Store
+		transcodeService    TranscodeService
+		refreshService      RefreshService
+		completenessService CompletenessService
+		authProvider        AuthProvider
 	}
 )
 
 var (
 	mediaListTypeMapping = map[string]media.MediaListType{
-		"movie":  media.MovieType,
-		"series": media.SeriesType,
+		"movie":      media.MovieType,
+		"series":     media.SeriesType,
+		"collection": media.CollectionType,
 	}
 
 	mediaListOrderColumnMapping = map[string]media.MediaListOrderColumn{
@@ -56,13 +108,13 @@ var (
 	}
 )
 
-func New(transcodeService TranscodeService, store Store) *MediaController {
-	return &MediaController{store: store, transcodeService: transcodeService}
+func New(transcodeService TranscodeService, refreshService RefreshService, completenessService CompletenessService, store Store, authProvider AuthProvider) *MediaController {
+	return &MediaController{store: store, transcodeService: transcodeService, refreshService: refreshService, completenessService: completenessService, authProvider: authProvider}
 }
 
-// ListMedia is an endpoint used to retrieve a list of movies and series which have been
+// ListMedia is an endpoint used to retrieve a list of movies, series and collections which have been
 // updated recently (this includes episodes being added to a series). The caller of this endpoint
-// can specify filtering options such as the type (movie|series), a limit to the number
+// can specify filtering options such as the type (movie|series|collection), a limit to the number
 // of results, or the genres which apply to the content.
 func (controller *MediaController) ListMedia(ec echo.Context, request gen.ListMediaRequestObject) (gen.ListMediaResponseObject, error) {
 	allowedTypesRaw := []string{}
@@ -94,6 +146,11 @@ func (controller *MediaController) ListMedia(ec echo.Context, request gen.ListMe
 		allowedGenres[k] = vv
 	}
 
+	allowedPeople := []uuid.UUID{}
+	if request.Params.Person != nil {
+		allowedPeople = *request.Params.Person
+	}
+
 	orderByRaw := []string{}
 	if request.Params.OrderBy != nil {
 		orderByRaw = *request.Params.OrderBy
@@ -135,7 +192,14 @@ func (controller *MediaController) ListMedia(ec echo.Context, request gen.ListMe
 		titleFilter = *request.Params.TitleFilter
 	}
 
-	results, err := controller.store.ListMedia(allowedTypes, titleFilter, allowedGenres, orderBy, offset, limit)
+	collapseCollections := request.Params.CollapseCollections != nil && *request.Params.CollapseCollections
+
+	accessFilter, err := controller.accessFilter(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := controller.store.ListMedia(allowedTypes, titleFilter, allowedGenres, allowedPeople, collapseCollections, orderBy, accessFilter, offset, limit)
 	if err != nil {
 		return nil, echo.NewHTTPError(http.StatusBadRequest, err)
 	}
@@ -159,23 +223,43 @@ func (controller *MediaController) ListGenres(ec echo.Context, _ gen.ListGenresR
 
 func (controller *MediaController) GetMovie(ec echo.Context, request gen.GetMovieRequestObject) (gen.GetMovieResponseObject, error) {
 	wrap := wrapErrorGenerator("failed to fetch movie")
+	accessFilter, err := controller.requireMediaAccess(ec, request.Id)
+	if err != nil {
+		return nil, err
+	}
+
 	movie, err := controller.store.GetMovie(request.Id)
 	if err != nil {
 		return nil, wrap(err)
 	}
 
-	watchTargets, err := controller.getMediaWatchTargets(request.Id)
+	files, err := controller.store.GetFilesForMedia(request.Id)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	files = slices.DeleteFunc(files, func(f *media.MediaFile) bool { return !accessFilter.AllowsPath(f.SourcePath) })
+
+	watchTargets, err := controller.getMediaWatchTargets(request.Id, files)
 	if err != nil {
 		return nil, wrap(err)
 	}
 
 	dto := gen.Movie{
-		Id:           movie.ID,
-		TmdbId:       movie.TmdbID,
-		Title:        movie.Title,
-		CreatedAt:    movie.CreatedAt,
-		UpdatedAt:    movie.UpdatedAt,
-		WatchTargets: watchTargets,
+		Id:              movie.ID,
+		TmdbId:          movie.TmdbID,
+		Title:           movie.Title,
+		CreatedAt:       movie.CreatedAt,
+		UpdatedAt:       movie.UpdatedAt,
+		Metadata:        metadataToDto(&movie.Metadata),
+		Adult:           movie.Adult,
+		ContentRating:   movie.ContentRating,
+		Runtime:         movie.Runtime,
+		ReleaseDate:     dateToDto(movie.ReleaseDate),
+		PosterImageId:   movie.PosterImage,
+		BackdropImageId: movie.BackdropImage,
+		CollectionId:    movie.CollectionID,
+		Files:           mediaFilesToDtos(files),
+		WatchTargets:    watchTargets,
 	}
 
 	return gen.GetMovie200JSONResponse(dto), nil
@@ -183,30 +267,53 @@ func (controller *MediaController) GetMovie(ec echo.Context, request gen.GetMovi
 
 func (controller *MediaController) GetEpisode(ec echo.Context, request gen.GetEpisodeRequestObject) (gen.GetEpisodeResponseObject, error) {
 	wrap := wrapErrorGenerator("failed to fetch episode")
+	accessFilter, err := controller.requireMediaAccess(ec, request.Id)
+	if err != nil {
+		return nil, err
+	}
+
 	episode, err := controller.store.GetEpisode(request.Id)
 	if err != nil {
 		return nil, wrap(err)
 	}
 
-	watchTargets, err := controller.getMediaWatchTargets(request.Id)
+	files, err := controller.store.GetFilesForMedia(request.Id)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	files = slices.DeleteFunc(files, func(f *media.MediaFile) bool { return !accessFilter.AllowsPath(f.SourcePath) })
+
+	watchTargets, err := controller.getMediaWatchTargets(request.Id, files)
 	if err != nil {
 		return nil, wrap(err)
 	}
 
 	dto := gen.Episode{
-		Id:           episode.ID,
-		TmdbId:       episode.TmdbID,
-		Title:        episode.Title,
-		CreatedAt:    episode.CreatedAt,
-		UpdatedAt:    episode.UpdatedAt,
-		WatchTargets: watchTargets,
+		Id:            episode.ID,
+		TmdbId:        episode.TmdbID,
+		Title:         episode.Title,
+		CreatedAt:     episode.CreatedAt,
+		UpdatedAt:     episode.UpdatedAt,
+		Metadata:      metadataToDto(&episode.Metadata),
+		Adult:         episode.Adult,
+		ContentRating: episode.ContentRating,
+		Runtime:       episode.Runtime,
+		AirDate:       dateToDto(episode.ReleaseDate),
+		StillImageId:  episode.BackdropImage,
+		Files:         mediaFilesToDtos(files),
+		WatchTargets:  watchTargets,
 	}
 
 	return gen.GetEpisode200JSONResponse(dto), nil
 }
 
 func (controller *MediaController) GetSeries(ec echo.Context, request gen.GetSeriesRequestObject) (gen.GetSeriesResponseObject, error) {
-	series, err := controller.store.GetInflatedSeries(request.Id)
+	accessFilter, err := controller.accessFilter(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := controller.store.GetInflatedSeries(request.Id, accessFilter)
 	if err != nil {
 		return nil, wrapErrorGenerator("Failed to get series")(err)
 	}
@@ -214,6 +321,208 @@ func (controller *MediaController) GetSeries(ec echo.Context, request gen.GetSer
 	return gen.GetSeries200JSONResponse(inflatedSeriesToDto(series)), nil
 }
 
+func (controller *MediaController) RefreshMovie(ec echo.Context, request gen.RefreshMovieRequestObject) (gen.RefreshMovieResponseObject, error) {
+	if err := controller.refreshService.RefreshMovie(request.Id); err != nil {
+		return nil, wrapErrorGenerator("failed to refresh movie")(err)
+	}
+
+	return gen.RefreshMovie200Response{}, nil
+}
+
+func (controller *MediaController) RematchMovie(ec echo.Context, request gen.RematchMovieRequestObject) (gen.RematchMovieResponseObject, error) {
+	if err := controller.refreshService.RematchMovie(request.Id, request.Body.TmdbId); err != nil {
+		if errors.Is(err, media.ErrTmdbIDConflict) {
+			return gen.RematchMovie409Response{}, nil
+		}
+
+		return nil, wrapErrorGenerator("failed to re-match movie")(err)
+	}
+
+	return gen.RematchMovie200Response{}, nil
+}
+
+func (controller *MediaController) RefreshSeries(ec echo.Context, request gen.RefreshSeriesRequestObject) (gen.RefreshSeriesResponseObject, error) {
+	if err := controller.refreshService.RefreshSeries(request.Id); err != nil {
+		return nil, wrapErrorGenerator("failed to refresh series")(err)
+	}
+
+	return gen.RefreshSeries200Response{}, nil
+}
+
+func (controller *MediaController) RefreshSeason(ec echo.Context, request gen.RefreshSeasonRequestObject) (gen.RefreshSeasonResponseObject, error) {
+	if err := controller.refreshService.RefreshSeason(request.Id); err != nil {
+		return nil, wrapErrorGenerator("failed to refresh season")(err)
+	}
+
+	return gen.RefreshSeason200Response{}, nil
+}
+
+func (controller *MediaController) RefreshEpisode(ec echo.Context, request gen.RefreshEpisodeRequestObject) (gen.RefreshEpisodeResponseObject, error) {
+	if err := controller.refreshService.RefreshEpisode(request.Id); err != nil {
+		return nil, wrapErrorGenerator("failed to refresh episode")(err)
+	}
+
+	return gen.RefreshEpisode200Response{}, nil
+}
+
+func (controller *MediaController) RematchEpisode(ec echo.Context, request gen.RematchEpisodeRequestObject) (gen.RematchEpisodeResponseObject, error) {
+	body := request.Body
+	if err := controller.refreshService.RematchEpisode(request.Id, body.SeriesTmdbId, body.SeasonNumber, body.EpisodeNumber); err != nil {
+		if errors.Is(err, media.ErrTmdbIDConflict) {
+			return gen.RematchEpisode409Response{}, nil
+		}
+
+		return nil, wrapErrorGenerator("failed to re-match episode")(err)
+	}
+
+	return gen.RematchEpisode200Response{}, nil
+}
+
+func (controller *MediaController) ListCollections(ec echo.Context, _ gen.ListCollectionsRequestObject) (gen.ListCollectionsResponseObject, error) {
+	accessFilter, err := controller.accessFilter(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := controller.store.ListCollections(accessFilter)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.ListCollections200JSONResponse(collectionStubsToDtos(collections)), nil
+}
+
+func (controller *MediaController) GetCollection(ec echo.Context, request gen.GetCollectionRequestObject) (gen.GetCollectionResponseObject, error) {
+	accessFilter, err := controller.accessFilter(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, err := controller.store.GetInflatedCollection(request.Id, accessFilter)
+	if err != nil {
+		return nil, wrapErrorGenerator("failed to fetch collection")(err)
+	}
+
+	return gen.GetCollection200JSONResponse(inflatedCollectionToDto(collection)), nil
+}
+
+func (controller *MediaController) GetMovieCredits(ec echo.Context, request gen.GetMovieCreditsRequestObject) (gen.GetMovieCreditsResponseObject, error) {
+	wrap := wrapErrorGenerator("failed to fetch movie credits")
+	if _, err := controller.requireMediaAccess(ec, request.Id); err != nil {
+		return nil, err
+	}
+
+	// Credits of unknown media are empty, so the movie must be checked to exist
+	if _, err := controller.store.GetMovie(request.Id); err != nil {
+		return nil, wrap(err)
+	}
+
+	credits, err := controller.store.GetCreditsForMedia(request.Id)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return gen.GetMovieCredits200JSONResponse(mediaCreditsToDtos(credits)), nil
+}
+
+func (controller *MediaController) GetEpisodeCredits(ec echo.Context, request gen.GetEpisodeCreditsRequestObject) (gen.GetEpisodeCreditsResponseObject, error) {
+	wrap := wrapErrorGenerator("failed to fetch episode credits")
+	if _, err := controller.requireMediaAccess(ec, request.Id); err != nil {
+		return nil, err
+	}
+
+	// Credits of unknown media are empty, so the episode must be checked to exist
+	if _, err := controller.store.GetEpisode(request.Id); err != nil {
+		return nil, wrap(err)
+	}
+
+	credits, err := controller.store.GetCreditsForMedia(request.Id)
+	if err != nil {
+		return nil, wrap(err)
+	}
+
+	return gen.GetEpisodeCredits200JSONResponse(mediaCreditsToDtos(credits)), nil
+}
+
+func (controller *MediaController) GetSeriesCredits(ec echo.Context, request gen.GetSeriesCreditsRequestObject) (gen.GetSeriesCreditsResponseObject, error) {
+	if err := controller.requireSeriesAccess(ec, request.Id); err != nil {
+		return nil, err
+	}
+
+	credits, err := controller.store.GetCreditsForSeries(request.Id)
+	if err != nil {
+		return nil, wrapErrorGenerator("failed to fetch series credits")(err)
+	}
+
+	return gen.GetSeriesCredits200JSONResponse(mediaCreditsToDtos(credits)), nil
+}
+
+func (controller *MediaController) GetSeriesCompleteness(ec echo.Context, request gen.GetSeriesCompletenessRequestObject) (gen.GetSeriesCompletenessResponseObject, error) {
+	if err := controller.requireSeriesAccess(ec, request.Id); err != nil {
+		return nil, err
+	}
+
+	includeSpecials := request.Params.IncludeSpecials != nil && *request.Params.IncludeSpecials
+	report, err := controller.completenessService.GetSeriesCompleteness(request.Id, includeSpecials)
+	if err != nil {
+		return nil, wrapErrorGenerator("failed to determine series completeness")(err)
+	}
+
+	return gen.GetSeriesCompleteness200JSONResponse(seriesCompletenessToDto(report)), nil
+}
+
+func (controller *MediaController) ListSeriesCompleteness(ec echo.Context, request gen.ListSeriesCompletenessRequestObject) (gen.ListSeriesCompletenessResponseObject, error) {
+	includeSpecials := request.Params.IncludeSpecials != nil && *request.Params.IncludeSpecials
+	reports, err := controller.completenessService.ListSeriesCompleteness(includeSpecials)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	accessFilter, err := controller.accessFilter(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	if accessFilter != nil {
+		seriesIDs := make([]uuid.UUID, len(reports))
+		for k, v := range reports {
+			seriesIDs[k] = v.SeriesID
+		}
+
+		accessible, err := controller.store.FilterAccessibleSeries(seriesIDs, accessFilter)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		reports = slices.DeleteFunc(reports, func(r *completeness.SeriesCompleteness) bool { return !slices.Contains(accessible, r.SeriesID) })
+	}
+
+	return gen.ListSeriesCompleteness200JSONResponse(seriesCompletenessToDtos(reports)), nil
+}
+
+func (controller *MediaController) GetPerson(ec echo.Context, request gen.GetPersonRequestObject) (gen.GetPersonResponseObject, error) {
+	person, err := controller.store.GetPerson(request.Id)
+	if err != nil {
+		return nil, wrapErrorGenerator("failed to fetch person")(err)
+	}
+
+	return gen.GetPerson200JSONResponse(personToDto(person)), nil
+}
+
+func (controller *MediaController) GetPersonCredits(ec echo.Context, request gen.GetPersonCreditsRequestObject) (gen.GetPersonCreditsResponseObject, error) {
+	credits, err := controller.store.GetCreditsForPerson(request.Id)
+	if err != nil {
+		return nil, wrapErrorGenerator("failed to fetch person credits")(err)
+	}
+
+	credits, err = controller.filterAccessibleCredits(ec, credits)
+	if err != nil {
+		return nil, err
+	}
+
+	return gen.GetPersonCredits200JSONResponse(personCreditsToDtos(credits)), nil
+}
+
 func (controller *MediaController) DeleteMovie(ec echo.Context, request gen.DeleteMovieRequestObject) (gen.DeleteMovieResponseObject, error) {
 	if err := controller.store.DeleteMovie(request.Id); err != nil {
 		return nil, echo.NewHTTPError(http.StatusBadRequest, err)
@@ -246,7 +555,102 @@ func (controller *MediaController) DeleteEpisode(ec echo.Context, request gen.De
 	return gen.DeleteEpisode201Response{}, nil
 }
 
-func (controller *MediaController) getMediaWatchTargets(mediaID uuid.UUID) ([]gen.MediaWatchTarget, error) {
+func (controller *MediaController) UpdateMediaFile(ec echo.Context, request gen.UpdateMediaFileRequestObject) (gen.UpdateMediaFileResponseObject, error) {
+	var label *string
+	if request.Body.Label != nil && *request.Body.Label != "" {
+		label = request.Body.Label
+	}
+
+	file, err := controller.store.UpdateMediaFileLabel(request.Id, label)
+	if err != nil {
+		return nil, wrapErrorGenerator("failed to update media file")(err)
+	}
+
+	return gen.UpdateMediaFile200JSONResponse(mediaFileToDto(file)), nil
+}
+
+// accessFilter returns the media access filter for the authenticated user, or nil if
+// the user is unrestricted (in which case all media is accessible).
+func (controller *MediaController) accessFilter(ec echo.Context) (*media.AccessFilter, error) {
+	user, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	return user.MediaAccessFilter(), nil
+}
+
+// requireMediaAccess returns the media access filter for the authenticated user, after ensuring
+// that the movie/episode provided is accessible to them. If it isn't, a 404 error is returned
+// so as to not disclose the existence of the media.
+func (controller *MediaController) requireMediaAccess(ec echo.Context, mediaID uuid.UUID) (*media.AccessFilter, error) {
+	accessFilter, err := controller.accessFilter(ec)
+	if err != nil || accessFilter == nil {
+		return accessFilter, err
+	}
+
+	if accessible, err := controller.store.IsMediaAccessible(mediaID, accessFilter); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	} else if !accessible {
+		return nil, echo.ErrNotFound
+	}
+
+	return accessFilter, nil
+}
+
+// requireSeriesAccess ensures that the series provided is accessible to the authenticated
+// user, returning a 404 error if it isn't (see requireMediaAccess).
+func (controller *MediaController) requireSeriesAccess(ec echo.Context, seriesID uuid.UUID) error {
+	accessFilter, err := controller.accessFilter(ec)
+	if err != nil || accessFilter == nil {
+		return err
+	}
+
+	if accessible, err := controller.store.IsSeriesAccessible(seriesID, accessFilter); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	} else if !accessible {
+		return echo.ErrNotFound
+	}
+
+	return nil
+}
+
+// filterAccessibleCredits returns the credits provided which belong to a movie, episode or
+// series which is accessible to the authenticated user.
+func (controller *MediaController) filterAccessibleCredits(ec echo.Context, credits []*media.PersonCredit) ([]*media.PersonCredit, error) {
+	accessFilter, err := controller.accessFilter(ec)
+	if err != nil || accessFilter == nil {
+		return credits, err
+	}
+
+	var mediaIDs, seriesIDs []uuid.UUID
+	for _, v := range credits {
+		if v.MediaType == "series" {
+			seriesIDs = append(seriesIDs, v.MediaID)
+		} else {
+			mediaIDs = append(mediaIDs, v.MediaID)
+		}
+	}
+
+	accessibleMedia, err := controller.store.FilterAccessibleMedia(mediaIDs, accessFilter)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	accessibleSeries, err := controller.store.FilterAccessibleSeries(seriesIDs, accessFilter)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return slices.DeleteFunc(credits, func(c *media.PersonCredit) bool {
+		return !slices.Contains(accessibleMedia, c.MediaID) && !slices.Contains(accessibleSeries, c.MediaID)
+	}), nil
+}
+
+// getMediaWatchTargets returns the watch targets for each of the files of the media provided. If
+// the media has several files, the display name of each watch target is prefixed with
+// the label of the file, e.g. "4K HEVC (Direct)" and "1080p H264 (Direct)".
+func (controller *MediaController) getMediaWatchTargets(mediaID uuid.UUID, files []*media.MediaFile) ([]gen.MediaWatchTarget, error) {
 	targets := controller.store.GetAllTargets()
 	findTarget := func(tid uuid.UUID) *ffmpeg.Target {
 		for _, v := range targets {
@@ -264,33 +668,53 @@ func (controller *MediaController) getMediaWatchTargets(mediaID uuid.UUID) ([]ge
 		return nil, err
 	}
 
-	// 1. Add completed transcodes as valid pre-transcoded targets
-	targetsNotEligibleForLiveTranscode := make(map[uuid.UUID]struct{}, len(activeTranscodes))
-	watchTargets := make([]gen.MediaWatchTarget, 0, len(completedTranscodes))
-	for k, v := range completedTranscodes {
-		targetsNotEligibleForLiveTranscode[v.TargetID] = struct{}{}
-		watchTargets[k] = newWatchTarget(findTarget(v.TargetID), gen.PRETRANSCODE, true)
-	}
+	watchTargets := make([]gen.MediaWatchTarget, 0)
+	for _, file := range files {
+		fileTargets := make([]gen.MediaWatchTarget, 0)
 
-	// 2. Add in-progress transcodes (as not ready to watch)
-	for _, v := range activeTranscodes {
-		targetsNotEligibleForLiveTranscode[v.Target().ID] = struct{}{}
-		watchTargets = append(watchTargets, newWatchTarget(v.Target(), gen.PRETRANSCODE, false))
-	}
+		// 1. Add completed transcodes as valid pre-transcoded targets
+		targetsNotEligibleForLiveTranscode := make(map[uuid.UUID]struct{})
+		for _, v := range completedTranscodes {
+			if v.MediaFileID != file.ID {
+				continue
+			}
 
-	// 3. Any targets which do NOT have a complete or in-progress pre-transcode are eligible for live transcoding/streaming
-	for _, v := range targets {
-		// TODO: check if the specified target allows for live transcoding
-		if _, ok := targetsNotEligibleForLiveTranscode[v.ID]; ok {
-			continue
+			targetsNotEligibleForLiveTranscode[v.TargetID] = struct{}{}
+			fileTargets = append(fileTargets, newWatchTarget(findTarget(v.TargetID), file, gen.PRETRANSCODE, true))
 		}
 
-		watchTargets = append(watchTargets, newWatchTarget(v, gen.LIVETRANSCODE, true))
-	}
+		// 2. Add in-progress transcodes (as not ready to watch)
+		for _, v := range activeTranscodes {
+			if v.Media().File.ID != file.ID {
+				continue
+			}
 
-	// 4. We can directly stream the source media itself, so add that too
-	// TODO: at some point we may want this to be configurable
-	watchTargets = append(watchTargets, gen.MediaWatchTarget{DisplayName: "Direct", Ready: true, Type: gen.LIVETRANSCODE, TargetId: nil, Enabled: true})
+			targetsNotEligibleForLiveTranscode[v.Target().ID] = struct{}{}
+			fileTargets = append(fileTargets, newWatchTarget(v.Target(), file, gen.PRETRANSCODE, false))
+		}
+
+		// 3. Any targets which do NOT have a complete or in-progress pre-transcode are eligible for live transcoding/streaming
+		for _, v := range targets {
+			// TODO: check if the specified target allows for live transcoding
+			if _, ok := targetsNotEligibleForLiveTranscode[v.ID]; ok {
+				continue
+			}
+
+			fileTargets = append(fileTargets, newWatchTarget(v, file, gen.LIVETRANSCODE, true))
+		}
+
+		// 4. We can directly stream the source media itself, so add that too
+		// TODO: at some point we may want this to be configurable
+		fileTargets = append(fileTargets, gen.MediaWatchTarget{DisplayName: "Direct", Ready: true, Type: gen.LIVETRANSCODE, TargetId: nil, MediaFileId: &file.ID, Enabled: true})
+
+		if len(files) > 1 {
+			for k, v := range fileTargets {
+				fileTargets[k].DisplayName = fmt.Sprintf("%s (%s)", file.DisplayLabel(), v.DisplayName)
+			}
+		}
+
+		watchTargets = append(watchTargets, fileTargets...)
+	}
 
 	return watchTargets, nil
 }
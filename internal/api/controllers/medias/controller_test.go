@@ -0,0 +1,99 @@
+package medias
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeStore contains a single movie and a single episode, neither of which have credits.
+type fakeStore struct {
+	Store
+	movieID   uuid.UUID
+	episodeID uuid.UUID
+}
+
+func (store *fakeStore) GetMovie(movieID uuid.UUID) (*media.Movie, error) {
+	if movieID != store.movieID {
+		return nil, fmt.Errorf("query for media failed: %w", sql.ErrNoRows)
+	}
+
+	return &media.Movie{Model: media.Model{ID: movieID}}, nil
+}
+
+func (store *fakeStore) GetEpisode(episodeID uuid.UUID) (*media.Episode, error) {
+	if episodeID != store.episodeID {
+		return nil, fmt.Errorf("query for media failed: %w", sql.ErrNoRows)
+	}
+
+	return &media.Episode{Model: media.Model{ID: episodeID}}, nil
+}
+
+func (store *fakeStore) GetCreditsForMedia(_ uuid.UUID) ([]*media.MediaCredit, error) {
+	return []*media.MediaCredit{}, nil
+}
+
+// fakeAuthProvider authenticates all requests as an unrestricted user.
+type fakeAuthProvider struct{}
+
+func (fakeAuthProvider) GetAuthenticatedUserFromContext(_ echo.Context) (*jwt.AuthenticatedUser, error) {
+	return &jwt.AuthenticatedUser{UserID: uuid.New()}, nil
+}
+
+func httpStatus(err error) int {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+
+	return 0
+}
+
+func TestGetCredits_UnknownMedia(t *testing.T) {
+	store := &fakeStore{movieID: uuid.New(), episodeID: uuid.New()}
+	controller := New(nil, nil, nil, store, fakeAuthProvider{})
+	newContext := func() echo.Context {
+		return echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	}
+	movieCredits := func(id uuid.UUID) error {
+		_, err := controller.GetMovieCredits(newContext(), gen.GetMovieCreditsRequestObject{Id: id})
+		return err
+	}
+	episodeCredits := func(id uuid.UUID) error {
+		_, err := controller.GetEpisodeCredits(newContext(), gen.GetEpisodeCreditsRequestObject{Id: id})
+		return err
+	}
+
+	tests := []struct {
+		summary        string
+		call           func(id uuid.UUID) error
+		id             uuid.UUID
+		expectedStatus int
+	}{
+		{summary: "movie credits", call: movieCredits, id: store.movieID},
+		{summary: "unknown movie credits", call: movieCredits, id: uuid.New(), expectedStatus: http.StatusNotFound},
+		{summary: "movie credits of episode", call: movieCredits, id: store.episodeID, expectedStatus: http.StatusNotFound},
+		{summary: "episode credits", call: episodeCredits, id: store.episodeID},
+		{summary: "unknown episode credits", call: episodeCredits, id: uuid.New(), expectedStatus: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.summary, func(t *testing.T) {
+			err := test.call(test.id)
+			if test.expectedStatus == 0 && err != nil {
+				t.Errorf("expected credits to be returned, got %v", err)
+			} else if test.expectedStatus != 0 && httpStatus(err) != test.expectedStatus {
+				t.Errorf("expected status %d, got %v", test.expectedStatus, err)
+			}
+		})
+	}
+}
@@ -3,16 +3,39 @@ package medias
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/hbomb79/Thea/internal/api/gen"
 	"github.com/hbomb79/Thea/internal/api/util"
+	"github.com/hbomb79/Thea/internal/completeness"
 	"github.com/hbomb79/Thea/internal/ffmpeg"
 	"github.com/hbomb79/Thea/internal/media"
 	"github.com/labstack/echo/v4"
+	openapi_types "github.com/oapi-codegen/runtime/types"
 )
 
-func newWatchTarget(target *ffmpeg.Target, t gen.MediaWatchTargetType, ready bool) gen.MediaWatchTarget {
-	return gen.MediaWatchTarget{DisplayName: target.Label, Ready: ready, Type: t, TargetId: &target.ID, Enabled: true}
+func newWatchTarget(target *ffmpeg.Target, file *media.MediaFile, t gen.MediaWatchTargetType, ready bool) gen.MediaWatchTarget {
+	return gen.MediaWatchTarget{DisplayName: target.Label, Ready: ready, Type: t, TargetId: &target.ID, MediaFileId: &file.ID, Enabled: true}
+}
+
+func mediaFileToDto(file *media.MediaFile) gen.MediaFile {
+	return gen.MediaFile{
+		Id:           file.ID,
+		Label:        file.Label,
+		DisplayLabel: file.DisplayLabel(),
+		CreatedAt:    file.CreatedAt,
+		Width:        file.Width,
+		Height:       file.Height,
+		VideoCodec:   file.VideoCodec,
+		Bitrate:      file.Bitrate,
+		Size:         file.Size,
+		ContentHash:  file.ContentHash,
+	}
+}
+
+func mediaFilesToDtos(files []*media.MediaFile) *[]gen.MediaFile {
+	dtos := util.ApplyConversion(files, mediaFileToDto)
+	return &dtos
 }
 
 func episodeToStubDto(episode *media.Episode) gen.EpisodeStub {
@@ -24,7 +47,12 @@ func episodesToStubDtos(episodes []*media.Episode) []gen.EpisodeStub {
 }
 
 func inflatedSeasonToDto(season *media.InflatedSeason) gen.Season {
-	return gen.Season{Episodes: episodesToStubDtos(season.Episodes)}
+	return gen.Season{
+		Overview:      season.Overview,
+		AirDate:       dateToDto(season.AirDate),
+		PosterImageId: season.PosterImage,
+		Episodes:      episodesToStubDtos(season.Episodes),
+	}
 }
 
 func infaltedSeasonsToDtos(seasons []*media.InflatedSeason) []gen.Season {
@@ -33,13 +61,77 @@ func infaltedSeasonsToDtos(seasons []*media.InflatedSeason) []gen.Season {
 
 func inflatedSeriesToDto(series *media.InflatedSeries) gen.Series {
 	return gen.Series{
-		Id:      series.ID,
-		Seasons: infaltedSeasonsToDtos(series.Seasons),
-		Title:   series.Title,
-		TmdbId:  series.TmdbID,
+		Id:              series.ID,
+		Seasons:         infaltedSeasonsToDtos(series.Seasons),
+		Title:           series.Title,
+		TmdbId:          series.TmdbID,
+		Metadata:        metadataToDto(&series.Metadata),
+		FirstAirDate:    dateToDto(series.FirstAirDate),
+		LastAirDate:     dateToDto(series.LastAirDate),
+		PosterImageId:   series.PosterImage,
+		BackdropImageId: series.BackdropImage,
 	}
 }
 
+func inflatedCollectionToDto(collection *media.InflatedCollection) gen.Collection {
+	return gen.Collection{
+		Id:              collection.ID,
+		TmdbId:          collection.TmdbID,
+		Title:           collection.Title,
+		CreatedAt:       collection.CreatedAt,
+		UpdatedAt:       collection.UpdatedAt,
+		PosterImageId:   collection.PosterImage,
+		BackdropImageId: collection.BackdropImage,
+		Movies:          util.ApplyConversion(collection.Movies, movieToStubDto),
+	}
+}
+
+func collectionStubToDto(collection *media.CollectionStub) gen.CollectionStub {
+	return gen.CollectionStub{
+		Id:              collection.ID,
+		TmdbId:          collection.TmdbID,
+		Title:           collection.Title,
+		PosterImageId:   collection.PosterImage,
+		BackdropImageId: collection.BackdropImage,
+		MovieCount:      collection.MovieCount,
+	}
+}
+
+func collectionStubsToDtos(collections []*media.CollectionStub) []gen.CollectionStub {
+	return util.ApplyConversion(collections, collectionStubToDto)
+}
+
+func movieToStubDto(movie *media.Movie) gen.MovieStub {
+	return gen.MovieStub{
+		Id:            movie.ID,
+		TmdbId:        movie.TmdbID,
+		Title:         movie.Title,
+		Runtime:       movie.Runtime,
+		ReleaseDate:   dateToDto(movie.ReleaseDate),
+		PosterImageId: movie.PosterImage,
+	}
+}
+
+func metadataToDto(metadata *media.Metadata) gen.MediaMetadata {
+	return gen.MediaMetadata{
+		Overview:         metadata.Overview,
+		Tagline:          metadata.Tagline,
+		OriginalTitle:    metadata.OriginalTitle,
+		OriginalLanguage: metadata.OriginalLanguage,
+		Status:           metadata.Status,
+		VoteAverage:      metadata.VoteAverage,
+		VoteCount:        metadata.VoteCount,
+	}
+}
+
+func dateToDto(date *time.Time) *openapi_types.Date {
+	if date == nil {
+		return nil
+	}
+
+	return &openapi_types.Date{Time: *date}
+}
+
 func newListDtos(results []*media.MediaListResult) ([]gen.MediaListItem, error) {
 	dtos := make([]gen.MediaListItem, len(results))
 	for k, v := range results {
@@ -57,28 +149,110 @@ func newListDto(result *media.MediaListResult) (*gen.MediaListItem, error) {
 	if result.IsMovie() {
 		movie := result.Movie
 		return &gen.MediaListItem{
-			Type:        gen.MOVIE,
-			Id:          movie.ID,
-			Title:       movie.Title,
-			TmdbId:      movie.TmdbID,
-			UpdatedAt:   movie.UpdatedAt,
-			SeasonCount: nil,
-			Genres:      genreModelsToDtos(movie.Genres),
+			Type:          gen.MediaListItemTypeMOVIE,
+			Id:            movie.ID,
+			Title:         movie.Title,
+			TmdbId:        movie.TmdbID,
+			UpdatedAt:     movie.UpdatedAt,
+			SeasonCount:   nil,
+			PosterImageId: movie.PosterImage,
+			Genres:        genreModelsToDtos(movie.Genres),
 		}, nil
 	} else if result.IsSeries() {
 		series := result.Series
 		return &gen.MediaListItem{
-			Type:        gen.SERIES,
-			Id:          series.ID,
-			Title:       series.Title,
-			TmdbId:      series.TmdbID,
-			UpdatedAt:   series.UpdatedAt,
-			SeasonCount: &series.SeasonCount,
-			Genres:      genreModelsToDtos(series.Genres),
+			Type:          gen.MediaListItemTypeSERIES,
+			Id:            series.ID,
+			Title:         series.Title,
+			TmdbId:        series.TmdbID,
+			UpdatedAt:     series.UpdatedAt,
+			SeasonCount:   &series.SeasonCount,
+			PosterImageId: series.PosterImage,
+			Genres:        genreModelsToDtos(series.Genres),
+		}, nil
+	} else if result.IsCollection() {
+		collection := result.Collection
+		return &gen.MediaListItem{
+			Type:          gen.MediaListItemTypeCOLLECTION,
+			Id:            collection.ID,
+			Title:         collection.Title,
+			TmdbId:        collection.TmdbID,
+			UpdatedAt:     collection.UpdatedAt,
+			MovieCount:    &collection.MovieCount,
+			PosterImageId: collection.PosterImage,
+			Genres:        genreModelsToDtos(collection.Genres),
 		}, nil
 	}
 
-	return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Media %v found during listing has an illegal type. Expected movie or series.", result))
+	return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Media %v found during listing has an illegal type. Expected movie, series or collection.", result))
+}
+
+func mediaCreditToDto(credit *media.MediaCredit) gen.MediaCredit {
+	return gen.MediaCredit{
+		Id:         credit.ID,
+		Role:       creditRoleToDto(credit.Role),
+		Character:  credit.Character,
+		Job:        credit.Job,
+		Department: credit.Department,
+		Order:      credit.Order,
+		Person:     personToDto(&credit.Person),
+	}
+}
+
+func mediaCreditsToDtos(credits []*media.MediaCredit) []gen.MediaCredit {
+	return util.ApplyConversion(credits, mediaCreditToDto)
+}
+
+func personCreditToDto(credit *media.PersonCredit) gen.PersonCredit {
+	return gen.PersonCredit{
+		Id:         credit.ID,
+		Role:       creditRoleToDto(credit.Role),
+		Character:  credit.Character,
+		Job:        credit.Job,
+		Department: credit.Department,
+		Order:      credit.Order,
+		MediaType:  personCreditMediaTypeToDto(credit.MediaType),
+		MediaId:    credit.MediaID,
+		MediaTitle: credit.MediaTitle,
+	}
+}
+
+func personCreditsToDtos(credits []*media.PersonCredit) []gen.PersonCredit {
+	return util.ApplyConversion(credits, personCreditToDto)
+}
+
+func personToDto(person *media.Person) gen.Person {
+	return gen.Person{
+		Id:                 person.ID,
+		TmdbId:             person.TmdbID,
+		Name:               person.Name,
+		KnownForDepartment: person.KnownForDepartment,
+	}
+}
+
+func creditRoleToDto(role media.CreditRole) gen.CreditRole {
+	//exhaustive:enforce
+	switch role {
+	case media.CastCreditRole:
+		return gen.CAST
+	case media.CrewCreditRole:
+		return gen.CREW
+	}
+
+	panic("unreachable")
+}
+
+func personCreditMediaTypeToDto(mediaType string) gen.PersonCreditMediaType {
+	switch mediaType {
+	case "movie":
+		return gen.PersonCreditMediaTypeMOVIE
+	case "episode":
+		return gen.PersonCreditMediaTypeEPISODE
+	case "series":
+		return gen.PersonCreditMediaTypeSERIES
+	}
+
+	panic("unreachable")
 }
 
 func genreModelsToDtos(genres []*media.Genre) []gen.MediaGenre {
@@ -89,3 +263,41 @@ func genreModelsToDtos(genres []*media.Genre) []gen.MediaGenre {
 
 	return dtos
 }
+
+func seriesCompletenessToDto(series *completeness.SeriesCompleteness) gen.SeriesCompleteness {
+	return gen.SeriesCompleteness{
+		SeriesId:        series.SeriesID,
+		Title:           series.Title,
+		AiredEpisodes:   series.AiredEpisodes(),
+		PresentEpisodes: series.PresentEpisodes(),
+		Percentage:      series.Percentage(),
+		Seasons:         util.ApplyConversion(series.Seasons, seasonCompletenessToDto),
+		Error:           series.Error,
+	}
+}
+
+func seriesCompletenessToDtos(series []*completeness.SeriesCompleteness) []gen.SeriesCompleteness {
+	return util.ApplyConversion(series, seriesCompletenessToDto)
+}
+
+func seasonCompletenessToDto(season *completeness.SeasonCompleteness) gen.SeasonCompleteness {
+	return gen.SeasonCompleteness{
+		SeasonId:        season.SeasonID,
+		SeasonNumber:    season.SeasonNumber,
+		Title:           season.Title,
+		AiredEpisodes:   season.AiredEpisodes,
+		PresentEpisodes: season.PresentEpisodes,
+		Percentage:      season.Percentage(),
+		Missing:         util.ApplyConversion(season.Missing, missingEpisodeToDto),
+	}
+}
+
+func missingEpisodeToDto(episode *completeness.MissingEpisode) gen.MissingEpisode {
+	return gen.MissingEpisode{
+		TmdbId:        episode.TmdbID,
+		EpisodeNumber: episode.EpisodeNumber,
+		Title:         episode.Title,
+		AirDate:       dateToDto(episode.AirDate),
+		Aired:         episode.Aired,
+	}
+}
@@ -0,0 +1,42 @@
+package reconciliation
+
+import (
+	"net/http"
+
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/reconcile"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	ReconcileService interface {
+		Reconcile() (*reconcile.Report, error)
+		LastReport() *reconcile.Report
+	}
+
+	ReconciliationController struct {
+		reconcileService ReconcileService
+	}
+)
+
+func New(reconcileService ReconcileService) *ReconciliationController {
+	return &ReconciliationController{reconcileService: reconcileService}
+}
+
+func (controller *ReconciliationController) GetReconciliationReport(ec echo.Context, request gen.GetReconciliationReportRequestObject) (gen.GetReconciliationReportResponseObject, error) {
+	report := controller.reconcileService.LastReport()
+	if report == nil {
+		return nil, echo.ErrNotFound
+	}
+
+	return gen.GetReconciliationReport200JSONResponse(reportToDto(report)), nil
+}
+
+func (controller *ReconciliationController) RunReconciliation(ec echo.Context, request gen.RunReconciliationRequestObject) (gen.RunReconciliationResponseObject, error) {
+	report, err := controller.reconcileService.Reconcile()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RunReconciliation200JSONResponse(reportToDto(report)), nil
+}
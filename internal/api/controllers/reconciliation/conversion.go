@@ -0,0 +1,40 @@
+package reconciliation
+
+import (
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/util"
+	"github.com/hbomb79/Thea/internal/reconcile"
+)
+
+func reportToDto(report *reconcile.Report) gen.ReconciliationReport {
+	return gen.ReconciliationReport{
+		StartedAt:         report.StartedAt,
+		CompletedAt:       report.CompletedAt,
+		MissingSources:    util.ApplyConversion(report.MissingSources, missingSourceToDto),
+		MissingTranscodes: util.ApplyConversion(report.MissingTranscodes, missingTranscodeToDto),
+		OrphanedFiles:     util.ApplyConversion(report.OrphanedFiles, orphanedFileToDto),
+	}
+}
+
+func missingSourceToDto(source *reconcile.MissingSource) gen.MissingSource {
+	return gen.MissingSource{
+		MediaFileId: source.MediaFileID,
+		MediaId:     source.MediaID,
+		Path:        source.Path,
+		Candidates:  source.Candidates,
+		RelocatedTo: source.RelocatedTo,
+	}
+}
+
+func missingTranscodeToDto(transcode *reconcile.MissingTranscode) gen.MissingTranscode {
+	return gen.MissingTranscode{
+		TranscodeId: transcode.TranscodeID,
+		MediaId:     transcode.MediaID,
+		Path:        transcode.Path,
+		Removed:     transcode.Removed,
+	}
+}
+
+func orphanedFileToDto(file *reconcile.OrphanedFile) gen.OrphanedFile {
+	return gen.OrphanedFile{Path: file.Path, Size: file.Size, Removed: file.Removed}
+}
@@ -0,0 +1,121 @@
+package roles
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/api/util"
+	"github.com/hbomb79/Thea/internal/user"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	Store interface {
+		ListRoles() ([]*user.Role, error)
+		GetRole(roleID uuid.UUID) (*user.Role, error)
+		CreateRole(label string, permissions []string) (*user.Role, error)
+		UpdateRole(roleID uuid.UUID, newLabel *string, newPermissions *[]string) (*user.Role, error)
+		DeleteRole(roleID uuid.UUID) error
+	}
+
+	AuthProvider interface {
+		GetAuthenticatedUserFromContext(ec echo.Context) (*jwt.AuthenticatedUser, error)
+	}
+
+	RoleController struct {
+		store        Store
+		authProvider AuthProvider
+	}
+)
+
+func New(store Store, authProvider AuthProvider) *RoleController {
+	return &RoleController{store: store, authProvider: authProvider}
+}
+
+func (controller *RoleController) ListRoles(ec echo.Context, _ gen.ListRolesRequestObject) (gen.ListRolesResponseObject, error) {
+	roles, err := controller.store.ListRoles()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.ListRoles200JSONResponse(util.ApplyConversion(roles, roleToDto)), nil
+}
+
+func (controller *RoleController) GetRole(ec echo.Context, request gen.GetRoleRequestObject) (gen.GetRoleResponseObject, error) {
+	role, err := controller.store.GetRole(request.Id)
+	if err != nil {
+		return nil, echo.ErrNotFound
+	}
+
+	return gen.GetRole200JSONResponse(roleToDto(role)), nil
+}
+
+// CreateRole creates a new role with the permissions provided. The role can only
+// contain permissions which the authenticated user has.
+func (controller *RoleController) CreateRole(ec echo.Context, request gen.CreateRoleRequestObject) (gen.CreateRoleResponseObject, error) {
+	if err := controller.requireHeldPermissions(ec, request.Body.Permissions); err != nil {
+		return nil, err
+	}
+
+	role, err := controller.store.CreateRole(request.Body.Label, request.Body.Permissions)
+	if err != nil {
+		return nil, roleErrorToHTTP("create role", err)
+	}
+
+	return gen.CreateRole201JSONResponse(roleToDto(role)), nil
+}
+
+// UpdateRole updates the label and/or permissions of the role. The role can only be
+// given permissions which the authenticated user has.
+func (controller *RoleController) UpdateRole(ec echo.Context, request gen.UpdateRoleRequestObject) (gen.UpdateRoleResponseObject, error) {
+	if request.Body.Permissions != nil {
+		if err := controller.requireHeldPermissions(ec, *request.Body.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	role, err := controller.store.UpdateRole(request.Id, request.Body.Label, request.Body.Permissions)
+	if err != nil {
+		return nil, roleErrorToHTTP("update role", err)
+	}
+
+	return gen.UpdateRole200JSONResponse(roleToDto(role)), nil
+}
+
+func (controller *RoleController) DeleteRole(ec echo.Context, request gen.DeleteRoleRequestObject) (gen.DeleteRoleResponseObject, error) {
+	if err := controller.store.DeleteRole(request.Id); err != nil {
+		return nil, roleErrorToHTTP("delete role", err)
+	}
+
+	return gen.DeleteRole204Response{}, nil
+}
+
+// requireHeldPermissions returns a 403 error if any of the permissions provided are not
+// held by the authenticated user, to prevent users from escalating their own privileges.
+func (controller *RoleController) requireHeldPermissions(ec echo.Context, permissions []string) error {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if perm, missing := util.MissingPermission(authUser.Permissions, permissions); missing {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Cannot grant permission '%s' which the user does not have", perm))
+	}
+
+	return nil
+}
+
+func roleErrorToHTTP(desc string, err error) error {
+	switch {
+	case errors.Is(err, user.ErrRoleNotFound):
+		return echo.ErrNotFound
+	case errors.Is(err, user.ErrRoleLabelTaken):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to %s: %v", desc, err))
+	}
+}
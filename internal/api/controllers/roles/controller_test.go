@@ -0,0 +1,116 @@
+package roles
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/user"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeStore implements the parts of the Store used by the tests of this package. Calls to
+// any other method of the Store will panic, as the embedded interface is nil.
+type fakeStore struct {
+	Store
+	roles map[uuid.UUID]*user.Role
+}
+
+func (store *fakeStore) CreateRole(label string, permissions []string) (*user.Role, error) {
+	role := &user.Role{Permissions: permissions}
+	role.ID = uuid.New()
+	role.Label = label
+
+	store.roles[role.ID] = role
+	return role, nil
+}
+
+func (store *fakeStore) UpdateRole(roleID uuid.UUID, newLabel *string, newPermissions *[]string) (*user.Role, error) {
+	role, ok := store.roles[roleID]
+	if !ok {
+		return nil, user.ErrRoleNotFound
+	}
+
+	if newLabel != nil {
+		role.Label = *newLabel
+	}
+	if newPermissions != nil {
+		role.Permissions = *newPermissions
+	}
+
+	return role, nil
+}
+
+// fakeAuthProvider authenticates all requests as a user with the permissions provided.
+type fakeAuthProvider struct{ permissions []string }
+
+func (provider *fakeAuthProvider) GetAuthenticatedUserFromContext(_ echo.Context) (*jwt.AuthenticatedUser, error) {
+	return &jwt.AuthenticatedUser{UserID: uuid.New(), Permissions: provider.permissions}, nil
+}
+
+func newContext() echo.Context {
+	return echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/roles", nil), httptest.NewRecorder())
+}
+
+func httpStatus(err error) int {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+
+	return 0
+}
+
+func TestCreateRole_RequiresHeldPermissions(t *testing.T) {
+	tests := []struct {
+		summary        string
+		permissions    []string
+		expectedStatus int
+	}{
+		{summary: "no permissions", permissions: []string{}},
+		{summary: "held permissions", permissions: []string{"media:read", "role:create"}},
+		{summary: "permission not held", permissions: []string{"media:read", "user:delete"}, expectedStatus: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.summary, func(t *testing.T) {
+			store := &fakeStore{roles: make(map[uuid.UUID]*user.Role)}
+			controller := New(store, &fakeAuthProvider{permissions: []string{"media:read", "role:create"}})
+
+			_, err := controller.CreateRole(newContext(), gen.CreateRoleRequestObject{
+				Body: &gen.CreateRoleJSONRequestBody{Label: "Role", Permissions: test.permissions},
+			})
+			if test.expectedStatus == 0 {
+				if err != nil || len(store.roles) != 1 {
+					t.Fatalf("expected role to be created, got error %v", err)
+				}
+			} else if httpStatus(err) != test.expectedStatus || len(store.roles) != 0 {
+				t.Fatalf("expected role to be rejected with status %d, got error %v", test.expectedStatus, err)
+			}
+		})
+	}
+}
+
+func TestUpdateRole_RequiresHeldPermissions(t *testing.T) {
+	store := &fakeStore{roles: make(map[uuid.UUID]*user.Role)}
+	role, _ := store.CreateRole("Role", []string{"media:read"})
+	controller := New(store, &fakeAuthProvider{permissions: []string{"media:read", "role:edit"}})
+
+	label := "Renamed"
+	if _, err := controller.UpdateRole(newContext(), gen.UpdateRoleRequestObject{Id: role.ID, Body: &gen.UpdateRoleJSONRequestBody{Label: &label}}); err != nil {
+		t.Fatalf("expected role rename without permissions to succeed, got %v", err)
+	}
+
+	escalated := []string{"media:read", "user:delete"}
+	_, err := controller.UpdateRole(newContext(), gen.UpdateRoleRequestObject{Id: role.ID, Body: &gen.UpdateRoleJSONRequestBody{Permissions: &escalated}})
+	if httpStatus(err) != http.StatusForbidden {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+	if len(role.Permissions) != 1 {
+		t.Errorf("expected permissions of role to be unchanged, got %v", role.Permissions)
+	}
+}
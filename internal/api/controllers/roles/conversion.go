@@ -0,0 +1,17 @@
+package roles
+
+import (
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/user"
+)
+
+func roleToDto(role *user.Role) gen.Role {
+	return gen.Role{
+		Id:          role.ID,
+		Label:       role.Label,
+		BuiltIn:     role.BuiltIn,
+		Permissions: role.Permissions,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}
+}
@@ -15,7 +15,7 @@ import (
 
 type (
 	TranscodeService interface {
-		NewTask(mediaID uuid.UUID, targetID uuid.UUID) error
+		NewTask(mediaID uuid.UUID, fileID *uuid.UUID, targetID uuid.UUID) error
 		CancelTask(id uuid.UUID) error
 		PauseTask(id uuid.UUID) error
 		ResumeTask(id uuid.UUID) error
@@ -42,7 +42,7 @@ func New(transcodeService TranscodeService, store Store) *TranscodesController {
 }
 
 func (controller *TranscodesController) CreateTranscodeTask(ec echo.Context, request gen.CreateTranscodeTaskRequestObject) (gen.CreateTranscodeTaskResponseObject, error) {
-	if err := controller.transcodeService.NewTask(request.Body.MediaId, request.Body.TargetId); err != nil {
+	if err := controller.transcodeService.NewTask(request.Body.MediaId, request.Body.MediaFileId, request.Body.TargetId); err != nil {
 		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Task creation failed: %v", err))
 	}
 
@@ -0,0 +1,152 @@
+package uploads
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/ingest"
+	"github.com/hbomb79/Thea/internal/upload"
+	"github.com/hbomb79/Thea/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	UploadService interface {
+		CreateUpload(userID uuid.UUID, fileName string, size int64, checksum string, tmdbID *string) (*upload.Upload, error)
+		GetUpload(uploadID uuid.UUID, userID uuid.UUID) (*upload.Upload, error)
+		ListUploads(userID uuid.UUID) ([]*upload.Upload, error)
+		WriteChunk(uploadID uuid.UUID, userID uuid.UUID, offset int64, content io.Reader) (*upload.Upload, error)
+		AbortUpload(uploadID uuid.UUID, userID uuid.UUID) error
+	}
+
+	AuthProvider interface {
+		GetAuthenticatedUserFromContext(ec echo.Context) (*jwt.AuthenticatedUser, error)
+	}
+
+	// UploadsController is responsible for the resumable uploads of media,
+	// which are queued for ingestion once complete. Uploads are only
+	// visible to the user which created them.
+	UploadsController struct {
+		service      UploadService
+		authProvider AuthProvider
+	}
+)
+
+var log = logger.Get("UploadsController")
+
+func New(service UploadService, authProvider AuthProvider) *UploadsController {
+	return &UploadsController{service: service, authProvider: authProvider}
+}
+
+func (controller *UploadsController) CreateUpload(ec echo.Context, request gen.CreateUploadRequestObject) (gen.CreateUploadResponseObject, error) {
+	userID, err := controller.authenticatedUserID(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	body := request.Body
+	created, err := controller.service.CreateUpload(userID, body.FileName, body.Size, body.Checksum, body.TmdbId)
+	if err != nil {
+		return nil, uploadError(err)
+	}
+
+	return gen.CreateUpload201JSONResponse(uploadToDto(created)), nil
+}
+
+func (controller *UploadsController) ListUploads(ec echo.Context, _ gen.ListUploadsRequestObject) (gen.ListUploadsResponseObject, error) {
+	userID, err := controller.authenticatedUserID(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	uploads, err := controller.service.ListUploads(userID)
+	if err != nil {
+		return nil, uploadError(err)
+	}
+
+	return gen.ListUploads200JSONResponse(uploadsToDtos(uploads)), nil
+}
+
+func (controller *UploadsController) GetUpload(ec echo.Context, request gen.GetUploadRequestObject) (gen.GetUploadResponseObject, error) {
+	userID, err := controller.authenticatedUserID(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := controller.service.GetUpload(request.Id, userID)
+	if err != nil {
+		return nil, uploadError(err)
+	}
+
+	return gen.GetUpload200JSONResponse(uploadToDto(model)), nil
+}
+
+// UploadChunk appends the request body to the upload, starting at the offset provided. If the
+// chunk completes the upload, the returned DTO contains the ID of the ingest
+// the file was queued as.
+func (controller *UploadsController) UploadChunk(ec echo.Context, request gen.UploadChunkRequestObject) (gen.UploadChunkResponseObject, error) {
+	userID, err := controller.authenticatedUserID(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := controller.service.WriteChunk(request.Id, userID, request.Params.Offset, request.Body)
+	if err != nil {
+		return nil, uploadError(err)
+	}
+
+	return gen.UploadChunk200JSONResponse(uploadToDto(model)), nil
+}
+
+func (controller *UploadsController) AbortUpload(ec echo.Context, request gen.AbortUploadRequestObject) (gen.AbortUploadResponseObject, error) {
+	userID, err := controller.authenticatedUserID(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := controller.service.AbortUpload(request.Id, userID); err != nil {
+		return nil, uploadError(err)
+	}
+
+	return gen.AbortUpload200Response{}, nil
+}
+
+func (controller *UploadsController) authenticatedUserID(ec echo.Context) (uuid.UUID, error) {
+	user, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return uuid.Nil, echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	return user.UserID, nil
+}
+
+// uploadError converts an error returned by the upload service in to an
+// HTTP error with an appropriate status code.
+func uploadError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return echo.ErrNotFound
+	case errors.Is(err, upload.ErrInvalidFileName),
+		errors.Is(err, upload.ErrInvalidSize),
+		errors.Is(err, upload.ErrInvalidChecksum),
+		errors.Is(err, upload.ErrSizeExceeded),
+		errors.Is(err, ingest.ErrInvalidFileName):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, upload.ErrUploadTooLarge):
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, upload.ErrOffsetMismatch),
+		errors.Is(err, upload.ErrUploadInProgress),
+		errors.Is(err, ingest.ErrIngestFileExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, upload.ErrChecksumMismatch):
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	log.Errorf("Upload request failed: %v\n", err)
+	return echo.NewHTTPError(http.StatusInternalServerError, err)
+}
@@ -0,0 +1,25 @@
+package uploads
+
+import (
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/util"
+	"github.com/hbomb79/Thea/internal/upload"
+)
+
+func uploadToDto(model *upload.Upload) gen.Upload {
+	return gen.Upload{
+		Id:        model.ID,
+		FileName:  model.FileName,
+		Size:      model.Size,
+		Offset:    model.Offset,
+		Checksum:  model.Checksum,
+		TmdbId:    model.TmdbID,
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+		IngestId:  model.IngestID,
+	}
+}
+
+func uploadsToDtos(models []*upload.Upload) []gen.Upload {
+	return util.ApplyConversion(models, uploadToDto)
+}
@@ -1,12 +1,16 @@
 package users
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"path/filepath"
 
 	"github.com/google/uuid"
 	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
 	"github.com/hbomb79/Thea/internal/api/util"
+	"github.com/hbomb79/Thea/internal/token"
 	"github.com/hbomb79/Thea/internal/user"
 	"github.com/labstack/echo/v4"
 )
@@ -15,14 +19,40 @@ type (
 	Store interface {
 		ListUsers() ([]*user.User, error)
 		GetUserWithID(userID uuid.UUID) (*user.User, error)
+		CreateUser(username []byte, password []byte, passwordChangeRequired bool, permissions ...string) (*user.User, error)
+		DeleteUser(userID uuid.UUID) error
+		RenameUser(userID uuid.UUID, username []byte) error
+		UnlockUser(userID uuid.UUID) error
+		DeleteUserMFA(userID uuid.UUID) error
+		UpdateUserPassword(userID uuid.UUID, password []byte, passwordChangeRequired bool) error
 		UpdateUserPermissions(userID uuid.UUID, newPermissions []string) error
+		UpdateUserRoles(userID uuid.UUID, roleIDs []uuid.UUID) error
+		GetRole(roleID uuid.UUID) (*user.Role, error)
+		UpdateUserAccessRestrictions(userID uuid.UUID, restrictions user.AccessRestrictions) error
+		ListActiveSessionsForUser(userID uuid.UUID) ([]*token.Session, error)
+		GetSession(sessionID uuid.UUID) (*token.Session, error)
+		RevokeSession(sessionID uuid.UUID) error
+		RevokeSessionsForUser(userID uuid.UUID) error
+		ListAPIKeysForUser(userID uuid.UUID) ([]*token.APIKey, error)
+		GetAPIKey(keyID uuid.UUID) (*token.APIKey, error)
+		RevokeAPIKey(keyID uuid.UUID) error
+		RevokeAPIKeysForUser(userID uuid.UUID) error
 	}
 
-	UserController struct{ store Store }
+	AuthProvider interface {
+		GetAuthenticatedUserFromContext(ec echo.Context) (*jwt.AuthenticatedUser, error)
+		RevokeAllForUser(userID uuid.UUID) (*http.Cookie, *http.Cookie, error)
+	}
+
+	UserController struct {
+		store          Store
+		authProvider   AuthProvider
+		passwordPolicy user.PasswordPolicy
+	}
 )
 
-func NewController(store Store) *UserController {
-	return &UserController{store: store}
+func NewController(store Store, authProvider AuthProvider, passwordPolicy user.PasswordPolicy) *UserController {
+	return &UserController{store: store, authProvider: authProvider, passwordPolicy: passwordPolicy}
 }
 
 func (controller *UserController) ListUsers(ec echo.Context, _ gen.ListUsersRequestObject) (gen.ListUsersResponseObject, error) {
@@ -43,10 +73,284 @@ func (controller *UserController) GetUser(ec echo.Context, request gen.GetUserRe
 	return gen.GetUser200JSONResponse(userToDto(user)), nil
 }
 
+func (controller *UserController) CreateUser(ec echo.Context, request gen.CreateUserRequestObject) (gen.CreateUserResponseObject, error) {
+	password := []byte(request.Body.Password)
+	if err := controller.passwordPolicy.Validate(request.Body.Username, password); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	changeRequired := request.Body.PasswordChangeRequired != nil && *request.Body.PasswordChangeRequired
+	created, err := controller.store.CreateUser([]byte(request.Body.Username), password, changeRequired, request.Body.Permissions...)
+	if err != nil {
+		if errors.Is(err, user.ErrUsernameTaken) {
+			return nil, echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to create user: %s", err))
+	}
+
+	// Fetch the user again so that the permissions of the user are included
+	u, err := controller.store.GetUserWithID(created.ID)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.CreateUser201JSONResponse(userToDto(u)), nil
+}
+
+// DeleteUser revokes all the sessions and API keys of the user, before deleting the user
+// and their permissions. Users are unable to delete themselves, to ensure that
+// Thea is not accidentally left without any users.
+func (controller *UserController) DeleteUser(ec echo.Context, request gen.DeleteUserRequestObject) (gen.DeleteUserResponseObject, error) {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return nil, echo.ErrUnauthorized
+	}
+	if authUser.UserID == request.Id {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Users cannot delete themselves")
+	}
+
+	if _, err := controller.store.GetUserWithID(request.Id); err != nil {
+		return nil, echo.ErrNotFound
+	}
+
+	if _, _, err := controller.authProvider.RevokeAllForUser(request.Id); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if err := controller.store.RevokeAPIKeysForUser(request.Id); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if err := controller.store.DeleteUser(request.Id); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, echo.ErrNotFound
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.DeleteUser200Response{}, nil
+}
+
+func (controller *UserController) RenameUser(ec echo.Context, request gen.RenameUserRequestObject) (gen.RenameUserResponseObject, error) {
+	if err := controller.store.RenameUser(request.Id, []byte(request.Body.Username)); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, echo.ErrNotFound
+		} else if errors.Is(err, user.ErrUsernameTaken) {
+			return nil, echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	u, err := controller.store.GetUserWithID(request.Id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RenameUser200JSONResponse(userToDto(u)), nil
+}
+
+// UnlockUser unlocks a user which has been locked due to too many failed
+// logins, allowing them to login again before their lockout expires.
+func (controller *UserController) UnlockUser(ec echo.Context, request gen.UnlockUserRequestObject) (gen.UnlockUserResponseObject, error) {
+	if err := controller.store.UnlockUser(request.Id); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, echo.ErrNotFound
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	u, err := controller.store.GetUserWithID(request.Id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.UnlockUser200JSONResponse(userToDto(u)), nil
+}
+
+// ResetUserMfa removes the two-factor authentication of the user, allowing
+// a user which has lost their authenticator (and recovery codes) to login.
+func (controller *UserController) ResetUserMfa(ec echo.Context, request gen.ResetUserMfaRequestObject) (gen.ResetUserMfaResponseObject, error) {
+	if err := controller.store.DeleteUserMFA(request.Id); err != nil {
+		if errors.Is(err, user.ErrMFANotEnrolled) {
+			return nil, echo.ErrNotFound
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.ResetUserMfa204Response{}, nil
+}
+
+// SetUserPassword sets the password of the user (without requiring their current
+// password), and revokes all of their existing sessions and API keys.
+func (controller *UserController) SetUserPassword(ec echo.Context, request gen.SetUserPasswordRequestObject) (gen.SetUserPasswordResponseObject, error) {
+	u, err := controller.store.GetUserWithID(request.Id)
+	if err != nil {
+		return nil, echo.ErrNotFound
+	}
+
+	password := []byte(request.Body.Password)
+	if err := controller.passwordPolicy.Validate(u.Username, password); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	changeRequired := request.Body.PasswordChangeRequired != nil && *request.Body.PasswordChangeRequired
+	if err := controller.store.UpdateUserPassword(u.ID, password, changeRequired); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if _, _, err := controller.authProvider.RevokeAllForUser(u.ID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	if err := controller.store.RevokeAPIKeysForUser(u.ID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.SetUserPassword200Response{}, nil
+}
+
+// UpdateUserPermissions replaces the permissions assigned directly to the user. The user
+// can only be given permissions which the authenticated user has.
 func (controller *UserController) UpdateUserPermissions(ec echo.Context, request gen.UpdateUserPermissionsRequestObject) (gen.UpdateUserPermissionsResponseObject, error) {
+	if err := controller.requireHeldPermissions(ec, request.Body.Permissions); err != nil {
+		return nil, err
+	}
+
 	if err := controller.store.UpdateUserPermissions(request.Id, request.Body.Permissions); err != nil {
 		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to apply new permissions for user: %s", err))
 	}
 
 	return gen.UpdateUserPermissions200Response{}, nil
 }
+
+// UpdateUserRoles replaces the roles assigned to the user. The user can only be given
+// roles whose permissions are all held by the authenticated user.
+func (controller *UserController) UpdateUserRoles(ec echo.Context, request gen.UpdateUserRolesRequestObject) (gen.UpdateUserRolesResponseObject, error) {
+	for _, roleID := range request.Body.RoleIds {
+		role, err := controller.store.GetRole(roleID)
+		if err != nil {
+			if errors.Is(err, user.ErrRoleNotFound) {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to apply new roles for user: %s", err))
+			}
+
+			return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		if err := controller.requireHeldPermissions(ec, role.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := controller.store.UpdateUserRoles(request.Id, request.Body.RoleIds); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to apply new roles for user: %s", err))
+	}
+
+	return gen.UpdateUserRoles200Response{}, nil
+}
+
+// UpdateUserRestrictions replaces the access restrictions of the user, which restrict the media
+// visible to them. The sessions of the user must refresh their tokens for the change to apply.
+func (controller *UserController) UpdateUserRestrictions(ec echo.Context, request gen.UpdateUserRestrictionsRequestObject) (gen.UpdateUserRestrictionsResponseObject, error) {
+	restrictions := user.AccessRestrictions{
+		MaxContentRating: request.Body.MaxContentRating,
+		HideAdultContent: request.Body.HideAdultContent,
+	}
+
+	if request.Body.AllowedLibraries != nil {
+		restrictions.AllowedLibraries = make([]string, len(*request.Body.AllowedLibraries))
+		for k, v := range *request.Body.AllowedLibraries {
+			if !filepath.IsAbs(v) {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("allowed library '%s' is not an absolute path", v))
+			}
+
+			restrictions.AllowedLibraries[k] = filepath.Clean(v)
+		}
+	}
+
+	if restrictions.MaxContentRating != nil && *restrictions.MaxContentRating < 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "max content rating must not be negative")
+	}
+
+	if err := controller.store.UpdateUserAccessRestrictions(request.Id, restrictions); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, echo.ErrNotFound
+		}
+
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	u, err := controller.store.GetUserWithID(request.Id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.UpdateUserRestrictions200JSONResponse(userToDto(u)), nil
+}
+
+func (controller *UserController) ListUserSessions(ec echo.Context, request gen.ListUserSessionsRequestObject) (gen.ListUserSessionsResponseObject, error) {
+	sessions, err := controller.store.ListActiveSessionsForUser(request.Id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.ListUserSessions200JSONResponse(util.ApplyConversion(sessions, SessionToDto)), nil
+}
+
+func (controller *UserController) RevokeUserSessions(ec echo.Context, request gen.RevokeUserSessionsRequestObject) (gen.RevokeUserSessionsResponseObject, error) {
+	if err := controller.store.RevokeSessionsForUser(request.Id); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RevokeUserSessions200Response{}, nil
+}
+
+func (controller *UserController) RevokeUserSession(ec echo.Context, request gen.RevokeUserSessionRequestObject) (gen.RevokeUserSessionResponseObject, error) {
+	session, err := controller.store.GetSession(request.SessionId)
+	if err != nil || session.UserID != request.Id || !session.IsActive() {
+		return nil, echo.ErrNotFound
+	}
+
+	if err := controller.store.RevokeSession(session.ID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RevokeUserSession200Response{}, nil
+}
+
+func (controller *UserController) ListUserApiKeys(ec echo.Context, request gen.ListUserApiKeysRequestObject) (gen.ListUserApiKeysResponseObject, error) {
+	keys, err := controller.store.ListAPIKeysForUser(request.Id)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.ListUserApiKeys200JSONResponse(util.ApplyConversion(keys, APIKeyToDto)), nil
+}
+
+func (controller *UserController) RevokeUserApiKey(ec echo.Context, request gen.RevokeUserApiKeyRequestObject) (gen.RevokeUserApiKeyResponseObject, error) {
+	key, err := controller.store.GetAPIKey(request.ApiKeyId)
+	if err != nil || key.UserID != request.Id || key.RevokedAt != nil {
+		return nil, echo.ErrNotFound
+	}
+
+	if err := controller.store.RevokeAPIKey(key.ID); err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return gen.RevokeUserApiKey200Response{}, nil
+}
+
+// requireHeldPermissions returns a 403 error if any of the permissions provided are not
+// held by the authenticated user, to prevent users from escalating their own privileges.
+func (controller *UserController) requireHeldPermissions(ec echo.Context, permissions []string) error {
+	authUser, err := controller.authProvider.GetAuthenticatedUserFromContext(ec)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err)
+	}
+
+	if perm, missing := util.MissingPermission(authUser.Permissions, permissions); missing {
+		return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("Cannot grant permission '%s' which the user does not have", perm))
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package users
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/user"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeStore implements the parts of the Store used by the tests of this package. Calls to
+// any other method of the Store will panic, as the embedded interface is nil.
+type fakeStore struct {
+	Store
+	roles     map[uuid.UUID]*user.Role
+	userRoles map[uuid.UUID][]uuid.UUID
+	users     map[uuid.UUID]*user.User
+	passwords map[uuid.UUID]string
+
+	revokedAPIKeysFor []uuid.UUID
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		roles:     make(map[uuid.UUID]*user.Role),
+		userRoles: make(map[uuid.UUID][]uuid.UUID),
+		users:     make(map[uuid.UUID]*user.User),
+		passwords: make(map[uuid.UUID]string),
+	}
+}
+
+func (store *fakeStore) addUser(username string) *user.User {
+	u := &user.User{}
+	u.ID = uuid.New()
+	u.Username = username
+
+	store.users[u.ID] = u
+	return u
+}
+
+func (store *fakeStore) GetUserWithID(userID uuid.UUID) (*user.User, error) {
+	if u, ok := store.users[userID]; ok {
+		return u, nil
+	}
+
+	return nil, user.ErrUserNotFound
+}
+
+func (store *fakeStore) UpdateUserPassword(userID uuid.UUID, password []byte, _ bool) error {
+	store.passwords[userID] = string(password)
+	return nil
+}
+
+func (store *fakeStore) DeleteUser(userID uuid.UUID) error {
+	delete(store.users, userID)
+	return nil
+}
+
+func (store *fakeStore) RevokeAPIKeysForUser(userID uuid.UUID) error {
+	store.revokedAPIKeysFor = append(store.revokedAPIKeysFor, userID)
+	return nil
+}
+
+func (store *fakeStore) addRole(permissions ...string) *user.Role {
+	role := &user.Role{Permissions: permissions}
+	role.ID = uuid.New()
+
+	store.roles[role.ID] = role
+	return role
+}
+
+func (store *fakeStore) GetRole(roleID uuid.UUID) (*user.Role, error) {
+	if role, ok := store.roles[roleID]; ok {
+		return role, nil
+	}
+
+	return nil, user.ErrRoleNotFound
+}
+
+func (store *fakeStore) UpdateUserRoles(userID uuid.UUID, roleIDs []uuid.UUID) error {
+	store.userRoles[userID] = roleIDs
+	return nil
+}
+
+// fakeAuthProvider authenticates all requests as a user with the permissions provided.
+type fakeAuthProvider struct {
+	AuthProvider
+	permissions []string
+	revokedFor  []uuid.UUID
+}
+
+func (provider *fakeAuthProvider) RevokeAllForUser(userID uuid.UUID) (*http.Cookie, *http.Cookie, error) {
+	provider.revokedFor = append(provider.revokedFor, userID)
+	return nil, nil, nil
+}
+
+func (provider *fakeAuthProvider) GetAuthenticatedUserFromContext(_ echo.Context) (*jwt.AuthenticatedUser, error) {
+	return &jwt.AuthenticatedUser{UserID: uuid.New(), Permissions: provider.permissions}, nil
+}
+
+func newContext() echo.Context {
+	return echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/users", nil), httptest.NewRecorder())
+}
+
+func httpStatus(err error) int {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+
+	return 0
+}
+
+func TestUpdateUserRoles_RequiresHeldPermissions(t *testing.T) {
+	store := newFakeStore()
+	viewer := store.addRole("media:read")
+	admin := store.addRole("media:read", "user:delete")
+	controller := NewController(store, &fakeAuthProvider{permissions: []string{"media:read", "user:edit"}}, user.PasswordPolicy{})
+
+	userID := uuid.New()
+	if _, err := controller.UpdateUserRoles(newContext(), gen.UpdateUserRolesRequestObject{Id: userID, Body: &gen.UpdateUserRolesJSONRequestBody{RoleIds: []uuid.UUID{viewer.ID}}}); err != nil {
+		t.Fatalf("expected role with held permissions to be assigned, got %v", err)
+	}
+
+	_, err := controller.UpdateUserRoles(newContext(), gen.UpdateUserRolesRequestObject{Id: userID, Body: &gen.UpdateUserRolesJSONRequestBody{RoleIds: []uuid.UUID{viewer.ID, admin.ID}}})
+	if httpStatus(err) != http.StatusForbidden {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+	if roles := store.userRoles[userID]; len(roles) != 1 || roles[0] != viewer.ID {
+		t.Errorf("expected roles of user to be unchanged, got %v", roles)
+	}
+
+	_, err = controller.UpdateUserRoles(newContext(), gen.UpdateUserRolesRequestObject{Id: userID, Body: &gen.UpdateUserRolesJSONRequestBody{RoleIds: []uuid.UUID{uuid.New()}}})
+	if httpStatus(err) != http.StatusBadRequest {
+		t.Fatalf("expected bad request for unknown role, got %v", err)
+	}
+}
+
+func TestUpdateUserPermissions_RequiresHeldPermissions(t *testing.T) {
+	controller := NewController(newFakeStore(), &fakeAuthProvider{permissions: []string{"media:read", "user:edit"}}, user.PasswordPolicy{})
+
+	_, err := controller.UpdateUserPermissions(newContext(), gen.UpdateUserPermissionsRequestObject{Id: uuid.New(), Body: &gen.UpdateUserPermissionsJSONRequestBody{Permissions: []string{"user:delete"}}})
+	if httpStatus(err) != http.StatusForbidden {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+}
+
+func TestSetUserPassword_RevokesSessionsAndAPIKeys(t *testing.T) {
+	store := newFakeStore()
+	alice := store.addUser("alice")
+	authProvider := &fakeAuthProvider{}
+	controller := NewController(store, authProvider, user.PasswordPolicy{})
+
+	if _, err := controller.SetUserPassword(newContext(), gen.SetUserPasswordRequestObject{Id: alice.ID, Body: &gen.SetUserPasswordJSONRequestBody{Password: "new password"}}); err != nil {
+		t.Fatalf("expected password to be set, got %v", err)
+	}
+	if store.passwords[alice.ID] != "new password" {
+		t.Errorf("expected password of user to be changed")
+	}
+	if len(authProvider.revokedFor) != 1 || authProvider.revokedFor[0] != alice.ID {
+		t.Errorf("expected sessions of user to be revoked, got %v", authProvider.revokedFor)
+	}
+	if len(store.revokedAPIKeysFor) != 1 || store.revokedAPIKeysFor[0] != alice.ID {
+		t.Errorf("expected API keys of user to be revoked, got %v", store.revokedAPIKeysFor)
+	}
+}
+
+func TestDeleteUser_RevokesSessionsAndAPIKeys(t *testing.T) {
+	store := newFakeStore()
+	alice := store.addUser("alice")
+	authProvider := &fakeAuthProvider{}
+	controller := NewController(store, authProvider, user.PasswordPolicy{})
+
+	if _, err := controller.DeleteUser(newContext(), gen.DeleteUserRequestObject{Id: alice.ID}); err != nil {
+		t.Fatalf("expected user to be deleted, got %v", err)
+	}
+	if _, ok := store.users[alice.ID]; ok {
+		t.Errorf("expected user to be deleted")
+	}
+	if len(authProvider.revokedFor) != 1 || authProvider.revokedFor[0] != alice.ID {
+		t.Errorf("expected sessions of user to be revoked, got %v", authProvider.revokedFor)
+	}
+	if len(store.revokedAPIKeysFor) != 1 || store.revokedAPIKeysFor[0] != alice.ID {
+		t.Errorf("expected API keys of user to be revoked, got %v", store.revokedAPIKeysFor)
+	}
+}
@@ -1,18 +1,69 @@
 package users
 
 import (
+	"time"
+
 	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/token"
 	"github.com/hbomb79/Thea/internal/user"
 )
 
 func userToDto(user *user.User) gen.User {
+	var lockedUntil *time.Time
+	if user.IsLocked() {
+		lockedUntil = user.LockedUntil
+	}
+
 	return gen.User{
-		Id:          user.ID,
-		Username:    user.Username,
-		Permissions: user.Permissions,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		LastLogin:   user.LastLoginAt,
-		LastRefresh: user.LastRefreshAt,
+		Id:                     user.ID,
+		Username:               user.Username,
+		Permissions:            user.Permissions,
+		Roles:                  user.Roles,
+		CreatedAt:              user.CreatedAt,
+		UpdatedAt:              user.UpdatedAt,
+		LastLogin:              user.LastLoginAt,
+		LastRefresh:            user.LastRefreshAt,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+		LockedUntil:            lockedUntil,
+		MfaEnabled:             user.MFAEnabled,
+		Restrictions:           accessRestrictionsToDto(&user.AccessRestrictions),
+	}
+}
+
+func accessRestrictionsToDto(restrictions *user.AccessRestrictions) gen.AccessRestrictions {
+	var allowedLibraries *[]string
+	if restrictions.AllowedLibraries != nil {
+		libraries := []string(restrictions.AllowedLibraries)
+		allowedLibraries = &libraries
+	}
+
+	return gen.AccessRestrictions{
+		AllowedLibraries: allowedLibraries,
+		MaxContentRating: restrictions.MaxContentRating,
+		HideAdultContent: restrictions.HideAdultContent,
+	}
+}
+
+func SessionToDto(session *token.Session) gen.Session {
+	return gen.Session{
+		Id:         session.ID,
+		CreatedAt:  session.CreatedAt,
+		LastUsedAt: session.LastUsedAt,
+		ExpiresAt:  session.ExpiresAt,
+		Device:     session.Device,
+		UserAgent:  session.UserAgent,
+		IpAddress:  session.IPAddress,
+	}
+}
+
+func APIKeyToDto(key *token.APIKey) gen.ApiKey {
+	return gen.ApiKey{
+		Id:          key.ID,
+		Label:       key.Label,
+		Prefix:      key.Prefix,
+		Permissions: key.Permissions,
+		CreatedAt:   key.CreatedAt,
+		ExpiresAt:   key.ExpiresAt,
+		LastUsedAt:  key.LastUsedAt,
 	}
 }
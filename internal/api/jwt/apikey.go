@@ -0,0 +1,119 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/hbomb79/Thea/internal/token"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	APIKeyHeaderName = "X-Api-Key"
+
+	// sessionRequiredExtension is an OpenAPI extension which marks operations which
+	// cannot be accessed using an API key, such as the management of API keys (which
+	// would otherwise allow a key to create other keys with more permissions).
+	sessionRequiredExtension = "x-session-required"
+)
+
+var (
+	ErrAPIKeyInvalid   = errors.New("API key is unknown, revoked or expired")
+	ErrSessionRequired = errors.New("operation cannot be accessed using an API key")
+)
+
+// authenticateAPIKey validates the API key provided, returning the user the key belongs to. The
+// permissions of the user returned are restricted to the permissions the key is scoped to.
+func (auth *jwtAuthProvider) authenticateAPIKey(key string) (*AuthenticatedUser, error) {
+	apiKey, err := auth.store.GetAPIKeyWithHash(token.HashAPIKey(key))
+	if err != nil || !apiKey.IsActive() {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	authUser, err := auth.authenticatedUserForAPIKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't block the request waiting for this
+	go func() {
+		if err := auth.store.RecordAPIKeyUsage(apiKey.ID); err != nil {
+			log.Warnf("Failed to record usage of API key %s: %v\n", apiKey.ID, err)
+		}
+	}()
+
+	return authUser, nil
+}
+
+// authenticatedUserForAPIKey returns the user the (active) API key provided belongs to,
+// with permissions restricted to the permissions the key is scoped to.
+func (auth *jwtAuthProvider) authenticatedUserForAPIKey(apiKey *token.APIKey) (*AuthenticatedUser, error) {
+	user, err := auth.store.GetUserWithID(apiKey.UserID)
+	if err != nil {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	// The key only has the permissions it's scoped to which the user
+	// still has (the permissions of the user may have changed since)
+	permissions := make([]string, 0, len(apiKey.Permissions))
+	for _, perm := range apiKey.Permissions {
+		if slices.Contains(user.Permissions, perm) {
+			permissions = append(permissions, perm)
+		}
+	}
+
+	return &AuthenticatedUser{
+		UserID:                 user.ID,
+		APIKeyID:               &apiKey.ID,
+		Permissions:            permissions,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+		MFAEnrolmentRequired:   auth.requiresMFAEnrolment(user),
+		Restrictions:           accessRestrictions(user),
+	}, nil
+}
+
+// sameAuthorization returns true if the users provided have the same
+// permissions, restrictions and account requirements.
+func sameAuthorization(a *AuthenticatedUser, b *AuthenticatedUser) bool {
+	if a.PasswordChangeRequired != b.PasswordChangeRequired || a.MFAEnrolmentRequired != b.MFAEnrolmentRequired {
+		return false
+	}
+	if !reflect.DeepEqual(a.Restrictions, b.Restrictions) {
+		return false
+	}
+
+	aPermissions, bPermissions := slices.Clone(a.Permissions), slices.Clone(b.Permissions)
+	slices.Sort(aPermissions)
+	slices.Sort(bPermissions)
+	return slices.Equal(aPermissions, bPermissions)
+}
+
+// apiKeyFromRequest extracts the API key from the request headers, which may be provided
+// using either the X-Api-Key header, or as a bearer token in the Authorization header.
+func apiKeyFromRequest(request *http.Request) (string, bool) {
+	if key := request.Header.Get(APIKeyHeaderName); key != "" {
+		return key, true
+	}
+
+	if key, ok := strings.CutPrefix(request.Header.Get(echo.HeaderAuthorization), "Bearer "); ok && key != "" {
+		return key, true
+	}
+
+	return "", false
+}
+
+// isSessionRequired returns true if the operation being accessed is marked
+// as requiring a session (see sessionRequiredExtension).
+func isSessionRequired(authInput *openapi3filter.AuthenticationInput) bool {
+	route := authInput.RequestValidationInput.Route
+	if route == nil || route.Operation == nil {
+		return false
+	}
+
+	required, ok := route.Operation.Extensions[sessionRequiredExtension].(bool)
+	return ok && required
+}
@@ -2,6 +2,7 @@ package jwt
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -13,10 +14,11 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/hbomb79/Thea/internal/api/gen"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/internal/token"
 	"github.com/hbomb79/Thea/internal/user"
 	"github.com/hbomb79/Thea/internal/user/permissions"
 	"github.com/hbomb79/Thea/pkg/logger"
-	"github.com/hbomb79/Thea/pkg/sync"
 	"github.com/labstack/echo/v4"
 	middleware "github.com/oapi-codegen/echo-middleware"
 )
@@ -25,6 +27,12 @@ var (
 	ErrUnknownSecurityScheme   = errors.New("request specifies an unknown security scheme and so cannot be validated")
 	ErrAuthTokenMissing        = errors.New("request does not contain required auth token in cookies")
 	ErrInsufficientPermissions = errors.New("authenticated user is missing required permissions")
+	ErrSessionInactive         = errors.New("session has been revoked or has expired")
+	ErrRefreshTokenReused      = errors.New("refresh token has already been used")
+	ErrPasswordChangeRequired  = errors.New("authenticated user must change their password")
+	ErrPermissionsOutdated     = errors.New("permissions of auth token are outdated, tokens must be refreshed")
+	ErrMFAEnrolmentRequired    = errors.New("authenticated user must enrol in two-factor authentication")
+	ErrMFAChallengeInvalid     = errors.New("MFA challenge token is invalid or has expired")
 
 	log = logger.Get("JWT-Auth")
 )
@@ -38,60 +46,112 @@ const (
 	RefreshTokenCookieName = "refresh-token"
 	RefreshTokenLifespan   = time.Hour * 24 * 30 // 30 days
 
+	MFAChallengeLifespan = time.Minute * 5
+
 	tokenExpiryCleanupDelay = 5 * time.Second
+	maintenanceInterval     = time.Hour
 )
 
 type (
 	AuthenticatedUser struct {
 		UserID      uuid.UUID
+		SessionID   uuid.UUID
 		Permissions []string
+
+		// APIKeyID is the ID of the API key used to authenticate the
+		// request. If nil, the request was authenticated using an auth token.
+		APIKeyID *uuid.UUID
+
+		// PermissionsVersion is the permissions version of the session at the time the auth
+		// token was issued (see token.Session). Unused for requests authenticated by API key.
+		PermissionsVersion int
+
+		// PasswordChangeRequired restricts the user to endpoints which require no
+		// permissions (such as changing their password) until their password is changed.
+		PasswordChangeRequired bool
+
+		// MFAEnrolmentRequired restricts the user to endpoints which require no permissions
+		// (such as enrolling in two-factor authentication) until they have enrolled, as
+		// the MFA policy requires them to do so.
+		MFAEnrolmentRequired bool
+
+		// Restrictions are the access restrictions of the user, which restrict the media
+		// visible to them. Nil if the user is unrestricted.
+		Restrictions *user.AccessRestrictions
 	}
 
 	authTokenClaims struct {
 		jwt.RegisteredClaims
 		Permissions []string  `json:"permissions"`
 		UserID      uuid.UUID `json:"user_id"`
+		SessionID   uuid.UUID `json:"session_id"`
+
+		// PasswordChangeRequired restricts the user to endpoints which require no
+		// permissions (such as changing their password) until their password is changed.
+		PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+
+		// MFAEnrolmentRequired restricts the user to endpoints which require no permissions
+		// (such as enrolling in two-factor authentication) until they have enrolled.
+		MFAEnrolmentRequired bool `json:"mfa_enrolment_required,omitempty"`
+
+		// PermissionsVersion is the permissions version of the session at the time
+		// the token was issued. If the permissions of the user change, the version of the
+		// session is incremented and this token is rejected.
+		PermissionsVersion int `json:"permissions_version"`
+
+		// Restrictions are the access restrictions of the user, omitted if the user is
+		// unrestricted. Changes to the restrictions of a user increment the permissions
+		// version of their sessions, and so outdated restrictions are rejected as above.
+		Restrictions *user.AccessRestrictions `json:"restrictions,omitempty"`
 	}
 
-	refreshTokenClaims struct {
+	// mfaChallengeClaims are the claims of an MFA challenge token, which is issued
+	// once the user has provided their username and password (but before they've provided
+	// their two-factor authentication code).
+	mfaChallengeClaims struct {
 		jwt.RegisteredClaims
 		UserID uuid.UUID `json:"user_id"`
 	}
 
+	// refreshTokenClaims are the claims of a refresh token. The ID of the
+	// token (jti) is used to ensure each refresh token is only used once.
+	refreshTokenClaims struct {
+		jwt.RegisteredClaims
+		UserID    uuid.UUID `json:"user_id"`
+		SessionID uuid.UUID `json:"session_id"`
+	}
+
 	Store interface {
 		RecordUserLogin(userID uuid.UUID) error
 		RecordUserRefresh(userID uuid.UUID) error
 		GetUserWithUsernameAndPassword(username []byte, rawPassword []byte) (*user.User, error)
 		GetUserWithID(ID uuid.UUID) (*user.User, error)
+
+		SaveSigningKey(key *token.SigningKey) error
+		ListSigningKeys() ([]*token.SigningKey, error)
+		DeleteSigningKeysRetiredBefore(tokenType token.Type, before time.Time) error
+
+		SaveSession(session *token.Session) error
+		GetSession(sessionID uuid.UUID) (*token.Session, error)
+		RotateSessionRefreshToken(sessionID uuid.UUID, existingTokenID uuid.UUID, newTokenID uuid.UUID, expiresAt time.Time, client token.Client) (bool, error)
+		RevokeSession(sessionID uuid.UUID) error
+		RevokeSessionsForUser(userID uuid.UUID) error
+		DeleteSessionsInactiveBefore(before time.Time) error
+
+		GetAPIKey(keyID uuid.UUID) (*token.APIKey, error)
+		GetAPIKeyWithHash(hash []byte) (*token.APIKey, error)
+		RecordAPIKeyUsage(keyID uuid.UUID) error
 	}
 
+	// jwtAuthProvider issues and validates the JWTs used to authenticate users. Each
+	// login creates a session (persisted using the store), which all the tokens
+	// issued for the login belong to. Revoking a session (e.g. by logging out)
+	// invalidates all of it's tokens.
 	jwtAuthProvider struct {
 		store                  Store
-		authTokenSecret        []byte
-		refreshTokenSecret     []byte
+		keys                   *keyring
 		refreshTokenCookiePath string
-
-		// This map (acting as a set) is used to keep track of
-		// any token which we have explicitly revoked (for example,
-		// when a user logs out, the auth and refresh token are revoked).
-		//
-		// NB: Tokens are removed from this set when they are cleaned up
-		// (which happens automatically some time after their expiration).
-		blacklistedTokens *sync.TypedSyncMap[string, struct{}]
-
-		// This map is used to keep track of which tokens are currently
-		// 'active' for each user. This map is automatically monitored
-		// by the auth provider to clear out tokens shortly after they expire.
-		// When we wish to revoke all tokens associated with a specific user, we
-		// can use this map to fetch the tokens.
-		//
-		// NB: A token does NOT need to exist here in order to be valid, this
-		// is simply a mechanism to track active tokens for the purpose of
-		// revocation if requested.
-		//
-		// NB': Tokens are removed from this map when they are cleaned up
-		// (which happens automatically some time after their expiration).
-		userTokens *sync.TypedSyncMap[uuid.UUID, []string]
+		mfaPolicy              user.MFAPolicy
 	}
 )
 
@@ -102,31 +162,70 @@ type (
 // HTTP path which should restrict the transmission of the
 // refresh token (it should only be sent to the server when it's going
 // to be used).
-// Finally, the two secrets which are used to sign the tokens. These two
-// secrets should not match, and should be >= 256 bits in size.
-func NewJwtAuth(store Store, refreshRoutePath string, authTokenSecret []byte, refreshTokenSecret []byte) *jwtAuthProvider {
-	return &jwtAuthProvider{
-		store,
-		authTokenSecret,
-		refreshTokenSecret,
-		refreshRoutePath,
-		new(sync.TypedSyncMap[string, struct{}]),
-		new(sync.TypedSyncMap[uuid.UUID, []string]),
-	}
-}
-
-// generateTokensAndSetCookies generates an auth token and a refresh token
-// using the appropriate secrets and expiries, before storing both of the tokens
-// in the requests cookies.
-func (auth *jwtAuthProvider) GenerateTokenCookies(userID uuid.UUID) (*http.Cookie, *http.Cookie, error) {
-	authToken, authTokenExp, err := auth.generateAccessToken(userID)
+// The keys used to sign the tokens are loaded from the store (and generated
+// if none exist), see keyring. The MFA policy provided determines which users
+// are restricted until they enrol in two-factor authentication.
+func NewJwtAuth(store Store, refreshRoutePath string, mfaPolicy user.MFAPolicy) (*jwtAuthProvider, error) {
+	keys, err := newKeyring(store)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	refreshToken, refreshTokenExp, err := auth.generateRefreshToken(userID)
-	if err != nil {
-		return nil, nil, err
+	return &jwtAuthProvider{store, keys, refreshRoutePath, mfaPolicy}, nil
+}
+
+// Run periodically removes inactive sessions and retired signing keys, and rotates the
+// signing keys once they are older than the rotation interval provided (zero disables
+// scheduled rotation). This method blocks until the context provided is cancelled.
+func (auth *jwtAuthProvider) Run(ctx context.Context, rotationInterval time.Duration) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		auth.keys.maintain(rotationInterval)
+		if err := auth.store.DeleteSessionsInactiveBefore(time.Now().Add(-RefreshTokenLifespan)); err != nil {
+			log.Errorf("Failed to remove inactive sessions: %v\n", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RotateSigningKeys generates new signing keys for all types of token. Tokens
+// signed by the previous keys remain valid until they expire.
+func (auth *jwtAuthProvider) RotateSigningKeys() error {
+	for _, tokenType := range signedTokenTypes {
+		if err := auth.keys.rotate(tokenType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListSigningKeys returns all the signing keys which can be used to verify tokens,
+// including retired keys, with the most recently created first.
+func (auth *jwtAuthProvider) ListSigningKeys() []*token.SigningKey {
+	return auth.keys.allKeys()
+}
+
+// GenerateTokenCookies creates a new session for the user provided, and generates
+// an auth token and a refresh token for the session. The tokens are returned
+// as cookies, with the intention that they are set in the response.
+func (auth *jwtAuthProvider) GenerateTokenCookies(userID uuid.UUID, client token.Client) (*http.Cookie, *http.Cookie, error) {
+	session := &token.Session{
+		ID:             uuid.New(),
+		UserID:         userID,
+		ExpiresAt:      time.Now().Add(RefreshTokenLifespan),
+		RefreshTokenID: uuid.New(),
+		Client:         client,
+	}
+	if err := auth.store.SaveSession(session); err != nil {
+		return nil, nil, fmt.Errorf("failed to create session for user %s: %w", userID, err)
 	}
 
 	// Don't block the request waiting for these
@@ -139,20 +238,51 @@ func (auth *jwtAuthProvider) GenerateTokenCookies(userID uuid.UUID) (*http.Cooki
 		}
 	}()
 
-	// Update our tracked list of tokens for this user, and schedule cleanup
-	// of this token
-	actual, loaded := auth.userTokens.LoadOrStore(userID, []string{authToken, refreshToken})
-	if loaded {
-		auth.userTokens.Store(userID, append(actual, authToken, refreshToken))
+	return auth.generateTokenCookies(session.UserID, session.ID, session.RefreshTokenID, session.ExpiresAt)
+}
+
+// GenerateMFAChallenge generates a short-lived MFA challenge token for the user provided, which
+// is issued (instead of the auth and refresh tokens) when a user which has enrolled in two-factor
+// authentication provides their username and password. The token must be provided (along with a
+// valid code) to complete the login, see ValidateMFAChallenge.
+func (auth *jwtAuthProvider) GenerateMFAChallenge(userID uuid.UUID) (string, time.Time, error) {
+	exp := time.Now().Add(MFAChallengeLifespan)
+	claims := &mfaChallengeClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+	}
+
+	tkn, err := generateToken(claims, auth.keys.signingKey(token.MFAChallenge))
+	if err != nil {
+		return "", time.Now(), fmt.Errorf("failed to generate MFA challenge token: %w", err)
 	}
 
-	auth.scheduleUserTokenCleanup(userID, authToken, authTokenExp)
-	auth.scheduleUserTokenCleanup(userID, refreshToken, refreshTokenExp)
+	return tkn, exp, nil
+}
 
-	// Create and return the token cookies to be set in the response
-	authTokenCookie := createTokenCookie(AuthTokenCookieName, "/", authToken, authTokenExp)
-	refreshTokenCookie := createTokenCookie(RefreshTokenCookieName, auth.refreshTokenCookiePath, refreshToken, refreshTokenExp)
-	return authTokenCookie, refreshTokenCookie, nil
+// ValidateMFAChallenge validates the MFA challenge token provided,
+// returning the ID of the user the challenge was issued to.
+func (auth *jwtAuthProvider) ValidateMFAChallenge(challenge string) (uuid.UUID, error) {
+	tkn, err := auth.validateJWT(challenge, token.MFAChallenge)
+	if err != nil {
+		log.Warnf("Validation of MFA challenge token failed: %v\n", err)
+		return uuid.Nil, ErrMFAChallengeInvalid
+	}
+
+	claims, ok := tkn.Claims.(*jwt.MapClaims)
+	if !ok {
+		return uuid.Nil, ErrMFAChallengeInvalid
+	}
+
+	userID, err := auth.getUserIDFromClaims(*claims)
+	if err != nil {
+		return uuid.Nil, ErrMFAChallengeInvalid
+	}
+
+	return *userID, nil
 }
 
 // GetAuthenticatedUserFromContext provides a way for endpoints
@@ -168,60 +298,150 @@ func (auth *jwtAuthProvider) GetAuthenticatedUserFromContext(ec echo.Context) (*
 	return u, nil
 }
 
-// RevokeTokensInContext revokes the auth and refresh token in this
-// request context, assuming they are provided. A missing token/cookie
-// is ignored. An expired auth and refresh token is returned, with the intention
-// that they are sent back to the client in the response.
-func (auth *jwtAuthProvider) RevokeTokensInContext(ec echo.Context) (*http.Cookie, *http.Cookie) {
-	if cookie, err := ec.Cookie(AuthTokenCookieName); err == nil && cookie != nil {
-		auth.revokeToken(cookie.Value)
+// RevalidateAuthenticatedUser checks that the authentication of the user provided is still current,
+// which is used to re-check long-lived connections (such as websockets) which were authenticated
+// once, when they were established. An error is returned if the session (or API key) of the user
+// is no longer active, or if the permissions (or restrictions) of the user have since changed.
+func (auth *jwtAuthProvider) RevalidateAuthenticatedUser(authUser *AuthenticatedUser) error {
+	if authUser.APIKeyID != nil {
+		apiKey, err := auth.store.GetAPIKey(*authUser.APIKeyID)
+		if err != nil || !apiKey.IsActive() {
+			return ErrAPIKeyInvalid
+		}
+
+		current, err := auth.authenticatedUserForAPIKey(apiKey)
+		if err != nil {
+			return err
+		}
+		if !sameAuthorization(authUser, current) {
+			return ErrPermissionsOutdated
+		}
+
+		return nil
+	}
+
+	session, err := auth.store.GetSession(authUser.SessionID)
+	if err != nil || !session.IsActive() || session.UserID != authUser.UserID {
+		return ErrSessionInactive
 	}
-	if cookie, err := ec.Cookie(RefreshTokenCookieName); err == nil && cookie != nil {
-		auth.revokeToken(cookie.Value)
+	if session.PermissionsVersion != authUser.PermissionsVersion {
+		return ErrPermissionsOutdated
 	}
 
-	expiredAuthToken := createTokenCookie(AuthTokenCookieName, "/", "", time.Now().Add(time.Hour*-24))
-	expiredRefreshToken := createTokenCookie(AuthTokenCookieName, "/", "", time.Now().Add(time.Hour*-24))
-	return expiredAuthToken, expiredRefreshToken
+	return nil
 }
 
-// RevokeAllForUser finds all the tokens we've granted to a specified
-// user ID and revokes all of them (if any). This will require that the
-// specified user logs in again on all of their devices. Returns back
-// expired auth and refresh cookies with the intention that they are
-// returned to the client in the response.
-func (auth *jwtAuthProvider) RevokeAllForUser(userID uuid.UUID) (*http.Cookie, *http.Cookie) {
-	if grantedTokens, ok := auth.userTokens.Load(userID); ok {
-		for _, granted := range grantedTokens {
-			auth.revokeToken(granted)
+// MediaAccessFilter returns the filter which restricts the media visible to
+// the user, or nil if the user is unrestricted.
+func (authUser *AuthenticatedUser) MediaAccessFilter() *media.AccessFilter {
+	return authUser.Restrictions.MediaFilter()
+}
+
+// RevokeTokensInContext revokes the session of the auth (or refresh) token in
+// this request context, assuming one is provided. A missing token/cookie is ignored. An
+// expired auth and refresh token is returned, with the intention that they are sent back
+// to the client in the response.
+func (auth *jwtAuthProvider) RevokeTokensInContext(ec echo.Context) (*http.Cookie, *http.Cookie, error) {
+	for _, tokenType := range []token.Type{token.Auth, token.Refresh} {
+		cookieName := AuthTokenCookieName
+		if tokenType == token.Refresh {
+			cookieName = RefreshTokenCookieName
+		}
+
+		cookie, err := ec.Cookie(cookieName)
+		if err != nil || cookie == nil {
+			continue
 		}
+
+		tkn, err := auth.validateJWT(cookie.Value, tokenType)
+		if err != nil {
+			continue
+		}
+
+		sessionID, err := getSessionIDFromClaims(*tkn.Claims.(*jwt.MapClaims))
+		if err != nil {
+			continue
+		}
+
+		if err := auth.store.RevokeSession(*sessionID); err != nil {
+			return nil, nil, err
+		}
+		break
 	}
 
-	expired := time.Now().Add(time.Hour * -24)
-	expiredAuthToken := createTokenCookie(AuthTokenCookieName, "/", "", expired)
-	expiredRefreshToken := createTokenCookie(RefreshTokenCookieName, auth.refreshTokenCookiePath, "", expired)
-	return expiredAuthToken, expiredRefreshToken
+	authCookie, refreshCookie := auth.expiredTokenCookies()
+	return authCookie, refreshCookie, nil
 }
 
-// RefreshTokens generates new auth and refresh tokens and stores them in
-// the request cookies IF the request contains a valid refresh token. The
-// new cookies are returned to the caller on success.
-func (auth *jwtAuthProvider) RefreshTokens(allegedRefreshToken string) (*http.Cookie, *http.Cookie, error) {
-	token, err := auth.validateJWT(allegedRefreshToken, auth.refreshTokenSecret)
+// RevokeAllForUser revokes all of the sessions of the user specified. This will require
+// that the specified user logs in again on all of their devices. Returns back expired
+// auth and refresh cookies with the intention that they are returned to the client in
+// the response.
+func (auth *jwtAuthProvider) RevokeAllForUser(userID uuid.UUID) (*http.Cookie, *http.Cookie, error) {
+	if err := auth.store.RevokeSessionsForUser(userID); err != nil {
+		return nil, nil, err
+	}
+
+	authCookie, refreshCookie := auth.expiredTokenCookies()
+	return authCookie, refreshCookie, nil
+}
+
+// RefreshTokens generates new auth and refresh tokens IF the refresh token provided is
+// valid, returning the new tokens as cookies. Refresh tokens are single-use, and so the
+// refresh token provided can no longer be used. If the refresh token provided has already
+// been used, then it's likely it has been stolen and so the entire session is revoked.
+func (auth *jwtAuthProvider) RefreshTokens(allegedRefreshToken string, client token.Client) (*http.Cookie, *http.Cookie, error) {
+	tkn, err := auth.validateJWT(allegedRefreshToken, token.Refresh)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to refresh: %w", err)
 	}
 
-	claims, ok := token.Claims.(*jwt.MapClaims)
+	claims, ok := tkn.Claims.(*jwt.MapClaims)
 	if !ok {
-		return nil, nil, fmt.Errorf("token claims invalid type %T (expected *jwt.MapClaims)", token.Claims)
+		return nil, nil, fmt.Errorf("token claims invalid type %T (expected *jwt.MapClaims)", tkn.Claims)
 	}
 	userID, err := auth.getUserIDFromClaims(*claims)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to refresh: %w", err)
 	}
+	sessionID, err := getSessionIDFromClaims(*claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to refresh: %w", err)
+	}
+	tokenID, err := getTokenIDFromClaims(*claims)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to refresh: %w", err)
+	}
+
+	newTokenID := uuid.New()
+	expiresAt := time.Now().Add(RefreshTokenLifespan)
+	rotated, err := auth.store.RotateSessionRefreshToken(*sessionID, *tokenID, newTokenID, expiresAt, client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to refresh: %w", err)
+	}
+	if !rotated {
+		session, err := auth.store.GetSession(*sessionID)
+		if err != nil || !session.IsActive() {
+			return nil, nil, fmt.Errorf("failed to refresh: %w", ErrSessionInactive)
+		}
+
+		// The refresh token was valid, but is not the current refresh token for the session. This
+		// means it has already been used, so we must assume the session has been compromised
+		log.Warnf("Refresh token for session %s of user %s was reused, revoking session\n", *sessionID, *userID)
+		if err := auth.store.RevokeSession(*sessionID); err != nil {
+			log.Errorf("Failed to revoke session %s after refresh token reuse: %v\n", *sessionID, err)
+		}
+
+		return nil, nil, fmt.Errorf("failed to refresh: %w", ErrRefreshTokenReused)
+	}
 
-	return auth.GenerateTokenCookies(*userID)
+	go func() {
+		if err := auth.store.RecordUserRefresh(*userID); err != nil {
+			log.Warnf("Failed to record user refresh for %v: %v\n", *userID, err)
+		}
+	}()
+
+	return auth.generateTokenCookies(*userID, *sessionID, newTokenID, expiresAt)
 }
 
 // getSecurityValidator returns a middleware which uses the generated OpenAPI swagger spec to
@@ -313,56 +533,148 @@ func (auth *jwtAuthProvider) validateSpecSecurity(spec *openapi3.T) {
 	}
 }
 
-// validateTokenFromAuthInput accepts an OpenAPI authentication input
-// and returns an error if we're unable to extract a valid JWT
-// from the requests cookies.
-// If we CAN extract a valid token, then said token is also
-// checked to ensure it contains the correct permissions.
+// validateTokenFromAuthInput authenticates the request using either the API key
+// in the request headers (see apiKeyFromRequest), or the auth token in the requests
+// cookies. If the request is authenticated, the user is also checked to ensure
+// they have the permissions required by the request scopes.
 func (auth *jwtAuthProvider) validateTokenFromAuthInput(ctx context.Context, authInput *openapi3filter.AuthenticationInput) error {
 	if authInput.SecuritySchemeName != PermissionAuthSecuritySchemeName {
 		return ErrUnknownSecurityScheme
 	}
 
-	tokenCookie, err := authInput.RequestValidationInput.Request.Cookie(AuthTokenCookieName)
+	var authUser *AuthenticatedUser
+	request := authInput.RequestValidationInput.Request
+	if key, ok := apiKeyFromRequest(request); ok {
+		if isSessionRequired(authInput) {
+			return ErrSessionRequired
+		}
+
+		user, err := auth.authenticateAPIKey(key)
+		if err != nil {
+			return err
+		}
+		authUser = user
+	} else {
+		user, err := auth.authenticateAuthToken(request)
+		if err != nil {
+			return err
+		}
+		authUser = user
+	}
+
+	// Users which must change their password may only access the
+	// endpoints which require no permissions until they have done so
+	if authUser.PasswordChangeRequired && len(authInput.Scopes) > 0 {
+		return ErrPasswordChangeRequired
+	}
+
+	// Likewise for users which must enrol in two-factor authentication
+	if authUser.MFAEnrolmentRequired && len(authInput.Scopes) > 0 {
+		return ErrMFAEnrolmentRequired
+	}
+
+	// Check that the permissiosn specified by the request scopes
+	// are all present inside of the users permissions
+	for _, perm := range authInput.Scopes {
+		if !slices.Contains(authUser.Permissions, perm) {
+			log.Warnf("User %s failed permissions check while accessing %s: missing permission '%s'\n", authUser.UserID, request.RequestURI, perm)
+			return ErrInsufficientPermissions
+		}
+	}
+
+	// Insert user info inside of request context to allow for
+	// endpoint handlers to extract user information
+	eCtx := middleware.GetEchoContext(ctx)
+	eCtx.Set("user", authUser)
+
+	return nil
+}
+
+// authenticateAuthToken attempts to extract a valid JWT auth token from
+// the requests cookies, returning the user the token belongs to.
+func (auth *jwtAuthProvider) authenticateAuthToken(request *http.Request) (*AuthenticatedUser, error) {
+	tokenCookie, err := request.Cookie(AuthTokenCookieName)
 	if err != nil {
-		return ErrAuthTokenMissing
+		return nil, ErrAuthTokenMissing
 	}
 
-	token, err := auth.validateJWT(tokenCookie.Value, auth.authTokenSecret)
+	tkn, err := auth.validateJWT(tokenCookie.Value, token.Auth)
 	if err != nil {
-		return fmt.Errorf("validation of auth token failed: %w", err)
+		return nil, fmt.Errorf("validation of auth token failed: %w", err)
 	}
 
-	claims, ok := token.Claims.(*jwt.MapClaims)
+	claims, ok := tkn.Claims.(*jwt.MapClaims)
 	if !ok {
-		return errors.New("failed to cast JWT claims to MapClaims")
+		return nil, errors.New("failed to cast JWT claims to MapClaims")
 	}
 
 	// Extract user information (ID and permissions) from JWT
 	userID, err := auth.getUserIDFromClaims(*claims)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// Ensure the session the token belongs to has not been revoked
+	sessionID, err := getSessionIDFromClaims(*claims)
+	if err != nil {
+		return nil, err
+	}
+	session, err := auth.store.GetSession(*sessionID)
+	if err != nil || !session.IsActive() || session.UserID != *userID {
+		return nil, ErrSessionInactive
+	}
+
+	// Ensure the permissions in the token are current, otherwise the client must
+	// refresh it's tokens so that the new tokens contain the current permissions
+	version, ok := (*claims)["permissions_version"].(float64)
+	if !ok || int(version) != session.PermissionsVersion {
+		return nil, ErrPermissionsOutdated
 	}
 
-	// Check that the permissiosn specified by the request scopes
-	// are all present inside of the users permissions
 	userPermissions, err := auth.getPermissionsFromClaims(*claims)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, perm := range authInput.Scopes {
-		if !slices.Contains(userPermissions, perm) {
-			log.Warnf("User %s failed permissions check while accessing %s: missing permission '%s'\n", userID, authInput.RequestValidationInput.Request.RequestURI, perm)
-			return ErrInsufficientPermissions
-		}
+
+	restrictions, err := getRestrictionsFromClaims(*claims)
+	if err != nil {
+		return nil, err
+	}
+
+	changeRequired, _ := (*claims)["password_change_required"].(bool)
+	enrolmentRequired, _ := (*claims)["mfa_enrolment_required"].(bool)
+	return &AuthenticatedUser{
+		UserID:                 *userID,
+		SessionID:              *sessionID,
+		PermissionsVersion:     int(version),
+		Permissions:            userPermissions,
+		PasswordChangeRequired: changeRequired,
+		MFAEnrolmentRequired:   enrolmentRequired,
+		Restrictions:           restrictions,
+	}, nil
+}
+
+// getRestrictionsFromClaims extracts the access restrictions of the user
+// from the JWT claims, returning nil if the user is unrestricted.
+func getRestrictionsFromClaims(claims jwt.MapClaims) (*user.AccessRestrictions, error) {
+	raw, ok := claims["restrictions"]
+	if !ok || raw == nil {
+		return nil, nil
 	}
 
-	// Insert user info inside of request context to allow for
-	// endpoint handlers to extract user information
-	eCtx := middleware.GetEchoContext(ctx)
-	eCtx.Set("user", &AuthenticatedUser{UserID: *userID, Permissions: userPermissions})
+	// The claims have already been decoded in to generic maps, so the simplest
+	// way to decode the restrictions is to re-encode them.
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract restrictions from JWT claims: %w", err)
+	}
 
-	return nil
+	var restrictions user.AccessRestrictions
+	if err := json.Unmarshal(encoded, &restrictions); err != nil {
+		return nil, fmt.Errorf("failed to extract restrictions from JWT claims: %w", err)
+	}
+
+	return &restrictions, nil
 }
 
 func (auth *jwtAuthProvider) getPermissionsFromClaims(claims jwt.MapClaims) ([]string, error) {
@@ -389,17 +701,17 @@ func (auth *jwtAuthProvider) getPermissionsFromClaims(claims jwt.MapClaims) ([]s
 }
 
 // validateToken ensures that the provided token is:
-//   - signed using the same secret/algorithm as we expect
+//   - signed using the algorithm we expect, by a known signing key for the type of token
 //   - contains a valid userID
 //   - not expired
-//   - not blacklisted
-func (auth *jwtAuthProvider) validateJWT(token string, secret []byte) (*jwt.Token, error) {
-	// Parse token using secret
+func (auth *jwtAuthProvider) validateJWT(tokenString string, tokenType token.Type) (*jwt.Token, error) {
+	// Parse token using the secret of the key which signed it
 	tokenClaims := &jwt.MapClaims{}
 	tkn, err := jwt.ParseWithClaims(
-		token,
+		tokenString,
 		tokenClaims,
-		func(token *jwt.Token) (interface{}, error) { return secret, nil },
+		auth.keys.keyFunc(tokenType),
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse JWT: %w", err)
@@ -415,12 +727,25 @@ func (auth *jwtAuthProvider) validateJWT(token string, secret []byte) (*jwt.Toke
 		return nil, fmt.Errorf("failed to extract userID from JWT: %w", err)
 	}
 
-	// Check we haven't revoked this token
-	if _, ok := auth.blacklistedTokens.Load(token); ok {
-		return nil, errors.New("failed to verify JWT: token has been revoked")
+	return tkn, nil
+}
+
+// generateTokenCookies generates an auth token and a refresh token (with the ID provided)
+// for the session specified, returning them as cookies.
+func (auth *jwtAuthProvider) generateTokenCookies(userID uuid.UUID, sessionID uuid.UUID, refreshTokenID uuid.UUID, refreshTokenExp time.Time) (*http.Cookie, *http.Cookie, error) {
+	authToken, authTokenExp, err := auth.generateAccessToken(userID, sessionID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return tkn, nil
+	refreshToken, err := auth.generateRefreshToken(userID, sessionID, refreshTokenID, refreshTokenExp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authTokenCookie := createTokenCookie(AuthTokenCookieName, "/", authToken, authTokenExp)
+	refreshTokenCookie := createTokenCookie(RefreshTokenCookieName, auth.refreshTokenCookiePath, refreshToken, refreshTokenExp)
+	return authTokenCookie, refreshTokenCookie, nil
 }
 
 // generateAccessToken accepts a userID and generates a short-term token
@@ -431,7 +756,15 @@ func (auth *jwtAuthProvider) validateJWT(token string, secret []byte) (*jwt.Toke
 //
 // (Shortly) before this token expires, it is expected that the client will
 // refresh their tokens using their refreshToken.
-func (auth *jwtAuthProvider) generateAccessToken(userID uuid.UUID) (string, time.Time, error) {
+func (auth *jwtAuthProvider) generateAccessToken(userID uuid.UUID, sessionID uuid.UUID) (string, time.Time, error) {
+	// NB: the session must be fetched BEFORE the user, so that a change to the permissions of the user
+	// which occurs between the two queries results in a token with an outdated permissions version (rather
+	// than a token with outdated permissions and a current version)
+	session, err := auth.store.GetSession(sessionID)
+	if err != nil {
+		return "", time.Now(), fmt.Errorf("failed to fetch session %s during auth token generation: %w", sessionID, err)
+	}
+
 	user, err := auth.store.GetUserWithID(userID)
 	if err != nil {
 		return "", time.Now(), fmt.Errorf("failed to fetch user %s during auth token generation: %w", userID, err)
@@ -439,62 +772,68 @@ func (auth *jwtAuthProvider) generateAccessToken(userID uuid.UUID) (string, time
 
 	exp := time.Now().Add(AuthTokenLifespan)
 	claims := &authTokenClaims{
-		UserID:           userID,
-		Permissions:      user.Permissions,
-		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(exp)},
+		UserID:                 userID,
+		SessionID:              sessionID,
+		Permissions:            user.Permissions,
+		PasswordChangeRequired: user.PasswordChangeRequired,
+		MFAEnrolmentRequired:   auth.requiresMFAEnrolment(user),
+		PermissionsVersion:     session.PermissionsVersion,
+		Restrictions:           accessRestrictions(user),
+		RegisteredClaims:       jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(exp)},
 	}
 
-	token, err := generateToken(claims, auth.authTokenSecret)
+	tkn, err := generateToken(claims, auth.keys.signingKey(token.Auth))
 	if err != nil {
 		return "", time.Now(), fmt.Errorf("failed to generate auth token: %w", err)
 	}
 
-	return token, exp, nil
+	return tkn, exp, nil
 }
 
-// generateRefreshToken accepts a userID and generates a long-life token
-// which can be used to generate more auth tokens by the client.
-func (auth *jwtAuthProvider) generateRefreshToken(userID uuid.UUID) (string, time.Time, error) {
-	_, err := auth.store.GetUserWithID(userID)
-	if err != nil {
-		return "", time.Now(), fmt.Errorf("failed to fetch user %s during refresh token generation: %w", userID, err)
+// requiresMFAEnrolment returns true if the user provided has not enrolled in two-factor
+// authentication, despite being required to by the MFA policy.
+func (auth *jwtAuthProvider) requiresMFAEnrolment(user *user.User) bool {
+	return !user.MFAEnabled && auth.mfaPolicy.Requires(user.Permissions)
+}
+
+// accessRestrictions returns the access restrictions of the
+// user provided, or nil if the user is unrestricted.
+func accessRestrictions(user *user.User) *user.AccessRestrictions {
+	if !user.IsRestricted() {
+		return nil
 	}
 
-	exp := time.Now().Add(RefreshTokenLifespan)
+	restrictions := user.AccessRestrictions
+	return &restrictions
+}
+
+// generateRefreshToken generates a long-life token which can be used (once) by the
+// client to generate more auth tokens for the session provided.
+func (auth *jwtAuthProvider) generateRefreshToken(userID uuid.UUID, sessionID uuid.UUID, tokenID uuid.UUID, exp time.Time) (string, error) {
 	claims := &refreshTokenClaims{
-		UserID:           userID,
-		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(exp)},
+		UserID:    userID,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID.String(),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
 	}
 
-	token, err := generateToken(claims, auth.refreshTokenSecret)
+	tkn, err := generateToken(claims, auth.keys.signingKey(token.Refresh))
 	if err != nil {
-		return "", time.Now(), fmt.Errorf("failed to generate refresh token: %w", err)
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
-	return token, exp, nil
+	return tkn, nil
 }
 
-// scheduleUserTokenCleanup will remove the specified token from the users token map
-// at the time specified. This allows for us to store any newly generated
-// user tokens inside the map without worrying about the size of the map
-// growing with no limit.
-func (auth *jwtAuthProvider) scheduleUserTokenCleanup(userID uuid.UUID, token string, expiry time.Time) {
-	until := time.Until(expiry.Add(tokenExpiryCleanupDelay))
-	log.Debugf("Scheduling cleanup of a token for user %s in %s\n", userID, until)
-
-	time.AfterFunc(until, func() {
-		log.Debugf("Cleaning up token %s for user %s as it has expired (~5 seconds ago)\n", token, userID)
-
-		// Clear from blacklist as it won't be accepted now due to expiring anyway
-		auth.blacklistedTokens.Delete(token)
-
-		// Clear from our user tokens mapping as the token will not need to be revoked now that it has expired
-		userTokens, ok := auth.userTokens.Load(userID)
-		if ok && len(userTokens) > 0 {
-			newUserTokens := slices.DeleteFunc(userTokens, func(tk string) bool { return tk == token })
-			auth.userTokens.Store(userID, newUserTokens)
-		}
-	})
+// expiredTokenCookies returns expired auth and refresh token cookies, which
+// will cause the client to discard their existing tokens.
+func (auth *jwtAuthProvider) expiredTokenCookies() (*http.Cookie, *http.Cookie) {
+	expired := time.Now().Add(time.Hour * -24)
+	expiredAuthToken := createTokenCookie(AuthTokenCookieName, "/", "", expired)
+	expiredRefreshToken := createTokenCookie(RefreshTokenCookieName, auth.refreshTokenCookiePath, "", expired)
+	return expiredAuthToken, expiredRefreshToken
 }
 
 func (auth *jwtAuthProvider) getUserIDFromClaims(claims jwt.MapClaims) (*uuid.UUID, error) {
@@ -509,9 +848,32 @@ func (auth *jwtAuthProvider) getUserIDFromClaims(claims jwt.MapClaims) (*uuid.UU
 	}
 }
 
-func (auth *jwtAuthProvider) revokeToken(token string) {
-	log.Debugf("Revoking token %s\n", token)
-	auth.blacklistedTokens.Store(token, struct{}{})
+func getSessionIDFromClaims(claims jwt.MapClaims) (*uuid.UUID, error) {
+	sessionID, ok := claims["session_id"].(string)
+	if !ok {
+		return nil, errors.New("failed to extract session ID from JWT claims: missing")
+	}
+
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract session ID from JWT claims: %w", err)
+	}
+
+	return &id, nil
+}
+
+func getTokenIDFromClaims(claims jwt.MapClaims) (*uuid.UUID, error) {
+	tokenID, ok := claims["jti"].(string)
+	if !ok {
+		return nil, errors.New("failed to extract token ID from JWT claims: missing")
+	}
+
+	id, err := uuid.Parse(tokenID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract token ID from JWT claims: %w", err)
+	}
+
+	return &id, nil
 }
 
 func createTokenCookie(name string, path string, token string, expiration time.Time) *http.Cookie {
@@ -525,10 +887,12 @@ func createTokenCookie(name string, path string, token string, expiration time.T
 	return cookie
 }
 
-func generateToken(claims jwt.Claims, secret []byte) (string, error) {
-	// Create the JWT claims, which includes the username and expiry time
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(secret)
+func generateToken(claims jwt.Claims, key *token.SigningKey) (string, error) {
+	// Create the JWT claims, which includes the username and expiry time. The ID
+	// of the signing key is included so the token can be verified after the key is rotated
+	tkn := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tkn.Header[keyIDHeader] = key.ID
+	tokenString, err := tkn.SignedString(key.Secret)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,198 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hbomb79/Thea/internal/token"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+const (
+	keyIDHeader = "kid"
+)
+
+var (
+	// signedTokenTypes are the types of token which are signed
+	// using the keyring, each of which has its own signing key.
+	signedTokenTypes = []token.Type{token.Auth, token.Refresh, token.MFAChallenge}
+
+	ErrSigningKeyUnknown  = errors.New("token was not signed by a known signing key")
+	ErrSigningKeyMismatch = errors.New("token was signed by a key for a different type of token")
+)
+
+// keyring holds the signing keys used to sign and verify JWTs, which are persisted
+// using the store so that tokens remain valid when Thea is restarted. Tokens are signed
+// using the active (most recent) key for their type, and identify the key used
+// via the 'kid' header.
+//
+// When keys are rotated, the previous keys are retired rather than removed so that
+// the tokens they signed can still be verified until they expire.
+type keyring struct {
+	sync.RWMutex
+	store  Store
+	keys   map[string]*token.SigningKey
+	active map[token.Type]*token.SigningKey
+}
+
+func newKeyring(store Store) (*keyring, error) {
+	ring := &keyring{store: store}
+	if err := ring.load(); err != nil {
+		return nil, err
+	}
+
+	for _, tokenType := range signedTokenTypes {
+		if ring.signingKey(tokenType) != nil {
+			continue
+		}
+
+		log.Emit(logger.NEW, "No %s token signing key found, generating new key\n", tokenType)
+		if err := ring.rotate(tokenType); err != nil {
+			return nil, err
+		}
+	}
+
+	return ring, nil
+}
+
+// signingKey returns the key which should be used to sign
+// new tokens of the type provided.
+func (ring *keyring) signingKey(tokenType token.Type) *token.SigningKey {
+	ring.RLock()
+	defer ring.RUnlock()
+
+	return ring.active[tokenType]
+}
+
+// allKeys returns all the keys in this keyring, with the
+// most recently created first.
+func (ring *keyring) allKeys() []*token.SigningKey {
+	ring.RLock()
+	defer ring.RUnlock()
+
+	keys := make([]*token.SigningKey, 0, len(ring.keys))
+	for _, key := range ring.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys
+}
+
+// keyFunc returns a jwt.Keyfunc which finds the secret for the key identified by
+// the 'kid' header of a token. The key must be for the type of token provided, and
+// if the key is retired, it must have been retired recently enough that the tokens
+// it signed may not have expired yet.
+func (ring *keyring) keyFunc(tokenType token.Type) jwt.Keyfunc {
+	return func(tkn *jwt.Token) (interface{}, error) {
+		keyID, ok := tkn.Header[keyIDHeader].(string)
+		if !ok {
+			return nil, ErrSigningKeyUnknown
+		}
+
+		ring.RLock()
+		key, ok := ring.keys[keyID]
+		ring.RUnlock()
+		if !ok {
+			return nil, ErrSigningKeyUnknown
+		}
+
+		if key.TokenType != tokenType {
+			return nil, ErrSigningKeyMismatch
+		}
+		if key.RetiredAt != nil && time.Since(*key.RetiredAt) > tokenLifespan(tokenType) {
+			return nil, fmt.Errorf("%w: key %s has been retired", ErrSigningKeyUnknown, key.ID)
+		}
+
+		return key.Secret, nil
+	}
+}
+
+// rotate generates a new signing key for the type of token provided, retiring
+// the existing key.
+func (ring *keyring) rotate(tokenType token.Type) error {
+	key, err := token.NewSigningKey(tokenType)
+	if err != nil {
+		return err
+	}
+
+	if err := ring.store.SaveSigningKey(key); err != nil {
+		return err
+	}
+
+	log.Emit(logger.SUCCESS, "Rotated %s token signing key, new key ID %s\n", tokenType, key.ID)
+	return ring.load()
+}
+
+// prune removes the retired keys which can no longer be used to
+// verify tokens, as all the tokens they signed have expired.
+func (ring *keyring) prune() error {
+	for _, tokenType := range signedTokenTypes {
+		before := time.Now().Add(-tokenLifespan(tokenType) - tokenExpiryCleanupDelay)
+		if err := ring.store.DeleteSigningKeysRetiredBefore(tokenType, before); err != nil {
+			return err
+		}
+	}
+
+	return ring.load()
+}
+
+// maintain prunes the retired keys of this keyring, and rotates the active keys
+// if they are older than the rotation interval provided. A rotation interval of
+// zero disables rotation.
+func (ring *keyring) maintain(rotationInterval time.Duration) {
+	if err := ring.prune(); err != nil {
+		log.Errorf("Failed to prune retired signing keys: %v\n", err)
+	}
+
+	if rotationInterval <= 0 {
+		return
+	}
+
+	for _, tokenType := range signedTokenTypes {
+		if key := ring.signingKey(tokenType); key != nil && time.Since(key.CreatedAt) < rotationInterval {
+			continue
+		}
+
+		if err := ring.rotate(tokenType); err != nil {
+			log.Errorf("Scheduled rotation of %s token signing key failed: %v\n", tokenType, err)
+		}
+	}
+}
+
+// load replaces the keys in this keyring with those from the store.
+func (ring *keyring) load() error {
+	keys, err := ring.store.ListSigningKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	ring.Lock()
+	defer ring.Unlock()
+
+	ring.keys = make(map[string]*token.SigningKey, len(keys))
+	ring.active = make(map[token.Type]*token.SigningKey)
+	for _, key := range keys {
+		ring.keys[key.ID] = key
+		if existing, ok := ring.active[key.TokenType]; key.RetiredAt == nil && (!ok || key.CreatedAt.After(existing.CreatedAt)) {
+			ring.active[key.TokenType] = key
+		}
+	}
+
+	return nil
+}
+
+func tokenLifespan(tokenType token.Type) time.Duration {
+	switch tokenType {
+	case token.Refresh:
+		return RefreshTokenLifespan
+	case token.MFAChallenge:
+		return MFAChallengeLifespan
+	default:
+		return AuthTokenLifespan
+	}
+}
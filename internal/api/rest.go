@@ -2,25 +2,34 @@ package api
 
 import (
 	"context"
-	"crypto/rand"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/hbomb79/Thea/internal/api/controllers/auditlog"
 	"github.com/hbomb79/Thea/internal/api/controllers/auth"
+	"github.com/hbomb79/Thea/internal/api/controllers/downloads"
+	"github.com/hbomb79/Thea/internal/api/controllers/images"
 	"github.com/hbomb79/Thea/internal/api/controllers/ingests"
 	"github.com/hbomb79/Thea/internal/api/controllers/medias"
+	"github.com/hbomb79/Thea/internal/api/controllers/reconciliation"
+	"github.com/hbomb79/Thea/internal/api/controllers/roles"
 	"github.com/hbomb79/Thea/internal/api/controllers/targets"
 	"github.com/hbomb79/Thea/internal/api/controllers/transcodes"
+	"github.com/hbomb79/Thea/internal/api/controllers/uploads"
 	"github.com/hbomb79/Thea/internal/api/controllers/users"
 	"github.com/hbomb79/Thea/internal/api/controllers/workflows"
 	"github.com/hbomb79/Thea/internal/api/gen"
 	"github.com/hbomb79/Thea/internal/api/jwt"
+	"github.com/hbomb79/Thea/internal/http/oidc"
 	"github.com/hbomb79/Thea/internal/http/websocket"
+	"github.com/hbomb79/Thea/internal/user"
 	"github.com/hbomb79/Thea/pkg/logger"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -38,6 +47,30 @@ var (
 type (
 	RestConfig struct {
 		HostAddr string `toml:"host_address" env:"API_HOST_ADDR" env-default:"0.0.0.0:8080"`
+
+		// The addresses (or CIDR ranges) of the reverse proxies in front of Thea. The client IP
+		// address is only taken from the X-Forwarded-For header of requests sent by these proxies;
+		// otherwise, the address of the connection is used. The client IP address is used to throttle
+		// logins, and is recorded against sessions and audit entries, so must not be spoofable.
+		TrustedProxies []string `toml:"trusted_proxies" env:"API_TRUSTED_PROXIES"`
+
+		// The number of days after which the keys used to sign auth and refresh tokens
+		// are automatically rotated. Tokens signed by the previous keys remain valid until
+		// they expire. A value of zero disables automatic rotation.
+		SigningKeyRotationDays int `toml:"signing_key_rotation_days" env:"API_SIGNING_KEY_ROTATION_DAYS" env-default:"30"`
+
+		// The requirements that passwords must satisfy when users are
+		// created, or when the password of a user is changed.
+		PasswordPolicy user.PasswordPolicy `toml:"password_policy"`
+
+		// The protections against brute-force attacks against the passwords of users
+		LoginPolicy user.LoginPolicy `toml:"login_policy"`
+
+		// Determines which users are required to enrol in two-factor authentication
+		MFAPolicy user.MFAPolicy `toml:"mfa_policy"`
+
+		// Allows users to login via an external OpenID Connect identity provider
+		OIDC oidc.Config `toml:"oidc"`
 	}
 
 	Controller interface {
@@ -53,7 +86,9 @@ type (
 		medias.Store
 		auth.Store
 		users.Store
+		roles.Store
 		jwt.Store
+		auditStore
 	}
 
 	TranscodeService interface {
@@ -61,6 +96,26 @@ type (
 		transcodes.TranscodeService
 	}
 
+	RefreshService interface {
+		medias.RefreshService
+	}
+
+	CompletenessService interface {
+		medias.CompletenessService
+	}
+
+	ReconcileService interface {
+		reconciliation.ReconcileService
+	}
+
+	UploadService interface {
+		uploads.UploadService
+	}
+
+	DownloadService interface {
+		downloads.DownloadService
+	}
+
 	// strictServerImpl offers an implementation of the generated
 	// StrictServerInterface (generated by OpenAPI), which is
 	// a union of all the methods exposed by the controllers.
@@ -68,10 +123,17 @@ type (
 		*ingests.IngestsController
 		*auth.AuthController
 		*users.UserController
+		*roles.RoleController
 		*medias.MediaController
 		*transcodes.TranscodesController
 		*targets.TargetController
 		*workflows.WorkflowController
+		*images.ImageController
+		*reconciliation.ReconciliationController
+		*uploads.UploadsController
+		*downloads.DownloadsController
+		*auditlog.AuditLogController
+		*broadcaster
 	}
 
 	// The RestGateway is a thin-wrapper around the Echo HTTP router. It's sole responsbility
@@ -79,9 +141,14 @@ type (
 	// and to enforce authc + authz middleware where applicable.
 	RestGateway struct {
 		*broadcaster
-		config *RestConfig
-		ec     *echo.Echo
-		socket *websocket.SocketHub
+		config       *RestConfig
+		ec           *echo.Echo
+		socket       *websocket.SocketHub
+		authProvider authRunner
+	}
+
+	authRunner interface {
+		Run(ctx context.Context, rotationInterval time.Duration)
 	}
 )
 
@@ -92,18 +159,30 @@ func NewRestGateway(
 	config *RestConfig,
 	ingestService ingests.IngestService,
 	transcodeService TranscodeService,
+	refreshService RefreshService,
+	completenessService CompletenessService,
+	reconcileService ReconcileService,
+	uploadService UploadService,
+	downloadService DownloadService,
+	auditService AuditService,
+	imageCache images.ImageCache,
 	store Store,
 ) *RestGateway {
 	// -- Setup JWT auth provider --
 	apiBasePath := "/api/thea/v1"
-	authKey, refreshKey, err := newJwtSigningKeys()
+	authProvider, err := jwt.NewJwtAuth(store, fmt.Sprintf("%s/auth/", apiBasePath), config.MFAPolicy)
+	if err != nil {
+		panic(err)
+	}
+
+	ipExtractor, err := newIPExtractor(config.TrustedProxies)
 	if err != nil {
 		panic(err)
 	}
-	authProvider := jwt.NewJwtAuth(store, fmt.Sprintf("%s/auth/", apiBasePath), authKey, refreshKey)
 
 	// -- Setup Middleware --
 	ec := echo.New()
+	ec.IPExtractor = ipExtractor
 	ec.OnAddRouteHandler = func(_ string, route echo.Route, _ echo.HandlerFunc, _ []echo.MiddlewareFunc) {
 		log.Emit(logger.DEBUG, "Registered new route %s %s\n", route.Method, route.Path)
 	}
@@ -126,21 +205,33 @@ func NewRestGateway(
 	// -- Setup gateway --
 	socket := websocket.New()
 	gateway := &RestGateway{
-		broadcaster: newBroadcaster(socket, ingestService, transcodeService, store),
-		config:      config,
-		ec:          ec,
-		socket:      socket,
+		broadcaster:  newBroadcaster(socket, ingestService, transcodeService, downloadService, store, authProvider),
+		config:       config,
+		ec:           ec,
+		socket:       socket,
+		authProvider: authProvider,
 	}
 
 	serverImpl := gen.NewStrictHandler(&strictServerImpl{
 		ingests.New(ingestService),
-		auth.New(authProvider, store),
-		users.NewController(store),
-		medias.New(transcodeService, store),
+		auth.New(authProvider, store, config.PasswordPolicy, config.LoginPolicy, config.MFAPolicy, oidc.NewProvider(config.OIDC)),
+		users.NewController(store, authProvider, config.PasswordPolicy),
+		roles.New(store, authProvider),
+		medias.New(transcodeService, refreshService, completenessService, store, authProvider),
 		transcodes.New(transcodeService, store),
 		targets.New(store),
 		workflows.New(store),
-	}, []gen.StrictMiddlewareFunc{requestBodyValidatorMiddleware})
+		images.New(imageCache),
+		reconciliation.New(reconcileService),
+		uploads.New(uploadService, authProvider),
+		downloads.New(downloadService),
+		auditlog.New(auditService),
+		gateway.broadcaster,
+	}, []gen.StrictMiddlewareFunc{
+		// Requests rejected by validation are not audited (see newAuditMiddleware)
+		newAuditMiddleware(auditService, store, authProvider),
+		requestBodyValidatorMiddleware,
+	})
 
 	gen.RegisterHandlersWithBaseURL(ec, serverImpl, apiBasePath)
 	return gateway
@@ -173,6 +264,13 @@ func (gateway *RestGateway) Run(parentCtx context.Context) error {
 		gateway.socket.Start(ctx)
 	}()
 
+	// Start maintenance of sessions and JWT signing keys
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		gateway.authProvider.Run(ctx, gateway.config.SigningKeyRotationInterval())
+	}()
+
 	wg.Wait()
 
 	// Return cancellation cause if any, otherwise nil as parent context
@@ -184,18 +282,36 @@ func (gateway *RestGateway) Run(parentCtx context.Context) error {
 	return nil
 }
 
-const jwtSecretLength = 64 // 512 bits
-func newJwtSigningKeys() ([]byte, []byte, error) {
-	authSecret, err := randomSecret(jwtSecretLength)
-	if err != nil {
-		return nil, nil, err
+// newIPExtractor returns the extractor used to determine the IP address of clients. Without any
+// trusted proxies, the address of the connection is used, as headers (e.g. X-Forwarded-For) can be
+// forged by clients. Otherwise, the X-Forwarded-For header is trusted only for requests from the proxies.
+func newIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
 	}
-	refreshSecret, err := randomSecret(jwtSecretLength)
-	if err != nil {
-		return nil, nil, err
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy '%s' is not a valid IP address or CIDR range: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
 	}
 
-	return authSecret, refreshSecret, nil
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+func (config *RestConfig) SigningKeyRotationInterval() time.Duration {
+	return time.Duration(config.SigningKeyRotationDays) * time.Hour * 24
 }
 
 // Middleware to run Echo validator (see newValidator) against all incoming requests.
@@ -228,16 +344,3 @@ func newValidator() *validator.Validate {
 
 	return validate
 }
-
-// randomSecret generates a random byte slice of the
-// requested length. This is used to create cryptographically
-// secure random byte arrays for use with JWT signing.
-func randomSecret(length uint32) ([]byte, error) {
-	secret := make([]byte, length)
-	_, err := rand.Read(secret)
-	if err != nil {
-		return nil, err
-	}
-
-	return secret, nil
-}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewIPExtractor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		expected       string
+	}{
+		{"no proxies ignores header", nil, "203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"no proxies ignores header from private address", nil, "10.0.0.2:1234", "198.51.100.1", "10.0.0.2"},
+		{"trusted proxy", []string{"10.0.0.2"}, "10.0.0.2:1234", "198.51.100.1", "198.51.100.1"},
+		{"trusted proxy range", []string{"10.0.0.0/8"}, "10.1.2.3:1234", "198.51.100.1", "198.51.100.1"},
+		{"untrusted proxy", []string{"10.0.0.2"}, "10.0.0.3:1234", "198.51.100.1", "10.0.0.3"},
+		{"forged hops before trusted proxy", []string{"10.0.0.2"}, "10.0.0.2:1234", "192.0.2.9, 198.51.100.1", "198.51.100.1"},
+		{"trusted IPv6 proxy", []string{"2001:db8::1"}, "[2001:db8::1]:1234", "198.51.100.1", "198.51.100.1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			extractor, err := newIPExtractor(test.trustedProxies)
+			if err != nil {
+				t.Fatalf("failed to create IP extractor: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			req.Header.Set("X-Forwarded-For", test.forwardedFor)
+			req.Header.Set("X-Real-IP", test.forwardedFor)
+			if got := extractor(req); got != test.expected {
+				t.Errorf("expected client IP %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestNewIPExtractor_InvalidProxy(t *testing.T) {
+	for _, proxy := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := newIPExtractor([]string{proxy}); err == nil {
+			t.Errorf("expected trusted proxy %q to be rejected", proxy)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package util
 
+import "slices"
+
 func ApplyConversion[T any, K any](models []T, converter func(T) K) []K {
 	dtos := make([]K, len(models))
 	for k, v := range models {
@@ -8,3 +10,15 @@ func ApplyConversion[T any, K any](models []T, converter func(T) K) []K {
 
 	return dtos
 }
+
+// MissingPermission returns the first of the requested permissions which is not
+// present in the held permissions, and false if all requested permissions are held.
+func MissingPermission(held []string, requested []string) (string, bool) {
+	for _, perm := range requested {
+		if !slices.Contains(held, perm) {
+			return perm, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,387 @@
+package artwork
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png" // Register PNG decoder for sidecar/TMDB artwork
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hbomb79/Thea/pkg/logger"
+	"golang.org/x/image/draw"
+)
+
+const (
+	// maxImageSize is the largest image (in bytes) which will be
+	// accepted in to the cache.
+	maxImageSize = 20 * 1024 * 1024
+
+	resizedImageQuality = 85
+	httpRequestTimeout  = time.Second * 30
+	sniffLength         = 512
+)
+
+var (
+	log = logger.Get("Artwork")
+
+	// StandardWidths contains the widths which images can be resized to. Requests
+	// for a width which is not in this list are rounded up to the next standard width,
+	// to avoid the cache filling with many slightly different variants of the same image.
+	StandardWidths = []int{92, 154, 185, 342, 500, 780, 1280}
+
+	// SidecarFilenames are the names of the local image files which are
+	// used as artwork if TMDB is unable to provide any.
+	SidecarFilenames = []string{"poster.jpg", "folder.jpg"}
+
+	ErrImageNotFound = errors.New("image not found")
+	ErrInvalidImage  = errors.New("image content is not a supported image format")
+
+	imageIDMatcher = regexp.MustCompile(`^[a-f0-9]{64}$`)
+)
+
+type (
+	// Cache is a content-addressed store of images. Each image is identified by the
+	// SHA-256 hash of it's content, meaning that identical artwork (e.g. the same poster
+	// used by multiple seasons) is only stored once.
+	//
+	// Resized variants of the images are generated on-demand, and stored alongside the original.
+	Cache struct {
+		dir        string
+		httpClient *http.Client
+
+		// resizeLock ensures that concurrent requests for the same variant do not
+		// race to generate it.
+		resizeLock sync.Mutex
+	}
+
+	// Importer is the interface used to import images in to a cache.
+	Importer interface {
+		ImportFromURL(url string) (string, error)
+		ImportFromFile(path string) (string, error)
+	}
+
+	// Image represents an image (or a resized variant of an image) which
+	// is available in the cache.
+	Image struct {
+		ID          string
+		Width       int
+		ContentType string
+		Path        string
+		ModTime     time.Time
+		Size        int64
+	}
+)
+
+// NewCache creates a new image cache which stores images
+// inside of the directory provided, creating the directory if it's missing.
+func NewCache(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create image cache directory '%s': %w", dir, err)
+	}
+
+	return &Cache{dir: dir, httpClient: &http.Client{Timeout: httpRequestTimeout}}, nil
+}
+
+// ImportFromURL downloads the image at the URL provided and stores it in the cache,
+// returning the ID of the image. The URL of each downloaded image is recorded, so that
+// subsequent imports of the same URL are served from the cache without downloading it again.
+func (cache *Cache) ImportFromURL(url string) (string, error) {
+	urlPath := cache.pathForURL(url)
+	if imageID, err := os.ReadFile(urlPath); err == nil && imageIDMatcher.Match(imageID) {
+		if _, err := os.Stat(cache.pathForID(string(imageID))); err == nil {
+			log.Debugf("Image at %s already exists in cache as %s\n", url, imageID)
+			return string(imageID), nil
+		}
+	}
+
+	resp, err := cache.httpClient.Get(url) //nolint
+	if err != nil {
+		return "", fmt.Errorf("failed to download image from %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download image from %s: unexpected status code %d", url, resp.StatusCode)
+	}
+
+	imageID, err := cache.importImage(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// Failure to record the URL only means the image will be downloaded again if re-imported
+	if err := os.MkdirAll(filepath.Dir(urlPath), os.ModeDir|os.ModePerm); err != nil {
+		log.Warnf("Failed to record URL of image %s: %v\n", imageID, err)
+	} else if err := os.WriteFile(urlPath, []byte(imageID), 0o600); err != nil {
+		log.Warnf("Failed to record URL of image %s: %v\n", imageID, err)
+	}
+
+	return imageID, nil
+}
+
+// ImportFromFile copies the image at the path provided in to the cache,
+// returning the ID of the image.
+func (cache *Cache) ImportFromFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open image %s: %w", path, err)
+	}
+	defer file.Close()
+
+	return cache.importImage(file)
+}
+
+// FindSidecar searches the directories provided (in order) for a sidecar image (such
+// as poster.jpg or folder.jpg), returning the path of the first one found. An empty
+// string is returned if no sidecar images exist.
+func FindSidecar(dirs ...string) string {
+	for _, dir := range dirs {
+		for _, name := range SidecarFilenames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+
+	return ""
+}
+
+// Import imports the image at the URL provided in to the cache, returning the ID of
+// the cached image. If the URL is empty (or the download fails), the sidecar directories
+// provided are searched for local artwork (e.g. poster.jpg) instead.
+// Failure to import artwork is not considered fatal, and so nil is returned in this case.
+func Import(importer Importer, url string, sidecarDirs ...string) *string {
+	if url != "" {
+		if imageID, err := importer.ImportFromURL(url); err == nil {
+			return &imageID
+		} else {
+			log.Warnf("Failed to download artwork from %s: %v\n", url, err)
+		}
+	}
+
+	if sidecar := FindSidecar(sidecarDirs...); sidecar != "" {
+		if imageID, err := importer.ImportFromFile(sidecar); err == nil {
+			return &imageID
+		} else {
+			log.Warnf("Failed to import sidecar artwork %s: %v\n", sidecar, err)
+		}
+	}
+
+	return nil
+}
+
+// Get returns the image with the given ID, resized to the width provided. The width is rounded
+// up to the nearest standard width, and a width of zero (or a width larger than the original image)
+// returns the original image. The resized variant is generated if it does not already exist.
+func (cache *Cache) Get(imageID string, width int) (*Image, error) {
+	if !imageIDMatcher.MatchString(imageID) {
+		return nil, ErrImageNotFound
+	}
+
+	originalPath := cache.pathForID(imageID)
+	original, err := cache.stat(imageID, 0, originalPath)
+	if err != nil {
+		return nil, err
+	}
+
+	width = standardWidth(width)
+	if width == 0 {
+		return original, nil
+	}
+
+	variantPath := fmt.Sprintf("%s_w%d", originalPath, width)
+	if variant, err := cache.stat(imageID, width, variantPath); err == nil {
+		return variant, nil
+	}
+
+	cache.resizeLock.Lock()
+	defer cache.resizeLock.Unlock()
+
+	// Another request may have generated this variant while we waited for the lock
+	if variant, err := cache.stat(imageID, width, variantPath); err == nil {
+		return variant, nil
+	}
+
+	resized, err := resizeImage(originalPath, variantPath, width)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resize image %s to width %d: %w", imageID, width, err)
+	} else if !resized {
+		// Image is already smaller than the requested width
+		return original, nil
+	}
+
+	return cache.stat(imageID, width, variantPath)
+}
+
+// importImage reads the image content from the reader provided and stores it in the
+// cache, using the hash of the content as it's ID. Content which does not decode
+// as a supported image is rejected.
+func (cache *Cache) importImage(reader io.Reader) (string, error) {
+	tmp, err := os.CreateTemp(cache.dir, "import-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file for image import: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hasher), io.LimitReader(reader, maxImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image content: %w", err)
+	} else if written > maxImageSize {
+		return "", fmt.Errorf("image exceeds maximum size of %d bytes", maxImageSize)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to validate image content: %w", err)
+	}
+	if _, _, err := image.DecodeConfig(tmp); err != nil {
+		return "", ErrInvalidImage
+	}
+
+	imageID := hex.EncodeToString(hasher.Sum(nil))
+	path := cache.pathForID(imageID)
+	if _, err := os.Stat(path); err == nil {
+		log.Debugf("Image %s already exists in cache\n", imageID)
+		return imageID, nil
+	}
+
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write image content: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModeDir|os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create image cache directory: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to move image in to cache: %w", err)
+	}
+
+	log.Emit(logger.DEBUG, "Imported new image %s in to cache\n", imageID)
+	return imageID, nil
+}
+
+// stat returns the Image for the file at the path provided, or ErrImageNotFound
+// if the file does not exist.
+func (cache *Cache) stat(imageID string, width int, path string) (*Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrImageNotFound
+		}
+
+		return nil, fmt.Errorf("failed to open image %s: %w", imageID, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat image %s: %w", imageID, err)
+	}
+
+	sniff := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("failed to read image %s: %w", imageID, err)
+	}
+
+	return &Image{
+		ID:          imageID,
+		Width:       width,
+		ContentType: http.DetectContentType(sniff[:n]),
+		Path:        path,
+		ModTime:     info.ModTime(),
+		Size:        info.Size(),
+	}, nil
+}
+
+// pathForID returns the path for the original image with the given ID. Images are
+// sharded in to sub-directories using the first two characters of their ID to avoid
+// a single directory containing an excessive number of files.
+func (cache *Cache) pathForID(imageID string) string {
+	return filepath.Join(cache.dir, imageID[:2], imageID)
+}
+
+// pathForURL returns the path of the file which records the ID of the image
+// downloaded from the URL provided. The files are named using the hash of the URL, and
+// sharded in the same way as the images themselves.
+func (cache *Cache) pathForURL(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	urlHash := hex.EncodeToString(hash[:])
+	return filepath.Join(cache.dir, "urls", urlHash[:2], urlHash)
+}
+
+// ETag returns the entity tag for this image. As images are content-addressed, the
+// ID and width of the image uniquely identify the content.
+func (img *Image) ETag() string {
+	return fmt.Sprintf(`"%s-w%d"`, img.ID, img.Width)
+}
+
+// resizeImage decodes the image at the source path, and writes a JPEG encoded
+// copy of it (scaled to the width provided, maintaining aspect ratio) to the destination
+// path. If the source image is not wider than the width provided, no resize is
+// performed and false is returned.
+func resizeImage(sourcePath string, destPath string, width int) (bool, error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return false, err
+	}
+	defer source.Close()
+
+	src, _, err := image.Decode(source)
+	if err != nil {
+		return false, err
+	}
+
+	bounds := src.Bounds()
+	if bounds.Dx() <= width {
+		return false, nil
+	}
+
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+
+	tmpPath := destPath + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return false, err
+	}
+	if err := jpeg.Encode(out, dst, &jpeg.Options{Quality: resizedImageQuality}); err != nil {
+		out.Close()
+		_ = os.Remove(tmpPath)
+		return false, err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return false, err
+	}
+
+	return true, os.Rename(tmpPath, destPath)
+}
+
+// standardWidth rounds the width provided up to the nearest standard width. If the
+// width is zero, or exceeds the largest standard width, zero is returned to
+// indicate the original image should be used.
+func standardWidth(width int) int {
+	if width <= 0 {
+		return 0
+	}
+
+	idx := sort.SearchInts(StandardWidths, width)
+	if idx >= len(StandardWidths) {
+		return 0
+	}
+
+	return StandardWidths[idx]
+}
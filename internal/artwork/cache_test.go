@@ -0,0 +1,55 @@
+package artwork
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestImportFromURL_ReusesPreviousDownload(t *testing.T) {
+	var content bytes.Buffer
+	if err := png.Encode(&content, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = w.Write(content.Bytes())
+	}))
+	defer server.Close()
+
+	cache, err := NewCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := cache.ImportFromURL(server.URL + "/poster.png")
+	if err != nil {
+		t.Fatalf("failed to import image: %v", err)
+	}
+	second, err := cache.ImportFromURL(server.URL + "/poster.png")
+	if err != nil {
+		t.Fatalf("failed to re-import image: %v", err)
+	}
+
+	if first != second {
+		t.Errorf("expected re-import to return image %s, got %s", first, second)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected image to be downloaded once, got %d requests", n)
+	}
+
+	// A different URL must be downloaded, even if the content turns out to be identical
+	third, err := cache.ImportFromURL(server.URL + "/backdrop.png")
+	if err != nil {
+		t.Fatalf("failed to import image: %v", err)
+	}
+	if third != first || requests.Load() != 2 {
+		t.Errorf("expected new URL to be downloaded and deduplicated by content")
+	}
+}
@@ -0,0 +1,15 @@
+package audit
+
+import "time"
+
+// Config contains configuration options that allow
+// customization of how long audit entries are kept for.
+type Config struct {
+	// Audit entries older than this many days are deleted. A
+	// value of zero keeps audit entries indefinitely.
+	RetentionDays int `toml:"retention_days" env:"AUDIT_RETENTION_DAYS" env-default:"365"`
+}
+
+func (config *Config) RetentionDuration() time.Duration {
+	return time.Duration(config.RetentionDays) * 24 * time.Hour
+}
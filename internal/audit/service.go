@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+var log = logger.Get("AuditServ")
+
+const retentionCheckInterval = time.Hour
+
+type (
+	DataStore interface {
+		RecordAuditEntry(entry *Entry) error
+		ListAuditEntries(filter Filter) ([]*Entry, error)
+		DeleteAuditEntriesBefore(before time.Time) (int64, error)
+	}
+
+	// auditService records the audit entries of actions performed via the API, and
+	// periodically removes entries which are older than the configured retention period.
+	auditService struct {
+		config Config
+		store  DataStore
+	}
+)
+
+func New(config Config, store DataStore) *auditService {
+	return &auditService{config: config, store: store}
+}
+
+// Run periodically removes expired audit entries until the context provided is cancelled.
+func (service *auditService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(retentionCheckInterval)
+	defer ticker.Stop()
+
+	service.removeExpiredEntries()
+	for {
+		select {
+		case <-ticker.C:
+			service.removeExpiredEntries()
+		case <-ctx.Done():
+			log.Emit(logger.STOP, "Audit service closed\n")
+			return nil
+		}
+	}
+}
+
+// Record assigns an ID to the entry provided, and computes the changes between
+// it's before and after snapshots, before persisting the entry.
+func (service *auditService) Record(entry *Entry) error {
+	entry.ID = uuid.New()
+	entry.Changes = diff(entry.Before.Get(), entry.After.Get())
+	return service.store.RecordAuditEntry(entry)
+}
+
+func (service *auditService) ListEntries(filter Filter) ([]*Entry, error) {
+	return service.store.ListAuditEntries(filter)
+}
+
+func (service *auditService) removeExpiredEntries() {
+	if service.config.RetentionDays <= 0 {
+		return
+	}
+
+	removed, err := service.store.DeleteAuditEntriesBefore(time.Now().Add(-service.config.RetentionDuration()))
+	if err != nil {
+		log.Errorf("Failed to remove expired audit entries: %v\n", err)
+		return
+	}
+
+	if removed > 0 {
+		log.Emit(logger.REMOVE, "Removed %d audit entries older than %d days\n", removed, service.config.RetentionDays)
+	}
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeys are the (lowercased) suffixes of the keys whose values must never be written
+// to the audit log, such as passwords and TOTP codes. Suffixes are used so that keys such as
+// 'password_change_required' are not redacted.
+var sensitiveKeys = []string{"password", "secret", "token", "code", "codes", "salt", "hash"}
+
+// Snapshot returns a JSON representation of the value provided, with the values of any
+// sensitive keys redacted. Nil is returned if the value is nil, or is not representable
+// as a JSON object.
+func Snapshot(value any) database.JSONColumn[map[string]any] {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Pointer && reflect.ValueOf(value).IsNil()) {
+		return database.NewJSONColumn[map[string]any](nil)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return database.NewJSONColumn[map[string]any](nil)
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(encoded, &decoded); err != nil || decoded == nil {
+		return database.NewJSONColumn[map[string]any](nil)
+	}
+
+	redact(decoded)
+	return database.NewJSONColumn(&decoded)
+}
+
+// redact recursively replaces the values of any sensitive keys in the value provided.
+func redact(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if isSensitiveKey(key) {
+				v[key] = redactedValue
+				continue
+			}
+
+			redact(child)
+		}
+	case []any:
+		for _, child := range v {
+			redact(child)
+		}
+	}
+}
+
+func isSensitiveKey(key string) bool {
+	normalized := strings.ToLower(strings.ReplaceAll(key, "_", ""))
+	for _, sensitive := range sensitiveKeys {
+		if strings.HasSuffix(normalized, sensitive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diff returns the top-level fields which differ between the snapshots
+// provided, mapped to their before and after values. Nil is returned
+// unless both snapshots are present.
+func diff(before *map[string]any, after *map[string]any) database.JSONColumn[map[string]any] {
+	if before == nil || after == nil {
+		return database.NewJSONColumn[map[string]any](nil)
+	}
+
+	changes := make(map[string]any)
+	for key, beforeValue := range *before {
+		if afterValue, ok := (*after)[key]; !ok || !reflect.DeepEqual(beforeValue, afterValue) {
+			changes[key] = map[string]any{"before": beforeValue, "after": afterValue}
+		}
+	}
+	for key, afterValue := range *after {
+		if _, ok := (*before)[key]; !ok {
+			changes[key] = map[string]any{"before": nil, "after": afterValue}
+		}
+	}
+
+	return database.NewJSONColumn(&changes)
+}
@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const secretValue = "hunter2"
+
+func TestSnapshot_RedactsSensitiveValues(t *testing.T) {
+	type nested struct {
+		APIToken string `json:"api_token"`
+		Label    string `json:"label"`
+	}
+
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"password", map[string]any{"password": secretValue}},
+		{"new password", map[string]any{"new_password": secretValue}},
+		{"camel case password", map[string]any{"newPassword": secretValue}},
+		{"token", map[string]any{"refresh_token": secretValue}},
+		{"secret", map[string]any{"client_secret": secretValue}},
+		{"code", map[string]any{"code": secretValue}},
+		{"recovery codes", map[string]any{"recovery_codes": []string{secretValue}}},
+		{"salt", map[string]any{"salt": secretValue}},
+		{"hash", map[string]any{"content_hash": secretValue}},
+		{"upper case key", map[string]any{"PASSWORD": secretValue}},
+		{"nested object", map[string]any{"key": nested{APIToken: secretValue, Label: "label"}}},
+		{"object in array", map[string]any{"keys": []nested{{APIToken: secretValue}}}},
+		{"pointer to struct", &struct {
+			Password *string `json:"password"`
+		}{Password: ptr(secretValue)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := Snapshot(test.value)
+			if snapshot.Get() == nil {
+				t.Fatalf("expected snapshot, got nil")
+			}
+
+			// The value written to the database must not contain the secret anywhere
+			stored, err := snapshot.Value()
+			if err != nil {
+				t.Fatalf("failed to encode snapshot: %v", err)
+			}
+			if strings.Contains(stored.(string), secretValue) {
+				t.Errorf("stored snapshot %s contains secret value", stored)
+			}
+			if !strings.Contains(stored.(string), redactedValue) {
+				t.Errorf("stored snapshot %s does not contain redacted marker", stored)
+			}
+		})
+	}
+}
+
+func TestSnapshot_RetainsNonSensitiveValues(t *testing.T) {
+	snapshot := Snapshot(map[string]any{
+		"username":                 "alice",
+		"password_change_required": true,
+		"permissions":              []string{"media:access"},
+	})
+
+	expected := map[string]any{
+		"username":                 "alice",
+		"password_change_required": true,
+		"permissions":              []any{"media:access"},
+	}
+	if got := *snapshot.Get(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestSnapshot_NonObjectValues(t *testing.T) {
+	var nilPointer *struct{}
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"nil", nil},
+		{"nil pointer", nilPointer},
+		{"string", "value"},
+		{"array", []string{"value"}},
+		{"unmarshalable", map[string]any{"fn": func() {}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := Snapshot(test.value)
+			if snapshot.Get() != nil {
+				t.Errorf("expected nil snapshot, got %v", *snapshot.Get())
+			}
+
+			if stored, err := snapshot.Value(); err != nil || stored != nil {
+				t.Errorf("expected NULL to be stored, got %v (err %v)", stored, err)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   map[string]any
+		after    map[string]any
+		expected string
+	}{
+		{
+			name:     "no changes",
+			before:   map[string]any{"label": "a"},
+			after:    map[string]any{"label": "a"},
+			expected: `{}`,
+		},
+		{
+			name:     "changed value",
+			before:   map[string]any{"label": "a", "enabled": true},
+			after:    map[string]any{"label": "b", "enabled": true},
+			expected: `{"label":{"after":"b","before":"a"}}`,
+		},
+		{
+			name:     "added and removed keys",
+			before:   map[string]any{"removed": 1.0},
+			after:    map[string]any{"added": 2.0},
+			expected: `{"added":{"after":2,"before":null},"removed":{"after":null,"before":1}}`,
+		},
+		{
+			name:     "nested change",
+			before:   map[string]any{"targets": []any{"a"}},
+			after:    map[string]any{"targets": []any{"a", "b"}},
+			expected: `{"targets":{"after":["a","b"],"before":["a"]}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := diff(&test.before, &test.after)
+			encoded, err := json.Marshal(changes.Get())
+			if err != nil {
+				t.Fatalf("failed to encode changes: %v", err)
+			}
+
+			if string(encoded) != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, encoded)
+			}
+		})
+	}
+}
+
+func TestDiff_MissingSnapshot(t *testing.T) {
+	snapshot := map[string]any{"label": "a"}
+	if changes := diff(nil, &snapshot); changes.Get() != nil {
+		t.Errorf("expected nil changes without a before snapshot, got %v", *changes.Get())
+	}
+	if changes := diff(&snapshot, nil); changes.Get() != nil {
+		t.Errorf("expected nil changes without an after snapshot, got %v", *changes.Get())
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
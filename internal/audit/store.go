@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+type (
+	Store struct{}
+
+	// Entry is an audit record of a mutating action performed via the API. Entries
+	// are append-only, and are only removed once they exceed the retention period.
+	Entry struct {
+		ID        uuid.UUID `db:"id"`
+		CreatedAt time.Time `db:"created_at"`
+
+		// The user which performed the action, along with the session (or
+		// API key) which was used to authenticate the request.
+		ActorUserID    uuid.UUID  `db:"actor_user_id"`
+		ActorSessionID *uuid.UUID `db:"actor_session_id"`
+		ActorAPIKeyID  *uuid.UUID `db:"actor_api_key_id"`
+
+		// Action is the operation which was performed (e.g. 'deleteSeries'), and the
+		// resource type/ID identify the target of the action (if known).
+		Action       string  `db:"action"`
+		ResourceType *string `db:"resource_type"`
+		ResourceID   *string `db:"resource_id"`
+
+		// Before and After are snapshots of the target resource, and Changes contains
+		// the top-level fields which differ between the two. Any may be nil if the resource
+		// could not be captured (e.g. the resource was created, or deleted, by the action).
+		Before  database.JSONColumn[map[string]any] `db:"before"`
+		After   database.JSONColumn[map[string]any] `db:"after"`
+		Changes database.JSONColumn[map[string]any] `db:"changes"`
+
+		// Metadata of the request, the body of which has any sensitive values redacted.
+		RequestBody   database.JSONColumn[map[string]any] `db:"request_body"`
+		RequestMethod string                              `db:"request_method"`
+		RequestPath   string                              `db:"request_path"`
+		IPAddress     *string                             `db:"ip_address"`
+		UserAgent     *string                             `db:"user_agent"`
+		StatusCode    int                                 `db:"status_code"`
+	}
+
+	// Filter restricts the audit entries returned when listing. Zero-value
+	// fields do not restrict the entries.
+	Filter struct {
+		ActorUserID  *uuid.UUID
+		Action       *string
+		ResourceType *string
+		ResourceID   *string
+		Since        *time.Time
+		Until        *time.Time
+		Offset       uint64
+		Limit        uint64
+	}
+)
+
+func (store *Store) Record(db database.Queryable, entry *Entry) error {
+	if _, err := db.NamedExec(`
+		INSERT INTO audit_log(
+			id, created_at, actor_user_id, actor_session_id, actor_api_key_id, action, resource_type, resource_id,
+			before, after, changes, request_body, request_method, request_path, ip_address, user_agent, status_code
+		) VALUES (
+			:id, current_timestamp, :actor_user_id, :actor_session_id, :actor_api_key_id, :action, :resource_type, :resource_id,
+			:before, :after, :changes, :request_body, :request_method, :request_path, :ip_address, :user_agent, :status_code
+		)`, entry); err != nil {
+		return fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the audit entries which satisfy the filter provided (newest first).
+func (store *Store) List(db database.Queryable, filter Filter) ([]*Entry, error) {
+	builder := squirrel.Select("*").From("audit_log").OrderBy("created_at DESC", "id").Offset(filter.Offset).Limit(filter.Limit)
+	if filter.ActorUserID != nil {
+		builder = builder.Where("actor_user_id=?", *filter.ActorUserID)
+	}
+	if filter.Action != nil {
+		builder = builder.Where("action=?", *filter.Action)
+	}
+	if filter.ResourceType != nil {
+		builder = builder.Where("resource_type=?", *filter.ResourceType)
+	}
+	if filter.ResourceID != nil {
+		builder = builder.Where("resource_id=?", *filter.ResourceID)
+	}
+	if filter.Since != nil {
+		builder = builder.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		builder = builder.Where("created_at < ?", *filter.Until)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct list audit entries query: %w", err)
+	}
+
+	var results []*Entry
+	if err := db.Select(&results, db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("failed to select audit entries: %w", err)
+	}
+
+	return results, nil
+}
+
+// DeleteBefore removes all audit entries created before the time provided, returning the number
+// of entries removed. The audit log rejects deletions outside of the retention policy, so this
+// must be called within a transaction (in which the retention policy is enabled).
+func (store *Store) DeleteBefore(db database.Queryable, before time.Time) (int64, error) {
+	if _, err := db.Exec(`SET LOCAL thea.audit_retention = 'on'`); err != nil {
+		return 0, fmt.Errorf("failed to enable audit retention policy: %w", err)
+	}
+
+	res, err := db.Exec(`DELETE FROM audit_log WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired audit entries: %w", err)
+	}
+
+	return res.RowsAffected()
+}
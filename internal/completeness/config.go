@@ -0,0 +1,25 @@
+package completeness
+
+import "time"
+
+// Config contains configuration options that allow customization
+// of how Thea checks for missing episodes.
+type Config struct {
+	// The CompletenessService will periodically check continuing and
+	// recently aired series for newly aired episodes which are
+	// not present in Thea. A value of zero disables this check.
+	CheckIntervalHours int `toml:"check_interval_hours" env-default:"6"`
+
+	// The maximum number of series whose completeness is determined concurrently
+	// when listing the completeness of all series, which bounds the number of
+	// in-flight requests to TMDB.
+	ListConcurrency int `toml:"list_concurrency" env-default:"4"`
+}
+
+func (config *Config) CheckIntervalDuration() time.Duration {
+	return time.Duration(config.CheckIntervalHours) * time.Hour
+}
+
+func (config *Config) listConcurrency() int {
+	return max(1, config.ListConcurrency)
+}
@@ -0,0 +1,296 @@
+package completeness
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/event"
+	"github.com/hbomb79/Thea/internal/http/tmdb"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+var log = logger.Get("CompletenessServ")
+
+type (
+	searcher interface {
+		GetSeries(seriesID string) (*tmdb.Series, error)
+		GetSeason(seriesID string, seasonNumber int) (*tmdb.Season, error)
+	}
+
+	DataStore interface {
+		GetSeries(seriesID uuid.UUID) (*media.Series, error)
+		ListSeries() ([]*media.Series, error)
+		GetSeasonsForSeries(seriesID uuid.UUID) ([]*media.Season, error)
+		GetEpisodesForSeries(seriesID uuid.UUID) ([]*media.Episode, error)
+		ListSeriesForRefresh(airedSince time.Time) ([]*media.Series, error)
+	}
+
+	// SeriesCompleteness describes how many of the episodes of a series (as
+	// listed by TMDB) are present in Thea. If the completeness could not be
+	// determined, the Error describes why and the Seasons are empty.
+	SeriesCompleteness struct {
+		SeriesID uuid.UUID
+		Title    string
+		Seasons  []*SeasonCompleteness
+		Error    *string
+	}
+
+	// SeasonCompleteness describes how many of the episodes of a season (as listed by TMDB)
+	// are present in Thea. The SeasonID is nil if Thea has no episodes for this season.
+	SeasonCompleteness struct {
+		SeasonID        *uuid.UUID
+		SeasonNumber    int
+		Title           string
+		AiredEpisodes   int
+		PresentEpisodes int
+		Missing         []*MissingEpisode
+	}
+
+	// MissingEpisode is an episode listed by TMDB which is not present in Thea. Episodes
+	// which have not yet aired are included, however their Aired flag will be false.
+	MissingEpisode struct {
+		TmdbID        string
+		EpisodeNumber int
+		Title         string
+		AirDate       *time.Time
+		Aired         bool
+	}
+
+	// completenessService compares the seasons and episodes which Thea has for
+	// each series against the episodes listed by TMDB, allowing gaps in a
+	// series (e.g. due to failed downloads) to be found.
+	//
+	// The service also periodically checks continuing series for newly aired
+	// episodes which are missing, dispatching a MissingEpisodeEvent for each.
+	completenessService struct {
+		config   Config
+		searcher searcher
+		store    DataStore
+		eventBus event.EventDispatcher
+	}
+)
+
+const specialsSeasonNumber = 0
+
+func New(config Config, searcher searcher, store DataStore, eventBus event.EventDispatcher) *completenessService {
+	return &completenessService{config: config, searcher: searcher, store: store, eventBus: eventBus}
+}
+
+// Run will periodically check for newly aired episodes which are missing
+// until the context provided is cancelled. If the check is disabled, this method
+// simply blocks until the context is cancelled.
+func (service *completenessService) Run(ctx context.Context) error {
+	if service.config.CheckIntervalHours <= 0 {
+		log.Emit(logger.WARNING, "Scheduled missing episode check is disabled\n")
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(service.config.CheckIntervalDuration())
+	defer ticker.Stop()
+
+	lastChecked := time.Now().Add(-service.config.CheckIntervalDuration())
+	log.Emit(logger.NEW, "Completeness service started (interval=%s)\n", service.config.CheckIntervalDuration())
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			service.checkForMissingEpisodes(lastChecked, now)
+			lastChecked = now
+		case <-ctx.Done():
+			log.Emit(logger.STOP, "Completeness service closed\n")
+			return nil
+		}
+	}
+}
+
+// GetSeriesCompleteness compares the episodes which Thea has for the series with the
+// ID provided against the episodes listed by TMDB. Specials (season zero) are excluded
+// unless includeSpecials is true.
+func (service *completenessService) GetSeriesCompleteness(seriesID uuid.UUID, includeSpecials bool) (*SeriesCompleteness, error) {
+	series, err := service.store.GetSeries(seriesID)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.seriesCompleteness(series, includeSpecials, time.Now())
+}
+
+// ListSeriesCompleteness returns the completeness of every series known to Thea. Specials
+// (season zero) are excluded unless includeSpecials is true.
+//
+// The completeness of each series is determined concurrently (bounded by the Config), using
+// the cached TMDB responses where possible. Failure to determine the completeness of a series
+// does not fail the listing, instead the Error of that series is set.
+func (service *completenessService) ListSeriesCompleteness(includeSpecials bool) ([]*SeriesCompleteness, error) {
+	allSeries, err := service.store.ListSeries()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	output := make([]*SeriesCompleteness, len(allSeries))
+	wg := &sync.WaitGroup{}
+	semaphore := make(chan struct{}, service.config.listConcurrency())
+	for k, series := range allSeries {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(k int, series *media.Series) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			completeness, err := service.seriesCompleteness(series, includeSpecials, now)
+			if err != nil {
+				log.Warnf("Failed to determine completeness of series %s (%s): %v\n", series.ID, series.Title, err)
+				reason := err.Error()
+				completeness = &SeriesCompleteness{SeriesID: series.ID, Title: series.Title, Seasons: make([]*SeasonCompleteness, 0), Error: &reason}
+			}
+
+			output[k] = completeness
+		}(k, series)
+	}
+
+	wg.Wait()
+	return output, nil
+}
+
+// checkForMissingEpisodes dispatches a MissingEpisodeEvent for each series which has an episode
+// that aired within the window provided, but which is not present in Thea.
+func (service *completenessService) checkForMissingEpisodes(from time.Time, to time.Time) {
+	candidates, err := service.store.ListSeriesForRefresh(from)
+	if err != nil {
+		log.Errorf("Failed to find series for missing episode check: %v\n", err)
+		return
+	}
+
+	for _, series := range candidates {
+		completeness, err := service.seriesCompleteness(series, false, to)
+		if err != nil {
+			log.Warnf("Missing episode check for series %s (%s) failed: %v\n", series.ID, series.Title, err)
+			continue
+		}
+
+		for _, season := range completeness.Seasons {
+			for _, episode := range season.Missing {
+				if episode.Aired && episode.AirDate.After(from) {
+					log.Emit(logger.INFO, "Newly aired episode S%dE%d of series %s (%s) is missing\n", season.SeasonNumber, episode.EpisodeNumber, series.ID, series.Title)
+					service.eventBus.Dispatch(event.MissingEpisodeEvent, series.ID)
+				}
+			}
+		}
+	}
+}
+
+func (service *completenessService) seriesCompleteness(series *media.Series, includeSpecials bool, now time.Time) (*SeriesCompleteness, error) {
+	tmdbSeries, err := service.searcher.GetSeries(series.TmdbID)
+	if err != nil {
+		return nil, err
+	}
+
+	seasons, err := service.store.GetSeasonsForSeries(series.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	episodes, err := service.store.GetEpisodesForSeries(series.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Seasons and episodes are matched using their TMDB IDs, as these are
+	// stable even if TMDB renumbers the seasons/episodes of a series
+	seasonIDs := make(map[string]uuid.UUID, len(seasons))
+	for _, season := range seasons {
+		seasonIDs[season.TmdbID] = season.ID
+	}
+	presentEpisodes := make(map[string]struct{}, len(episodes))
+	for _, episode := range episodes {
+		presentEpisodes[episode.TmdbID] = struct{}{}
+	}
+
+	output := &SeriesCompleteness{SeriesID: series.ID, Title: series.Title, Seasons: make([]*SeasonCompleteness, 0, len(tmdbSeries.Seasons))}
+	for _, summary := range tmdbSeries.Seasons {
+		if summary.SeasonNumber == specialsSeasonNumber && !includeSpecials {
+			continue
+		}
+
+		season, err := service.searcher.GetSeason(series.TmdbID, summary.SeasonNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		seasonCompleteness := &SeasonCompleteness{SeasonNumber: summary.SeasonNumber, Title: season.Name, Missing: make([]*MissingEpisode, 0)}
+		if seasonID, ok := seasonIDs[season.ID.String()]; ok {
+			seasonCompleteness.SeasonID = &seasonID
+		}
+
+		for _, episode := range season.Episodes {
+			airDate := episode.AirDate.TimeOrNil()
+			aired := airDate != nil && !airDate.After(now)
+			if aired {
+				seasonCompleteness.AiredEpisodes++
+			}
+
+			if _, ok := presentEpisodes[episode.ID.String()]; ok {
+				seasonCompleteness.PresentEpisodes++
+				continue
+			}
+
+			seasonCompleteness.Missing = append(seasonCompleteness.Missing, &MissingEpisode{
+				TmdbID:        episode.ID.String(),
+				EpisodeNumber: episode.EpisodeNumber,
+				Title:         episode.Name,
+				AirDate:       airDate,
+				Aired:         aired,
+			})
+		}
+
+		output.Seasons = append(output.Seasons, seasonCompleteness)
+	}
+
+	return output, nil
+}
+
+// AiredEpisodes returns the total number of aired episodes across all seasons of the series.
+func (series *SeriesCompleteness) AiredEpisodes() int {
+	total := 0
+	for _, season := range series.Seasons {
+		total += season.AiredEpisodes
+	}
+
+	return total
+}
+
+// PresentEpisodes returns the total number of episodes present in Thea across all seasons of the series.
+func (series *SeriesCompleteness) PresentEpisodes() int {
+	total := 0
+	for _, season := range series.Seasons {
+		total += season.PresentEpisodes
+	}
+
+	return total
+}
+
+// Percentage returns the percentage of aired episodes in the series which are present in Thea.
+func (series *SeriesCompleteness) Percentage() float64 {
+	return percentage(series.PresentEpisodes(), series.AiredEpisodes())
+}
+
+// Percentage returns the percentage of aired episodes in the season which are present in Thea. If
+// no episodes have aired, the season is considered complete.
+func (season *SeasonCompleteness) Percentage() float64 {
+	return percentage(season.PresentEpisodes, season.AiredEpisodes)
+}
+
+// percentage returns the percentage of aired episodes which are present. Present
+// episodes which have not yet aired (e.g. early releases) are not counted beyond 100%.
+func percentage(present int, aired int) float64 {
+	if aired == 0 {
+		return 100
+	}
+
+	return min(100, float64(present)/float64(aired)*100)
+}
@@ -0,0 +1,97 @@
+package completeness
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/http/tmdb"
+	"github.com/hbomb79/Thea/internal/media"
+)
+
+// fakeSearcher returns a single empty season for each series, except for
+// those whose TMDB ID is in the failing set. The number of concurrent
+// requests is tracked so that the bound on concurrency can be verified.
+type fakeSearcher struct {
+	failing map[string]bool
+
+	mutex     sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (searcher *fakeSearcher) GetSeries(seriesID string) (*tmdb.Series, error) {
+	searcher.mutex.Lock()
+	searcher.active++
+	searcher.maxActive = max(searcher.maxActive, searcher.active)
+	searcher.mutex.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	searcher.mutex.Lock()
+	searcher.active--
+	searcher.mutex.Unlock()
+	if searcher.failing[seriesID] {
+		return nil, errors.New("tmdb unavailable")
+	}
+
+	return &tmdb.Series{ID: json.Number(seriesID), Seasons: []tmdb.SeasonSummary{{SeasonNumber: 1}}}, nil
+}
+
+func (searcher *fakeSearcher) GetSeason(seriesID string, seasonNumber int) (*tmdb.Season, error) {
+	return &tmdb.Season{ID: json.Number(seriesID + "1"), SeasonNumber: seasonNumber}, nil
+}
+
+type fakeStore struct {
+	DataStore
+	series []*media.Series
+}
+
+func (store *fakeStore) ListSeries() ([]*media.Series, error) { return store.series, nil }
+func (store *fakeStore) GetSeasonsForSeries(_ uuid.UUID) ([]*media.Season, error) {
+	return []*media.Season{}, nil
+}
+
+func (store *fakeStore) GetEpisodesForSeries(_ uuid.UUID) ([]*media.Episode, error) {
+	return []*media.Episode{}, nil
+}
+
+func TestListSeriesCompleteness_ReportsErrorsPerSeries(t *testing.T) {
+	store := &fakeStore{}
+	for i := 0; i < 10; i++ {
+		store.series = append(store.series, &media.Series{Model: media.Model{ID: uuid.New(), TmdbID: strconv.Itoa(i)}})
+	}
+
+	searcher := &fakeSearcher{failing: map[string]bool{"3": true}}
+	service := New(Config{ListConcurrency: 2}, searcher, store, nil)
+
+	output, err := service.ListSeriesCompleteness(false)
+	if err != nil {
+		t.Fatalf("expected failure of a single series to not fail the listing, got %v", err)
+	}
+	if len(output) != len(store.series) {
+		t.Fatalf("expected completeness of all %d series, got %d", len(store.series), len(output))
+	}
+
+	for k, series := range output {
+		if series.SeriesID != store.series[k].ID {
+			t.Errorf("expected output to be in the same order as the series")
+		}
+
+		if store.series[k].TmdbID == "3" {
+			if series.Error == nil || len(series.Seasons) != 0 {
+				t.Errorf("expected failing series to have an error and no seasons, got %#v", series)
+			}
+		} else if series.Error != nil || len(series.Seasons) != 1 {
+			t.Errorf("expected series %s to succeed, got %#v", store.series[k].TmdbID, series)
+		}
+	}
+
+	if n := searcher.maxActive; n > 2 {
+		t.Errorf("expected at most 2 concurrent TMDB requests, got %d", n)
+	}
+}
@@ -6,9 +6,17 @@ import (
 	"path/filepath"
 
 	"github.com/hbomb79/Thea/internal/api"
+	"github.com/hbomb79/Thea/internal/audit"
+	"github.com/hbomb79/Thea/internal/completeness"
 	"github.com/hbomb79/Thea/internal/database"
+	"github.com/hbomb79/Thea/internal/download"
+	"github.com/hbomb79/Thea/internal/http/tmdb"
 	"github.com/hbomb79/Thea/internal/ingest"
+	"github.com/hbomb79/Thea/internal/reconcile"
+	"github.com/hbomb79/Thea/internal/refresh"
 	"github.com/hbomb79/Thea/internal/transcode"
+	"github.com/hbomb79/Thea/internal/upload"
+	"github.com/hbomb79/Thea/internal/user"
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
@@ -16,14 +24,22 @@ import (
 // various user config supplied by file, or
 // manually inside the code.
 type TheaConfig struct {
-	Format        transcode.Config        `toml:"transcode"`
-	IngestService ingest.Config           `toml:"ingestion"`
-	Services      DockerConfig            `toml:"docker"`
-	Database      database.DatabaseConfig `toml:"database"`
-	RestConfig    api.RestConfig          `toml:"api"`
-	OmdbKey       string                  `toml:"omdb_api_key" env:"OMDB_API_KEY" env-required:"true"`
-	CacheDirPath  string                  `toml:"cache_dir" env:"CACHE_DIR"`
-	ConfigDirPath string                  `toml:"config_dir" env:"CONFIG_DIR"`
+	Format          transcode.Config        `toml:"transcode"`
+	IngestService   ingest.Config           `toml:"ingestion"`
+	Services        DockerConfig            `toml:"docker"`
+	Database        database.DatabaseConfig `toml:"database"`
+	RestConfig      api.RestConfig          `toml:"api"`
+	Tmdb            tmdb.Config             `toml:"tmdb"`
+	Refresh         refresh.Config          `toml:"refresh"`
+	Completeness    completeness.Config     `toml:"completeness"`
+	Reconcile       reconcile.Config        `toml:"reconcile"`
+	Upload          upload.Config           `toml:"upload"`
+	Download        download.Config         `toml:"download"`
+	Audit           audit.Config            `toml:"audit"`
+	PasswordHashing user.HashConfig         `toml:"password_hashing"`
+	OmdbKey         string                  `toml:"omdb_api_key" env:"OMDB_API_KEY" env-required:"true"`
+	CacheDirPath    string                  `toml:"cache_dir" env:"CACHE_DIR"`
+	ConfigDirPath   string                  `toml:"config_dir" env:"CONFIG_DIR"`
 }
 
 // DockerConfig is used to enable/disable the internal intialisation of
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"embed"
 	"encoding/json"
 	"errors"
@@ -217,6 +218,25 @@ type JSONColumn[T any] struct {
 	val *T
 }
 
+// NewJSONColumn returns a JSONColumn containing the value provided, which
+// is encoded as JSON when written to the database. A nil value is written as NULL.
+func NewJSONColumn[T any](val *T) JSONColumn[T] {
+	return JSONColumn[T]{val}
+}
+
+func (j JSONColumn[T]) Value() (driver.Value, error) {
+	if j.val == nil {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(j.val)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(encoded), nil
+}
+
 func (j *JSONColumn[T]) Scan(src any) error {
 	if src == nil {
 		j.val = nil
@@ -0,0 +1,28 @@
+-- +goose Up
+
+ALTER TABLE series
+    ADD COLUMN overview TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tagline TEXT NOT NULL DEFAULT '',
+    ADD COLUMN original_title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN original_language TEXT NOT NULL DEFAULT '',
+    ADD COLUMN status TEXT NOT NULL DEFAULT '',
+    ADD COLUMN vote_average REAL NOT NULL DEFAULT 0,
+    ADD COLUMN vote_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN first_air_date DATE,
+    ADD COLUMN last_air_date DATE;
+
+ALTER TABLE season
+    ADD COLUMN overview TEXT NOT NULL DEFAULT '',
+    ADD COLUMN air_date DATE;
+
+-- For episodes, the release_date column holds the air date of the episode
+ALTER TABLE media
+    ADD COLUMN overview TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tagline TEXT NOT NULL DEFAULT '',
+    ADD COLUMN original_title TEXT NOT NULL DEFAULT '',
+    ADD COLUMN original_language TEXT NOT NULL DEFAULT '',
+    ADD COLUMN status TEXT NOT NULL DEFAULT '',
+    ADD COLUMN vote_average REAL NOT NULL DEFAULT 0,
+    ADD COLUMN vote_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN runtime INT NOT NULL DEFAULT 0,
+    ADD COLUMN release_date DATE;
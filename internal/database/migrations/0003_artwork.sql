@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- Artwork columns contain the ID of an image in Thea's content-addressed
+-- image cache. For episodes, the backdrop_image column holds the episode still.
+ALTER TABLE series
+    ADD COLUMN poster_image TEXT,
+    ADD COLUMN backdrop_image TEXT;
+
+ALTER TABLE season
+    ADD COLUMN poster_image TEXT,
+    ADD COLUMN backdrop_image TEXT;
+
+ALTER TABLE media
+    ADD COLUMN poster_image TEXT,
+    ADD COLUMN backdrop_image TEXT;
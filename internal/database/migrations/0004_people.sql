@@ -0,0 +1,39 @@
+-- +goose Up
+
+CREATE TABLE person(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    tmdb_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    known_for_department TEXT NOT NULL DEFAULT '',
+
+    CONSTRAINT person_uk_tmdb_id UNIQUE(tmdb_id)
+);
+
+CREATE TYPE credit_role AS ENUM ('cast', 'crew');
+CREATE TABLE credit(
+    id UUID NOT NULL PRIMARY KEY,
+    person_id UUID NOT NULL,
+    role credit_role NOT NULL,
+    character TEXT NOT NULL DEFAULT '',
+    job TEXT NOT NULL DEFAULT '',
+    department TEXT NOT NULL DEFAULT '',
+    credit_order INT,
+
+    -- Credits are owned by either a movie/episode (media_id), or a series (series_id)
+    media_id UUID,
+    series_id UUID,
+
+    CONSTRAINT credit_fk_person_id FOREIGN KEY(person_id) REFERENCES person(id) ON DELETE CASCADE,
+    CONSTRAINT credit_fk_media_id FOREIGN KEY(media_id) REFERENCES media(id) ON DELETE CASCADE,
+    CONSTRAINT credit_fk_series_id FOREIGN KEY(series_id) REFERENCES series(id) ON DELETE CASCADE,
+    CONSTRAINT valid_credit_owner CHECK(
+        (media_id IS NOT NULL AND series_id IS NULL) OR
+        (media_id IS NULL AND series_id IS NOT NULL)
+    )
+);
+
+CREATE INDEX credit_idx_person_id ON credit(person_id);
+CREATE INDEX credit_idx_media_id ON credit(media_id);
+CREATE INDEX credit_idx_series_id ON credit(series_id);
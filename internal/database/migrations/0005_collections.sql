@@ -0,0 +1,21 @@
+-- +goose Up
+
+-- Collections group together related movies (e.g. a franchise), as
+-- sourced from the 'belongs_to_collection' information on TMDB movies.
+CREATE TABLE collection(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    tmdb_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    poster_image TEXT,
+    backdrop_image TEXT,
+
+    CONSTRAINT collection_uk_tmdb_id UNIQUE(tmdb_id)
+);
+
+ALTER TABLE media
+    ADD COLUMN collection_id UUID,
+    ADD CONSTRAINT media_fk_collection_id FOREIGN KEY(collection_id) REFERENCES collection(id) ON DELETE SET NULL;
+
+CREATE INDEX media_idx_collection_id ON media(collection_id);
@@ -0,0 +1,16 @@
+-- +goose Up
+
+-- Media files are additional source files for a movie/episode, such as
+-- a higher quality copy which was kept alongside the original source when
+-- a duplicate was detected during ingestion.
+CREATE TABLE media_file(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    media_id UUID NOT NULL,
+    source_path TEXT NOT NULL,
+
+    CONSTRAINT media_file_uk_source_path UNIQUE(source_path),
+    CONSTRAINT media_file_fk_media_id FOREIGN KEY(media_id) REFERENCES media(id) ON DELETE CASCADE
+);
+
+CREATE INDEX media_file_idx_media_id ON media_file(media_id);
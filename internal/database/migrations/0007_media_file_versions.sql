@@ -0,0 +1,35 @@
+-- +goose Up
+
+-- Media files now hold ALL of the source files for a movie/episode (rather than
+-- only the additional ones), along with the stream information probed from each file.
+ALTER TABLE media_file
+    ADD COLUMN updated_at TIMESTAMPTZ,
+    ADD COLUMN label TEXT,
+    ADD COLUMN width INT,
+    ADD COLUMN height INT,
+    ADD COLUMN video_codec TEXT,
+    ADD COLUMN bitrate BIGINT,
+    ADD COLUMN duration TEXT;
+
+UPDATE media_file SET updated_at = created_at;
+ALTER TABLE media_file ALTER COLUMN updated_at SET NOT NULL;
+
+INSERT INTO media_file(id, created_at, updated_at, media_id, source_path)
+SELECT gen_random_uuid(), media.created_at, media.updated_at, media.id, media.source_path FROM media
+ON CONFLICT(source_path) DO NOTHING;
+
+-- Transcodes are produced from a specific media file. Existing transcodes
+-- were produced from the (previously singular) source of their media.
+ALTER TABLE media_transcodes ADD COLUMN media_file_id UUID;
+
+UPDATE media_transcodes SET media_file_id = media_file.id
+FROM media, media_file
+WHERE media.id = media_transcodes.media_id AND media_file.source_path = media.source_path;
+
+ALTER TABLE media_transcodes
+    ALTER COLUMN media_file_id SET NOT NULL,
+    ADD CONSTRAINT media_transcodes_fk_media_file_id FOREIGN KEY(media_file_id) REFERENCES media_file(id) ON DELETE RESTRICT;
+
+CREATE INDEX media_transcodes_idx_media_file_id ON media_transcodes(media_file_id);
+
+ALTER TABLE media DROP COLUMN source_path;
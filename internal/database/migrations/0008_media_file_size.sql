@@ -0,0 +1,5 @@
+-- +goose Up
+
+-- The size of each source file is stored so that missing sources can
+-- be relocated (by matching the name and size of files under the library roots).
+ALTER TABLE media_file ADD COLUMN size BIGINT;
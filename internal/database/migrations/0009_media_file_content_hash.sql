@@ -0,0 +1,7 @@
+-- +goose Up
+
+-- A partial hash of the content of each source file, allowing files to be
+-- identified irrespective of their path (e.g. to detect moved/renamed files).
+ALTER TABLE media_file ADD COLUMN content_hash TEXT;
+
+CREATE INDEX media_file_idx_content_hash ON media_file(content_hash);
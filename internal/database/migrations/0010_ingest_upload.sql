@@ -0,0 +1,16 @@
+-- +goose Up
+
+-- Uploads which are in progress. The uploaded content is staged on disk,
+-- and the row is removed once the upload is complete and handed to the ingest service.
+CREATE TABLE ingest_upload(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    user_id UUID NOT NULL,
+    file_name TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    checksum TEXT NOT NULL,
+    tmdb_id TEXT,
+
+    CONSTRAINT ingest_upload_fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- Downloads of remote media. The downloaded content is staged on disk until
+-- the download is complete, at which point it's handed to the ingest service.
+CREATE TABLE download(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    url TEXT NOT NULL,
+    file_name TEXT NOT NULL,
+    size BIGINT,
+    checksum TEXT,
+    tmdb_id TEXT,
+    state TEXT NOT NULL,
+    error TEXT,
+    ingest_id UUID
+);
@@ -0,0 +1,15 @@
+-- +goose Up
+
+-- Rules which remember the TMDB ID that files with a particular scraped title
+-- were resolved to, allowing future files with the same title to be ingested
+-- without searching TMDB (e.g. subsequent episodes of a series).
+CREATE TABLE ingest_rule(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    title TEXT NOT NULL,
+    episodic BOOLEAN NOT NULL,
+    tmdb_id TEXT NOT NULL,
+
+    CONSTRAINT ingest_rule_uk_title_episodic UNIQUE(title, episodic)
+);
@@ -0,0 +1,12 @@
+-- +goose Up
+
+-- Secrets used to sign the JWTs issued by Thea, identified by the 'kid' header
+-- of the tokens they sign. Retired keys are retained (but no longer used for signing)
+-- until all the tokens they signed have expired.
+CREATE TABLE jwt_signing_key(
+    id TEXT NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    token_type TEXT NOT NULL,
+    secret BYTEA NOT NULL,
+    retired_at TIMESTAMPTZ
+);
@@ -0,0 +1,22 @@
+-- +goose Up
+
+-- A session is created when a user logs in, and lasts until the user logs out (or
+-- the session is revoked/expires). The refresh token ID is the ID of the only refresh
+-- token for the session which can be used, as refresh tokens are single-use. Use of
+-- any other refresh token for the session is considered reuse, and revokes the session.
+CREATE TABLE sessions(
+    id UUID NOT NULL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    refresh_token_id UUID NOT NULL,
+    device TEXT,
+    user_agent TEXT,
+    ip_address TEXT,
+
+    CONSTRAINT sessions_fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX sessions_idx_user_id ON sessions(user_id);
@@ -0,0 +1,5 @@
+-- +goose Up
+
+-- Users flagged as requiring a password change (such as the initial 'admin' user
+-- created when Thea is first started) are unable to use Thea until they change their password.
+ALTER TABLE users ADD COLUMN password_change_required BOOLEAN NOT NULL DEFAULT FALSE;
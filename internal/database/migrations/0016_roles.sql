@@ -0,0 +1,36 @@
+-- +goose Up
+
+-- Roles are named sets of permissions which can be assigned to users. The effective
+-- permissions of a user is the union of their own permissions, and the permissions
+-- of all their roles. Built-in roles are seeded by Thea and cannot be modified.
+CREATE TABLE roles(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    label TEXT NOT NULL UNIQUE,
+    built_in BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE roles_permissions(
+    role_id UUID NOT NULL,
+    permission_id UUID NOT NULL,
+
+    CONSTRAINT roles_permissions_fk_role_id FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    CONSTRAINT roles_permissions_fk_permission_id FOREIGN KEY(permission_id) REFERENCES permissions(id) ON DELETE CASCADE,
+    CONSTRAINT roles_permissions_uk_role_permission UNIQUE(role_id, permission_id)
+);
+
+CREATE TABLE users_roles(
+    user_id UUID NOT NULL,
+    role_id UUID NOT NULL,
+
+    CONSTRAINT users_roles_fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT users_roles_fk_role_id FOREIGN KEY(role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    CONSTRAINT users_roles_uk_user_role UNIQUE(user_id, role_id)
+);
+
+-- The permissions version of a session is embedded in the auth tokens issued for the
+-- session, and is incremented whenever the effective permissions of the user change. Auth
+-- tokens with an outdated version are rejected, forcing the client to refresh it's tokens (which
+-- issues tokens containing the new permissions of the user).
+ALTER TABLE sessions ADD COLUMN permissions_version INT NOT NULL DEFAULT 0;
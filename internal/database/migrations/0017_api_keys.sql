@@ -0,0 +1,31 @@
+-- +goose Up
+
+-- API keys are long-lived credentials which allow scripts/automation to authenticate
+-- as a user (without logging in). Only a hash of each key is stored, as the keys are
+-- high-entropy random values. The prefix of the key is stored so users can identify their keys.
+CREATE TABLE api_keys(
+    id UUID NOT NULL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    label TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    hash BYTEA NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+
+    CONSTRAINT api_keys_fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX api_keys_idx_user_id ON api_keys(user_id);
+
+-- The permissions an API key is scoped to. The effective permissions of a key are
+-- the permissions in this set which the user (currently) has.
+CREATE TABLE api_keys_permissions(
+    api_key_id UUID NOT NULL,
+    permission_id UUID NOT NULL,
+
+    CONSTRAINT api_keys_permissions_fk_api_key_id FOREIGN KEY(api_key_id) REFERENCES api_keys(id) ON DELETE CASCADE,
+    CONSTRAINT api_keys_permissions_fk_permission_id FOREIGN KEY(permission_id) REFERENCES permissions(id) ON DELETE CASCADE,
+    CONSTRAINT api_keys_permissions_uk_api_key_permission UNIQUE(api_key_id, permission_id)
+);
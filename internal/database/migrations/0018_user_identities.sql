@@ -0,0 +1,17 @@
+-- +goose Up
+
+-- User identities link a Thea user to an identity at an external (OpenID Connect)
+-- identity provider, allowing the user to login via the identity provider. The
+-- identity is the (issuer, subject) pair, which is stable and unique for each
+-- identity (unlike the username or email claims, which may change).
+CREATE TABLE user_identities(
+    user_id UUID NOT NULL,
+    issuer TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+
+    CONSTRAINT user_identities_fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT user_identities_uk_issuer_subject UNIQUE(issuer, subject)
+);
+
+CREATE INDEX user_identities_idx_user_id ON user_identities(user_id);
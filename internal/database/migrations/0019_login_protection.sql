@@ -0,0 +1,31 @@
+-- +goose Up
+
+-- The argon2 parameters used to hash the password of each user are stored alongside
+-- the hash, so that the parameters can be changed without invalidating existing
+-- passwords (which are transparently rehashed when the user next logs in). The
+-- defaults are the parameters which Thea used prior to them being configurable.
+ALTER TABLE users ADD COLUMN password_time INT NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN password_memory INT NOT NULL DEFAULT 65536;
+ALTER TABLE users ADD COLUMN password_threads INT NOT NULL DEFAULT 1;
+
+-- The number of consecutive failed logins for each user, and the time
+-- until which the user is locked out after too many failed logins.
+ALTER TABLE users ADD COLUMN failed_login_count INT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- An audit record of failed login attempts. The user ID is only
+-- populated if the username provided matches an existing user.
+CREATE TABLE failed_logins(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    username TEXT NOT NULL,
+    user_id UUID,
+    ip_address TEXT,
+    user_agent TEXT,
+    reason TEXT NOT NULL,
+
+    CONSTRAINT failed_logins_fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX failed_logins_idx_created_at ON failed_logins(created_at);
+CREATE INDEX failed_logins_idx_user_id ON failed_logins(user_id);
@@ -0,0 +1,29 @@
+-- +goose Up
+
+-- The TOTP (two-factor authentication) secret of each user which has enrolled. Enrolment
+-- is only complete once the user has confirmed it by providing a valid code, at which
+-- point the confirmed_at column is set. The secret must be stored in a recoverable form
+-- as it is required to generate codes. The step of the most recently accepted code is
+-- stored to ensure that each code can only be used once.
+CREATE TABLE users_totp(
+    user_id UUID NOT NULL PRIMARY KEY,
+    secret BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+
+    CONSTRAINT users_totp_fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Single-use recovery codes, which allow a user to login if they lose access to their
+-- authenticator. Only a hash of each code is stored, as the codes are high-entropy random values.
+CREATE TABLE users_recovery_codes(
+    id UUID NOT NULL PRIMARY KEY,
+    user_id UUID NOT NULL,
+    hash BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+
+    CONSTRAINT users_recovery_codes_fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT users_recovery_codes_uk_user_hash UNIQUE(user_id, hash)
+);
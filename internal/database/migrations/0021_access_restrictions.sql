@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- The content rating (certification) of each movie/episode, as reported by TMDB, and
+-- the minimum audience age which that rating corresponds to. Episodes inherit the rating
+-- of their series. The age is NULL if the media is unrated, or the rating is not recognised.
+ALTER TABLE media ADD COLUMN content_rating TEXT;
+ALTER TABLE media ADD COLUMN content_rating_age INT;
+
+-- Access restrictions for each user, which restrict the media visible to them. A NULL
+-- allowed_libraries permits access to every library, and a NULL max_content_rating
+-- permits media of any rating.
+ALTER TABLE users ADD COLUMN allowed_libraries TEXT[];
+ALTER TABLE users ADD COLUMN max_content_rating INT;
+ALTER TABLE users ADD COLUMN hide_adult_content BOOLEAN NOT NULL DEFAULT FALSE;
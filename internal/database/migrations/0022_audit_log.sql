@@ -0,0 +1,51 @@
+-- +goose Up
+
+-- An append-only record of the mutating actions performed via the API. The actor is deliberately
+-- not a foreign key, so that entries outlive the user (or API key) which performed them. The before
+-- and after columns contain a snapshot of the target resource (if it could be captured), and the
+-- changes column contains the top-level fields which differ between the two snapshots. Entries are
+-- only ever deleted once they fall outside of the configured retention period.
+CREATE TABLE audit_log(
+    id UUID NOT NULL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL,
+    actor_user_id UUID NOT NULL,
+    actor_session_id UUID,
+    actor_api_key_id UUID,
+    action TEXT NOT NULL,
+    resource_type TEXT,
+    resource_id TEXT,
+    before JSONB,
+    after JSONB,
+    changes JSONB,
+    request_body JSONB,
+    request_method TEXT NOT NULL,
+    request_path TEXT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    status_code INT NOT NULL
+);
+
+CREATE INDEX audit_log_idx_created_at ON audit_log(created_at);
+CREATE INDEX audit_log_idx_actor_user_id ON audit_log(actor_user_id);
+CREATE INDEX audit_log_idx_resource ON audit_log(resource_type, resource_id);
+
+-- The audit log is append-only: updates (and truncation) are always rejected, and rows may only
+-- be deleted by the retention policy, which sets 'thea.audit_retention' for the duration of it's
+-- transaction. Note that this guards against accidental modification, not against a database user
+-- who is able to alter the trigger (or set the variable themselves).
+-- +goose StatementBegin
+CREATE FUNCTION audit_log_prevent_modification() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_setting('thea.audit_retention', true) = 'on' THEN
+        RETURN OLD;
+    END IF;
+
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_log_trg_prevent_modification BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_prevent_modification();
+CREATE TRIGGER audit_log_trg_prevent_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_prevent_modification();
@@ -0,0 +1,85 @@
+package download
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// maxRedirects is the maximum number of redirects which will be
+// followed when performing a download.
+const maxRedirects = 10
+
+var errAddressNotPermitted = errors.New("downloads from loopback, link-local and private addresses are not permitted")
+
+// newHTTPClient constructs the client used to perform downloads. Unless private addresses are
+// allowed, the client refuses to connect to loopback, link-local and private addresses, preventing
+// downloads from being used to reach services which are not otherwise exposed (SSRF).
+//
+// The address is checked when each connection is made (i.e. after DNS resolution), and so the check
+// also applies to any redirects followed, and to hosts which resolve to a different address later on.
+func newHTTPClient(allowPrivateAddresses bool) *http.Client {
+	if allowPrivateAddresses {
+		return &http.Client{}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   controlPermittedAddress,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Connecting via a proxy would mean the address of the proxy is checked, rather
+	// than the address of the download
+	transport.Proxy = nil
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: redirect to '%s'", ErrInvalidURL, req.URL)
+			}
+			if addr, err := netip.ParseAddr(req.URL.Hostname()); err == nil && !isPermittedAddress(addr) {
+				return fmt.Errorf("%w: redirect to '%s'", errAddressNotPermitted, req.URL)
+			}
+
+			return nil
+		},
+	}
+}
+
+// controlPermittedAddress is used as the Control function of a net.Dialer, and
+// rejects connections to addresses which are not permitted (see isPermittedAddress).
+func controlPermittedAddress(_ string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse dial address '%s': %w", address, err)
+	}
+	if !isPermittedAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errAddressNotPermitted, addrPort.Addr())
+	}
+
+	return nil
+}
+
+// isPermittedAddress returns false if the address provided is a loopback,
+// link-local, private, unspecified or multicast address.
+func isPermittedAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsPrivate() &&
+		!addr.IsUnspecified()
+}
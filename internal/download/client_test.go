@@ -0,0 +1,83 @@
+package download
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPermittedAddress(t *testing.T) {
+	tests := []struct {
+		address   string
+		permitted bool
+	}{
+		{address: "93.184.216.34", permitted: true},
+		{address: "2606:2800:220:1:248:1893:25c8:1946", permitted: true},
+		{address: "127.0.0.1", permitted: false},
+		{address: "::1", permitted: false},
+		{address: "::ffff:127.0.0.1", permitted: false},
+		{address: "169.254.169.254", permitted: false},
+		{address: "fe80::1", permitted: false},
+		{address: "10.0.0.1", permitted: false},
+		{address: "172.16.0.1", permitted: false},
+		{address: "192.168.1.1", permitted: false},
+		{address: "fd00::1", permitted: false},
+		{address: "0.0.0.0", permitted: false},
+		{address: "224.0.0.1", permitted: false},
+	}
+
+	for _, test := range tests {
+		if actual := isPermittedAddress(netip.MustParseAddr(test.address)); actual != test.permitted {
+			t.Errorf("isPermittedAddress(%s) = %v, expected %v", test.address, actual, test.permitted)
+		}
+	}
+}
+
+func TestHTTPClient_RefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := newHTTPClient(false).Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, errAddressNotPermitted) {
+		t.Errorf("expected connection to loopback address to be refused, got %v", err)
+	}
+
+	resp, err = newHTTPClient(true).Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected connection to be permitted when private addresses are allowed, got %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestHTTPClient_RefusesRedirectsToPrivateAddresses(t *testing.T) {
+	client := newHTTPClient(false)
+	for _, target := range []string{"http://127.0.0.1/internal", "http://[::1]:8080/internal", "file:///etc/passwd"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if err := client.CheckRedirect(req, []*http.Request{httptest.NewRequest(http.MethodGet, "https://example.com/file", nil)}); err == nil {
+			t.Errorf("expected redirect to %s to be refused", target)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://cdn.example.com/file", nil)
+	if err := client.CheckRedirect(req, []*http.Request{httptest.NewRequest(http.MethodGet, "https://example.com/file", nil)}); err != nil {
+		t.Errorf("expected redirect to public host to be followed, got %v", err)
+	}
+}
+
+func TestCreateDownload_RefusesPrivateAddresses(t *testing.T) {
+	service, _, _ := newTestService(t)
+	service.config.AllowPrivateAddresses = false
+
+	for _, url := range []string{"http://127.0.0.1/movie.mkv", "http://[::1]/movie.mkv", "http://169.254.169.254/latest/meta-data"} {
+		if _, err := service.CreateDownload(url, nil, nil, nil); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("expected download of %s to be refused, got %v", url, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package download
+
+// Config contains configuration options that allow
+// customization of how Thea downloads remote media.
+type Config struct {
+	// The directory that in-progress downloads are staged in. Once
+	// complete, downloads are moved to the ingestion directory. If not
+	// provided, a directory inside of Thea's cache directory is used.
+	StagingPath string `toml:"staging_dir" env:"DOWNLOAD_STAGING_DIR"`
+
+	// Controls the number of downloads which can be performed at once.
+	Parallelism int `toml:"parallelism" env-default:"2"`
+
+	// The maximum combined bandwidth of all downloads, in kilobytes
+	// per second. A value of zero disables the limit.
+	BandwidthLimitKilobytes int `toml:"bandwidth_limit_kbps" env-default:"0"`
+
+	// By default, downloads from loopback, link-local and private addresses
+	// are refused so that downloads cannot be used to reach services on Thea's
+	// network. Enabling this allows such downloads (e.g. from a NAS on the LAN).
+	AllowPrivateAddresses bool `toml:"allow_private_addresses" env:"DOWNLOAD_ALLOW_PRIVATE_ADDRESSES" env-default:"false"`
+}
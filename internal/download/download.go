@@ -0,0 +1,63 @@
+package download
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DownloadState string
+
+const (
+	Queued      DownloadState = "QUEUED"
+	Downloading DownloadState = "DOWNLOADING"
+	Paused      DownloadState = "PAUSED"
+	Failed      DownloadState = "FAILED"
+	Complete    DownloadState = "COMPLETED"
+)
+
+type (
+	// Download is a download of a remote file which is to be ingested once
+	// complete. The content of the download is staged on disk, allowing
+	// the download to be resumed if interrupted.
+	Download struct {
+		ID        uuid.UUID     `db:"id"`
+		CreatedAt time.Time     `db:"created_at"`
+		UpdatedAt time.Time     `db:"updated_at"`
+		URL       string        `db:"url"`
+		FileName  string        `db:"file_name"`
+		State     DownloadState `db:"state"`
+
+		// Size is the size of the remote file, which is only known once
+		// the remote server has responded with it.
+		Size *int64 `db:"size"`
+
+		// Checksum is the (optional) hex-encoded SHA-256 digest of the remote file,
+		// which the downloaded content is verified against.
+		Checksum *string `db:"checksum"`
+
+		// TmdbID optionally specifies the TMDB ID of the movie (or the series, for
+		// episodes) that the download is for, which skips searching TMDB during ingestion.
+		TmdbID *string `db:"tmdb_id"`
+
+		// Error contains the reason the download failed, if the download is FAILED.
+		Error *string `db:"error"`
+
+		// IngestID is populated once the download is complete, and has been queued for ingestion.
+		IngestID *uuid.UUID `db:"ingest_id"`
+	}
+
+	// Progress describes the progress of a download which is underway.
+	Progress struct {
+		DownloadedBytes int64
+		TotalBytes      *int64
+
+		// BytesPerSecond is the speed of the download, averaged since it was started (or resumed).
+		BytesPerSecond int64
+	}
+)
+
+func (download *Download) String() string {
+	return fmt.Sprintf("Download{ID=%s URL=%s State=%s}", download.ID, download.URL, download.State)
+}
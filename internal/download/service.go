@@ -1 +1,686 @@
 package download
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/event"
+	"github.com/hbomb79/Thea/internal/ingest"
+	"github.com/hbomb79/Thea/pkg/logger"
+	"github.com/hbomb79/Thea/pkg/worker"
+	"golang.org/x/time/rate"
+)
+
+var (
+	log = logger.Get("DownloadServ")
+
+	ErrDownloadNotFound  = errors.New("download does not exist")
+	ErrInvalidURL        = errors.New("download URL must be an absolute HTTP(S) URL")
+	ErrInvalidFileName   = errors.New("download file name is not valid")
+	ErrInvalidChecksum   = errors.New("download checksum must be a hex-encoded SHA-256 digest")
+	ErrIllegalTransition = errors.New("download cannot transition from it's current state")
+	ErrChecksumMismatch  = errors.New("checksum of downloaded content does not match the checksum of the download")
+
+	errDownloadPaused    = errors.New("download paused")
+	errDownloadCancelled = errors.New("download cancelled")
+
+	contentRangeRegex = regexp.MustCompile(`^bytes (\d+)-\d+/(\d+|\*)$`)
+)
+
+const (
+	// progressEventInterval is the minimum interval between progress
+	// events for a download, to avoid flooding the event bus.
+	progressEventInterval = time.Millisecond * 500
+
+	// bandwidthChunkSize is the maximum number of bytes read from a
+	// download before waiting on the bandwidth limiter.
+	bandwidthChunkSize = 32 * 1024
+)
+
+type (
+	DataStore interface {
+		SaveDownload(download *Download) error
+		UpdateDownload(download *Download) error
+		ListDownloads() ([]*Download, error)
+		DeleteDownload(downloadID uuid.UUID) error
+	}
+
+	ingester interface {
+		IngestFile(path string, fileName string, overrideTmdbID *string) (*ingest.IngestItem, error)
+	}
+
+	// activeDownload tracks a download which a worker is currently performing.
+	activeDownload struct {
+		cancel     context.CancelCauseFunc
+		startedAt  time.Time
+		startBytes int64
+		downloaded atomic.Int64
+		total      atomic.Pointer[int64]
+	}
+
+	// downloadService is responsible for downloading remote media (via HTTP(S)) in to
+	// Thea. Downloads are queued, and performed by a pool of workers; the content of
+	// each download is staged on disk so that downloads which are paused or interrupted
+	// can be resumed (using a HTTP Range request) rather than restarted.
+	//
+	// Once complete, the content of a download is (optionally) verified against
+	// the checksum provided, before being handed to the ingest service.
+	downloadService struct {
+		*sync.Mutex
+		config     Config
+		store      DataStore
+		ingester   ingester
+		eventBus   event.EventCoordinator
+		client     *http.Client
+		limiter    *rate.Limiter
+		workerPool worker.WorkerPool
+
+		ctx       context.Context
+		downloads []*Download
+		active    map[uuid.UUID]*activeDownload
+	}
+)
+
+// New creates a new download service, loading the persisted downloads from the store provided. Downloads
+// which were underway when Thea was last stopped are queued, and will resume once the service is started.
+func New(config Config, store DataStore, ingester ingester, eventBus event.EventCoordinator) (*downloadService, error) {
+	if err := os.MkdirAll(config.StagingPath, os.ModeDir|os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create download staging directory: %w", err)
+	}
+
+	downloads, err := store.ListDownloads()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load downloads: %w", err)
+	}
+	for _, download := range downloads {
+		if download.State == Downloading {
+			download.State = Queued
+		}
+	}
+
+	service := &downloadService{
+		Mutex:      &sync.Mutex{},
+		config:     config,
+		store:      store,
+		ingester:   ingester,
+		eventBus:   eventBus,
+		client:     newHTTPClient(config.AllowPrivateAddresses),
+		workerPool: *worker.NewWorkerPool(),
+		downloads:  downloads,
+		active:     make(map[uuid.UUID]*activeDownload),
+	}
+
+	if config.BandwidthLimitKilobytes > 0 {
+		bytesPerSecond := config.BandwidthLimitKilobytes * 1024
+		service.limiter = rate.NewLimiter(rate.Limit(bytesPerSecond), max(bytesPerSecond, bandwidthChunkSize))
+	}
+
+	for i := 0; i < config.Parallelism; i++ {
+		label := fmt.Sprintf("download-worker-%d", i)
+		if err := service.workerPool.PushWorker(worker.NewWorker(label, service.PerformDownload)); err != nil {
+			return nil, fmt.Errorf("failed to push worker to pool: %w", err)
+		}
+	}
+
+	return service, nil
+}
+
+// Run starts the worker pool, which performs the queued downloads. To stop the service (and
+// interrupt all ongoing downloads), the calling code should cancel the context provided.
+func (service *downloadService) Run(ctx context.Context) error {
+	service.Lock()
+	service.ctx = ctx
+	service.Unlock()
+
+	if err := service.workerPool.Start(); err != nil {
+		return fmt.Errorf("failed to construct worker pool: %w", err)
+	}
+	defer service.workerPool.Close()
+
+	service.wakeupWorkerPool()
+	log.Emit(logger.NEW, "Download service started\n")
+
+	<-ctx.Done()
+	log.Emit(logger.STOP, "Download service closed\n")
+	return nil
+}
+
+// CreateDownload queues a new download of the URL provided. If no file name is provided,
+// the name is derived from the path of the URL. If a checksum is provided, it must be
+// the hex-encoded SHA-256 digest of the remote file.
+func (service *downloadService) CreateDownload(rawURL string, fileName *string, checksum *string, tmdbID *string) (*Download, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidURL, rawURL)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !service.config.AllowPrivateAddresses && !isPermittedAddress(addr) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, errAddressNotPermitted)
+	}
+
+	name := path.Base(u.Path)
+	if fileName != nil {
+		name = *fileName
+	}
+	if name == "" || name != filepath.Base(name) || name == "." || name == ".." || name == "/" {
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidFileName, name)
+	}
+
+	if checksum != nil {
+		if decoded, err := hex.DecodeString(*checksum); err != nil || len(decoded) != sha256.Size {
+			return nil, ErrInvalidChecksum
+		}
+		lower := strings.ToLower(*checksum)
+		checksum = &lower
+	}
+
+	download := &Download{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		URL:       rawURL,
+		FileName:  name,
+		State:     Queued,
+		Checksum:  checksum,
+		TmdbID:    tmdbID,
+	}
+	if err := service.store.SaveDownload(download); err != nil {
+		return nil, err
+	}
+
+	service.Lock()
+	service.downloads = append(service.downloads, download)
+	service.Unlock()
+
+	log.Emit(logger.NEW, "Queued download %s of %s\n", download.ID, rawURL)
+	service.eventBus.Dispatch(event.DownloadUpdateEvent, download.ID)
+	service.wakeupWorkerPool()
+	return download, nil
+}
+
+// GetDownload returns the download with the ID provided, or nil if no such download exists.
+func (service *downloadService) GetDownload(downloadID uuid.UUID) *Download {
+	service.Lock()
+	defer service.Unlock()
+
+	return service.getDownload(downloadID)
+}
+
+// GetAllDownloads returns all the downloads known to the service, oldest first.
+func (service *downloadService) GetAllDownloads() []*Download {
+	service.Lock()
+	defer service.Unlock()
+
+	out := make([]*Download, len(service.downloads))
+	copy(out, service.downloads)
+	return out
+}
+
+// GetProgress returns the progress of the download with the ID provided, or nil
+// if the download is not currently underway.
+func (service *downloadService) GetProgress(downloadID uuid.UUID) *Progress {
+	service.Lock()
+	defer service.Unlock()
+
+	active, ok := service.active[downloadID]
+	if !ok {
+		return nil
+	}
+
+	return active.progress()
+}
+
+// PauseDownload pauses the download with the ID provided, interrupting it if
+// it's underway. The content downloaded so far is retained, allowing the download
+// to be resumed later.
+func (service *downloadService) PauseDownload(downloadID uuid.UUID) error {
+	service.Lock()
+	defer service.Unlock()
+
+	download := service.getDownload(downloadID)
+	if download == nil {
+		return ErrDownloadNotFound
+	}
+	if download.State != Queued && download.State != Downloading {
+		return fmt.Errorf("%w: cannot pause %s download", ErrIllegalTransition, download.State)
+	}
+
+	if active, ok := service.active[downloadID]; ok {
+		active.cancel(errDownloadPaused)
+	}
+
+	log.Emit(logger.INFO, "Pausing download %s\n", downloadID)
+	return service.updateState(download, Paused, nil)
+}
+
+// ResumeDownload queues the paused or failed download with the ID provided.
+func (service *downloadService) ResumeDownload(downloadID uuid.UUID) error {
+	service.Lock()
+	defer service.Unlock()
+
+	download := service.getDownload(downloadID)
+	if download == nil {
+		return ErrDownloadNotFound
+	}
+	if download.State != Paused && download.State != Failed {
+		return fmt.Errorf("%w: cannot resume %s download", ErrIllegalTransition, download.State)
+	}
+
+	log.Emit(logger.INFO, "Resuming download %s\n", downloadID)
+	if err := service.updateState(download, Queued, nil); err != nil {
+		return err
+	}
+
+	service.wakeupWorkerPool()
+	return nil
+}
+
+// CancelDownload removes the download with the ID provided, interrupting it if it's
+// underway. Any content downloaded so far is discarded.
+func (service *downloadService) CancelDownload(downloadID uuid.UUID) error {
+	service.Lock()
+	defer service.Unlock()
+
+	download := service.getDownload(downloadID)
+	if download == nil {
+		return ErrDownloadNotFound
+	}
+
+	if err := service.store.DeleteDownload(downloadID); err != nil {
+		return err
+	}
+	service.removeDownload(downloadID)
+
+	// If the download is underway, the worker performing it is responsible
+	// for removing the staged content once it has stopped writing to it.
+	if active, ok := service.active[downloadID]; ok {
+		active.cancel(errDownloadCancelled)
+	} else {
+		service.removeStagedContent(downloadID)
+	}
+
+	log.Emit(logger.INFO, "Cancelled download %s\n", downloadID)
+	service.eventBus.Dispatch(event.DownloadUpdateEvent, downloadID)
+	return nil
+}
+
+// PerformDownload is the worker function for the download service, which is called
+// by the services WorkerPool. The first queued download is claimed and performed; if
+// no download is queued, the worker is put to sleep.
+func (service *downloadService) PerformDownload(w worker.Worker) (bool, error) {
+	download, active, ctx := service.claimQueuedDownload()
+	if download == nil {
+		return true, nil
+	}
+
+	err := service.performDownload(ctx, download, active)
+	service.finishDownload(ctx, download, active, err)
+	return false, nil
+}
+
+// claimQueuedDownload finds the first queued download and marks it as
+// downloading, returning the download and the context it should be performed with. Downloads
+// which are still being stopped by another worker (e.g. paused, and then quickly resumed) are
+// skipped, as that worker may still be writing to the staged content.
+//
+// Note: This function takes ownership of the mutex and releases it on return.
+func (service *downloadService) claimQueuedDownload() (*Download, *activeDownload, context.Context) {
+	service.Lock()
+	defer service.Unlock()
+
+	for _, download := range service.downloads {
+		if download.State != Queued {
+			continue
+		}
+		if _, ok := service.active[download.ID]; ok {
+			continue
+		}
+
+		ctx, cancel := context.WithCancelCause(service.ctx)
+		active := &activeDownload{cancel: cancel, startedAt: time.Now()}
+		active.total.Store(download.Size)
+		service.active[download.ID] = active
+
+		if err := service.updateState(download, Downloading, nil); err != nil {
+			log.Warnf("Failed to persist state of download %s: %v\n", download.ID, err)
+		}
+
+		return download, active, ctx
+	}
+
+	return nil, nil, nil
+}
+
+// finishDownload updates the state of the download provided based on the result
+// of the worker performing the download. The active download provided must be the one
+// claimed by the worker.
+//
+// Note: This function takes ownership of the mutex and releases it on return.
+func (service *downloadService) finishDownload(ctx context.Context, download *Download, active *activeDownload, err error) {
+	service.Lock()
+	defer service.Unlock()
+
+	interrupted, cause := ctx.Err() != nil, context.Cause(ctx)
+	// The download may have been resumed while this worker was stopping. Only the entry claimed
+	// by this worker is removed, so the download can be claimed again once this worker returns.
+	active.cancel(nil)
+	if service.active[download.ID] == active {
+		delete(service.active, download.ID)
+	}
+
+	if interrupted {
+		switch cause {
+		case errDownloadPaused:
+			// State has already been updated by PauseDownload
+		case errDownloadCancelled:
+			service.removeStagedContent(download.ID)
+		default:
+			// The service is shutting down, the download will be resumed
+			// when the service is next started.
+			log.Emit(logger.STOP, "Download %s interrupted by shutdown\n", download.ID)
+		}
+
+		return
+	}
+
+	if err != nil {
+		log.Errorf("Download %s failed: %v\n", download.ID, err)
+		message := err.Error()
+		if updateErr := service.updateState(download, Failed, &message); updateErr != nil {
+			log.Warnf("Failed to persist state of download %s: %v\n", download.ID, updateErr)
+		}
+
+		return
+	}
+
+	item, err := service.ingester.IngestFile(service.stagingPath(download.ID), download.FileName, download.TmdbID)
+	if err != nil {
+		log.Errorf("Download %s complete, but could not be queued for ingestion: %v\n", download.ID, err)
+		message := fmt.Sprintf("failed to queue download for ingestion: %v", err)
+		if updateErr := service.updateState(download, Failed, &message); updateErr != nil {
+			log.Warnf("Failed to persist state of download %s: %v\n", download.ID, updateErr)
+		}
+
+		return
+	}
+
+	log.Emit(logger.SUCCESS, "Download %s complete, queued for ingestion as %s\n", download.ID, item)
+	download.IngestID = &item.ID
+	if err := service.updateState(download, Complete, nil); err != nil {
+		log.Warnf("Failed to persist state of download %s: %v\n", download.ID, err)
+	}
+	service.eventBus.Dispatch(event.DownloadCompleteEvent, download.ID)
+}
+
+// performDownload downloads the remote content of the download provided in to the staging
+// directory. If content has already been staged (from an earlier attempt), a Range request
+// is used to resume the download.
+func (service *downloadService) performDownload(ctx context.Context, download *Download, active *activeDownload) error {
+	path := service.stagingPath(download.ID)
+	offset := int64(0)
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	if download.Size == nil || offset < *download.Size {
+		var err error
+		offset, err = service.fetch(ctx, download, active, offset)
+		if err != nil {
+			return err
+		}
+	}
+
+	if download.Size != nil && offset != *download.Size {
+		return fmt.Errorf("downloaded %d bytes, but expected %d bytes", offset, *download.Size)
+	}
+
+	if download.Checksum != nil {
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			return fmt.Errorf("failed to compute checksum of downloaded content: %w", err)
+		}
+
+		if checksum != *download.Checksum {
+			service.removeStagedContent(download.ID)
+			return fmt.Errorf("%w: got %s", ErrChecksumMismatch, checksum)
+		}
+	}
+
+	return nil
+}
+
+// fetch requests the remote content of the download, starting from the offset provided,
+// and appends it to the staged content. The new size of the staged content is returned.
+func (service *downloadService) fetch(ctx context.Context, download *Download, active *activeDownload, offset int64) (int64, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, download.URL, nil)
+	if err != nil {
+		return offset, err
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	response, err := service.client.Do(request)
+	if err != nil {
+		return offset, err
+	}
+	defer response.Body.Close()
+
+	var size *int64
+	switch response.StatusCode {
+	case http.StatusOK:
+		// Server does not support (or ignored) the range request, so the content must be restarted
+		offset = 0
+		if response.ContentLength >= 0 {
+			size = &response.ContentLength
+		}
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(response.Header.Get("Content-Range"))
+		if err != nil {
+			return offset, err
+		}
+		if start != offset {
+			return offset, fmt.Errorf("server responded with content starting at %d, but requested %d", start, offset)
+		}
+		size = total
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Staged content is larger than the remote file, which has likely changed. Discard
+		// the content so the download restarts if resumed.
+		service.removeStagedContent(download.ID)
+		return 0, errors.New("staged content does not match remote file, download must be restarted")
+	default:
+		return offset, fmt.Errorf("unexpected response status %s", response.Status)
+	}
+
+	if size != nil && (download.Size == nil || *download.Size != *size) {
+		service.Lock()
+		download.Size = size
+		active.total.Store(size)
+		if err := service.store.UpdateDownload(download); err != nil {
+			log.Warnf("Failed to persist size of download %s: %v\n", download.ID, err)
+		}
+		service.Unlock()
+		service.eventBus.Dispatch(event.DownloadUpdateEvent, download.ID)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(service.stagingPath(download.ID), flags, 0o644)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	active.startBytes = offset
+	active.downloaded.Store(offset)
+	reader := &progressReader{
+		ctx:     ctx,
+		reader:  response.Body,
+		limiter: service.limiter,
+		onRead: func(n int) {
+			active.downloaded.Add(int64(n))
+		},
+	}
+
+	ticker := time.NewTicker(progressEventInterval)
+	defer ticker.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				service.eventBus.Dispatch(event.DownloadProgressEvent, download.ID)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	written, err := io.Copy(file, reader)
+	return offset + written, err
+}
+
+// updateState sets the state (and error) of the download provided, persists
+// the change, and notifies listeners.
+//
+// Note: The caller must hold the mutex.
+func (service *downloadService) updateState(download *Download, state DownloadState, message *string) error {
+	download.State = state
+	download.Error = message
+	download.UpdatedAt = time.Now()
+	if err := service.store.UpdateDownload(download); err != nil {
+		return err
+	}
+
+	service.eventBus.Dispatch(event.DownloadUpdateEvent, download.ID)
+	return nil
+}
+
+func (service *downloadService) getDownload(downloadID uuid.UUID) *Download {
+	for _, download := range service.downloads {
+		if download.ID == downloadID {
+			return download
+		}
+	}
+
+	return nil
+}
+
+func (service *downloadService) removeDownload(downloadID uuid.UUID) {
+	for k, download := range service.downloads {
+		if download.ID == downloadID {
+			service.downloads = append(service.downloads[:k], service.downloads[k+1:]...)
+			return
+		}
+	}
+}
+
+func (service *downloadService) removeStagedContent(downloadID uuid.UUID) {
+	if err := os.Remove(service.stagingPath(downloadID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warnf("Cleanup of staged content for download %s failed: %v\n", downloadID, err)
+	}
+}
+
+func (service *downloadService) stagingPath(downloadID uuid.UUID) string {
+	return filepath.Join(service.config.StagingPath, downloadID.String())
+}
+
+func (service *downloadService) wakeupWorkerPool() {
+	if err := service.workerPool.WakeupWorkers(); err != nil {
+		log.Warnf("Failed to wakeup download workers: %v\n", err)
+	}
+}
+
+func (active *activeDownload) progress() *Progress {
+	downloaded := active.downloaded.Load()
+	progress := &Progress{DownloadedBytes: downloaded, TotalBytes: active.total.Load()}
+	if elapsed := time.Since(active.startedAt).Seconds(); elapsed > 0 {
+		progress.BytesPerSecond = int64(float64(downloaded-active.startBytes) / elapsed)
+	}
+
+	return progress
+}
+
+// progressReader wraps a reader, reporting the number of bytes read and
+// (optionally) limiting the rate at which bytes can be read.
+type progressReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *rate.Limiter
+	onRead  func(n int)
+}
+
+func (reader *progressReader) Read(p []byte) (int, error) {
+	if reader.limiter != nil {
+		if len(p) > bandwidthChunkSize {
+			p = p[:bandwidthChunkSize]
+		}
+		if err := reader.limiter.WaitN(reader.ctx, len(p)); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := reader.reader.Read(p)
+	reader.onRead(n)
+	return n, err
+}
+
+// parseContentRange parses the start offset, and the total size (if known) from
+// the value of a Content-Range header.
+func parseContentRange(header string) (int64, *int64, error) {
+	matches := contentRangeRegex.FindStringSubmatch(header)
+	if matches == nil {
+		return 0, nil, fmt.Errorf("content range '%s' is malformed", header)
+	}
+
+	start, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("content range '%s' is malformed: %w", header, err)
+	}
+	if matches[2] == "*" {
+		return start, nil, nil
+	}
+
+	total, err := strconv.ParseInt(matches[2], 10, 64)
+	if err != nil {
+		return 0, nil, fmt.Errorf("content range '%s' is malformed: %w", header, err)
+	}
+
+	return start, &total, nil
+}
+
+// fileChecksum returns the hex-encoded SHA-256 digest of the file at the path provided.
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
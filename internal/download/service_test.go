@@ -0,0 +1,489 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/event"
+	"github.com/hbomb79/Thea/internal/ingest"
+)
+
+// fakeStore is an in-memory DataStore.
+type fakeStore struct {
+	*sync.Mutex
+	downloads map[uuid.UUID]Download
+}
+
+func (store *fakeStore) SaveDownload(download *Download) error {
+	store.Lock()
+	defer store.Unlock()
+	store.downloads[download.ID] = *download
+	return nil
+}
+
+func (store *fakeStore) UpdateDownload(download *Download) error { return store.SaveDownload(download) }
+
+func (store *fakeStore) ListDownloads() ([]*Download, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	downloads := make([]*Download, 0, len(store.downloads))
+	for _, download := range store.downloads {
+		download := download
+		downloads = append(downloads, &download)
+	}
+
+	return downloads, nil
+}
+
+func (store *fakeStore) DeleteDownload(downloadID uuid.UUID) error {
+	store.Lock()
+	defer store.Unlock()
+	delete(store.downloads, downloadID)
+	return nil
+}
+
+// fakeIngester records the files which are ingested.
+type fakeIngester struct {
+	ingested []string
+}
+
+func (ingester *fakeIngester) IngestFile(path string, fileName string, overrideTmdbID *string) (*ingest.IngestItem, error) {
+	ingester.ingested = append(ingester.ingested, path)
+	return &ingest.IngestItem{ID: uuid.New(), Path: path}, nil
+}
+
+// rangeServer serves the content provided, recording the Range header of each
+// request. If ignoreRange is set, Range requests are ignored (as some servers do).
+type rangeServer struct {
+	*sync.Mutex
+	content     []byte
+	ignoreRange bool
+	ranges      []string
+}
+
+func newRangeServer(t *testing.T, content []byte) (*rangeServer, *httptest.Server) {
+	t.Helper()
+
+	server := &rangeServer{Mutex: &sync.Mutex{}, content: content}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.Lock()
+		server.ranges = append(server.ranges, r.Header.Get("Range"))
+		ignoreRange := server.ignoreRange
+		server.Unlock()
+
+		if ignoreRange {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "file.mkv", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(httpServer.Close)
+
+	return server, httpServer
+}
+
+func newTestService(t *testing.T) (*downloadService, *fakeStore, *fakeIngester) {
+	t.Helper()
+
+	store := &fakeStore{Mutex: &sync.Mutex{}, downloads: make(map[uuid.UUID]Download)}
+	ingester := &fakeIngester{}
+	service, err := New(Config{StagingPath: t.TempDir(), AllowPrivateAddresses: true}, store, ingester, event.New())
+	if err != nil {
+		t.Fatalf("failed to create download service: %v", err)
+	}
+	service.ctx = context.Background()
+
+	return service, store, ingester
+}
+
+func testContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i % 251)
+	}
+
+	return content
+}
+
+func checksumOf(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// claim creates a download of the URL provided, and claims it as a worker would.
+func claim(t *testing.T, service *downloadService, url string, checksum *string) (*Download, *activeDownload, context.Context) {
+	t.Helper()
+
+	created, err := service.CreateDownload(url, nil, checksum, nil)
+	if err != nil {
+		t.Fatalf("failed to create download: %v", err)
+	}
+
+	download, active, ctx := service.claimQueuedDownload()
+	if download != created {
+		t.Fatalf("expected created download to be claimed, got %v", download)
+	}
+
+	return download, active, ctx
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header        string
+		expectedStart int64
+		expectedTotal int64 // -1 if unknown
+		expectedErr   bool
+	}{
+		{"bytes 0-99/100", 0, 100, false},
+		{"bytes 50-99/100", 50, 100, false},
+		{"bytes 1024-2047/*", 1024, -1, false},
+		{"bytes 0-0/1", 0, 1, false},
+		{"", 0, 0, true},
+		{"bytes */100", 0, 0, true},
+		{"bytes 0-99", 0, 0, true},
+		{"bits 0-99/100", 0, 0, true},
+		{"bytes -1-99/100", 0, 0, true},
+		{"bytes 0-99/100 ", 0, 0, true},
+		{"bytes 99999999999999999999-0/100", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			start, total, err := parseContentRange(test.header)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error, got (%d, %v)", start, total)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if start != test.expectedStart {
+				t.Errorf("expected start %d, got %d", test.expectedStart, start)
+			}
+			if test.expectedTotal == -1 && total != nil {
+				t.Errorf("expected unknown total, got %d", *total)
+			} else if test.expectedTotal != -1 && (total == nil || *total != test.expectedTotal) {
+				t.Errorf("expected total %d, got %v", test.expectedTotal, total)
+			}
+		})
+	}
+}
+
+func TestFileChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(path, []byte("abc"), 0o644); err != nil {
+		t.Fatalf("failed to write content: %v", err)
+	}
+
+	// SHA-256 test vector from FIPS 180-2
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		t.Fatalf("failed to compute checksum: %v", err)
+	}
+	if expected := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; checksum != expected {
+		t.Errorf("expected checksum %s, got %s", expected, checksum)
+	}
+
+	if _, err := fileChecksum(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestCreateDownload_Validation(t *testing.T) {
+	validChecksum := checksumOf([]byte("content"))
+	tests := []struct {
+		name        string
+		url         string
+		fileName    *string
+		checksum    *string
+		expectedErr error
+	}{
+		{"valid", "https://example.com/media/file.mkv", nil, nil, nil},
+		{"valid with checksum", "http://example.com/file.mkv", nil, &validChecksum, nil},
+		{"relative URL", "/file.mkv", nil, nil, ErrInvalidURL},
+		{"unsupported scheme", "ftp://example.com/file.mkv", nil, nil, ErrInvalidURL},
+		{"missing host", "https:///file.mkv", nil, nil, ErrInvalidURL},
+		{"no file name in URL", "https://example.com/", nil, nil, ErrInvalidFileName},
+		{"path traversal in file name", "https://example.com/file.mkv", ptr("../file.mkv"), nil, ErrInvalidFileName},
+		{"nested file name", "https://example.com/file.mkv", ptr("dir/file.mkv"), nil, ErrInvalidFileName},
+		{"checksum not hex", "https://example.com/file.mkv", nil, ptr(strings.Repeat("z", 64)), ErrInvalidChecksum},
+		{"checksum wrong length", "https://example.com/file.mkv", nil, ptr("abcd"), ErrInvalidChecksum},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, _, _ := newTestService(t)
+			if _, err := service.CreateDownload(test.url, test.fileName, test.checksum, nil); !errors.Is(err, test.expectedErr) {
+				t.Errorf("expected error %v, got %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestCreateDownload_NormalisesChecksum(t *testing.T) {
+	service, _, _ := newTestService(t)
+	checksum := strings.ToUpper(checksumOf([]byte("content")))
+
+	download, err := service.CreateDownload("https://example.com/file.mkv", nil, &checksum, nil)
+	if err != nil {
+		t.Fatalf("failed to create download: %v", err)
+	}
+	if *download.Checksum != strings.ToLower(checksum) {
+		t.Errorf("expected checksum to be lower-cased, got %s", *download.Checksum)
+	}
+	if download.FileName != "file.mkv" {
+		t.Errorf("expected file name to be derived from URL, got %s", download.FileName)
+	}
+}
+
+func TestPerformDownload(t *testing.T) {
+	content := testContent(100_000)
+	server, httpServer := newRangeServer(t, content)
+	service, store, ingester := newTestService(t)
+
+	checksum := checksumOf(content)
+	download, active, ctx := claim(t, service, httpServer.URL+"/file.mkv", &checksum)
+	err := service.performDownload(ctx, download, active)
+	service.finishDownload(ctx, download, active, err)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+
+	staged, err := os.ReadFile(service.stagingPath(download.ID))
+	if err != nil || !bytes.Equal(staged, content) {
+		t.Fatalf("expected staged content to match remote content (err %v)", err)
+	}
+	if len(server.ranges) != 1 || server.ranges[0] != "" {
+		t.Errorf("expected a single request without a range, got %q", server.ranges)
+	}
+
+	if download.State != Complete || download.Size == nil || *download.Size != int64(len(content)) {
+		t.Errorf("expected complete download of %d bytes, got %s of %v bytes", len(content), download.State, download.Size)
+	}
+	if persisted := store.downloads[download.ID]; persisted.State != Complete || persisted.IngestID == nil {
+		t.Errorf("expected completed state to be persisted, got %+v", persisted)
+	}
+	if len(ingester.ingested) != 1 || ingester.ingested[0] != service.stagingPath(download.ID) {
+		t.Errorf("expected staged content to be ingested, got %v", ingester.ingested)
+	}
+	if _, ok := service.active[download.ID]; ok {
+		t.Errorf("expected download to no longer be active")
+	}
+}
+
+func TestPerformDownload_Resume(t *testing.T) {
+	content := testContent(100_000)
+	server, httpServer := newRangeServer(t, content)
+	service, _, _ := newTestService(t)
+
+	checksum := checksumOf(content)
+	download, active, ctx := claim(t, service, httpServer.URL+"/file.mkv", &checksum)
+
+	// Stage part of the content, as a previous attempt would have
+	const staged = 40_000
+	if err := os.WriteFile(service.stagingPath(download.ID), content[:staged], 0o644); err != nil {
+		t.Fatalf("failed to stage content: %v", err)
+	}
+
+	if err := service.performDownload(ctx, download, active); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+
+	if len(server.ranges) != 1 || server.ranges[0] != "bytes=40000-" {
+		t.Errorf("expected a single range request from the staged offset, got %q", server.ranges)
+	}
+	if result, err := os.ReadFile(service.stagingPath(download.ID)); err != nil || !bytes.Equal(result, content) {
+		t.Fatalf("expected resumed content to match remote content (err %v)", err)
+	}
+	if download.Size == nil || *download.Size != int64(len(content)) {
+		t.Errorf("expected size to be taken from the content range, got %v", download.Size)
+	}
+
+	progress := active.progress()
+	if active.startBytes != staged || progress.DownloadedBytes != int64(len(content)) {
+		t.Errorf("expected progress to account for staged content, got %+v (started at %d)", progress, active.startBytes)
+	}
+}
+
+func TestPerformDownload_ResumeIgnoredByServer(t *testing.T) {
+	content := testContent(10_000)
+	server, httpServer := newRangeServer(t, content)
+	server.ignoreRange = true
+	service, _, _ := newTestService(t)
+
+	download, active, ctx := claim(t, service, httpServer.URL+"/file.mkv", nil)
+	if err := os.WriteFile(service.stagingPath(download.ID), []byte("stale content"), 0o644); err != nil {
+		t.Fatalf("failed to stage content: %v", err)
+	}
+
+	if err := service.performDownload(ctx, download, active); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+
+	// The staged content must be replaced, rather than appended to
+	if result, err := os.ReadFile(service.stagingPath(download.ID)); err != nil || !bytes.Equal(result, content) {
+		t.Fatalf("expected content to be restarted when range is ignored (err %v)", err)
+	}
+}
+
+func TestPerformDownload_StagedContentAlreadyComplete(t *testing.T) {
+	content := testContent(10_000)
+	server, httpServer := newRangeServer(t, content)
+	service, _, _ := newTestService(t)
+
+	checksum := checksumOf(content)
+	download, active, ctx := claim(t, service, httpServer.URL+"/file.mkv", &checksum)
+	size := int64(len(content))
+	download.Size = &size
+	if err := os.WriteFile(service.stagingPath(download.ID), content, 0o644); err != nil {
+		t.Fatalf("failed to stage content: %v", err)
+	}
+
+	if err := service.performDownload(ctx, download, active); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if len(server.ranges) != 0 {
+		t.Errorf("expected no requests when the staged content is complete, got %q", server.ranges)
+	}
+}
+
+func TestPerformDownload_RangeNotSatisfiable(t *testing.T) {
+	content := testContent(10_000)
+	_, httpServer := newRangeServer(t, content)
+	service, _, _ := newTestService(t)
+
+	download, active, ctx := claim(t, service, httpServer.URL+"/file.mkv", nil)
+	if err := os.WriteFile(service.stagingPath(download.ID), testContent(20_000), 0o644); err != nil {
+		t.Fatalf("failed to stage content: %v", err)
+	}
+
+	if err := service.performDownload(ctx, download, active); err == nil {
+		t.Fatalf("expected download to fail when staged content exceeds the remote content")
+	}
+	if _, err := os.Stat(service.stagingPath(download.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected staged content to be discarded, got %v", err)
+	}
+}
+
+func TestPerformDownload_UnexpectedContentRange(t *testing.T) {
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-9/10")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(testContent(10))
+	}))
+	t.Cleanup(httpServer.Close)
+	service, _, _ := newTestService(t)
+
+	download, active, ctx := claim(t, service, httpServer.URL+"/file.mkv", nil)
+	if err := os.WriteFile(service.stagingPath(download.ID), testContent(5), 0o644); err != nil {
+		t.Fatalf("failed to stage content: %v", err)
+	}
+
+	if err := service.performDownload(ctx, download, active); err == nil {
+		t.Fatalf("expected download to fail when content does not start at the requested offset")
+	}
+	if result, err := os.ReadFile(service.stagingPath(download.ID)); err != nil || len(result) != 5 {
+		t.Errorf("expected staged content to be untouched (err %v)", err)
+	}
+}
+
+func TestPerformDownload_ChecksumMismatch(t *testing.T) {
+	content := testContent(10_000)
+	_, httpServer := newRangeServer(t, content)
+	service, store, ingester := newTestService(t)
+
+	checksum := checksumOf([]byte("other content"))
+	download, active, ctx := claim(t, service, httpServer.URL+"/file.mkv", &checksum)
+	err := service.performDownload(ctx, download, active)
+	service.finishDownload(ctx, download, active, err)
+
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected error %v, got %v", ErrChecksumMismatch, err)
+	}
+	if _, err := os.Stat(service.stagingPath(download.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected mismatched content to be discarded, got %v", err)
+	}
+	if download.State != Failed || download.Error == nil || store.downloads[download.ID].State != Failed {
+		t.Errorf("expected download to have failed, got %s", download.State)
+	}
+	if len(ingester.ingested) != 0 {
+		t.Errorf("expected mismatched content to not be ingested")
+	}
+}
+
+func TestPauseAndResume_WhileWorkerStopping(t *testing.T) {
+	service, _, _ := newTestService(t)
+	download, active, ctx := claim(t, service, "https://example.com/file.mkv", nil)
+
+	if err := service.PauseDownload(download.ID); err != nil {
+		t.Fatalf("failed to pause download: %v", err)
+	}
+	if !errors.Is(context.Cause(ctx), errDownloadPaused) {
+		t.Fatalf("expected download to be interrupted by pause, got %v", context.Cause(ctx))
+	}
+	if err := service.ResumeDownload(download.ID); err != nil {
+		t.Fatalf("failed to resume download: %v", err)
+	}
+
+	// The first worker has not yet stopped, so the download must not be claimed again
+	if claimed, _, _ := service.claimQueuedDownload(); claimed != nil {
+		t.Fatalf("expected download to not be claimed while its previous worker is stopping")
+	}
+
+	service.finishDownload(ctx, download, active, context.Cause(ctx))
+	if download.State != Queued {
+		t.Fatalf("expected resumed download to remain queued, got %s", download.State)
+	}
+
+	claimed, newActive, newCtx := service.claimQueuedDownload()
+	if claimed != download || newActive == active {
+		t.Fatalf("expected download to be claimed once its previous worker has stopped")
+	}
+
+	// A late finish from the previous worker must not remove the entry of the new worker
+	service.finishDownload(ctx, download, active, context.Cause(ctx))
+	if service.active[download.ID] != newActive || newCtx.Err() != nil {
+		t.Errorf("expected the active download of the new worker to be retained")
+	}
+}
+
+func TestCancelDownload_RemovesStagedContent(t *testing.T) {
+	service, store, _ := newTestService(t)
+	download, active, ctx := claim(t, service, "https://example.com/file.mkv", nil)
+	if err := os.WriteFile(service.stagingPath(download.ID), testContent(10), 0o644); err != nil {
+		t.Fatalf("failed to stage content: %v", err)
+	}
+
+	if err := service.CancelDownload(download.ID); err != nil {
+		t.Fatalf("failed to cancel download: %v", err)
+	}
+	if _, ok := store.downloads[download.ID]; ok || service.GetDownload(download.ID) != nil {
+		t.Errorf("expected cancelled download to be removed")
+	}
+
+	// The worker performing the download removes the staged content once it has stopped
+	if _, err := os.Stat(service.stagingPath(download.ID)); err != nil {
+		t.Fatalf("expected staged content to remain until the worker has stopped, got %v", err)
+	}
+	service.finishDownload(ctx, download, active, context.Cause(ctx))
+	if _, err := os.Stat(service.stagingPath(download.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected staged content to be removed, got %v", err)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,63 @@
+package download
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+type Store struct{}
+
+func (store *Store) SaveDownload(db database.Queryable, download *Download) error {
+	if _, err := db.Exec(`
+		INSERT INTO download(id, created_at, updated_at, url, file_name, size, checksum, tmdb_id, state)
+		VALUES($1, current_timestamp, current_timestamp, $2, $3, $4, $5, $6, $7)`,
+		download.ID, download.URL, download.FileName, download.Size, download.Checksum, download.TmdbID, download.State,
+	); err != nil {
+		return fmt.Errorf("failed to create download row: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateDownload updates the mutable state of the download provided (state, size, error and ingest ID).
+func (store *Store) UpdateDownload(db database.Queryable, download *Download) error {
+	if _, err := db.Exec(`
+		UPDATE download
+		SET updated_at=current_timestamp, size=$2, state=$3, error=$4, ingest_id=$5
+		WHERE id=$1`,
+		download.ID, download.Size, download.State, download.Error, download.IngestID,
+	); err != nil {
+		return fmt.Errorf("failed to update download %s: %w", download.ID, err)
+	}
+
+	return nil
+}
+
+func (store *Store) GetDownload(db database.Queryable, downloadID uuid.UUID) (*Download, error) {
+	var dest Download
+	if err := db.Get(&dest, `SELECT * FROM download WHERE id=$1`, downloadID); err != nil {
+		return nil, fmt.Errorf("failed to find download %s: %w", downloadID, err)
+	}
+
+	return &dest, nil
+}
+
+// ListDownloads returns all downloads, oldest first.
+func (store *Store) ListDownloads(db database.Queryable) ([]*Download, error) {
+	var dest []*Download
+	if err := db.Select(&dest, `SELECT * FROM download ORDER BY created_at`); err != nil {
+		return nil, fmt.Errorf("failed to select downloads: %w", err)
+	}
+
+	return dest, nil
+}
+
+func (store *Store) DeleteDownload(db database.Queryable, downloadID uuid.UUID) error {
+	if _, err := db.Exec(`DELETE FROM download WHERE id=$1`, downloadID); err != nil {
+		return fmt.Errorf("failed to delete download %s: %w", downloadID, err)
+	}
+
+	return nil
+}
@@ -59,8 +59,15 @@ const (
 	IngestCompleteEvent Event = "ingest:complete"
 
 	NewMediaEvent    Event = "media:new"
+	UpdateMediaEvent Event = "media:update"
 	DeleteMediaEvent Event = "media:delete"
 
+	// ReplaceMediaEvent is dispatched when the source of existing media
+	// is replaced by a newly ingested file.
+	ReplaceMediaEvent Event = "media:replace"
+
+	MissingEpisodeEvent Event = "media:episode:missing"
+
 	TranscodeUpdateEvent       Event = "transcode:task:update"
 	TranscodeCompleteEvent     Event = "transcode:task:complete"
 	TranscodeTaskProgressEvent Event = "transcode:task:update:progress"
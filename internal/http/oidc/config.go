@@ -0,0 +1,50 @@
+package oidc
+
+// Config contains the configuration used to allow users to login
+// to Thea using an external OpenID Connect identity provider.
+type Config struct {
+	Enabled bool `toml:"enabled" env:"OIDC_ENABLED" env-default:"false"`
+
+	// The issuer URL of the identity provider. The provider configuration is
+	// discovered from the '.well-known/openid-configuration' document of the issuer.
+	IssuerURL string `toml:"issuer_url" env:"OIDC_ISSUER_URL"`
+
+	// The credentials of the client registered with the identity provider. The
+	// client secret may be omitted for public clients (PKCE is always used).
+	ClientID     string `toml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string `toml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+
+	// The URL of Thea's OIDC callback endpoint (e.g. 'https://thea.home/api/thea/v1/auth/oidc/callback'),
+	// which must be registered as a redirect URI with the identity provider.
+	RedirectURL string `toml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+
+	// The URL the browser is redirected to once the login has completed.
+	PostLoginRedirectURL string `toml:"post_login_redirect_url" env-default:"/"`
+
+	Scopes []string `toml:"scopes" env-default:"openid,profile,email"`
+
+	// The ID token claims used to determine the username, and the groups, of
+	// a user. If the username claim is missing, the email claim is used instead.
+	UsernameClaim string `toml:"username_claim" env-default:"preferred_username"`
+	GroupsClaim   string `toml:"groups_claim" env-default:"groups"`
+
+	// If enabled, a Thea user is created the first time an unknown user logs
+	// in via the identity provider. Otherwise, only users which are already known
+	// to Thea (see LinkByEmail) are able to login.
+	AutoProvision bool `toml:"auto_provision" env-default:"false"`
+
+	// If enabled, the first login of a user via the identity provider is linked to the
+	// existing Thea user whose username is the email address of the user. Identities are
+	// only linked if the identity provider asserts that the email address has been verified
+	// (the 'email_verified' claim), as the other claims (e.g. 'preferred_username') can
+	// often be chosen by the user.
+	LinkByEmail bool `toml:"link_by_email" env-default:"false"`
+
+	// Maps the groups provided by the identity provider to the labels of Thea roles, and to
+	// Thea permissions. If configured, the roles (and/or permissions) of the user are replaced
+	// with those mapped from their groups each time they login via the identity provider. Note
+	// that this includes any permissions granted directly to the user by an administrator, which
+	// are overwritten on the next login if they are not mapped from the groups of the user.
+	GroupRoles       map[string][]string `toml:"group_roles"`
+	GroupPermissions map[string][]string `toml:"group_permissions"`
+}
@@ -0,0 +1,407 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+const (
+	httpRequestTimeout = time.Second * 15
+
+	// The minimum time between fetches of the JWKS of the provider, which prevents
+	// tokens with unknown key IDs from causing excessive requests to the provider.
+	minKeyRefreshInterval = time.Minute
+
+	// discoveryTTL is how long the discovered configuration of the provider is cached for
+	discoveryTTL = time.Hour
+)
+
+var (
+	ErrDisabled          = errors.New("OIDC login is not enabled")
+	ErrIDTokenInvalid    = errors.New("ID token is invalid")
+	ErrSigningKeyUnknown = errors.New("ID token is signed with an unknown key")
+
+	// The signing algorithms which ID tokens may be signed with. The symmetric (HS*)
+	// algorithms are deliberately excluded, as is 'none'.
+	supportedSigningAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+	log = logger.Get("OIDC")
+)
+
+type (
+	// discoveryDocument contains the parts of the OpenID provider
+	// metadata (from the providers discovery document) which Thea uses.
+	discoveryDocument struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	tokenResponse struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		IDToken     string `json:"id_token"`
+	}
+
+	// Identity is the verified identity of a user, as asserted by
+	// the ID token issued by the identity provider.
+	Identity struct {
+		Issuer   string
+		Subject  string
+		Username string
+		Email    string
+		Groups   []string
+
+		// EmailVerified is true if the identity provider asserts that
+		// the user has verified that they own the email address.
+		EmailVerified bool
+	}
+
+	// Provider implements the OpenID Connect authorization code flow (with PKCE)
+	// against the configured identity provider. The configuration and signing keys
+	// of the provider are discovered lazily, and cached.
+	Provider struct {
+		*sync.Mutex
+		config     Config
+		httpClient *http.Client
+
+		discovery    *discoveryDocument
+		discoveredAt time.Time
+
+		keys          map[string]any
+		keysFetchedAt time.Time
+	}
+)
+
+func NewProvider(config Config) *Provider {
+	return &Provider{
+		Mutex:      &sync.Mutex{},
+		config:     config,
+		httpClient: &http.Client{Timeout: httpRequestTimeout},
+		keys:       make(map[string]any),
+	}
+}
+
+func (provider *Provider) Enabled() bool { return provider.config.Enabled }
+
+func (provider *Provider) Config() Config { return provider.config }
+
+// AuthCodeURL returns the URL of the identity providers authorization endpoint, which the
+// user should be redirected to in order to login. The state and nonce provided are returned
+// by the identity provider (in the callback and ID token respectively), and the code
+// challenge is derived from the PKCE code verifier (see NewCodeVerifier).
+func (provider *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	discovery, err := provider.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("authorization endpoint of provider is invalid: %w", err)
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.config.ClientID)
+	query.Set("redirect_uri", provider.config.RedirectURL)
+	query.Set("scope", strings.Join(provider.scopes(), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange exchanges the authorization code provided (which was issued to the callback of
+// Thea) for an ID token, which is then verified. The code verifier must be the verifier which the
+// code challenge (provided to AuthCodeURL) was derived from, and the nonce must be the nonce
+// provided to AuthCodeURL.
+func (provider *Provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*Identity, error) {
+	discovery, err := provider.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.config.RedirectURL)
+	form.Set("client_id", provider.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if provider.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(provider.config.ClientID), url.QueryEscape(provider.config.ClientSecret))
+	}
+
+	var tokens tokenResponse
+	if err := provider.doJSON(request, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response did not contain an ID token", ErrIDTokenInvalid)
+	}
+
+	return provider.verifyIDToken(ctx, discovery, tokens.IDToken, nonce)
+}
+
+// verifyIDToken verifies the signature and claims of the ID token provided (as per the
+// OpenID Connect Core specification, section 3.1.3.7), returning the identity it asserts.
+func (provider *Provider) verifyIDToken(ctx context.Context, discovery *discoveryDocument, rawToken string, nonce string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(
+		rawToken,
+		claims,
+		func(tkn *jwt.Token) (any, error) {
+			keyID, _ := tkn.Header["kid"].(string)
+			return provider.signingKey(ctx, discovery, keyID)
+		},
+		jwt.WithValidMethods(supportedSigningAlgorithms),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(provider.config.ClientID),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIDTokenInvalid, err)
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: missing expiry", ErrIDTokenInvalid)
+	}
+	if tokenNonce, _ := claims["nonce"].(string); tokenNonce == "" || tokenNonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrIDTokenInvalid)
+	}
+
+	// If the token has multiple audiences, the authorized party must be Thea
+	if audiences, err := claims.GetAudience(); err == nil && len(audiences) > 1 {
+		if azp, _ := claims["azp"].(string); azp != provider.config.ClientID {
+			return nil, fmt.Errorf("%w: authorized party mismatch", ErrIDTokenInvalid)
+		}
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrIDTokenInvalid)
+	}
+
+	identity := &Identity{Issuer: discovery.Issuer, Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified = boolClaim(claims["email_verified"])
+	identity.Username, _ = claims[provider.config.UsernameClaim].(string)
+	if identity.Username == "" {
+		identity.Username = identity.Email
+	}
+	identity.Groups = stringSliceClaim(claims[provider.config.GroupsClaim])
+
+	return identity, nil
+}
+
+// signingKey returns the public key with the ID provided from the JWKS of the provider. If
+// no such key is known, the JWKS is fetched again (as the provider may have rotated it's keys).
+func (provider *Provider) signingKey(ctx context.Context, discovery *discoveryDocument, keyID string) (any, error) {
+	provider.Lock()
+	defer provider.Unlock()
+
+	if key, ok := provider.findKey(keyID); ok {
+		return key, nil
+	}
+	if time.Since(provider.keysFetchedAt) < minKeyRefreshInterval {
+		return nil, ErrSigningKeyUnknown
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var keySet jsonWebKeySet
+	if err := provider.doJSON(request, &keySet); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS of provider: %w", err)
+	}
+
+	keys := make(map[string]any, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Debugf("Ignoring key %s from provider JWKS: %v\n", jwk.KeyID, err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	provider.keys = keys
+	provider.keysFetchedAt = time.Now()
+	if key, ok := provider.findKey(keyID); ok {
+		return key, nil
+	}
+
+	return nil, ErrSigningKeyUnknown
+}
+
+// findKey returns the key with the ID provided. If the ID is empty (the token has no
+// 'kid' header), then the key is only returned if the provider has exactly one key.
+//
+// NB: The caller must hold the lock of the provider.
+func (provider *Provider) findKey(keyID string) (any, bool) {
+	if keyID == "" {
+		if len(provider.keys) == 1 {
+			for _, key := range provider.keys {
+				return key, true
+			}
+		}
+
+		return nil, false
+	}
+
+	key, ok := provider.keys[keyID]
+	return key, ok
+}
+
+// discover returns the configuration of the provider, fetching the discovery document
+// of the provider if it has not yet been fetched (or the cached document is stale).
+func (provider *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	if !provider.config.Enabled {
+		return nil, ErrDisabled
+	}
+
+	provider.Lock()
+	defer provider.Unlock()
+	if provider.discovery != nil && time.Since(provider.discoveredAt) < discoveryTTL {
+		return provider.discovery, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(provider.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var discovery discoveryDocument
+	if err := provider.doJSON(request, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to discover provider configuration: %w", err)
+	}
+
+	// The issuer in the document MUST match the issuer we requested the document from
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(provider.config.IssuerURL, "/") {
+		return nil, fmt.Errorf("issuer of provider (%s) does not match configured issuer (%s)", discovery.Issuer, provider.config.IssuerURL)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("provider configuration is missing required endpoints")
+	}
+
+	provider.discovery = &discovery
+	provider.discoveredAt = time.Now()
+	return provider.discovery, nil
+}
+
+func (provider *Provider) doJSON(request *http.Request, target any) error {
+	log.Verbosef("%s -> %s\n", request.Method, request.URL)
+	response, err := provider.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %d: %s", response.StatusCode, string(body))
+	}
+
+	return json.Unmarshal(body, target)
+}
+
+func (provider *Provider) scopes() []string {
+	scopes := provider.config.Scopes
+	for _, scope := range scopes {
+		if scope == "openid" {
+			return scopes
+		}
+	}
+
+	return append([]string{"openid"}, scopes...)
+}
+
+// NewCodeVerifier generates a random PKCE code verifier, returning the
+// verifier along with the (S256) code challenge derived from it.
+func NewCodeVerifier() (string, string, error) {
+	verifier, err := RandomValue()
+	if err != nil {
+		return "", "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(challenge[:]), nil
+}
+
+// RandomValue generates a random URL-safe value, suitable
+// for use as the state or nonce of an authorization request.
+func RandomValue() (string, error) {
+	value := make([]byte, 32)
+	if _, err := rand.Read(value); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(value), nil
+}
+
+func stringSliceClaim(claim any) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []any:
+		output := make([]string, 0, len(value))
+		for _, v := range value {
+			if str, ok := v.(string); ok {
+				output = append(output, str)
+			}
+		}
+
+		return output
+	default:
+		return nil
+	}
+}
+
+// boolClaim returns the value of a boolean claim. Some identity providers encode
+// boolean claims as strings, so the string "true" is also accepted.
+func boolClaim(claim any) bool {
+	switch value := claim.(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,630 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "thea"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://thea.test/api/thea/v1/auth/oidc/callback"
+	testNonce        = "nonce-value"
+)
+
+// testIdentityProvider is an OpenID provider served by an httptest server, which
+// issues ID tokens signed with a generated key.
+type testIdentityProvider struct {
+	*sync.Mutex
+	server *httptest.Server
+	issuer string
+
+	keys map[string]any // private keys, by key ID
+
+	discoveryRequests int
+	jwksRequests      int
+	tokenRequest      *http.Request
+	tokenForm         url.Values
+
+	// idToken is returned from the token endpoint
+	idToken string
+}
+
+func newTestIdentityProvider(t *testing.T) *testIdentityProvider {
+	t.Helper()
+
+	idp := &testIdentityProvider{Mutex: &sync.Mutex{}, keys: make(map[string]any)}
+	idp.addRSAKey(t, "rsa-key")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		idp.Lock()
+		idp.discoveryRequests++
+		idp.Unlock()
+
+		writeJSON(w, discoveryDocument{
+			Issuer:                idp.issuer,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.Lock()
+		defer idp.Unlock()
+
+		idp.jwksRequests++
+		writeJSON(w, idp.keySet())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		idp.Lock()
+		defer idp.Unlock()
+
+		idp.tokenRequest, idp.tokenForm = r, r.PostForm
+		writeJSON(w, tokenResponse{AccessToken: "access-token", TokenType: "Bearer", IDToken: idp.idToken})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// rsaKeys caches generated RSA keys by key ID, as generating them is slow.
+var rsaKeys = struct {
+	*sync.Mutex
+	keys map[string]*rsa.PrivateKey
+}{&sync.Mutex{}, make(map[string]*rsa.PrivateKey)}
+
+func rsaKey(t *testing.T, keyID string) *rsa.PrivateKey {
+	t.Helper()
+
+	rsaKeys.Lock()
+	defer rsaKeys.Unlock()
+	if key, ok := rsaKeys.keys[keyID]; ok {
+		return key
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	rsaKeys.keys[keyID] = key
+	return key
+}
+
+func (idp *testIdentityProvider) addRSAKey(t *testing.T, keyID string) {
+	t.Helper()
+
+	key := rsaKey(t, keyID)
+	idp.Lock()
+	defer idp.Unlock()
+	idp.keys[keyID] = key
+}
+
+func (idp *testIdentityProvider) addECKey(t *testing.T, keyID string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+
+	idp.Lock()
+	defer idp.Unlock()
+	idp.keys[keyID] = key
+}
+
+// keySet returns the JWKS containing the public keys of the provider.
+//
+// NB: The caller must hold the lock of the provider.
+func (idp *testIdentityProvider) keySet() jsonWebKeySet {
+	var keySet jsonWebKeySet
+	for keyID, key := range idp.keys {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			keySet.Keys = append(keySet.Keys, jsonWebKey{
+				KeyID:   keyID,
+				KeyType: "RSA",
+				Use:     "sig",
+				N:       encodeBigInt(key.N),
+				E:       encodeBigInt(big.NewInt(int64(key.E))),
+			})
+		case *ecdsa.PrivateKey:
+			keySet.Keys = append(keySet.Keys, jsonWebKey{
+				KeyID:   keyID,
+				KeyType: "EC",
+				Use:     "sig",
+				Curve:   "P-256",
+				X:       encodeBigInt(key.X),
+				Y:       encodeBigInt(key.Y),
+			})
+		}
+	}
+
+	return keySet
+}
+
+// validClaims returns the claims of an ID token which the provider under test should accept.
+func (idp *testIdentityProvider) validClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":                idp.issuer,
+		"aud":                testClientID,
+		"sub":                "subject-1",
+		"iat":                now.Unix(),
+		"exp":                now.Add(time.Hour).Unix(),
+		"nonce":              testNonce,
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"groups":             []string{"admins", "users"},
+	}
+}
+
+// sign returns the ID token with the claims provided, signed with the key provided.
+func sign(t *testing.T, method jwt.SigningMethod, key any, keyID string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if keyID != "" {
+		token.Header["kid"] = keyID
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign ID token: %v", err)
+	}
+
+	return signed
+}
+
+func (idp *testIdentityProvider) setIDToken(idToken string) {
+	idp.Lock()
+	defer idp.Unlock()
+	idp.idToken = idToken
+}
+
+func (idp *testIdentityProvider) config() Config {
+	return Config{
+		Enabled:       true,
+		IssuerURL:     idp.issuer,
+		ClientID:      testClientID,
+		ClientSecret:  testClientSecret,
+		RedirectURL:   testRedirectURL,
+		Scopes:        []string{"profile", "email"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func encodeBigInt(value *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(value.Bytes())
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	provider := NewProvider(idp.config())
+
+	authURL, err := provider.AuthCodeURL(context.Background(), "state-value", testNonce, "challenge-value")
+	if err != nil {
+		t.Fatalf("failed to build auth code URL: %v", err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("failed to parse auth code URL: %v", err)
+	}
+	if endpoint := parsed.Scheme + "://" + parsed.Host + parsed.Path; endpoint != idp.server.URL+"/authorize" {
+		t.Errorf("expected discovered authorization endpoint, got %s", endpoint)
+	}
+
+	expected := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid profile email",
+		"state":                 "state-value",
+		"nonce":                 testNonce,
+		"code_challenge":        "challenge-value",
+		"code_challenge_method": "S256",
+	}
+	for key, value := range expected {
+		if got := parsed.Query().Get(key); got != value {
+			t.Errorf("expected %s=%q, got %q", key, value, got)
+		}
+	}
+}
+
+func TestDiscover_Cached(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	provider := NewProvider(idp.config())
+
+	for i := 0; i < 3; i++ {
+		if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err != nil {
+			t.Fatalf("failed to build auth code URL: %v", err)
+		}
+	}
+	if idp.discoveryRequests != 1 {
+		t.Errorf("expected discovery document to be fetched once, got %d requests", idp.discoveryRequests)
+	}
+
+	// Stale documents are fetched again
+	provider.discoveredAt = time.Now().Add(-discoveryTTL - time.Second)
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err != nil {
+		t.Fatalf("failed to build auth code URL: %v", err)
+	}
+	if idp.discoveryRequests != 2 {
+		t.Errorf("expected stale discovery document to be fetched again, got %d requests", idp.discoveryRequests)
+	}
+}
+
+func TestDiscover_IssuerMismatch(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	idp.issuer = "https://attacker.example.com"
+
+	config := idp.config()
+	config.IssuerURL = idp.server.URL
+	if _, err := NewProvider(config).AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil {
+		t.Fatalf("expected discovery document with mismatched issuer to be rejected")
+	}
+}
+
+func TestDiscover_Disabled(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	config := idp.config()
+	config.Enabled = false
+
+	if _, err := NewProvider(config).AuthCodeURL(context.Background(), "state", "nonce", "challenge"); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("expected error %v, got %v", ErrDisabled, err)
+	}
+	if idp.discoveryRequests != 0 {
+		t.Errorf("expected disabled provider to make no requests, got %d", idp.discoveryRequests)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	idp.setIDToken(sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", idp.validClaims()))
+	provider := NewProvider(idp.config())
+
+	identity, err := provider.Exchange(context.Background(), "auth-code", "code-verifier", testNonce)
+	if err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+
+	expectedForm := map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          "auth-code",
+		"code_verifier": "code-verifier",
+		"redirect_uri":  testRedirectURL,
+		"client_id":     testClientID,
+	}
+	for key, value := range expectedForm {
+		if got := idp.tokenForm.Get(key); got != value {
+			t.Errorf("expected token request %s=%q, got %q", key, value, got)
+		}
+	}
+	if id, secret, ok := idp.tokenRequest.BasicAuth(); !ok || id != testClientID || secret != testClientSecret {
+		t.Errorf("expected token request to authenticate with client credentials, got (%q, %q, %v)", id, secret, ok)
+	}
+
+	expected := &Identity{
+		Issuer:        idp.issuer,
+		Subject:       "subject-1",
+		Username:      "alice",
+		Email:         "alice@example.com",
+		Groups:        []string{"admins", "users"},
+		EmailVerified: true,
+	}
+	if !reflect.DeepEqual(identity, expected) {
+		t.Errorf("expected identity %+v, got %+v", expected, identity)
+	}
+}
+
+func TestExchange_PublicClient(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	idp.setIDToken(sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", idp.validClaims()))
+
+	config := idp.config()
+	config.ClientSecret = ""
+	if _, err := NewProvider(config).Exchange(context.Background(), "auth-code", "code-verifier", testNonce); err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+
+	if _, _, ok := idp.tokenRequest.BasicAuth(); ok {
+		t.Errorf("expected public client to not send client credentials")
+	}
+	if got := idp.tokenForm.Get("code_verifier"); got != "code-verifier" {
+		t.Errorf("expected code verifier to be sent, got %q", got)
+	}
+}
+
+func TestExchange_IdentityClaims(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(claims jwt.MapClaims)
+		expected Identity
+	}{
+		{
+			name:     "username falls back to email",
+			modify:   func(claims jwt.MapClaims) { delete(claims, "preferred_username") },
+			expected: Identity{Username: "alice@example.com", Email: "alice@example.com", EmailVerified: true, Groups: []string{"admins", "users"}},
+		},
+		{
+			name:     "unverified email",
+			modify:   func(claims jwt.MapClaims) { claims["email_verified"] = false },
+			expected: Identity{Username: "alice", Email: "alice@example.com", Groups: []string{"admins", "users"}},
+		},
+		{
+			name:     "string email_verified claim",
+			modify:   func(claims jwt.MapClaims) { claims["email_verified"] = "true" },
+			expected: Identity{Username: "alice", Email: "alice@example.com", EmailVerified: true, Groups: []string{"admins", "users"}},
+		},
+		{
+			name:     "missing email_verified claim",
+			modify:   func(claims jwt.MapClaims) { delete(claims, "email_verified") },
+			expected: Identity{Username: "alice", Email: "alice@example.com", Groups: []string{"admins", "users"}},
+		},
+		{
+			name:     "single group",
+			modify:   func(claims jwt.MapClaims) { claims["groups"] = "admins" },
+			expected: Identity{Username: "alice", Email: "alice@example.com", EmailVerified: true, Groups: []string{"admins"}},
+		},
+		{
+			name:     "no groups",
+			modify:   func(claims jwt.MapClaims) { delete(claims, "groups") },
+			expected: Identity{Username: "alice", Email: "alice@example.com", EmailVerified: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newTestIdentityProvider(t)
+			claims := idp.validClaims()
+			test.modify(claims)
+			idp.setIDToken(sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims))
+
+			identity, err := NewProvider(idp.config()).Exchange(context.Background(), "auth-code", "code-verifier", testNonce)
+			if err != nil {
+				t.Fatalf("failed to exchange code: %v", err)
+			}
+
+			test.expected.Issuer, test.expected.Subject = idp.issuer, "subject-1"
+			if !reflect.DeepEqual(*identity, test.expected) {
+				t.Errorf("expected identity %+v, got %+v", test.expected, *identity)
+			}
+		})
+	}
+}
+
+func TestExchange_RejectsInvalidIDTokens(t *testing.T) {
+	otherKey := rsaKey(t, "other-key")
+
+	tests := []struct {
+		name string
+
+		// idToken returns the ID token returned by the token endpoint
+		idToken func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string
+	}{
+		{
+			name: "wrong issuer",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				claims["iss"] = "https://attacker.example.com"
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "wrong audience",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				claims["aud"] = "another-client"
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "multiple audiences without authorized party",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				claims["aud"] = []string{testClientID, "another-client"}
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "multiple audiences with another authorized party",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				claims["aud"] = []string{testClientID, "another-client"}
+				claims["azp"] = "another-client"
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "expired",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				claims["exp"] = time.Now().Add(-2 * time.Minute).Unix()
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "missing expiry",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				delete(claims, "exp")
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "issued in the future",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				claims["iat"] = time.Now().Add(10 * time.Minute).Unix()
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "wrong nonce",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				claims["nonce"] = "another-nonce"
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "missing nonce",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				delete(claims, "nonce")
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "missing subject",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				delete(claims, "sub")
+				return sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", claims)
+			},
+		},
+		{
+			name: "signed with unknown key",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				return sign(t, jwt.SigningMethodRS256, otherKey, "unknown-key", claims)
+			},
+		},
+		{
+			name: "signed with another key using a known key ID",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				return sign(t, jwt.SigningMethodRS256, otherKey, "rsa-key", claims)
+			},
+		},
+		{
+			name: "signed with symmetric algorithm",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				return sign(t, jwt.SigningMethodHS256, []byte(testClientSecret), "rsa-key", claims)
+			},
+		},
+		{
+			name: "unsigned",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				return sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "rsa-key", claims)
+			},
+		},
+		{
+			name: "missing ID token",
+			idToken: func(t *testing.T, idp *testIdentityProvider, claims jwt.MapClaims) string {
+				return ""
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newTestIdentityProvider(t)
+			idp.setIDToken(test.idToken(t, idp, idp.validClaims()))
+
+			identity, err := NewProvider(idp.config()).Exchange(context.Background(), "auth-code", "code-verifier", testNonce)
+			if !errors.Is(err, ErrIDTokenInvalid) {
+				t.Fatalf("expected error %v, got identity %+v (err %v)", ErrIDTokenInvalid, identity, err)
+			}
+		})
+	}
+}
+
+func TestExchange_ECKey(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	idp.addECKey(t, "ec-key")
+	idp.setIDToken(sign(t, jwt.SigningMethodES256, idp.keys["ec-key"], "ec-key", idp.validClaims()))
+
+	if _, err := NewProvider(idp.config()).Exchange(context.Background(), "auth-code", "code-verifier", testNonce); err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+}
+
+func TestExchange_MissingKeyIDWithMultipleKeys(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	idp.addRSAKey(t, "another-key")
+	idp.setIDToken(sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "", idp.validClaims()))
+
+	if _, err := NewProvider(idp.config()).Exchange(context.Background(), "auth-code", "code-verifier", testNonce); !errors.Is(err, ErrIDTokenInvalid) {
+		t.Fatalf("expected token without key ID to be rejected when the provider has multiple keys, got %v", err)
+	}
+}
+
+func TestExchange_KeyRotation(t *testing.T) {
+	idp := newTestIdentityProvider(t)
+	idp.setIDToken(sign(t, jwt.SigningMethodRS256, idp.keys["rsa-key"], "rsa-key", idp.validClaims()))
+	provider := NewProvider(idp.config())
+
+	if _, err := provider.Exchange(context.Background(), "auth-code", "code-verifier", testNonce); err != nil {
+		t.Fatalf("failed to exchange code: %v", err)
+	}
+	if idp.jwksRequests != 1 {
+		t.Fatalf("expected JWKS to be fetched once, got %d requests", idp.jwksRequests)
+	}
+
+	// Tokens signed with a rotated key are rejected until the minimum refresh interval has passed,
+	// so that tokens with unknown key IDs do not cause excessive requests to the provider
+	idp.addRSAKey(t, "rotated-key")
+	idp.setIDToken(sign(t, jwt.SigningMethodRS256, idp.keys["rotated-key"], "rotated-key", idp.validClaims()))
+	if _, err := provider.Exchange(context.Background(), "auth-code", "code-verifier", testNonce); !errors.Is(err, ErrSigningKeyUnknown) {
+		t.Fatalf("expected error %v within refresh interval, got %v", ErrSigningKeyUnknown, err)
+	}
+	if idp.jwksRequests != 1 {
+		t.Fatalf("expected JWKS to not be fetched again within refresh interval, got %d requests", idp.jwksRequests)
+	}
+
+	provider.keysFetchedAt = time.Now().Add(-minKeyRefreshInterval - time.Second)
+	if _, err := provider.Exchange(context.Background(), "auth-code", "code-verifier", testNonce); err != nil {
+		t.Fatalf("expected rotated key to be fetched, got %v", err)
+	}
+	if idp.jwksRequests != 2 {
+		t.Fatalf("expected JWKS to be fetched again, got %d requests", idp.jwksRequests)
+	}
+}
+
+func TestNewCodeVerifier(t *testing.T) {
+	verifier, challenge, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("failed to generate code verifier: %v", err)
+	}
+
+	// RFC 7636 requires a verifier of 43-128 characters
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Errorf("expected verifier of 43-128 characters, got %d", len(verifier))
+	}
+
+	hash := sha256.Sum256([]byte(verifier))
+	if expected := base64.RawURLEncoding.EncodeToString(hash[:]); challenge != expected {
+		t.Errorf("expected S256 challenge %s, got %s", expected, challenge)
+	}
+
+	other, _, err := NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("failed to generate code verifier: %v", err)
+	}
+	if other == verifier {
+		t.Errorf("expected generated verifiers to differ")
+	}
+}
@@ -0,0 +1,334 @@
+package tmdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRequestsPerSecond = 20
+	defaultRequestBurst      = 10
+	defaultRetryBackoff      = time.Second
+	maxRetryAfterWait        = time.Minute
+
+	httpRequestTimeout = time.Second * 30
+)
+
+type (
+	// cachedResponse is the on-disk representation of a TMDB response
+	// body, alongside the time at which the cached body is considered stale.
+	cachedResponse struct {
+		ExpiresAt time.Time       `json:"expires_at"`
+		Body      json.RawMessage `json:"body"`
+	}
+
+	// inflightRequest represents a GET request which is currently being
+	// performed. Identical requests which arrive while this request is
+	// in-flight will wait on the wait group and share the result.
+	inflightRequest struct {
+		wg   sync.WaitGroup
+		body []byte
+		err  error
+	}
+
+	// client is a small HTTP client used to talk to TMDB which:
+	//   - Caches successful responses on disk (if a cache directory is configured)
+	//   - Coalesces identical in-flight requests in to a single HTTP request
+	//   - Rate-limits outgoing requests using a token bucket, honouring any
+	//     Retry-After headers returned by TMDB
+	//   - Retries requests which fail due to server-side (5xx) errors
+	client struct {
+		*sync.Mutex
+		httpClient *http.Client
+		cacheDir   string
+		limiter    *rate.Limiter
+		maxRetries int
+
+		// retryBackoff is the wait before the first retry of a failed request, which
+		// doubles with each subsequent retry (unless TMDB specifies a Retry-After).
+		retryBackoff time.Duration
+
+		// blockedUntil is set when TMDB asks us to back off (HTTP 429), and
+		// causes ALL outgoing requests to wait until this time has passed.
+		blockedUntil time.Time
+		inflight     map[string]*inflightRequest
+	}
+)
+
+func newClient(config Config) *client {
+	requestsPerSecond := config.RequestsPerSecond
+	if requestsPerSecond <= 0 {
+		requestsPerSecond = defaultRequestsPerSecond
+	}
+
+	if config.CacheDir != "" {
+		if err := os.MkdirAll(config.CacheDir, os.ModeDir|os.ModePerm); err != nil {
+			log.Warnf("Failed to create TMDB cache directory '%s', responses will not be cached: %v\n", config.CacheDir, err)
+			config.CacheDir = ""
+		}
+	}
+
+	return &client{
+		Mutex:        &sync.Mutex{},
+		httpClient:   &http.Client{Timeout: httpRequestTimeout},
+		cacheDir:     config.CacheDir,
+		limiter:      rate.NewLimiter(rate.Limit(requestsPerSecond), defaultRequestBurst),
+		maxRetries:   max(0, config.MaxRetries),
+		retryBackoff: defaultRetryBackoff,
+		inflight:     make(map[string]*inflightRequest),
+	}
+}
+
+// getJSON performs a GET request to the URL provided, and unmarshals the response
+// in to the target provided. If a non-expired response for this URL exists in the
+// cache then no HTTP request is made.
+// Successful responses are cached for the TTL provided. A TTL of zero disables
+// caching for this request.
+func (c *client) getJSON(urlPath string, ttl time.Duration, target interface{}) error {
+	cacheKey := cacheKeyForURL(urlPath)
+	if body, ok := c.readCache(cacheKey); ok {
+		log.Verbosef("GET (cached) -> %s\n", urlPath)
+		return decodeJSONResponse(body, target)
+	}
+
+	return c.fetchJSON(cacheKey, urlPath, ttl, target)
+}
+
+// getFreshJSON is the same as getJSON, however any existing cached response is ignored. The
+// fresh response is still written to the cache (replacing the existing entry) on success.
+func (c *client) getFreshJSON(urlPath string, ttl time.Duration, target interface{}) error {
+	return c.fetchJSON(cacheKeyForURL(urlPath), urlPath, ttl, target)
+}
+
+func (c *client) fetchJSON(cacheKey string, urlPath string, ttl time.Duration, target interface{}) error {
+	body, err := c.coalescedGet(cacheKey, urlPath)
+	if err != nil {
+		return err
+	}
+
+	if ttl > 0 {
+		c.writeCache(cacheKey, body, ttl)
+	}
+
+	return decodeJSONResponse(body, target)
+}
+
+// coalescedGet ensures that only one HTTP request for a given key is in-flight at
+// any one time. Callers which request the same key while a request is in-flight
+// will block until it completes, and will receive the same result.
+func (c *client) coalescedGet(key string, urlPath string) ([]byte, error) {
+	c.Lock()
+	if req, ok := c.inflight[key]; ok {
+		c.Unlock()
+		log.Verbosef("GET (coalesced) -> %s\n", urlPath)
+		req.wg.Wait()
+		return req.body, req.err
+	}
+
+	req := &inflightRequest{}
+	req.wg.Add(1)
+	c.inflight[key] = req
+	c.Unlock()
+
+	req.body, req.err = c.getWithRetry(urlPath)
+	req.wg.Done()
+
+	c.Lock()
+	delete(c.inflight, key)
+	c.Unlock()
+
+	return req.body, req.err
+}
+
+// getWithRetry performs the HTTP request, retrying if the request fails due
+// to a server-side error or rate-limiting. Backoff between retries is exponential, unless
+// the response specifies a Retry-After header.
+func (c *client) getWithRetry(urlPath string) ([]byte, error) {
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		body, retryAfter, err := c.get(urlPath)
+		if err == nil {
+			return body, nil
+		}
+
+		var failedRequestErr *FailedRequestError
+		if !errors.As(err, &failedRequestErr) || !failedRequestErr.isRetryable() || attempt >= c.maxRetries {
+			return nil, err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+
+		log.Warnf("GET %s failed (attempt %d/%d): %v. Retrying in %s\n", urlPath, attempt+1, c.maxRetries+1, err, wait)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+// get performs a single rate-limited GET request. If the response indicates a
+// failure, the error returned will be a FailedRequestError. If the response
+// contains a Retry-After header, the duration is returned (and is also
+// applied to all future requests made by this client).
+func (c *client) get(urlPath string) ([]byte, time.Duration, error) {
+	c.waitForCapacity()
+
+	log.Verbosef("GET -> %s\n", urlPath)
+	resp, err := c.httpClient.Get(urlPath) //nolint
+	if err != nil {
+		return nil, 0, &UnknownRequestError{fmt.Sprintf("failed to perform GET(%s) to TMDB: %v", urlPath, err)}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, &UnknownRequestError{fmt.Sprintf("failed to read response body: %v", err)}
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return body, 0, nil
+	}
+
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+	if retryAfter > 0 {
+		c.blockFor(retryAfter)
+	}
+
+	var tmdbError tmdbError
+	if err := json.Unmarshal(body, &tmdbError); err != nil {
+		return nil, retryAfter, &FailedRequestError{httpCode: resp.StatusCode, message: "non-OK response could not be unmarshalled", tmdbCode: -1}
+	}
+
+	return nil, retryAfter, &FailedRequestError{httpCode: resp.StatusCode, message: tmdbError.StatusMessage, tmdbCode: tmdbError.StatusCode}
+}
+
+// waitForCapacity blocks until the token bucket allows a request to be made, and
+// until any back-off period requested by TMDB has elapsed.
+func (c *client) waitForCapacity() {
+	c.Lock()
+	blockedFor := time.Until(c.blockedUntil)
+	c.Unlock()
+
+	if blockedFor > 0 {
+		log.Debugf("TMDB requested back-off, waiting %s before sending request\n", blockedFor)
+		time.Sleep(blockedFor)
+	}
+
+	_ = c.limiter.Wait(context.Background())
+}
+
+func (c *client) blockFor(duration time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	until := time.Now().Add(duration)
+	if until.After(c.blockedUntil) {
+		c.blockedUntil = until
+	}
+}
+
+// readCache returns the cached response body for the key provided, if
+// one exists and has not yet expired. Expired entries are removed.
+func (c *client) readCache(key string) ([]byte, bool) {
+	if c.cacheDir == "" {
+		return nil, false
+	}
+
+	path := filepath.Join(c.cacheDir, key)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var cached cachedResponse
+	if err := json.Unmarshal(raw, &cached); err != nil {
+		log.Warnf("TMDB cache entry %s is malformed and will be discarded: %v\n", key, err)
+		_ = os.Remove(path)
+		return nil, false
+	}
+
+	if time.Now().After(cached.ExpiresAt) {
+		_ = os.Remove(path)
+		return nil, false
+	}
+
+	return cached.Body, true
+}
+
+// writeCache stores the response body provided in the on-disk cache. Failure
+// to write to the cache is logged, but is otherwise ignored.
+func (c *client) writeCache(key string, body []byte, ttl time.Duration) {
+	if c.cacheDir == "" {
+		return
+	}
+
+	raw, err := json.Marshal(cachedResponse{ExpiresAt: time.Now().Add(ttl), Body: body})
+	if err != nil {
+		log.Warnf("Failed to marshal TMDB cache entry %s: %v\n", key, err)
+		return
+	}
+
+	// Write to a temporary file and rename it in to place to avoid
+	// readers observing a partially written cache entry
+	path := filepath.Join(c.cacheDir, key)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, raw, 0o600); err != nil {
+		log.Warnf("Failed to write TMDB cache entry %s: %v\n", key, err)
+		return
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Warnf("Failed to commit TMDB cache entry %s: %v\n", key, err)
+		_ = os.Remove(tmpPath)
+	}
+}
+
+func (err FailedRequestError) isRetryable() bool {
+	return err.httpCode == http.StatusTooManyRequests || err.httpCode >= http.StatusInternalServerError
+}
+
+// cacheKeyForURL hashes the URL provided to produce a filesystem safe
+// cache key. Hashing also ensures the API key is not leaked to the file system.
+func cacheKeyForURL(urlPath string) string {
+	sum := sha256.Sum256([]byte(urlPath))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which may be either
+// a number of seconds or a HTTP date. Zero is returned if the header is missing or
+// malformed. The result is capped to avoid TMDB stalling Thea indefinitely.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = time.Until(date)
+	}
+
+	return max(0, min(wait, maxRetryAfterWait))
+}
+
+func decodeJSONResponse(body []byte, target interface{}) error {
+	if err := json.Unmarshal(body, target); err != nil {
+		return &UnknownRequestError{fmt.Sprintf("response JSON could not be unmarshalled: %v", err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package tmdb
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptedResponse is a response served by a scriptedServer.
+type scriptedResponse struct {
+	status     int
+	retryAfter string
+	body       string
+}
+
+// scriptedServer serves the scripted responses in order, repeating the
+// last response once the script has been exhausted.
+type scriptedServer struct {
+	*sync.Mutex
+	script   []scriptedResponse
+	requests []time.Time
+}
+
+func newScriptedServer(t *testing.T, script ...scriptedResponse) (*scriptedServer, string) {
+	t.Helper()
+
+	server := &scriptedServer{Mutex: &sync.Mutex{}, script: script}
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.Lock()
+		response := server.script[min(len(server.requests), len(server.script)-1)]
+		server.requests = append(server.requests, time.Now())
+		server.Unlock()
+
+		if response.retryAfter != "" {
+			w.Header().Set("Retry-After", response.retryAfter)
+		}
+		w.WriteHeader(response.status)
+		_, _ = w.Write([]byte(response.body))
+	}))
+	t.Cleanup(httpServer.Close)
+
+	return server, httpServer.URL + "/3/movie/1"
+}
+
+func (server *scriptedServer) requestCount() int {
+	server.Lock()
+	defer server.Unlock()
+	return len(server.requests)
+}
+
+func newTestClient(maxRetries int) *client {
+	c := newClient(Config{MaxRetries: maxRetries})
+	c.retryBackoff = 10 * time.Millisecond
+	return c
+}
+
+var (
+	okResponse          = scriptedResponse{status: http.StatusOK, body: `{"id":1}`}
+	serverErrorResponse = scriptedResponse{status: http.StatusInternalServerError, body: `{"status_code":11,"status_message":"Internal error"}`}
+	notFoundResponse    = scriptedResponse{status: http.StatusNotFound, body: `{"status_code":34,"status_message":"Not found"}`}
+)
+
+func TestGetWithRetry_RetriesServerErrors(t *testing.T) {
+	server, url := newScriptedServer(t, serverErrorResponse, serverErrorResponse, okResponse)
+	c := newTestClient(2)
+
+	body, err := c.getWithRetry(url)
+	if err != nil {
+		t.Fatalf("expected request to succeed after retries, got %v", err)
+	}
+	if string(body) != okResponse.body {
+		t.Errorf("expected body %s, got %s", okResponse.body, body)
+	}
+	if count := server.requestCount(); count != 3 {
+		t.Errorf("expected 3 requests, got %d", count)
+	}
+}
+
+func TestGetWithRetry_GivesUpAfterMaxRetries(t *testing.T) {
+	server, url := newScriptedServer(t, serverErrorResponse)
+	c := newTestClient(2)
+
+	_, err := c.getWithRetry(url)
+	var failedRequestErr *FailedRequestError
+	if !errors.As(err, &failedRequestErr) || failedRequestErr.httpCode != http.StatusInternalServerError || failedRequestErr.tmdbCode != 11 {
+		t.Fatalf("expected failed request error from last attempt, got %v", err)
+	}
+	if count := server.requestCount(); count != 3 {
+		t.Errorf("expected initial request and 2 retries, got %d requests", count)
+	}
+}
+
+func TestGetWithRetry_ExponentialBackoff(t *testing.T) {
+	server, url := newScriptedServer(t, serverErrorResponse, serverErrorResponse, serverErrorResponse, okResponse)
+	c := newTestClient(3)
+	c.retryBackoff = 50 * time.Millisecond
+
+	if _, err := c.getWithRetry(url); err != nil {
+		t.Fatalf("expected request to succeed after retries, got %v", err)
+	}
+
+	server.Lock()
+	defer server.Unlock()
+	for i, expected := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if wait := server.requests[i+1].Sub(server.requests[i]); wait < expected {
+			t.Errorf("expected retry %d to wait at least %s, waited %s", i+1, expected, wait)
+		}
+	}
+}
+
+func TestGetWithRetry_DoesNotRetryClientErrors(t *testing.T) {
+	server, url := newScriptedServer(t, notFoundResponse, okResponse)
+	c := newTestClient(3)
+
+	_, err := c.getWithRetry(url)
+	var failedRequestErr *FailedRequestError
+	if !errors.As(err, &failedRequestErr) || failedRequestErr.httpCode != http.StatusNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if count := server.requestCount(); count != 1 {
+		t.Errorf("expected client error to not be retried, got %d requests", count)
+	}
+}
+
+func TestGetWithRetry_RetriesDisabled(t *testing.T) {
+	server, url := newScriptedServer(t, serverErrorResponse, okResponse)
+	c := newTestClient(0)
+
+	if _, err := c.getWithRetry(url); err == nil {
+		t.Fatalf("expected request to fail without retries")
+	}
+	if count := server.requestCount(); count != 1 {
+		t.Errorf("expected a single request, got %d", count)
+	}
+}
+
+func TestGetWithRetry_NonJSONErrorResponse(t *testing.T) {
+	_, url := newScriptedServer(t, scriptedResponse{status: http.StatusBadGateway, body: "<html>Bad Gateway</html>"})
+	c := newTestClient(0)
+
+	_, err := c.getWithRetry(url)
+	var failedRequestErr *FailedRequestError
+	if !errors.As(err, &failedRequestErr) || failedRequestErr.httpCode != http.StatusBadGateway || failedRequestErr.tmdbCode != -1 {
+		t.Fatalf("expected failed request error without a TMDB code, got %v", err)
+	}
+}
+
+func TestGetWithRetry_HonoursRetryAfter(t *testing.T) {
+	server, url := newScriptedServer(t,
+		scriptedResponse{status: http.StatusTooManyRequests, retryAfter: "1", body: `{"status_code":25,"status_message":"Rate limited"}`},
+		okResponse,
+	)
+	c := newTestClient(1)
+
+	start := time.Now()
+	if _, err := c.getWithRetry(url); err != nil {
+		t.Fatalf("expected request to succeed after rate limit, got %v", err)
+	}
+
+	// The Retry-After takes precedence over the (much shorter) backoff
+	server.Lock()
+	defer server.Unlock()
+	if wait := server.requests[1].Sub(server.requests[0]); wait < time.Second {
+		t.Errorf("expected retry to wait for the Retry-After duration, waited %s", wait)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected retry to wait for the Retry-After duration once, took %s", elapsed)
+	}
+}
+
+func TestGet_RetryAfterBlocksAllRequests(t *testing.T) {
+	_, url := newScriptedServer(t, scriptedResponse{status: http.StatusServiceUnavailable, retryAfter: "30", body: `{}`})
+	c := newTestClient(0)
+
+	before := time.Now()
+	_, retryAfter, err := c.get(url)
+	if err == nil {
+		t.Fatalf("expected request to fail")
+	}
+	if retryAfter != 30*time.Second {
+		t.Errorf("expected Retry-After of 30s, got %s", retryAfter)
+	}
+
+	c.Lock()
+	blockedUntil := c.blockedUntil
+	c.Unlock()
+	if blockedUntil.Before(before.Add(30 * time.Second)) {
+		t.Errorf("expected client to be blocked for 30s, blocked until %s", blockedUntil)
+	}
+
+	// A shorter Retry-After must not shorten an existing block
+	c.blockFor(time.Second)
+	c.Lock()
+	defer c.Unlock()
+	if !c.blockedUntil.Equal(blockedUntil) {
+		t.Errorf("expected existing block to be retained, blocked until %s", c.blockedUntil)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"5", 5 * time.Second},
+		{"-5", 0},
+		{"3600", maxRetryAfterWait},
+		{"soon", 0},
+		{"1.5", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), maxRetryAfterWait},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%q", test.header), func(t *testing.T) {
+			if got := parseRetryAfter(test.header); got != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter_HTTPDate(t *testing.T) {
+	header := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+
+	// HTTP dates have a resolution of one second
+	if got := parseRetryAfter(header); got <= 28*time.Second || got > 30*time.Second {
+		t.Errorf("expected wait of approximately 30s, got %s", got)
+	}
+}
@@ -1,19 +1,34 @@
 package tmdb
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/hbomb79/Thea/internal/media"
 )
 
-func TmdbEpisodeToMedia(ep *Episode, isSeasonAdult bool, metadata *media.FileMediaMetadata) *media.Episode {
+// TmdbEpisodeToMedia converts the TMDB episode provided to a media episode. TMDB does not
+// provide an adult flag or content rating for individual episodes, and so the episode inherits
+// these from the series provided.
+func TmdbEpisodeToMedia(ep *Episode, series *Series, metadata *media.FileMediaMetadata) *media.Episode {
 	return &media.Episode{
 		Model: media.Model{ID: uuid.New(), TmdbID: ep.ID.String(), Title: ep.Name},
 		Watchable: media.Watchable{
-			MediaResolution: media.MediaResolution{Width: *metadata.FrameW, Height: *metadata.FrameH},
-			SourcePath:      metadata.Path,
-			Adult:           isSeasonAdult,
+			MediaResolution:  media.MediaResolution{Width: *metadata.FrameW, Height: *metadata.FrameH},
+			Adult:            series.Adult,
+			ContentRating:    contentRatingOrNil(series.Certification),
+			ContentRatingAge: CertificationAge(series.Certification),
+			Runtime:          ep.Runtime,
+			ReleaseDate:      ep.AirDate.TimeOrNil(),
+		},
+		Metadata: media.Metadata{
+			Overview:    ep.Overview,
+			VoteAverage: ep.VoteAverage,
+			VoteCount:   ep.VoteCount,
 		},
 		EpisodeNumber: metadata.EpisodeNumber,
+		Credits:       TmdbCreditsToMedia(&ep.Credits),
 	}
 }
 
@@ -26,27 +41,112 @@ func TmdbGenresToMedia(genres []Genre) []*media.Genre {
 	return gs
 }
 
+// TmdbCreditsToMedia converts the TMDB cast, guest stars and crew in to
+// media credits. Guest stars are treated as regular cast members.
+func TmdbCreditsToMedia(credits *Credits) []*media.MediaCredit {
+	out := make([]*media.MediaCredit, 0, len(credits.Cast)+len(credits.GuestStars)+len(credits.Crew))
+	for _, cast := range append(credits.Cast, credits.GuestStars...) {
+		order := cast.Order
+		out = append(out, &media.MediaCredit{
+			Credit: media.Credit{Role: media.CastCreditRole, Character: cast.Character, Order: &order},
+			Person: tmdbPersonToMedia(cast.ID, cast.Name, cast.KnownForDepartment),
+		})
+	}
+
+	for _, crew := range credits.Crew {
+		out = append(out, &media.MediaCredit{
+			Credit: media.Credit{Role: media.CrewCreditRole, Job: crew.Job, Department: crew.Department},
+			Person: tmdbPersonToMedia(crew.ID, crew.Name, crew.KnownForDepartment),
+		})
+	}
+
+	return out
+}
+
+func tmdbPersonToMedia(id json.Number, name string, knownForDepartment string) media.Person {
+	return media.Person{ID: uuid.New(), TmdbID: id.String(), Name: name, KnownForDepartment: knownForDepartment}
+}
+
 func TmdbSeriesToMedia(series *Series) *media.Series {
 	return &media.Series{
-		Model:  media.Model{ID: uuid.New(), TmdbID: series.ID.String(), Title: series.Name},
-		Genres: TmdbGenresToMedia(series.Genres),
+		Model: media.Model{ID: uuid.New(), TmdbID: series.ID.String(), Title: series.Name},
+		Metadata: media.Metadata{
+			Overview:         series.Overview,
+			Tagline:          series.Tagline,
+			OriginalTitle:    series.OriginalName,
+			OriginalLanguage: series.OriginalLanguage,
+			Status:           series.Status,
+			VoteAverage:      series.VoteAverage,
+			VoteCount:        series.VoteCount,
+		},
+		FirstAirDate: series.FirstAirDate.TimeOrNil(),
+		LastAirDate:  series.LastAirDate.TimeOrNil(),
+		Genres:       TmdbGenresToMedia(series.Genres),
+		Credits:      TmdbCreditsToMedia(&series.Credits),
 	}
 }
 
 func TmdbSeasonToMedia(season *Season) *media.Season {
 	return &media.Season{
-		Model: media.Model{ID: uuid.New(), TmdbID: season.ID.String(), Title: season.Name},
+		Model:        media.Model{ID: uuid.New(), TmdbID: season.ID.String(), Title: season.Name},
+		SeasonNumber: season.SeasonNumber,
+		Overview:     season.Overview,
+		AirDate:      season.AirDate.TimeOrNil(),
 	}
 }
 
 func TmdbMovieToMedia(movie *Movie, metadata *media.FileMediaMetadata) *media.Movie {
 	return &media.Movie{
-		Model:  media.Model{ID: uuid.New(), TmdbID: movie.ID.String(), Title: movie.Name},
-		Genres: TmdbGenresToMedia(movie.Genres),
+		Model:      media.Model{ID: uuid.New(), TmdbID: movie.ID.String(), Title: movie.Name},
+		Genres:     TmdbGenresToMedia(movie.Genres),
+		Credits:    TmdbCreditsToMedia(&movie.Credits),
+		Collection: TmdbCollectionToMedia(movie.Collection),
 		Watchable: media.Watchable{
-			MediaResolution: media.MediaResolution{Width: *metadata.FrameW, Height: *metadata.FrameH},
-			SourcePath:      metadata.Path,
-			Adult:           movie.Adult,
+			MediaResolution:  media.MediaResolution{Width: *metadata.FrameW, Height: *metadata.FrameH},
+			Adult:            movie.Adult,
+			ContentRating:    contentRatingOrNil(movie.Certification),
+			ContentRatingAge: CertificationAge(movie.Certification),
+			Runtime:          movie.Runtime,
+			ReleaseDate:      movie.ReleaseDate.TimeOrNil(),
+		},
+		Metadata: media.Metadata{
+			Overview:         movie.Overview,
+			Tagline:          movie.Tagline,
+			OriginalTitle:    movie.OriginalName,
+			OriginalLanguage: movie.OriginalLanguage,
+			Status:           movie.Status,
+			VoteAverage:      movie.VoteAverage,
+			VoteCount:        movie.VoteCount,
 		},
 	}
 }
+
+// TmdbCollectionToMedia converts the TMDB collection provided to a media collection. If
+// the collection is nil (i.e. the movie does not belong to a collection) then nil is returned.
+func TmdbCollectionToMedia(collection *Collection) *media.Collection {
+	if collection == nil {
+		return nil
+	}
+
+	return &media.Collection{
+		Model: media.Model{ID: uuid.New(), TmdbID: collection.ID.String(), Title: collection.Name},
+	}
+}
+
+// TimeOrNil returns the time held by this date, or nil if the
+// date is nil or unknown (zero).
+func (date *Date) TimeOrNil() *time.Time {
+	if date == nil || date.IsZero() {
+		return nil
+	}
+
+	return &date.Time
+}
+
+func contentRatingOrNil(certification string) *string {
+	if certification == "" {
+		return nil
+	}
+
+	return &certification
+}
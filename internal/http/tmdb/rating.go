@@ -0,0 +1,105 @@
+package tmdb
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type (
+	// releaseDates contains the (per-country) releases of a movie, each of which may
+	// specify the certification of the movie in that country. TMDB provides this
+	// information when 'release_dates' is appended to a movie lookup.
+	releaseDates struct {
+		Results []struct {
+			Country  string `json:"iso_3166_1"`
+			Releases []struct {
+				Certification string `json:"certification"`
+			} `json:"release_dates"`
+		} `json:"results"`
+	}
+
+	// contentRatings contains the (per-country) content rating of a series. TMDB provides
+	// this information when 'content_ratings' is appended to a series lookup.
+	contentRatings struct {
+		Results []struct {
+			Country string `json:"iso_3166_1"`
+			Rating  string `json:"rating"`
+		} `json:"results"`
+	}
+)
+
+// certificationAges maps the certifications which do not contain the minimum age
+// of their audience to an age. Certifications not found here fall back to using the
+// number contained within them (e.g. '12A', 'FSK 16' or 'MA 15+').
+var certificationAges = map[string]int{
+	// US (movies)
+	"G":     0,
+	"PG":    8,
+	"PG-13": 13,
+	"R":     17,
+	"NC-17": 18,
+
+	// US (TV). Note TV-14 is handled by the numeric fallback
+	"TV-Y":  0,
+	"TV-G":  0,
+	"TV-Y7": 7,
+	"TV-PG": 8,
+	"TV-MA": 17,
+
+	// GB and AU
+	"U": 0,
+	"M": 15,
+}
+
+// certification returns the first non-empty certification of the movie
+// in the country provided, or an empty string if none exists.
+func (dates *releaseDates) certification(country string) string {
+	for _, result := range dates.Results {
+		if !strings.EqualFold(result.Country, country) {
+			continue
+		}
+
+		for _, release := range result.Releases {
+			if cert := strings.TrimSpace(release.Certification); cert != "" {
+				return cert
+			}
+		}
+	}
+
+	return ""
+}
+
+// certification returns the rating of the series in the country
+// provided, or an empty string if none exists.
+func (ratings *contentRatings) certification(country string) string {
+	for _, result := range ratings.Results {
+		if strings.EqualFold(result.Country, country) {
+			return strings.TrimSpace(result.Rating)
+		}
+	}
+
+	return ""
+}
+
+// CertificationAge returns the minimum age of the audience which the certification
+// provided is suitable for. Nil is returned if the certification is empty or is
+// not recognised (e.g. 'NR'), in which case the media should be treated as unrated.
+func CertificationAge(certification string) *int {
+	cert := strings.ToUpper(strings.TrimSpace(certification))
+	if age, ok := certificationAges[cert]; ok {
+		return &age
+	}
+
+	digits := strings.FieldsFunc(cert, func(r rune) bool { return !unicode.IsDigit(r) })
+	if len(digits) == 0 {
+		return nil
+	}
+
+	age, err := strconv.Atoi(digits[0])
+	if err != nil {
+		return nil
+	}
+
+	return &age
+}
@@ -3,7 +3,6 @@ package tmdb
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"sort"
 	"time"
@@ -20,18 +19,51 @@ const (
 	tmdbSearchMovieTemplate  = "%s/search/movie?query=%s&api_key=%s"
 	tmdbSearchSeriesTemplate = "%s/search/tv?query=%s&api_key=%s"
 
-	tmdbGetMovieTemplate   = "%s/movie/%s?api_key=%s"
-	tmdbGetSeriesTemplate  = "%s/tv/%s?api_key=%s"
+	// Credits (and content ratings) are appended to the responses of the movie/series/episode
+	// lookups to avoid making an additional request to TMDB for each.
+	tmdbGetMovieTemplate   = "%s/movie/%s?append_to_response=credits,release_dates&api_key=%s"
+	tmdbGetSeriesTemplate  = "%s/tv/%s?append_to_response=credits,content_ratings&api_key=%s"
 	tmdbGetSeasonTemplate  = "%s/tv/%s/season/%d?api_key=%s"
-	tmdbGetEpisodeTemplate = "%s/tv/%s/season/%d/episode/%d?api_key=%s"
+	tmdbGetEpisodeTemplate = "%s/tv/%s/season/%d/episode/%d?append_to_response=credits&api_key=%s"
+
+	// Images are downloaded at the largest of the artwork.StandardWidths, rather
+	// than the original size which is often far larger than is ever served.
+	tmdbImageTemplate = "https://image.tmdb.org/t/p/w1280%s"
 )
 
 var log = logger.Get("TMDB")
 
 type (
-	Date   struct{ time.Time }
+	Date struct{ time.Time }
+
+	// Config contains the configuration options for the
+	// TMDB searcher, and the HTTP client it uses.
 	Config struct {
-		APIKey string
+		// The API key used to authenticate with TMDB. This is
+		// populated from the top-level Thea config.
+		APIKey string `toml:"-"`
+
+		// The directory used to cache responses from TMDB. If empty,
+		// responses will not be cached.
+		CacheDir string `toml:"-"`
+
+		// The number of seconds that search results and detail lookups (movies, series, seasons, episodes)
+		// are cached for. Search results are cached for a shorter duration as newly released content
+		// may appear in results. A value of zero disables caching for that request type.
+		SearchCacheTTLSeconds int `toml:"search_cache_ttl_seconds" env:"TMDB_SEARCH_CACHE_TTL_SECONDS" env-default:"3600"`
+		DetailCacheTTLSeconds int `toml:"detail_cache_ttl_seconds" env:"TMDB_DETAIL_CACHE_TTL_SECONDS" env-default:"86400"`
+
+		// Controls the token-bucket used to rate-limit outgoing requests to TMDB. Any
+		// Retry-After response from TMDB will be honoured in addition to this limit.
+		RequestsPerSecond float64 `toml:"requests_per_second" env:"TMDB_REQUESTS_PER_SECOND" env-default:"20"`
+
+		// The number of times a request which fails due to a server-side
+		// error (HTTP 5xx or 429) will be retried before giving up.
+		MaxRetries int `toml:"max_retries" env:"TMDB_MAX_RETRIES" env-default:"3"`
+
+		// The ISO 3166-1 code of the country whose content ratings (certifications) are
+		// stored for movies and series, e.g. PG-13 for the US or 12A for GB.
+		ContentRatingCountry string `toml:"content_rating_country" env:"TMDB_CONTENT_RATING_COUNTRY" env-default:"US"`
 	}
 
 	Genre struct {
@@ -39,6 +71,30 @@ type (
 		Name string      `json:"name"`
 	}
 
+	// Credits contains the cast and crew for a movie, series or episode. Guest
+	// stars are only provided for episodes.
+	Credits struct {
+		Cast       []CastCredit `json:"cast"`
+		Crew       []CrewCredit `json:"crew"`
+		GuestStars []CastCredit `json:"guest_stars"`
+	}
+
+	CastCredit struct {
+		ID                 json.Number `json:"id"`
+		Name               string      `json:"name"`
+		KnownForDepartment string      `json:"known_for_department"`
+		Character          string      `json:"character"`
+		Order              int         `json:"order"`
+	}
+
+	CrewCredit struct {
+		ID                 json.Number `json:"id"`
+		Name               string      `json:"name"`
+		KnownForDepartment string      `json:"known_for_department"`
+		Department         string      `json:"department"`
+		Job                string      `json:"job"`
+	}
+
 	SearchResult struct {
 		Results      []SearchResultItem
 		TotalPages   int `json:"total_pages"`
@@ -53,36 +109,105 @@ type (
 		PosterPath   string      `json:"poster_path"`
 		FirstAirDate *Date       `json:"first_air_date"`
 		ReleaseDate  *Date       `json:"release_date"`
+		Popularity   float64     `json:"popularity"`
+
+		// TMDB provides the title of movies as 'title' (rather than 'name'), see SearchForMovie.
+		MovieTitle string `json:"title"`
 	}
 
 	Movie struct {
-		ID          json.Number `json:"id"`
-		Adult       bool        `json:"adult"`
-		ReleaseDate string      `json:"release_date"`
-		Name        string      `json:"title"`
-		Tagline     string      `json:"tagline"`
-		Overview    string      `json:"overview"`
-		Genres      []Genre     `json:"genres"`
+		ID               json.Number  `json:"id"`
+		Adult            bool         `json:"adult"`
+		ReleaseDate      *Date        `json:"release_date"`
+		Name             string       `json:"title"`
+		OriginalName     string       `json:"original_title"`
+		OriginalLanguage string       `json:"original_language"`
+		Tagline          string       `json:"tagline"`
+		Overview         string       `json:"overview"`
+		Status           string       `json:"status"`
+		Runtime          int          `json:"runtime"`
+		VoteAverage      float64      `json:"vote_average"`
+		VoteCount        int          `json:"vote_count"`
+		PosterPath       string       `json:"poster_path"`
+		BackdropPath     string       `json:"backdrop_path"`
+		Genres           []Genre      `json:"genres"`
+		Credits          Credits      `json:"credits"`
+		Collection       *Collection  `json:"belongs_to_collection"`
+		ReleaseDates     releaseDates `json:"release_dates"`
+
+		// Certification is the content rating of the movie in the country
+		// configured, populated by GetMovie. Empty if the movie is unrated.
+		Certification string `json:"-"`
+	}
+
+	// Collection is a group of related movies (such as a franchise). TMDB
+	// provides this information inside of a movie's details.
+	Collection struct {
+		ID           json.Number `json:"id"`
+		Name         string      `json:"name"`
+		PosterPath   string      `json:"poster_path"`
+		BackdropPath string      `json:"backdrop_path"`
 	}
 
 	Episode struct {
-		ID       json.Number `json:"id"`
-		Name     string      `json:"name"`
-		Overview string      `json:"overview"`
+		ID            json.Number `json:"id"`
+		EpisodeNumber int         `json:"episode_number"`
+		Name          string      `json:"name"`
+		Overview      string      `json:"overview"`
+		AirDate       *Date       `json:"air_date"`
+		Runtime       int         `json:"runtime"`
+		VoteAverage   float64     `json:"vote_average"`
+		VoteCount     int         `json:"vote_count"`
+		StillPath     string      `json:"still_path"`
+		Credits       Credits     `json:"credits"`
 	}
 
 	Season struct {
-		ID       json.Number `json:"id"`
-		Name     string      `json:"name"`
-		Overview string      `json:"overview"`
+		ID           json.Number `json:"id"`
+		SeasonNumber int         `json:"season_number"`
+		Name         string      `json:"name"`
+		Overview     string      `json:"overview"`
+		AirDate      *Date       `json:"air_date"`
+		PosterPath   string      `json:"poster_path"`
+
+		// Episodes contains all of the episodes in this season. TMDB does not include
+		// the credits for each episode when listing the episodes of a season.
+		Episodes []Episode `json:"episodes"`
+	}
+
+	// SeasonSummary is the basic information about a season
+	// which TMDB provides inside of a series' details.
+	SeasonSummary struct {
+		ID           json.Number `json:"id"`
+		SeasonNumber int         `json:"season_number"`
+		Name         string      `json:"name"`
+		EpisodeCount int         `json:"episode_count"`
+		AirDate      *Date       `json:"air_date"`
 	}
 
 	Series struct {
-		ID       json.Number `json:"id"`
-		Adult    bool        `json:"adult"`
-		Name     string      `json:"name"`
-		Overview string      `json:"overview"`
-		Genres   []Genre     `json:"genres"`
+		ID               json.Number     `json:"id"`
+		Adult            bool            `json:"adult"`
+		Name             string          `json:"name"`
+		OriginalName     string          `json:"original_name"`
+		OriginalLanguage string          `json:"original_language"`
+		Tagline          string          `json:"tagline"`
+		Overview         string          `json:"overview"`
+		Status           string          `json:"status"`
+		VoteAverage      float64         `json:"vote_average"`
+		VoteCount        int             `json:"vote_count"`
+		FirstAirDate     *Date           `json:"first_air_date"`
+		LastAirDate      *Date           `json:"last_air_date"`
+		PosterPath       string          `json:"poster_path"`
+		BackdropPath     string          `json:"backdrop_path"`
+		Genres           []Genre         `json:"genres"`
+		Credits          Credits         `json:"credits"`
+		Seasons          []SeasonSummary `json:"seasons"`
+		ContentRatings   contentRatings  `json:"content_ratings"`
+
+		// Certification is the content rating of the series in the country
+		// configured, populated by GetSeries. Empty if the series is unrated.
+		Certification string `json:"-"`
 	}
 
 	// tmdbSearcher is the primary search method for the Ingest and
@@ -90,12 +215,21 @@ type (
 	// See https://developer.themoviedb.org/reference/intro/getting-started for
 	// information on the TMDB API.
 	tmdbSearcher struct {
-		config Config
+		config      Config
+		client      *client
+		bypassCache bool
 	}
 )
 
 func NewSearcher(config Config) *tmdbSearcher {
-	return &tmdbSearcher{config}
+	return &tmdbSearcher{config: config, client: newClient(config)}
+}
+
+// Uncached returns a searcher which shares the underlying client (and therefore the
+// rate-limiting) of this searcher, but which always requests fresh details from TMDB
+// rather than using cached responses. This is used when refreshing the metadata of existing media.
+func (searcher *tmdbSearcher) Uncached() *tmdbSearcher {
+	return &tmdbSearcher{config: searcher.config, client: searcher.client, bypassCache: true}
 }
 
 // SearchForEpisode will search the TMDB API for a match using the
@@ -116,7 +250,7 @@ func (searcher *tmdbSearcher) SearchForSeries(metadata *media.FileMediaMetadata)
 	// Search for the series
 	path := fmt.Sprintf(tmdbSearchSeriesTemplate, tmdbBaseURL, url.QueryEscape(metadata.Title), searcher.config.APIKey)
 	var searchResult SearchResult
-	if err := httpGetJSONResponse(path, &searchResult); err != nil {
+	if err := searcher.client.getJSON(path, searcher.config.searchCacheTTL(), &searchResult); err != nil {
 		return "", err
 	}
 
@@ -141,9 +275,12 @@ func (searcher *tmdbSearcher) SearchForMovie(metadata *media.FileMediaMetadata)
 	// Search for the movie stub
 	path := fmt.Sprintf(tmdbSearchMovieTemplate, tmdbBaseURL, url.QueryEscape(metadata.Title), searcher.config.APIKey)
 	var searchResult SearchResult
-	if err := httpGetJSONResponse(path, &searchResult); err != nil {
+	if err := searcher.client.getJSON(path, searcher.config.searchCacheTTL(), &searchResult); err != nil {
 		return "", err
 	}
+	for i := range searchResult.Results {
+		searchResult.Results[i].Title = searchResult.Results[i].MovieTitle
+	}
 
 	if result, err := searcher.handleSearchResults(searchResult.Results, metadata); err == nil {
 		return result.ID.String(), nil
@@ -157,10 +294,11 @@ func (searcher *tmdbSearcher) SearchForMovie(metadata *media.FileMediaMetadata)
 func (searcher *tmdbSearcher) GetMovie(movieID string) (*Movie, error) {
 	path := fmt.Sprintf(tmdbGetMovieTemplate, tmdbBaseURL, movieID, searcher.config.APIKey)
 	var movie Movie
-	if err := httpGetJSONResponse(path, &movie); err != nil {
+	if err := searcher.getDetail(path, &movie); err != nil {
 		return nil, err
 	}
 
+	movie.Certification = movie.ReleaseDates.certification(searcher.config.ContentRatingCountry)
 	return &movie, nil
 }
 
@@ -169,10 +307,11 @@ func (searcher *tmdbSearcher) GetMovie(movieID string) (*Movie, error) {
 func (searcher *tmdbSearcher) GetSeries(seriesID string) (*Series, error) {
 	path := fmt.Sprintf(tmdbGetSeriesTemplate, tmdbBaseURL, seriesID, searcher.config.APIKey)
 	var series Series
-	if err := httpGetJSONResponse(path, &series); err != nil {
+	if err := searcher.getDetail(path, &series); err != nil {
 		return nil, err
 	}
 
+	series.Certification = series.ContentRatings.certification(searcher.config.ContentRatingCountry)
 	return &series, nil
 }
 
@@ -181,7 +320,7 @@ func (searcher *tmdbSearcher) GetSeries(seriesID string) (*Series, error) {
 func (searcher *tmdbSearcher) GetEpisode(seriesID string, seasonNumber int, episodeNumber int) (*Episode, error) {
 	path := fmt.Sprintf(tmdbGetEpisodeTemplate, tmdbBaseURL, seriesID, seasonNumber, episodeNumber, searcher.config.APIKey)
 	var episode Episode
-	if err := httpGetJSONResponse(path, &episode); err != nil {
+	if err := searcher.getDetail(path, &episode); err != nil {
 		return nil, err
 	}
 
@@ -193,13 +332,24 @@ func (searcher *tmdbSearcher) GetEpisode(seriesID string, seasonNumber int, epis
 func (searcher *tmdbSearcher) GetSeason(seriesID string, seasonNumber int) (*Season, error) {
 	path := fmt.Sprintf(tmdbGetSeasonTemplate, tmdbBaseURL, seriesID, seasonNumber, searcher.config.APIKey)
 	var season Season
-	if err := httpGetJSONResponse(path, &season); err != nil {
+	if err := searcher.getDetail(path, &season); err != nil {
 		return nil, err
 	}
 
 	return &season, nil
 }
 
+// ImageURL returns the URL which can be used to download the TMDB
+// image with the path provided (e.g. a movies PosterPath).
+// If the path is empty, an empty string is returned.
+func ImageURL(imagePath string) string {
+	if imagePath == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(tmdbImageTemplate, imagePath)
+}
+
 // PruneSearchResults accepts a list of search stubs from TMDB and attempts
 // to whittle them down to a singular result. To do so, the year and popularity
 // of the results is taken in to consideration.
@@ -237,6 +387,18 @@ func (searcher *tmdbSearcher) handleSearchResults(results []SearchResultItem, me
 	return nil, &MultipleResultError{results}
 }
 
+// Year returns the year the result was first released/aired, or
+// nil if TMDB does not know when the result was released.
+func (entry *SearchResultItem) Year() *int {
+	date := entry.effectiveDate()
+	if date == nil || date.IsZero() {
+		return nil
+	}
+
+	year := date.Year()
+	return &year
+}
+
 func (entry *SearchResultItem) effectiveDate() *Date {
 	if entry.FirstAirDate != nil {
 		return entry.FirstAirDate
@@ -245,7 +407,14 @@ func (entry *SearchResultItem) effectiveDate() *Date {
 	return entry.ReleaseDate
 }
 
+// UnmarshalJSON parses a TMDB date string (YYYY-MM-DD). TMDB uses an
+// empty string to represent an unknown date, in which case the
+// date is left as the zero time.
 func (date *Date) UnmarshalJSON(dateBytes []byte) error {
+	if string(dateBytes) == "null" || string(dateBytes) == `""` {
+		return nil
+	}
+
 	trimmedDateString := string(dateBytes[1 : len(dateBytes)-1])
 	parsed, err := time.Parse(time.DateOnly, trimmedDateString)
 	if err != nil {
@@ -276,33 +445,12 @@ func filterResultsInPlace(results *[]SearchResultItem, metadata *media.FileMedia
 	*results = (*results)[:insertionIndex]
 }
 
-func httpGetJSONResponse(urlPath string, targetInterface interface{}) error {
-	log.Verbosef("GET -> %s\n", urlPath)
-	resp, err := http.Get(urlPath) //nolint
-	if err != nil {
-		return &UnknownRequestError{fmt.Sprintf("failed to perform GET(%s) to TMDB: %v", urlPath, err)}
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var tmdbError tmdbError
-		if err := json.NewDecoder(resp.Body).Decode(&tmdbError); err != nil {
-			return &FailedRequestError{httpCode: resp.StatusCode, message: "non-OK response could not be unmarshalled", tmdbCode: -1}
-		}
-
-		return &FailedRequestError{httpCode: resp.StatusCode, message: tmdbError.StatusMessage, tmdbCode: tmdbError.StatusCode}
-	}
-
-	if err != nil {
-		return &UnknownRequestError{fmt.Sprintf("failed to read response body: %v", err)}
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(targetInterface); err != nil {
-		return &UnknownRequestError{fmt.Sprintf("response JSON could not be unmarshalled: %v", err)}
-	}
+func (config Config) searchCacheTTL() time.Duration {
+	return time.Duration(config.SearchCacheTTLSeconds) * time.Second
+}
 
-	return nil
+func (config Config) detailCacheTTL() time.Duration {
+	return time.Duration(config.DetailCacheTTLSeconds) * time.Second
 }
 
 type (
@@ -335,3 +483,13 @@ func (err FailedRequestError) Error() string {
 func (err NoResultError) Error() string                      { return "no results returned from TMDB" }
 func (err MultipleResultError) Error() string                { return "too many results returned from TMDB" }
 func (err MultipleResultError) Choices() *[]SearchResultItem { return &err.results }
+
+// getDetail fetches the details of some TMDB resource, unmarshalling the response
+// in to the target provided. Cached responses are ignored if this searcher is uncached.
+func (searcher *tmdbSearcher) getDetail(path string, target interface{}) error {
+	if searcher.bypassCache {
+		return searcher.client.getFreshJSON(path, searcher.config.detailCacheTTL(), target)
+	}
+
+	return searcher.client.getJSON(path, searcher.config.detailCacheTTL(), target)
+}
@@ -8,6 +8,7 @@ import (
 type socketClient struct {
 	id     *uuid.UUID
 	socket *websocket.Conn
+	filter MessageFilter
 }
 
 func (client *socketClient) SendMessage(message *SocketMessage) error {
@@ -13,6 +13,12 @@ var socketLogger = logger.Get("WebSocket")
 
 type SocketHandler func(*SocketHub, *SocketMessage) error
 
+// MessageFilter is used to determine whether a broadcast message should be
+// sent to a particular client. Filters are called from the hub's event loop,
+// and so do not need to be safe for concurrent use. However, as a slow filter
+// delays the messages of every client, filters must not block (e.g. on I/O).
+type MessageFilter func(*SocketMessage) bool
+
 // SocketHub is the struct responsible for managing
 // the websocket upgrading, connecting, pushing and
 // receiving of messages.
@@ -140,8 +146,10 @@ func (hub *SocketHub) Send(message *SocketMessage) {
 	hub.sendCh <- message
 }
 
-// UpgradeToSocket upgrades a given HTTP request to a websocket and adds the new clients to the hub.
-func (hub *SocketHub) UpgradeToSocket(w http.ResponseWriter, r *http.Request) {
+// UpgradeToSocket upgrades a given HTTP request to a websocket and adds the new clients to the hub. Broadcast
+// messages are only sent to the client if the filter provided (if any) accepts them. This method blocks until the
+// client disconnects, or until the context provided is cancelled (at which point the connection is closed).
+func (hub *SocketHub) UpgradeToSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, filter MessageFilter) {
 	if !hub.running {
 		socketLogger.Emit(logger.ERROR, "Failed to upgrade incoming HTTP request to a websocket: SocketHub has not been started!\n")
 		return
@@ -165,6 +173,7 @@ func (hub *SocketHub) UpgradeToSocket(w http.ResponseWriter, r *http.Request) {
 	client := &socketClient{
 		id:     &id,
 		socket: sock,
+		filter: filter,
 	}
 
 	// Register the client and open the read loop
@@ -192,11 +201,22 @@ func (hub *SocketHub) UpgradeToSocket(w http.ResponseWriter, r *http.Request) {
 	// Ensure the client is deregistered once it's read loop closes
 	// If client.Start finishes, it's either because the client disconnected
 	// or an error occurred - either way, we need to deregister it.
+	closed := make(chan struct{})
 	defer func() {
+		close(closed)
 		hub.deregisterCh <- client
 		client.Close()
 	}()
 
+	// Closing the socket causes the read loop to exit
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-closed:
+		}
+	}()
+
 	// Start the read loop for the client
 	if err := client.Read(hub.receiveCh); err != nil {
 		socketLogger.Emit(logger.WARNING, "Client {%v} closed, error: %v\n", client.id, err)
@@ -269,10 +289,14 @@ func (hub *SocketHub) findClient(id *uuid.UUID) (int, *socketClient) {
 	return -1, nil
 }
 
-// broadcastMessage sends the provided message to every connected
-// client - useful for pushing new state to all clients interested.
+// broadcastMessage sends the provided message to every connected client whose
+// filter accepts it - useful for pushing new state to all clients interested.
 func (hub *SocketHub) broadcastMessage(message *SocketMessage) error {
 	for _, client := range hub.clients {
+		if client.filter != nil && !client.filter(message) {
+			continue
+		}
+
 		if err := client.SendMessage(message); err != nil {
 			return err
 		}
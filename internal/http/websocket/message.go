@@ -30,6 +30,10 @@ type SocketMessage struct {
 	Type   socketMessageType      `json:"type"`
 	Origin *uuid.UUID             `json:"-"`
 	Target *uuid.UUID             `json:"-"`
+
+	// Scope is arbitrary (server-side only) information about the message, which
+	// the filters of clients may use to decide whether to send the message.
+	Scope any `json:"-"`
 }
 
 func (message *SocketMessage) ValidateArguments(required map[string]string) error {
@@ -0,0 +1,94 @@
+package ingest
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/hbomb79/Thea/internal/http/tmdb"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+// AutoResolveConfig controls the heuristics used to automatically pick a result when
+// a TMDB search returns multiple results which Thea cannot otherwise decide between. If
+// none of the enabled heuristics pick a result, the item is troubled as usual.
+type AutoResolveConfig struct {
+	// If enabled, the result whose title exactly matches the scraped title (ignoring case
+	// and whitespace), and whose release year matches the scraped year, is picked. If multiple
+	// results match, no result is picked.
+	ExactTitleYear bool `toml:"exact_title_year" env-default:"true"`
+
+	// If greater than one, the most popular result is picked when it's popularity (as
+	// reported by TMDB) is at least this many times that of the next most popular result. A
+	// value of zero disables this heuristic.
+	PopularityRatio float64 `toml:"popularity_ratio" env-default:"0"`
+}
+
+// resolve attempts to pick a result from the choices of the error provided (if it is a
+// tmdb.MultipleResultError) using the enabled heuristics, returning the TMDB ID of
+// the result picked. If no result is picked, the error provided is returned.
+func (config *AutoResolveConfig) resolve(err error, meta *media.FileMediaMetadata) (string, error) {
+	var multipleResultError tmdb.MultipleResultError
+	if !errors.As(err, &multipleResultError) {
+		return "", err
+	}
+
+	choices := *multipleResultError.Choices()
+	if config.ExactTitleYear {
+		if choice := pickExactTitleYear(choices, meta); choice != nil {
+			log.Emit(logger.INFO, "Automatically picked TMDB result %s ('%s') as it's title and year match the scraped metadata\n", choice.ID, choice.Title)
+			return choice.ID.String(), nil
+		}
+	}
+
+	if config.PopularityRatio > 1 {
+		if choice := pickPopular(choices, config.PopularityRatio); choice != nil {
+			log.Emit(logger.INFO, "Automatically picked TMDB result %s ('%s') as it is significantly more popular than the other results\n", choice.ID, choice.Title)
+			return choice.ID.String(), nil
+		}
+	}
+
+	return "", err
+}
+
+// pickExactTitleYear returns the only choice whose title and year match those of the
+// metadata provided. If no choices (or multiple choices) match, nil is returned.
+func pickExactTitleYear(choices []tmdb.SearchResultItem, meta *media.FileMediaMetadata) *tmdb.SearchResultItem {
+	if meta.Year == nil {
+		return nil
+	}
+
+	var match *tmdb.SearchResultItem
+	title := normalizeTitle(meta.Title)
+	for i, choice := range choices {
+		year := choice.Year()
+		if year == nil || *year != *meta.Year || normalizeTitle(choice.Title) != title {
+			continue
+		}
+
+		if match != nil {
+			return nil
+		}
+		match = &choices[i]
+	}
+
+	return match
+}
+
+// pickPopular returns the most popular choice if it's popularity is at least 'ratio' times
+// the popularity of the next most popular choice, else nil is returned.
+func pickPopular(choices []tmdb.SearchResultItem, ratio float64) *tmdb.SearchResultItem {
+	if len(choices) < 2 {
+		return nil
+	}
+
+	sorted := make([]tmdb.SearchResultItem, len(choices))
+	copy(sorted, choices)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Popularity > sorted[j].Popularity })
+
+	if sorted[0].Popularity <= 0 || sorted[0].Popularity < sorted[1].Popularity*ratio {
+		return nil
+	}
+
+	return &sorted[0]
+}
@@ -19,6 +19,10 @@ type Config struct {
 	// for new files
 	IngestPath string `toml:"dir_path" env-required:"true"`
 
+	// Additional directories which files can be manually ingested
+	// from. Unlike the IngestPath, these directories are not monitored.
+	LibraryPaths []string `toml:"library_paths"`
+
 	// An array of regular expressions that can be used to RESTRICT
 	// the files processed by this service. If any expression match
 	// the name of the file, it is ignored.
@@ -32,9 +36,18 @@ type Config struct {
 
 	// Controls the number of workers that can perform ingestions. Reducing
 	// to 1 means one ingestion at a time.
-	// Caution should be taken to not increase this value too high, as ingestion
-	// involves talking to external APIs which may impose rate limits
+	// Requests to external APIs (e.g. TMDB) made by the workers are cached and rate-limited,
+	// so increasing this value will not cause Thea to exceed the rate limits of these APIs
 	IngestionParallelism int `toml:"parallelism" env-default:"2"`
+
+	// Controls how the service responds to a file which matches media that
+	// already exists in Thea (with a different source file). See DuplicatePolicy
+	// for the available options.
+	DuplicatePolicy DuplicatePolicy `toml:"duplicate_policy" env-default:"trouble"`
+
+	// Controls how the service picks between multiple results returned by
+	// a TMDB search, see AutoResolveConfig.
+	AutoResolve AutoResolveConfig `toml:"auto_resolve"`
 }
 
 func (config *Config) RequiredModTimeAgeDuration() time.Duration {
@@ -42,10 +55,25 @@ func (config *Config) RequiredModTimeAgeDuration() time.Duration {
 }
 
 func (config *Config) GetIngestPath() string {
-	out, err := homedir.Expand(config.IngestPath)
+	return expandPath(config.IngestPath)
+}
+
+// GetLibraryPaths returns the paths of all directories which files can be
+// manually ingested from, including the ingestion directory.
+func (config *Config) GetLibraryPaths() []string {
+	paths := []string{config.GetIngestPath()}
+	for _, path := range config.LibraryPaths {
+		paths = append(paths, expandPath(path))
+	}
+
+	return paths
+}
+
+func expandPath(path string) string {
+	out, err := homedir.Expand(path)
 	if err != nil {
-		logger.Get("Config").Emit(logger.ERROR, "Failed to expand ingestion path (%s): %v {will use provided path un-expanded}\n", config.IngestPath, err)
-		return config.IngestPath
+		logger.Get("Config").Emit(logger.ERROR, "Failed to expand path (%s): %v {will use provided path un-expanded}\n", path, err)
+		return path
 	}
 
 	return out
@@ -0,0 +1,271 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/event"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+type (
+	// DuplicatePolicy controls how the ingest service reacts to a file which
+	// matches media (by TMDB ID) that is already present in Thea, but which
+	// is sourced from a different file.
+	DuplicatePolicy string
+
+	duplicateAction int
+)
+
+const (
+	// PolicyTrouble raises a DuplicateSource trouble on the ingest, leaving the decision to the user.
+	PolicyTrouble DuplicatePolicy = "trouble"
+	// PolicyKeepExisting discards (deletes) the newly ingested file.
+	PolicyKeepExisting DuplicatePolicy = "keep_existing"
+	// PolicyReplace replaces the existing source with the newly ingested file.
+	PolicyReplace DuplicatePolicy = "replace"
+	// PolicyKeepBoth keeps the newly ingested file as an additional version of the existing media.
+	PolicyKeepBoth DuplicatePolicy = "keep_both"
+	// PolicyPreferQuality compares the quality of the two files, and keeps only the best of the two. If
+	// the quality of the files cannot be distinguished, a DuplicateSource trouble is raised.
+	PolicyPreferQuality DuplicatePolicy = "prefer_quality"
+)
+
+const (
+	noDuplicate duplicateAction = iota
+	keepExistingSource
+	replaceExistingSource
+	keepBothSources
+)
+
+// codecRanking orders video codecs by their efficiency. For two files of the same resolution, the file
+// using the more efficient codec is considered to be of higher quality. Unknown codecs rank lowest.
+var codecRanking = map[string]int{
+	"mpeg2video": 1,
+	"mpeg4":      2,
+	"h264":       3,
+	"vp9":        4,
+	"hevc":       4,
+	"av1":        5,
+}
+
+var ErrUnknownDuplicatePolicy = errors.New("unknown duplicate policy")
+
+func (policy DuplicatePolicy) validate() error {
+	//exhaustive:enforce
+	switch policy {
+	case PolicyTrouble, PolicyKeepExisting, PolicyReplace, PolicyKeepBoth, PolicyPreferQuality:
+		return nil
+	}
+
+	return fmt.Errorf("%w '%s'", ErrUnknownDuplicatePolicy, policy)
+}
+
+// findDuplicateFile returns the existing media file (of the media with the ID provided) which the item
+// duplicates. If the media has several files, the highest quality file is returned. If the
+// media has no files, or the item is already one of the files of the media, nil is returned.
+func (item *IngestItem) findDuplicateFile(mediaID uuid.UUID, data DataStore) (*media.MediaFile, error) {
+	files, err := data.GetFilesForMedia(mediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *media.MediaFile
+	for _, file := range files {
+		if file.SourcePath == item.Path {
+			return nil, nil
+		}
+
+		if best == nil || compareQuality(file, best) > 0 {
+			best = file
+		}
+	}
+
+	return best, nil
+}
+
+// determineDuplicateAction decides what should happen to the source of the item given that media with the
+// same TMDB ID already exists, and is sourced from the existing file provided. If the item has been
+// given a duplicate resolution (from a trouble resolution), it will be used. Otherwise, the duplicate policy
+// provided decides the action. If the policy is unable to make a decision, a DuplicateSource trouble is returned.
+//
+// If the existing source no longer exists on the file system, the item is considered to have
+// superseded the existing source (e.g. it has been re-downloaded), and will replace it.
+func (item *IngestItem) determineDuplicateAction(existing *media.MediaFile, policy DuplicatePolicy, scraper scraper) (duplicateAction, error) {
+	existingPath := existing.SourcePath
+	if item.DuplicateResolution != nil {
+		resolution := *item.DuplicateResolution
+		item.DuplicateResolution = nil
+
+		log.Emit(logger.INFO, "Resolving duplicate source of item %s with provided resolution (from trouble resolution) of %s\n", item, resolution)
+		//exhaustive:ignore
+		switch resolution {
+		case KeepExisting:
+			return keepExistingSource, nil
+		case ReplaceExisting:
+			return replaceExistingSource, nil
+		case KeepBoth:
+			return keepBothSources, nil
+		}
+	}
+
+	if _, err := os.Stat(existingPath); errors.Is(err, os.ErrNotExist) {
+		log.Emit(logger.INFO, "Item %s supersedes existing source '%s' which no longer exists\n", item, existingPath)
+		return replaceExistingSource, nil
+	}
+
+	duplicateTrouble := Trouble{
+		error:     fmt.Errorf("media for item %s already exists with source '%s'", item, existingPath),
+		tType:     DuplicateSource,
+		duplicate: &existingPath,
+	}
+
+	//exhaustive:enforce
+	switch policy {
+	case PolicyTrouble:
+		return noDuplicate, duplicateTrouble
+	case PolicyKeepExisting:
+		return keepExistingSource, nil
+	case PolicyReplace:
+		return replaceExistingSource, nil
+	case PolicyKeepBoth:
+		return keepBothSources, nil
+	case PolicyPreferQuality:
+		// Files ingested before stream information was stored need to be probed
+		if existing.Width == nil || existing.Height == nil {
+			existingMeta, err := scraper.ScrapeFileForStreamInfo(existingPath)
+			if err != nil {
+				log.Warnf("Unable to compare quality of item %s against existing source '%s': %v\n", item, existingPath, err)
+				return noDuplicate, duplicateTrouble
+			}
+
+			existing = media.NewMediaFile(existing.MediaID, existingMeta)
+		}
+
+		comparison := compareQuality(media.NewMediaFile(existing.MediaID, item.ScrapedMetadata), existing)
+		if comparison > 0 {
+			return replaceExistingSource, nil
+		} else if comparison < 0 {
+			return keepExistingSource, nil
+		}
+
+		return noDuplicate, duplicateTrouble
+	}
+
+	panic("unreachable")
+}
+
+// applyDuplicateAction performs the duplicate action provided against the existing media file. If the
+// action means that the media does not need to be saved (e.g. the existing source is being kept), then
+// true is returned to indicate that ingestion of the item is complete.
+//
+// When replacing the existing source, the existing file is updated once the media is saved, see saveSource.
+func (item *IngestItem) applyDuplicateAction(action duplicateAction, existing *media.MediaFile, data DataStore, eventBus event.EventDispatcher) (bool, error) {
+	//exhaustive:enforce
+	switch action {
+	case noDuplicate:
+		return false, nil
+	case keepExistingSource:
+		log.Emit(logger.INFO, "Discarding source of item %s as existing source '%s' is being kept\n", item, existing.SourcePath)
+		removeSource(item.Path)
+		return true, nil
+	case keepBothSources:
+		file := media.NewMediaFile(existing.MediaID, item.ScrapedMetadata)
+		if err := data.SaveMediaFile(file); err != nil {
+			return false, newTrouble(err)
+		}
+
+		// Workflows are re-evaluated for the media, which will create transcodes for the new file only
+		log.Emit(logger.SUCCESS, "Saved source of item %s as an additional version of existing media %s\n", item, existing.MediaID)
+		eventBus.Dispatch(event.NewMediaEvent, existing.MediaID)
+		return true, nil
+	case replaceExistingSource:
+		return false, nil
+	}
+
+	panic("unreachable")
+}
+
+// saveSource saves the source of the item as a file of the media with the ID provided, once the media
+// itself has been saved. If the item is replacing an existing file, the existing file is updated in-place
+// to use the new source, and the old source is removed from the file system. The transcodes of the existing
+// file (including those in progress) are cancelled and deleted, as they were produced from the old source.
+func (item *IngestItem) saveSource(mediaID uuid.UUID, action duplicateAction, existing *media.MediaFile, data DataStore, transcoder transcoder, eventBus event.EventDispatcher) error {
+	file := media.NewMediaFile(mediaID, item.ScrapedMetadata)
+	if action != replaceExistingSource {
+		if err := data.SaveMediaFile(file); err != nil {
+			return newTrouble(err)
+		}
+
+		eventBus.Dispatch(event.NewMediaEvent, mediaID)
+		return nil
+	}
+
+	file.ID = existing.ID
+	if err := data.ReplaceMediaFileSource(file); err != nil {
+		return newTrouble(err)
+	}
+
+	log.Emit(logger.INFO, "Source '%s' of media %s replaced by item %s\n", existing.SourcePath, mediaID, item)
+	transcoder.CancelTasksForMediaFile(existing.ID)
+	if err := data.DeleteTranscodesForMediaFile(existing.ID); err != nil {
+		log.Emit(logger.ERROR, "Failed to delete transcodes of media file %s after its source was replaced: %v\n", existing.ID, err)
+	}
+
+	removeSource(existing.SourcePath)
+	eventBus.Dispatch(event.ReplaceMediaEvent, mediaID)
+	return nil
+}
+
+// compareQuality compares the quality of the two files provided, returning a positive
+// number if 'a' is higher quality than 'b', a negative number if 'b' is higher quality than 'a',
+// and zero if the quality of the two files cannot be distinguished.
+//
+// Files are compared by their resolution first, then by the efficiency of their video
+// codec, and finally by their bitrate.
+func compareQuality(a *media.MediaFile, b *media.MediaFile) int {
+	if diff := framePixels(a) - framePixels(b); diff != 0 {
+		return diff
+	}
+
+	if diff := codecRank(a) - codecRank(b); diff != 0 {
+		return diff
+	}
+
+	if a.Bitrate != nil && b.Bitrate != nil && *a.Bitrate != *b.Bitrate {
+		if *a.Bitrate > *b.Bitrate {
+			return 1
+		}
+
+		return -1
+	}
+
+	return 0
+}
+
+func framePixels(file *media.MediaFile) int {
+	if file.Width == nil || file.Height == nil {
+		return 0
+	}
+
+	return *file.Width * *file.Height
+}
+
+func codecRank(file *media.MediaFile) int {
+	if file.VideoCodec == nil {
+		return 0
+	}
+
+	return codecRanking[*file.VideoCodec]
+}
+
+// removeSource deletes the source file at the path provided, logging any
+// failures rather than returning them as the ingestion has already succeeded.
+func removeSource(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warnf("Cleanup of duplicate source at path '%s' failed: %v\n", path, err)
+	}
+}
@@ -0,0 +1,56 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hbomb79/Thea/internal/media"
+)
+
+var ErrIncompatibleHints = errors.New("ingest hints provided are not compatible")
+
+// IngestHints can be provided when manually ingesting files, and take precedence
+// over the information Thea would otherwise scrape from the file (or search for).
+type IngestHints struct {
+	// Episodic specifies whether the file is an episode (true) or a movie (false).
+	Episodic *bool
+
+	// TmdbID is the TMDB ID of the movie (or the series, for episodes) the file
+	// is for. If provided, searching TMDB for the media is skipped.
+	TmdbID *string
+
+	SeasonNumber  *int
+	EpisodeNumber *int
+
+	// SkipImportHold causes the file to be ingested immediately, rather than
+	// waiting for the modtime of the file to meet the configured threshold.
+	SkipImportHold bool
+}
+
+func (hints *IngestHints) validate() error {
+	if hints.Episodic != nil && !*hints.Episodic && (hints.SeasonNumber != nil || hints.EpisodeNumber != nil) {
+		return fmt.Errorf("%w: season/episode number cannot be provided for a movie", ErrIncompatibleHints)
+	}
+
+	return nil
+}
+
+// apply overrides the scraped metadata provided using the hints. Providing a season
+// or episode number implies the file is episodic.
+func (hints *IngestHints) apply(meta *media.FileMediaMetadata) {
+	if hints == nil {
+		return
+	}
+
+	if hints.Episodic != nil {
+		meta.Episodic = *hints.Episodic
+	}
+	if hints.SeasonNumber != nil {
+		meta.Episodic = true
+		meta.SeasonNumber = *hints.SeasonNumber
+	}
+	if hints.EpisodeNumber != nil {
+		meta.Episodic = true
+		meta.EpisodeNumber = *hints.EpisodeNumber
+	}
+}
@@ -1,12 +1,15 @@
 package ingest
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/artwork"
 	"github.com/hbomb79/Thea/internal/event"
 	"github.com/hbomb79/Thea/internal/http/tmdb"
 	"github.com/hbomb79/Thea/internal/media"
@@ -22,6 +25,18 @@ type (
 		Trouble         *Trouble
 		ScrapedMetadata *media.FileMediaMetadata
 		OverrideTmdbID  *string
+
+		// Hints are provided when an item is manually ingested, see IngestHints.
+		Hints *IngestHints
+
+		// ContentHash is the partial hash of the content of the
+		// item, see media.HashFile.
+		ContentHash *string
+		ContentSize int64
+
+		// DuplicateResolution is the user-selected resolution for a
+		// DUPLICATE_SOURCE trouble, used when the item is next ingested.
+		DuplicateResolution *ResolutionType
 	}
 )
 
@@ -39,16 +54,46 @@ var (
 	ErrResolutionIncompatible        = errors.New("provided resolution method is not valid for ingestion trouble")
 	ErrResolutionIncomplete          = errors.New("provided resolution context is missing information required to resolve the trouble")
 	ErrResolutionContextIncompatible = errors.New("trouble resolution failed, consult logs for further information")
+	ErrInvalidFileName               = errors.New("file name is not valid")
+	ErrIngestFileExists              = errors.New("a file with the same name already exists in the ingestion directory")
+	ErrPathNotInLibrary              = errors.New("path is not inside of the ingestion directory or a library directory")
+	ErrPathAlreadyKnown              = errors.New("path is already known to Thea")
+	ErrTroubleFilterEmpty            = errors.New("at least one trouble filter criteria must be provided")
+
+	// errIdenticalSource is returned when the content of an item is identical to the
+	// source of existing media (e.g. a copy of the file), and so the item should not be ingested.
+	errIdenticalSource = errors.New("item content is identical to the source of existing media")
 )
 
 // ingest is the main task for an ingest task which:
+// - Hashes the content of the file, to check if the file is already known to Thea
 // - Scrapes the metadata from the file
-// - Searches TMDB for a match
+// - Searches TMDB for a match (unless a TMDB ID is provided, or a title rule matches the item)
+// - Checks for existing media which this item duplicates
+// - Downloads the artwork for the media
 // - Saves the episode/movie to the database
 // Any of the above can encounter an error - if the error can be cast to the
 // IngestItemTrouble type then it should be raised as a TROUBLE on the item.
-func (item *IngestItem) ingest(eventBus event.EventCoordinator, scraper scraper, searcher searcher, data DataStore) error {
+func (item *IngestItem) ingest(eventBus event.EventCoordinator, scraper scraper, searcher searcher, artworkCache artworkCache, transcoder transcoder, data DataStore, config Config) error {
 	log.Emit(logger.NEW, "Beginning ingestion of item %s\n", item)
+	if item.ContentHash == nil {
+		hash, size, err := media.HashFile(item.Path)
+		if err != nil {
+			return Trouble{error: fmt.Errorf("failed to hash file: %w", err), tType: MetadataFailure}
+		}
+
+		item.ContentHash = &hash
+		item.ContentSize = size
+	}
+
+	if existing, err := data.GetMediaFileWithContentHash(*item.ContentHash); err == nil {
+		if done, err := item.ingestKnownContent(existing, data, eventBus); done || err != nil {
+			return err
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return newTrouble(err)
+	}
+
 	if item.ScrapedMetadata == nil {
 		log.Emit(logger.DEBUG, "Performing file system scrape of %s\n", item.Path)
 		if meta, err := scraper.ScrapeFileForMediaInfo(item.Path); err != nil {
@@ -62,21 +107,35 @@ func (item *IngestItem) ingest(eventBus event.EventCoordinator, scraper scraper,
 	}
 
 	meta := item.ScrapedMetadata
+	meta.ContentHash = item.ContentHash
+	item.Hints.apply(meta)
+	if item.OverrideTmdbID == nil && item.Hints != nil {
+		item.OverrideTmdbID = item.Hints.TmdbID
+	}
+	if item.OverrideTmdbID == nil {
+		if rule, err := data.GetTitleRule(meta.Title, meta.Episodic); err == nil {
+			log.Emit(logger.INFO, "Item %s matches title rule %s, using TMDB ID %s\n", item, rule.ID, rule.TmdbID)
+			item.OverrideTmdbID = &rule.TmdbID
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return newTrouble(err)
+		}
+	}
+
 	if item.ScrapedMetadata.Episodic {
-		return item.ingestEpisode(meta, data, searcher, eventBus)
+		return item.ingestEpisode(meta, data, scraper, searcher, artworkCache, transcoder, eventBus, config)
 	} else {
-		return item.ingestMovie(meta, data, searcher, eventBus)
+		return item.ingestMovie(meta, data, scraper, searcher, artworkCache, transcoder, eventBus, config)
 	}
 }
 
-func (item *IngestItem) ingestEpisode(meta *media.FileMediaMetadata, data DataStore, searcher searcher, eventBus event.EventDispatcher) error {
+func (item *IngestItem) ingestEpisode(meta *media.FileMediaMetadata, data DataStore, scraper scraper, searcher searcher, artworkCache artworkCache, transcoder transcoder, eventBus event.EventDispatcher, config Config) error {
 	var series *tmdb.Series
 	if item.OverrideTmdbID != nil {
-		// This item WAS troubled, but a resolution has provided a new value for the TMDB ID which we should use now.
+		// This item WAS troubled (or was manually ingested), and a TMDB ID has been provided which we should use now.
 		tmdbID := *item.OverrideTmdbID
 		item.OverrideTmdbID = nil
 
-		log.Emit(logger.INFO, "Retrying ingestion item %s with provided TMDB ID override (from trouble resolution) of %s\n", item, tmdbID)
+		log.Emit(logger.INFO, "Retrying ingestion item %s with provided TMDB ID override (from trouble resolution, ingest hints or title rule) of %s\n", item, tmdbID)
 		if found, err := searcher.GetSeries(tmdbID); err != nil {
 			return newTrouble(err)
 		} else {
@@ -85,7 +144,9 @@ func (item *IngestItem) ingestEpisode(meta *media.FileMediaMetadata, data DataSt
 	} else {
 		seriesID, err := searcher.SearchForSeries(meta)
 		if err != nil {
-			return newTrouble(err)
+			if seriesID, err = config.AutoResolve.resolve(err, meta); err != nil {
+				return newTrouble(err)
+			}
 		}
 
 		found, err := searcher.GetSeries(seriesID)
@@ -105,29 +166,63 @@ func (item *IngestItem) ingestEpisode(meta *media.FileMediaMetadata, data DataSt
 		return newTrouble(err)
 	}
 
+	ep := tmdb.TmdbEpisodeToMedia(episode, series, item.ScrapedMetadata)
+	var duplicate *media.MediaFile
+	if existing, err := data.GetEpisodeWithTmdbID(ep.TmdbID); err == nil {
+		if duplicate, err = item.findDuplicateFile(existing.ID, data); err != nil {
+			return newTrouble(err)
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return newTrouble(err)
+	}
+
+	action := noDuplicate
+	if duplicate != nil {
+		if action, err = item.determineDuplicateAction(duplicate, config.DuplicatePolicy, scraper); err != nil {
+			// Retain the series we matched, so that the item is not searched for again when it is resolved
+			seriesID := series.ID.String()
+			item.OverrideTmdbID = &seriesID
+			return err
+		}
+
+		if done, err := item.applyDuplicateAction(action, duplicate, data, eventBus); done || err != nil {
+			return err
+		}
+	}
+
 	log.Emit(logger.DEBUG, "Saving TMDB EPISODE: %v\nSEASON: %v\nSERIES: %v\n", episode, season, series)
-	ep := tmdb.TmdbEpisodeToMedia(episode, series.Adult, item.ScrapedMetadata)
-	if err := data.SaveEpisode(
-		ep,
-		tmdb.TmdbSeasonToMedia(season),
-		tmdb.TmdbSeriesToMedia(series),
-	); err != nil {
+	ep.BackdropImage = artwork.Import(artworkCache, tmdb.ImageURL(episode.StillPath))
+
+	// Sidecar artwork for a season is expected to be alongside the episode, whereas
+	// sidecar artwork for the series is expected in the parent directory (i.e. Series/Season 1/episode.mkv)
+	seasonDir := filepath.Dir(item.Path)
+	seas := tmdb.TmdbSeasonToMedia(season)
+	seas.PosterImage = artwork.Import(artworkCache, tmdb.ImageURL(season.PosterPath), seasonDir)
+
+	ser := tmdb.TmdbSeriesToMedia(series)
+	ser.PosterImage = artwork.Import(artworkCache, tmdb.ImageURL(series.PosterPath), filepath.Dir(seasonDir))
+	ser.BackdropImage = artwork.Import(artworkCache, tmdb.ImageURL(series.BackdropPath))
+
+	if err := data.SaveEpisode(ep, seas, ser); err != nil {
 		return newTrouble(err)
 	}
 
+	if err := item.saveSource(ep.ID, action, duplicate, data, transcoder, eventBus); err != nil {
+		return err
+	}
+
 	log.Emit(logger.SUCCESS, "Saved newly ingested episode %v\n", ep)
-	eventBus.Dispatch(event.NewMediaEvent, ep.ID)
 	return nil
 }
 
-func (item *IngestItem) ingestMovie(meta *media.FileMediaMetadata, data DataStore, searcher searcher, eventBus event.EventDispatcher) error {
+func (item *IngestItem) ingestMovie(meta *media.FileMediaMetadata, data DataStore, scraper scraper, searcher searcher, artworkCache artworkCache, transcoder transcoder, eventBus event.EventDispatcher, config Config) error {
 	var movie *tmdb.Movie
 	if item.OverrideTmdbID != nil {
-		// This item WAS troubled, but a resolution has provided a new value for the TMDB ID which we should use now.
+		// This item WAS troubled (or was manually ingested), and a TMDB ID has been provided which we should use now.
 		tmdbID := *item.OverrideTmdbID
 		item.OverrideTmdbID = nil
 
-		log.Emit(logger.INFO, "Retrying ingestion item %s with provided TMDB ID override (from trouble resolution) of %s\n", item, tmdbID)
+		log.Emit(logger.INFO, "Retrying ingestion item %s with provided TMDB ID override (from trouble resolution, ingest hints or title rule) of %s\n", item, tmdbID)
 		if found, err := searcher.GetMovie(tmdbID); err != nil {
 			return newTrouble(err)
 		} else {
@@ -136,7 +231,9 @@ func (item *IngestItem) ingestMovie(meta *media.FileMediaMetadata, data DataStor
 	} else {
 		movieID, err := searcher.SearchForMovie(item.ScrapedMetadata)
 		if err != nil {
-			return newTrouble(err)
+			if movieID, err = config.AutoResolve.resolve(err, meta); err != nil {
+				return newTrouble(err)
+			}
 		}
 
 		found, err := searcher.GetMovie(movieID)
@@ -146,18 +243,76 @@ func (item *IngestItem) ingestMovie(meta *media.FileMediaMetadata, data DataStor
 		movie = found
 	}
 
-	log.Emit(logger.DEBUG, "Saving newly ingested MOVIE: %v\n", movie)
 	mov := tmdb.TmdbMovieToMedia(movie, meta)
+	var duplicate *media.MediaFile
+	if existing, err := data.GetMovieWithTmdbID(mov.TmdbID); err == nil {
+		if duplicate, err = item.findDuplicateFile(existing.ID, data); err != nil {
+			return newTrouble(err)
+		}
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return newTrouble(err)
+	}
+
+	action := noDuplicate
+	if duplicate != nil {
+		var err error
+		if action, err = item.determineDuplicateAction(duplicate, config.DuplicatePolicy, scraper); err != nil {
+			// Retain the movie we matched, so that the item is not searched for again when it is resolved
+			item.OverrideTmdbID = &mov.TmdbID
+			return err
+		}
+
+		if done, err := item.applyDuplicateAction(action, duplicate, data, eventBus); done || err != nil {
+			return err
+		}
+	}
+
+	log.Emit(logger.DEBUG, "Saving newly ingested MOVIE: %v\n", movie)
+	mov.PosterImage = artwork.Import(artworkCache, tmdb.ImageURL(movie.PosterPath), filepath.Dir(item.Path))
+	mov.BackdropImage = artwork.Import(artworkCache, tmdb.ImageURL(movie.BackdropPath))
+	if mov.Collection != nil {
+		mov.Collection.PosterImage = artwork.Import(artworkCache, tmdb.ImageURL(movie.Collection.PosterPath))
+		mov.Collection.BackdropImage = artwork.Import(artworkCache, tmdb.ImageURL(movie.Collection.BackdropPath))
+	}
 	if err := data.SaveMovie(mov); err != nil {
 		return newTrouble(err)
 	}
 
-	log.Emit(logger.SUCCESS, "Saved newly ingested movie %v\n", mov)
-	eventBus.Dispatch(event.NewMediaEvent, mov.ID)
+	if err := item.saveSource(mov.ID, action, duplicate, data, transcoder, eventBus); err != nil {
+		return err
+	}
 
+	log.Emit(logger.SUCCESS, "Saved newly ingested movie %v\n", mov)
 	return nil
 }
 
+// ingestKnownContent handles an item whose content matches (by hash) the existing media file provided. If the
+// existing source no longer exists, then the item is the existing source after it was moved or renamed, and so
+// the media file is updated to use the path of the item (rather than ingesting it as new media). Otherwise, the
+// item is a copy of the existing source and errIdenticalSource is returned.
+//
+// If the item was handled (and therefore ingestion of the item is complete), true is returned.
+func (item *IngestItem) ingestKnownContent(existing *media.MediaFile, data DataStore, eventBus event.EventDispatcher) (bool, error) {
+	if existing.Size != nil && *existing.Size != item.ContentSize {
+		// Hash collision, the size of the file is encoded in the hash and so this is very unlikely
+		log.Warnf("Item %s matches content hash of existing source '%s', but the file sizes differ. Ignoring match\n", item, existing.SourcePath)
+		return false, nil
+	}
+
+	if _, err := os.Stat(existing.SourcePath); !errors.Is(err, os.ErrNotExist) {
+		log.Emit(logger.INFO, "Item %s is identical to existing source '%s' of media %s, skipping\n", item, existing.SourcePath, existing.MediaID)
+		return true, errIdenticalSource
+	}
+
+	if err := data.UpdateMediaFileSourcePath(existing.ID, item.Path); err != nil {
+		return true, newTrouble(err)
+	}
+
+	log.Emit(logger.SUCCESS, "Item %s is the existing source '%s' of media %s after being moved, source path updated\n", item, existing.SourcePath, existing.MediaID)
+	eventBus.Dispatch(event.UpdateMediaEvent, existing.MediaID)
+	return true, nil
+}
+
 func (item *IngestItem) modtimeDiff() (*time.Duration, error) {
 	itemInfo, err := os.Stat(item.Path)
 	if err != nil {
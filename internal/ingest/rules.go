@@ -0,0 +1,27 @@
+package ingest
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TitleRule remembers the TMDB ID that files with a particular scraped title
+// were resolved to. When a file with a matching title is ingested, the TMDB ID
+// is used rather than searching TMDB (see ResolveTroubledIngest).
+type TitleRule struct {
+	ID        uuid.UUID `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	Title     string    `db:"title"`
+	Episodic  bool      `db:"episodic"`
+	TmdbID    string    `db:"tmdb_id"`
+}
+
+// normalizeTitle returns the form of the scraped title provided which is used
+// when matching titles, such that insignificant differences (case, whitespace)
+// do not prevent a match.
+func normalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
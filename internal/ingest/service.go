@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,9 +23,14 @@ import (
 
 var log = logger.Get("IngestServ")
 
+// partialFileSuffix is appended to the name of files which are being moved in to the
+// ingestion directory, so that they're not discovered until the move is complete.
+const partialFileSuffix = ".partial"
+
 type (
 	scraper interface {
 		ScrapeFileForMediaInfo(path string) (*media.FileMediaMetadata, error)
+		ScrapeFileForStreamInfo(path string) (*media.FileMediaMetadata, error)
 	}
 
 	searcher interface {
@@ -35,14 +42,37 @@ type (
 		GetMovie(movieID string) (*tmdb.Movie, error)
 	}
 
+	artworkCache interface {
+		ImportFromURL(url string) (string, error)
+		ImportFromFile(path string) (string, error)
+	}
+
+	// transcoder is used to cancel the transcodes of a media file
+	// whose source is replaced by an ingested file.
+	transcoder interface {
+		CancelTasksForMediaFile(fileID uuid.UUID)
+	}
+
 	DataStore interface {
 		GetAllMediaSourcePaths() ([]string, error)
 		GetSeasonWithTmdbID(seasonID string) (*media.Season, error)
 		GetSeriesWithTmdbID(seriesID string) (*media.Series, error)
 		GetEpisodeWithTmdbID(episodeID string) (*media.Episode, error)
+		GetMovieWithTmdbID(movieID string) (*media.Movie, error)
 
 		SaveEpisode(episode *media.Episode, season *media.Season, series *media.Series) error
 		SaveMovie(movie *media.Movie) error
+		SaveMediaFile(file *media.MediaFile) error
+		ReplaceMediaFileSource(file *media.MediaFile) error
+		GetFilesForMedia(mediaID uuid.UUID) ([]*media.MediaFile, error)
+		GetMediaFileWithContentHash(hash string) (*media.MediaFile, error)
+		UpdateMediaFileSourcePath(fileID uuid.UUID, path string) error
+		DeleteTranscodesForMediaFile(fileID uuid.UUID) error
+
+		SaveTitleRule(rule *TitleRule) error
+		GetTitleRule(title string, episodic bool) (*TitleRule, error)
+		ListTitleRules() ([]*TitleRule, error)
+		DeleteTitleRule(ruleID uuid.UUID) error
 	}
 
 	// ingestService is responsible for managing the automatic detection
@@ -54,15 +84,21 @@ type (
 	// - Added to Thea's database, along with any related data.
 	ingestService struct {
 		*sync.Mutex
-		scraper   scraper
-		searcher  searcher
-		dataStore DataStore
-		eventBus  event.EventCoordinator
+		scraper      scraper
+		searcher     searcher
+		artworkCache artworkCache
+		transcoder   transcoder
+		dataStore    DataStore
+		eventBus     event.EventCoordinator
 
 		config           Config
 		items            []*IngestItem
 		importHoldTimers map[uuid.UUID]*time.Timer
 		workerPool       worker.WorkerPool
+
+		// identicalPaths contains the paths of files which were found to be identical
+		// to the source of existing media, and so should not be discovered again.
+		identicalPaths map[string]struct{}
 	}
 )
 
@@ -72,7 +108,11 @@ type (
 // The configs 'IngestPath' is validated to be an existing directory.
 // If the directory is missing it will be created, if the path
 // provided points to an existing FILE, an error is returned.
-func New(config Config, searcher searcher, scraper scraper, store DataStore, eventBus event.EventCoordinator) (*ingestService, error) {
+func New(config Config, searcher searcher, scraper scraper, artworkCache artworkCache, transcoder transcoder, store DataStore, eventBus event.EventCoordinator) (*ingestService, error) {
+	if err := config.DuplicatePolicy.validate(); err != nil {
+		return nil, err
+	}
+
 	// Ensure config ingest path is a valid directory, create it
 	// if it's missing.
 	ingestionPath := config.GetIngestPath()
@@ -92,10 +132,13 @@ func New(config Config, searcher searcher, scraper scraper, store DataStore, eve
 		Mutex:            &sync.Mutex{},
 		scraper:          scraper,
 		searcher:         searcher,
+		artworkCache:     artworkCache,
+		transcoder:       transcoder,
 		dataStore:        store,
 		config:           config,
 		items:            make([]*IngestItem, 0),
 		importHoldTimers: make(map[uuid.UUID]*time.Timer),
+		identicalPaths:   make(map[string]struct{}),
 		workerPool:       *worker.NewWorkerPool(),
 		eventBus:         eventBus,
 	}
@@ -177,7 +220,15 @@ func (service *ingestService) PerformItemIngest(w worker.Worker) (bool, error) {
 	log.Emit(logger.DEBUG, "Item %s claimed by worker %s for ingestion\n", item, w)
 	service.eventBus.Dispatch(event.IngestUpdateEvent, item.ID)
 
-	if err := item.ingest(service.eventBus, service.scraper, service.searcher, service.dataStore); err != nil {
+	err := item.ingest(service.eventBus, service.scraper, service.searcher, service.artworkCache, service.transcoder, service.dataStore, service.config)
+	if errors.Is(err, errIdenticalSource) {
+		service.Lock()
+		service.identicalPaths[item.Path] = struct{}{}
+		service.Unlock()
+		err = nil
+	}
+
+	if err != nil {
 		service.eventBus.Dispatch(event.IngestUpdateEvent, item.ID)
 		//nolint
 		if trbl, ok := err.(Trouble); ok {
@@ -210,20 +261,12 @@ func (service *ingestService) DiscoverNewFiles() {
 	service.Lock()
 	defer service.Unlock()
 
-	sourcePaths, err := service.dataStore.GetAllMediaSourcePaths()
+	sourcePathsLookup, err := service.knownPaths()
 	if err != nil {
 		log.Fatalf("Could not query DB for existing source paths: %v\n", err) //nolint
 		return
 	}
 
-	sourcePathsLookup := make(map[string]bool, len(sourcePaths))
-	for _, path := range sourcePaths {
-		sourcePathsLookup[path] = true
-	}
-	for _, item := range service.items {
-		sourcePathsLookup[item.Path] = true
-	}
-
 	newItems, err := recursivelyWalkFileSystem(service.config.GetIngestPath(), sourcePathsLookup)
 	if err != nil {
 		log.Emit(logger.FATAL, "file system polling failed: %v\n", err)
@@ -259,6 +302,126 @@ func (service *ingestService) DiscoverNewFiles() {
 	}
 }
 
+// IngestPath queues the file at the path provided for ingestion, or if the path is a directory,
+// all the files inside of it which are not already known to Thea. The path must be inside of the
+// ingestion directory, or one of the configured library directories. The hints provided are
+// applied to all items created, see IngestHints.
+//
+// Note: This function takes ownership of the mutex and releases it on return.
+func (service *ingestService) IngestPath(path string, hints IngestHints) ([]*IngestItem, error) {
+	if err := hints.validate(); err != nil {
+		return nil, err
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if !service.isLibraryPath(path) {
+		return nil, fmt.Errorf("%w: '%s'", ErrPathNotInLibrary, path)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() && hints.EpisodeNumber != nil {
+		return nil, fmt.Errorf("%w: episode number cannot be provided for a directory", ErrIncompatibleHints)
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	known, err := service.knownPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var found map[string]fs.FileInfo
+	if info.IsDir() {
+		if found, err = recursivelyWalkFileSystem(path, known); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, ok := known[path]; ok {
+			return nil, fmt.Errorf("%w: '%s'", ErrPathAlreadyKnown, path)
+		}
+		found = map[string]fs.FileInfo{path: info}
+	}
+
+	minModtimeAge := service.config.RequiredModTimeAgeDuration()
+	items := make([]*IngestItem, 0, len(found))
+	for itemPath, itemInfo := range found {
+		itemHints := hints
+		item := &IngestItem{ID: uuid.New(), Path: itemPath, State: Idle, Hints: &itemHints}
+
+		timeDiff := time.Since(itemInfo.ModTime())
+		if !hints.SkipImportHold && timeDiff < minModtimeAge {
+			item.State = ImportHold
+			service.scheduleImportHoldTimer(item.ID, minModtimeAge-timeDiff)
+		}
+
+		log.Emit(logger.NEW, "Queued manual ingestion of file %s as item %s\n", itemPath, item)
+		service.items = append(service.items, item)
+		items = append(items, item)
+	}
+
+	service.wakeupWorkerPool()
+	return items, nil
+}
+
+// IngestFile moves the file at the path provided in to the ingestion directory (using the
+// file name provided), and immediately queues it for ingestion. This is intended for
+// files which are known to be complete (such as uploaded files), and so the import hold
+// and blacklist are not applied. If an override TMDB ID is provided, searching for the
+// media is skipped.
+//
+// The file is moved to a temporary name (which is ignored by file discovery) before the
+// mutex is acquired, as moving the file may require copying it between devices. Once
+// acquired, the file is renamed in to place and queued.
+//
+// Note: This function takes ownership of the mutex and releases it on return.
+func (service *ingestService) IngestFile(path string, fileName string, overrideTmdbID *string) (*IngestItem, error) {
+	if fileName != filepath.Base(fileName) || fileName == "." || fileName == ".." {
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidFileName, fileName)
+	}
+
+	destination := filepath.Join(service.config.GetIngestPath(), fileName)
+	if _, err := os.Stat(destination); err == nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrIngestFileExists, destination)
+	}
+
+	staged := fmt.Sprintf("%s.%s%s", destination, uuid.New(), partialFileSuffix)
+	if err := moveFile(path, staged); err != nil {
+		return nil, fmt.Errorf("failed to move file in to ingestion directory: %w", err)
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	// The destination may have been created while the file was being moved
+	if _, err := os.Stat(destination); err == nil {
+		service.restoreStagedFile(staged, path)
+		return nil, fmt.Errorf("%w: '%s'", ErrIngestFileExists, destination)
+	}
+	if err := os.Rename(staged, destination); err != nil {
+		service.restoreStagedFile(staged, path)
+		return nil, fmt.Errorf("failed to move file in to ingestion directory: %w", err)
+	}
+
+	item := &IngestItem{
+		ID:             uuid.New(),
+		Path:           destination,
+		State:          Idle,
+		OverrideTmdbID: overrideTmdbID,
+	}
+
+	log.Emit(logger.NEW, "Queued ingestion of file %s as item %s\n", destination, item)
+	service.items = append(service.items, item)
+	service.wakeupWorkerPool()
+	return item, nil
+}
+
 // RemoveItem looks for an item with the ID provided in the services
 // state, and removes it if it's found.
 // This method *fails* if the item is currently 'INGESTING' as interrupting
@@ -300,7 +463,12 @@ func (service *ingestService) GetIngest(itemID uuid.UUID) *IngestItem {
 	return nil
 }
 
-func (service *ingestService) ResolveTroubledIngest(itemID uuid.UUID, method ResolutionType, context map[string]string) error {
+// ResolveTroubledIngest resolves the trouble of the ingest with the ID provided using the resolution
+// method (and context) provided. If remember is true and the resolution specifies a TMDB ID, a title
+// rule is saved so that future items with the same scraped title use the same TMDB ID.
+//
+// Note: This function takes ownership of the mutex and releases it on return.
+func (service *ingestService) ResolveTroubledIngest(itemID uuid.UUID, method ResolutionType, context map[string]string, remember bool) error {
 	service.Lock()
 	defer service.Unlock()
 
@@ -309,6 +477,66 @@ func (service *ingestService) ResolveTroubledIngest(itemID uuid.UUID, method Res
 		return ErrIngestNotFound
 	}
 
+	return service.resolveTroubledIngest(item, method, context, remember)
+}
+
+// ResolveTroubledIngests applies the same resolution to all troubled ingests which match the
+// filter provided, see ResolveTroubledIngest. Ingests whose trouble is not compatible with the
+// resolution method are skipped. The IDs of the ingests which were resolved, and of those which
+// were skipped, are returned.
+//
+// Note: This function takes ownership of the mutex and releases it on return.
+func (service *ingestService) ResolveTroubledIngests(filter TroubleFilter, method ResolutionType, context map[string]string, remember bool) ([]uuid.UUID, []uuid.UUID, error) {
+	if filter.isEmpty() {
+		return nil, nil, ErrTroubleFilterEmpty
+	}
+
+	service.Lock()
+	defer service.Unlock()
+
+	// Collect the matching items up-front, as aborting an item removes it from the services items
+	matching := make([]*IngestItem, 0)
+	for _, item := range service.items {
+		if item.State == Troubled && item.Trouble != nil && filter.matches(item) {
+			matching = append(matching, item)
+		}
+	}
+
+	resolved := make([]uuid.UUID, 0, len(matching))
+	skipped := make([]uuid.UUID, 0)
+	for _, item := range matching {
+		if err := service.resolveTroubledIngest(item, method, context, remember); err != nil {
+			if errors.Is(err, ErrResolutionIncompatible) {
+				skipped = append(skipped, item.ID)
+				continue
+			}
+
+			return nil, nil, err
+		}
+
+		resolved = append(resolved, item.ID)
+	}
+
+	log.Emit(logger.INFO, "Resolved %d troubled ingests with method %s (%d skipped)\n", len(resolved), method, len(skipped))
+	return resolved, skipped, nil
+}
+
+// ListTitleRules returns all the title rules which have been remembered when
+// resolving troubled ingests.
+func (service *ingestService) ListTitleRules() ([]*TitleRule, error) {
+	return service.dataStore.ListTitleRules()
+}
+
+// DeleteTitleRule deletes the title rule with the ID provided, such that future items
+// with a matching title are searched for as usual.
+func (service *ingestService) DeleteTitleRule(ruleID uuid.UUID) error {
+	return service.dataStore.DeleteTitleRule(ruleID)
+}
+
+// resolveTroubledIngest resolves the trouble of the item provided, see ResolveTroubledIngest.
+//
+// Note: The caller must hold the mutex.
+func (service *ingestService) resolveTroubledIngest(item *IngestItem, method ResolutionType, context map[string]string, remember bool) error {
 	if item.Trouble == nil || item.State != Troubled {
 		return ErrNoTrouble
 	}
@@ -329,11 +557,23 @@ func (service *ingestService) ResolveTroubledIngest(itemID uuid.UUID, method Res
 		// An item has been updated, so we need to inform the service to check for work to be done
 		service.wakeupWorkerPool()
 	case *TmdbIDResolution:
+		if remember {
+			if err := service.rememberTmdbID(item, v.tmdbID); err != nil {
+				return err
+			}
+		}
+
 		item.State = Idle
 		item.Trouble = nil
 		item.OverrideTmdbID = &v.tmdbID
 		// An item has been updated, so we need to inform the service to check for work to be done
 		service.wakeupWorkerPool()
+	case *DuplicateResolution:
+		item.State = Idle
+		item.Trouble = nil
+		item.DuplicateResolution = &v.method
+		// An item has been updated, so we need to inform the service to check for work to be done
+		service.wakeupWorkerPool()
 	default:
 		return fmt.Errorf("trouble resolution type of %T was not expected. This is likely a bug/should be unreachable", res)
 	}
@@ -342,6 +582,23 @@ func (service *ingestService) ResolveTroubledIngest(itemID uuid.UUID, method Res
 	return nil
 }
 
+// rememberTmdbID saves a title rule for the scraped title of the item provided, such that future
+// items with the same title use the TMDB ID provided rather than searching TMDB.
+func (service *ingestService) rememberTmdbID(item *IngestItem, tmdbID string) error {
+	if item.ScrapedMetadata == nil {
+		log.Warnf("Cannot remember TMDB ID %s for item %s as it has no scraped title\n", tmdbID, item)
+		return nil
+	}
+
+	rule := &TitleRule{ID: uuid.New(), Title: item.ScrapedMetadata.Title, Episodic: item.ScrapedMetadata.Episodic, TmdbID: tmdbID}
+	if err := service.dataStore.SaveTitleRule(rule); err != nil {
+		return err
+	}
+
+	log.Emit(logger.NEW, "Saved title rule %s, items with title '%s' will use TMDB ID %s\n", rule.ID, rule.Title, rule.TmdbID)
+	return nil
+}
+
 // AllItems returns a pointer to the array containing all
 // the IngestItems being processed by this service.
 func (service *ingestService) GetAllIngests() []*IngestItem {
@@ -431,6 +688,58 @@ func (service *ingestService) claimIdleItem() *IngestItem {
 	return nil
 }
 
+// knownPaths returns a lookup of all paths which should not be ingested, as they are
+// either the source of existing media, already being ingested, or known to be identical
+// to the source of existing media.
+//
+// Note: The caller must hold the mutex.
+func (service *ingestService) knownPaths() (map[string]bool, error) {
+	sourcePaths, err := service.dataStore.GetAllMediaSourcePaths()
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := make(map[string]bool, len(sourcePaths))
+	for _, path := range sourcePaths {
+		lookup[path] = true
+	}
+	for _, item := range service.items {
+		lookup[item.Path] = true
+	}
+	for path := range service.identicalPaths {
+		lookup[path] = true
+	}
+
+	return lookup, nil
+}
+
+// isLibraryPath returns true if the path provided is inside of
+// the ingestion directory, or one of the library directories. Symlinks
+// are resolved before comparison so that a link inside of a library cannot be
+// used to reach outside of it; if the path cannot be resolved, false is returned.
+func (service *ingestService) isLibraryPath(path string) bool {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+
+	for _, root := range service.config.GetLibraryPaths() {
+		root, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if root, err = filepath.EvalSymlinks(root); err != nil {
+			continue
+		}
+
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (service *ingestService) wakeupWorkerPool() {
 	if err := service.workerPool.WakeupWorkers(); err != nil {
 		log.Warnf("failed to wakeup workers in pool: %v\n", err)
@@ -439,7 +748,8 @@ func (service *ingestService) wakeupWorkerPool() {
 
 // recursivelyWalkFileSystem will walk the file system, starting at the directory provided,
 // and construct a map of all the files inside (including any inside of nested directories).
-// Files whose paths are included in the 'known' map will NOT be included in the result.
+// Files whose paths are included in the 'known' map, and partially moved files (see IngestFile),
+// will NOT be included in the result.
 // The key of the returned map is the path, and the value contains the FileInfo.
 func recursivelyWalkFileSystem(rootDirPath string, known map[string]bool) (map[string]fs.FileInfo, error) {
 	foundItems := make(map[string]fs.FileInfo, 0)
@@ -448,7 +758,7 @@ func recursivelyWalkFileSystem(rootDirPath string, known map[string]bool) (map[s
 			return err
 		}
 
-		if !dir.IsDir() {
+		if !dir.IsDir() && !strings.HasSuffix(path, partialFileSuffix) {
 			fileInfo, err := dir.Info()
 			if err != nil {
 				return err
@@ -467,3 +777,43 @@ func recursivelyWalkFileSystem(rootDirPath string, known map[string]bool) (map[s
 
 	return foundItems, nil
 }
+
+// restoreStagedFile moves a file which was staged for ingestion (see IngestFile) back
+// to it's original path, after the ingestion could not proceed.
+func (service *ingestService) restoreStagedFile(staged string, original string) {
+	if err := moveFile(staged, original); err != nil {
+		log.Errorf("Failed to restore staged file '%s' to '%s': %v\n", staged, original, err)
+	}
+}
+
+// moveFile moves the file at the source path to the destination path. If the file
+// cannot be renamed (e.g. as the paths are on different devices), the file is copied
+// to the destination before the source is removed.
+func moveFile(source string, destination string) error {
+	if err := os.Rename(source, destination); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		_ = os.Remove(destination)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(destination)
+		return err
+	}
+
+	return os.Remove(source)
+}
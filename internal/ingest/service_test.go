@@ -0,0 +1,117 @@
+package ingest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestIsLibraryPath(t *testing.T) {
+	base := t.TempDir()
+	ingestDir := filepath.Join(base, "ingest")
+	libraryDir := filepath.Join(base, "library")
+	outsideDir := filepath.Join(base, "outside")
+	for _, dir := range []string{ingestDir, libraryDir, outsideDir} {
+		if err := os.Mkdir(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, path := range []string{filepath.Join(ingestDir, "movie.mkv"), filepath.Join(libraryDir, "movie.mkv"), filepath.Join(outsideDir, "secret.mkv")} {
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Links inside of the ingest directory which point outside of it, and a link to the
+	// library directory (which should be accepted, as it resolves to the library)
+	links := map[string]string{
+		filepath.Join(ingestDir, "escape.mkv"):   filepath.Join(outsideDir, "secret.mkv"),
+		filepath.Join(ingestDir, "escape"):       outsideDir,
+		filepath.Join(outsideDir, "library"):     libraryDir,
+		filepath.Join(ingestDir, "dangling.mkv"): filepath.Join(base, "missing.mkv"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := &ingestService{config: Config{IngestPath: ingestDir, LibraryPaths: []string{libraryDir}}}
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{path: ingestDir, expected: true},
+		{path: filepath.Join(ingestDir, "movie.mkv"), expected: true},
+		{path: filepath.Join(libraryDir, "movie.mkv"), expected: true},
+		{path: filepath.Join(outsideDir, "library", "movie.mkv"), expected: true},
+		{path: filepath.Join(outsideDir, "secret.mkv"), expected: false},
+		{path: filepath.Join(ingestDir, "..", "outside", "secret.mkv"), expected: false},
+		{path: filepath.Join(ingestDir, "escape.mkv"), expected: false},
+		{path: filepath.Join(ingestDir, "escape", "secret.mkv"), expected: false},
+		{path: filepath.Join(ingestDir, "dangling.mkv"), expected: false},
+	}
+
+	for _, test := range tests {
+		if actual := service.isLibraryPath(test.path); actual != test.expected {
+			t.Errorf("isLibraryPath(%q) = %v, expected %v", test.path, actual, test.expected)
+		}
+	}
+}
+
+func TestIngestFile(t *testing.T) {
+	ingestDir := t.TempDir()
+	stagingDir := t.TempDir()
+	service := &ingestService{Mutex: &sync.Mutex{}, config: Config{IngestPath: ingestDir}}
+
+	source := filepath.Join(stagingDir, "upload")
+	if err := os.WriteFile(source, []byte("content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := service.IngestFile(source, "movie.mkv", nil)
+	if err != nil {
+		t.Fatalf("failed to ingest file: %v", err)
+	}
+
+	destination := filepath.Join(ingestDir, "movie.mkv")
+	if item.Path != destination || len(service.items) != 1 {
+		t.Errorf("expected item for '%s' to be queued, got %#v", destination, item)
+	}
+	if content, err := os.ReadFile(destination); err != nil || string(content) != "content" {
+		t.Errorf("expected file to be moved in to ingest directory: %v", err)
+	}
+	if entries, _ := os.ReadDir(ingestDir); len(entries) != 1 {
+		t.Errorf("expected no staged files to remain in ingest directory, got %v", entries)
+	}
+
+	// Ingesting another file with the same name must not replace the existing file
+	if err := os.WriteFile(source, []byte("other"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.IngestFile(source, "movie.mkv", nil); !errors.Is(err, ErrIngestFileExists) {
+		t.Errorf("expected error %v, got %v", ErrIngestFileExists, err)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Errorf("expected source of rejected file to be left in place: %v", err)
+	}
+}
+
+func TestRecursivelyWalkFileSystem_IgnoresPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"movie.mkv", "episode.mkv.1234" + partialFileSuffix} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := recursivelyWalkFileSystem(dir, map[string]bool{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := found[filepath.Join(dir, "movie.mkv")]; !ok || len(found) != 1 {
+		t.Errorf("expected only the complete file to be found, got %v", found)
+	}
+}
@@ -0,0 +1,55 @@
+package ingest
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+type Store struct{}
+
+// SaveTitleRule saves the rule provided, replacing the TMDB ID of any existing
+// rule with the same title.
+func (store *Store) SaveTitleRule(db database.Queryable, rule *TitleRule) error {
+	var updatedRule TitleRule
+	if err := db.QueryRowx(`
+		INSERT INTO ingest_rule(id, created_at, updated_at, title, episodic, tmdb_id)
+		VALUES($1, current_timestamp, current_timestamp, $2, $3, $4)
+		ON CONFLICT(title, episodic) DO UPDATE
+			SET (updated_at, tmdb_id) = (current_timestamp, EXCLUDED.tmdb_id)
+		RETURNING *`,
+		rule.ID, normalizeTitle(rule.Title), rule.Episodic, rule.TmdbID,
+	).StructScan(&updatedRule); err != nil {
+		return fmt.Errorf("failed to save ingest rule for title '%s': %w", rule.Title, err)
+	}
+
+	*rule = updatedRule
+	return nil
+}
+
+func (store *Store) GetTitleRule(db database.Queryable, title string, episodic bool) (*TitleRule, error) {
+	var dest TitleRule
+	if err := db.Get(&dest, `SELECT * FROM ingest_rule WHERE title=$1 AND episodic=$2`, normalizeTitle(title), episodic); err != nil {
+		return nil, fmt.Errorf("failed to find ingest rule for title '%s': %w", title, err)
+	}
+
+	return &dest, nil
+}
+
+func (store *Store) ListTitleRules(db database.Queryable) ([]*TitleRule, error) {
+	var dest []*TitleRule
+	if err := db.Select(&dest, `SELECT * FROM ingest_rule ORDER BY title`); err != nil {
+		return nil, fmt.Errorf("failed to select ingest rules: %w", err)
+	}
+
+	return dest, nil
+}
+
+func (store *Store) DeleteTitleRule(db database.Queryable, ruleID uuid.UUID) error {
+	if _, err := db.Exec(`DELETE FROM ingest_rule WHERE id=$1`, ruleID); err != nil {
+		return fmt.Errorf("failed to delete ingest rule %s: %w", ruleID, err)
+	}
+
+	return nil
+}
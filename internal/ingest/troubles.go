@@ -3,8 +3,10 @@ package ingest
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/hbomb79/Thea/internal/http/tmdb"
 )
 
@@ -17,12 +19,28 @@ type (
 		// choices is a nullable list of search results; only populated
 		// if the trouble type is TMDB_FAILURE_MULTI
 		choices *[]tmdb.SearchResultItem
+
+		// duplicate is the nullable source path of the existing media which
+		// the item duplicates; only populated if the trouble type is DUPLICATE_SOURCE
+		duplicate *string
+	}
+
+	// TroubleFilter selects the troubled ingests which a resolution is applied
+	// to (see ResolveTroubledIngests). Items must match all of the criteria provided.
+	TroubleFilter struct {
+		IDs         []uuid.UUID
+		TroubleType *TroubleType
+
+		// Title matches items whose scraped title is the same as this
+		// title (ignoring differences in case and whitespace).
+		Title *string
 	}
 
-	ResolutionType   int
-	RetryResolution  struct{}
-	AbortResolution  struct{}
-	TmdbIDResolution struct{ tmdbID string }
+	ResolutionType      int
+	RetryResolution     struct{}
+	AbortResolution     struct{}
+	TmdbIDResolution    struct{ tmdbID string }
+	DuplicateResolution struct{ method ResolutionType }
 )
 
 const (
@@ -31,12 +49,16 @@ const (
 	TmdbFailureMultipleResults
 	TmdbFailureNoResults
 	UnknownFailure
+	DuplicateSource
 )
 
 const (
 	Retry ResolutionType = iota
 	SpecifyTmdbID
 	Abort
+	KeepExisting
+	ReplaceExisting
+	KeepBoth
 )
 
 var allowedResolutionTypes = map[TroubleType][]ResolutionType{
@@ -45,6 +67,7 @@ var allowedResolutionTypes = map[TroubleType][]ResolutionType{
 	TmdbFailureUnknown:         {Abort, Retry, SpecifyTmdbID},
 	TmdbFailureMultipleResults: {Abort, Retry, SpecifyTmdbID},
 	TmdbFailureNoResults:       {Abort, Retry, SpecifyTmdbID},
+	DuplicateSource:            {Abort, KeepExisting, ReplaceExisting, KeepBoth},
 }
 
 func newTrouble(err error) Trouble {
@@ -102,6 +125,8 @@ func (t *Trouble) GenerateResolution(resolutionMethod ResolutionType, context ma
 		}
 
 		return nil, ErrResolutionContextIncompatible
+	case KeepExisting, ReplaceExisting, KeepBoth:
+		return &DuplicateResolution{method: resolutionMethod}, nil
 	default:
 		return nil, ErrResolutionIncompatible
 	}
@@ -119,6 +144,35 @@ func (t *Trouble) GetTmdbChoices() []tmdb.SearchResultItem {
 	return nil
 }
 
+// GetDuplicateSourcePath returns the source path of the existing media which
+// the troubled item duplicates IF and ONLY IF the trouble type is DUPLICATE_SOURCE. If
+// this condition is unmet, then `nil` is returned.
+func (t *Trouble) GetDuplicateSourcePath() *string {
+	if t.tType == DuplicateSource {
+		return t.duplicate
+	}
+
+	return nil
+}
+
+func (filter *TroubleFilter) isEmpty() bool {
+	return len(filter.IDs) == 0 && filter.TroubleType == nil && filter.Title == nil
+}
+
+func (filter *TroubleFilter) matches(item *IngestItem) bool {
+	if len(filter.IDs) > 0 && !slices.Contains(filter.IDs, item.ID) {
+		return false
+	}
+	if filter.TroubleType != nil && (item.Trouble == nil || item.Trouble.Type() != *filter.TroubleType) {
+		return false
+	}
+	if filter.Title != nil && (item.ScrapedMetadata == nil || normalizeTitle(item.ScrapedMetadata.Title) != normalizeTitle(*filter.Title)) {
+		return false
+	}
+
+	return true
+}
+
 func (t TroubleType) String() string {
 	//exhaustive:enforce
 	switch t {
@@ -132,6 +186,28 @@ func (t TroubleType) String() string {
 		return fmt.Sprintf("TMDB_FAILURE_NONE[%d]", t)
 	case UnknownFailure:
 		return fmt.Sprintf("UNKNOWN_FAILURE[%d]", t)
+	case DuplicateSource:
+		return fmt.Sprintf("DUPLICATE_SOURCE[%d]", t)
+	}
+
+	panic("unreachable")
+}
+
+func (r ResolutionType) String() string {
+	//exhaustive:enforce
+	switch r {
+	case Retry:
+		return fmt.Sprintf("RETRY[%d]", r)
+	case SpecifyTmdbID:
+		return fmt.Sprintf("SPECIFY_TMDB_ID[%d]", r)
+	case Abort:
+		return fmt.Sprintf("ABORT[%d]", r)
+	case KeepExisting:
+		return fmt.Sprintf("KEEP_EXISTING[%d]", r)
+	case ReplaceExisting:
+		return fmt.Sprintf("REPLACE_EXISTING[%d]", r)
+	case KeepBoth:
+		return fmt.Sprintf("KEEP_BOTH[%d]", r)
 	}
 
 	panic("unreachable")
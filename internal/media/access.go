@@ -0,0 +1,142 @@
+package media
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+	"github.com/lib/pq"
+)
+
+// AccessFilter restricts the media which is visible to a user. Movies and episodes are
+// accessible if they satisfy all of the restrictions of the filter, whereas series and collections
+// are accessible if any of their episodes/movies are. A nil filter does not restrict access.
+type AccessFilter struct {
+	// AllowedLibraries restricts the media to that which has at least one source file inside
+	// of these directories. A nil slice allows media from any library.
+	AllowedLibraries []string
+
+	// MaxContentRating is the maximum content rating age of the media. Unrated
+	// media is NOT accessible if a maximum is set.
+	MaxContentRating *int
+
+	// HideAdult causes media which TMDB considers to be adult content to be inaccessible
+	HideAdult bool
+}
+
+// AllowsPath returns true if the source file path provided is inside
+// of one of the libraries allowed by the filter.
+func (filter *AccessFilter) AllowsPath(path string) bool {
+	if filter == nil || filter.AllowedLibraries == nil {
+		return true
+	}
+
+	for _, library := range filter.AllowedLibraries {
+		if rel, err := filepath.Rel(library, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mediaCondition returns an SQL condition (using '?' placeholders), and it's arguments, which is
+// satisfied only by the rows of the media table which are accessible according to this filter.
+func (filter *AccessFilter) mediaCondition() (string, []any) {
+	conditions := []string{"TRUE"}
+	args := []any{}
+	if filter.HideAdult {
+		conditions = append(conditions, "NOT media.adult")
+	}
+	if filter.MaxContentRating != nil {
+		conditions = append(conditions, "media.content_rating_age <= ?")
+		args = append(args, *filter.MaxContentRating)
+	}
+	if filter.AllowedLibraries != nil {
+		patterns := make([]string, len(filter.AllowedLibraries))
+		for k, v := range filter.AllowedLibraries {
+			patterns[k] = escapeLikePattern(strings.TrimSuffix(v, string(filepath.Separator))) + string(filepath.Separator) + "%"
+		}
+
+		conditions = append(conditions, `EXISTS(
+			SELECT 1 FROM media_file
+			WHERE media_file.media_id = media.id AND media_file.source_path LIKE ANY(?)
+		)`)
+		args = append(args, pq.Array(patterns))
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// existsCondition returns an SQL condition (using '?' placeholders), and it's arguments, which is satisfied
+// only if at least one accessible movie/episode exists which satisfies the join and where clauses provided.
+func (filter *AccessFilter) existsCondition(join string, where string) (string, []any) {
+	condition, args := filter.mediaCondition()
+	return fmt.Sprintf("EXISTS(SELECT 1 FROM media %s WHERE %s AND %s)", join, where, condition), args
+}
+
+// listCondition returns an SQL condition (using '?' placeholders), and it's arguments, which is
+// satisfied only by the rows of the media list CTE (see getMediaListCte) which are accessible.
+func (filter *AccessFilter) listCondition() (string, []any) {
+	movieCondition, movieArgs := filter.existsCondition("", "media.id = joinedMedia.id")
+	seriesCondition, seriesArgs := filter.existsCondition("INNER JOIN season ON season.id = media.season_id", "season.series_id = joinedMedia.id")
+	collectionCondition, collectionArgs := filter.existsCondition("", "media.collection_id = joinedMedia.id")
+
+	condition := fmt.Sprintf(`(
+		(joinedMedia.type = 'movie' AND %s) OR
+		(joinedMedia.type = 'series' AND %s) OR
+		(joinedMedia.type = 'collection' AND %s)
+	)`, movieCondition, seriesCondition, collectionCondition)
+
+	return condition, append(append(movieArgs, seriesArgs...), collectionArgs...)
+}
+
+// FilterAccessibleMedia returns the IDs of the movies/episodes provided which are accessible
+// according to the filter provided. The order of the IDs is not preserved.
+func (store *Store) FilterAccessibleMedia(db database.Queryable, filter *AccessFilter, mediaIDs []uuid.UUID) ([]uuid.UUID, error) {
+	return filterAccessible(db, filter, `
+		SELECT media.id FROM media
+		WHERE media.id = ANY(?) AND %s`, mediaIDs)
+}
+
+// FilterAccessibleSeries returns the IDs of the series provided which have at least one episode
+// which is accessible according to the filter provided. The order of the IDs is not preserved.
+func (store *Store) FilterAccessibleSeries(db database.Queryable, filter *AccessFilter, seriesIDs []uuid.UUID) ([]uuid.UUID, error) {
+	return filterAccessible(db, filter, `
+		SELECT DISTINCT season.series_id FROM season
+		INNER JOIN media
+			ON media.season_id = season.id
+		WHERE season.series_id = ANY(?) AND %s`, seriesIDs)
+}
+
+// FilterAccessibleCollections returns the IDs of the collections provided which have at least one movie
+// which is accessible according to the filter provided. The order of the IDs is not preserved.
+func (store *Store) FilterAccessibleCollections(db database.Queryable, filter *AccessFilter, collectionIDs []uuid.UUID) ([]uuid.UUID, error) {
+	return filterAccessible(db, filter, `
+		SELECT DISTINCT media.collection_id FROM media
+		WHERE media.collection_id = ANY(?) AND %s`, collectionIDs)
+}
+
+// filterAccessible executes the query provided after formatting it to include the media
+// condition of the filter. If the filter is nil, the IDs provided are returned as-is.
+func filterAccessible(db database.Queryable, filter *AccessFilter, queryTemplate string, ids []uuid.UUID) ([]uuid.UUID, error) {
+	if filter == nil || len(ids) == 0 {
+		return ids, nil
+	}
+
+	condition, args := filter.mediaCondition()
+	var dest []uuid.UUID
+	if err := db.Select(&dest, db.Rebind(fmt.Sprintf(queryTemplate, condition)), append([]any{pq.Array(ids)}, args...)...); err != nil {
+		return nil, fmt.Errorf("failed to filter accessible media: %w", err)
+	}
+
+	return dest, nil
+}
+
+// escapeLikePattern escapes the characters provided which have
+// special meaning inside of a SQL LIKE pattern.
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
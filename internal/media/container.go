@@ -15,12 +15,16 @@ type (
 	// container is holding an 'Episode' type, then the 'Season'
 	// and 'Series' that the episode belongs to will also be populated
 	// if available.
+	//
+	// As media may have many source files, the container may also hold
+	// the specific File which is being operated on (e.g. transcoded). See WithFile.
 	Container struct {
 		Type    ContainerType
 		Movie   *Movie
 		Episode *Episode
 		Series  *Series
 		Season  *Season
+		File    *MediaFile
 	}
 )
 
@@ -30,13 +34,38 @@ const (
 	SeriesContainerType
 )
 
-func (cont *Container) Resolution() (int, int) { return 0, 0 }
-func (cont *Container) ID() uuid.UUID          { return cont.model().ID }
-func (cont *Container) Title() string          { return cont.model().Title }
-func (cont *Container) TmdbID() string         { return cont.model().TmdbID }
-func (cont *Container) CreatedAt() time.Time   { return cont.model().CreatedAt }
-func (cont *Container) UpdatedAt() time.Time   { return cont.model().UpdatedAt }
-func (cont *Container) Source() string         { return cont.watchable().SourcePath }
+func (cont *Container) ID() uuid.UUID        { return cont.model().ID }
+func (cont *Container) Title() string        { return cont.model().Title }
+func (cont *Container) TmdbID() string       { return cont.model().TmdbID }
+func (cont *Container) CreatedAt() time.Time { return cont.model().CreatedAt }
+func (cont *Container) UpdatedAt() time.Time { return cont.model().UpdatedAt }
+
+// WithFile returns a copy of this container which holds the media file provided.
+func (cont *Container) WithFile(file *MediaFile) *Container {
+	out := *cont
+	out.File = file
+	return &out
+}
+
+// Source returns the source path of the media file held by the container. An empty
+// string is returned if the container holds no file.
+func (cont *Container) Source() string {
+	if cont.File == nil {
+		return ""
+	}
+
+	return cont.File.SourcePath
+}
+
+// Resolution returns the width and height of the media file held by the container. If
+// the container holds no file, or the resolution of the file is unknown, zeros are returned.
+func (cont *Container) Resolution() (int, int) {
+	if cont.File == nil || cont.File.Width == nil || cont.File.Height == nil {
+		return 0, 0
+	}
+
+	return *cont.File.Width, *cont.File.Height
+}
 
 // EpisodeNumber returns the episode number for the media IF it is an Episode. -1
 // is returned if the container is holding a Movie.
@@ -62,19 +91,6 @@ func (cont *Container) String() string {
 	return fmt.Sprintf("{media title=%s | id=%s | tmdb_id=%s }", cont.model().Title, cont.model().ID, cont.model().TmdbID)
 }
 
-func (cont *Container) watchable() *Watchable {
-	switch cont.Type {
-	case MovieContainerType:
-		return &cont.Movie.Watchable
-	case EpisodeContainerType:
-		return &cont.Episode.Watchable
-	case SeriesContainerType:
-		return nil
-	}
-
-	panic("unreachable")
-}
-
 func (cont *Container) model() *Model {
 	switch cont.Type {
 	case MovieContainerType:
@@ -0,0 +1,63 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// hashChunkSize is the number of bytes read from the head and tail of a file when hashing.
+const hashChunkSize = 64 * 1024
+
+// HashFile computes a fast, partial hash of the file at the path provided, returning the hash
+// and the size of the file. The hash is the OpenSubtitles hash of the file: the size of the
+// file plus the sum of it's first and last 64KiB (read as little-endian 64-bit words), formatted
+// as hex. As only a small portion of the file is read, hashing is fast even for very large files,
+// and the hash is stable when the file is moved or renamed.
+//
+// Note: as the hash is partial, two files with the same hash are very likely, but not
+// guaranteed, to have the same content.
+func HashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	size := info.Size()
+	chunkSize := int64(hashChunkSize)
+	if size < chunkSize {
+		chunkSize = size
+	}
+
+	hash := uint64(size)
+	for _, offset := range []int64{0, size - chunkSize} {
+		chunk := make([]byte, chunkSize)
+		if _, err := file.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return "", 0, fmt.Errorf("failed to read file for hashing: %w", err)
+		}
+
+		hash += sumWords(chunk)
+	}
+
+	return fmt.Sprintf("%016x", hash), size, nil
+}
+
+// sumWords sums the bytes provided as little-endian 64-bit words. If the
+// length of the input is not a multiple of 8, the final word is zero-padded.
+func sumWords(data []byte) uint64 {
+	var sum uint64
+	for i := 0; i < len(data); i += 8 {
+		word := make([]byte, 8)
+		copy(word, data[i:])
+		sum += binary.LittleEndian.Uint64(word)
+	}
+
+	return sum
+}
@@ -2,6 +2,7 @@ package media
 
 import (
 	"errors"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -20,6 +21,10 @@ type (
 		Year          *int
 		FrameW        *int
 		FrameH        *int
+		VideoCodec    string
+		Bitrate       *int64 // Overall bitrate of the file, in bits per second
+		Size          *int64 // Size of the file, in bytes
+		ContentHash   *string
 		Path          string
 	}
 
@@ -64,6 +69,24 @@ func (scraper *MetadataScraper) ScrapeFileForMediaInfo(path string) (*FileMediaM
 	return &output, nil
 }
 
+// ScrapeFileForStreamInfo is similar to ScrapeFileForMediaInfo, however only
+// the information available from ffprobe (frame width/height, video codec, bitrate and
+// runtime) is extracted. This is useful for comparing the quality of files whose
+// title does not need to be parsed (e.g. the source of existing media).
+func (scraper *MetadataScraper) ScrapeFileForStreamInfo(path string) (*FileMediaMetadata, error) {
+	output := FileMediaMetadata{
+		SeasonNumber:  -1,
+		EpisodeNumber: -1,
+		Path:          path,
+	}
+
+	if err := scraper.extractFfprobeInformation(path, &output); err != nil {
+		return nil, err
+	}
+
+	return &output, nil
+}
+
 // extractTitleInformation uses regular expressions to try and find:
 // - Title
 // - Year
@@ -106,22 +129,43 @@ func (scraper *MetadataScraper) extractTitleInformation(title string, output *Fi
 }
 
 // extractFfprobeInformation will read the media metadata using ffprobe. If successful,
-// the frame width/height and the runtime of the media will be populated in the output.
+// the frame width/height, video codec, bitrate and the runtime of the media will be populated in the output,
+// along with the size of the file.
 func (scraper *MetadataScraper) extractFfprobeInformation(path string, output *FileMediaMetadata) error {
 	metadata, err := ffmpeg.ProbeFile(path, scraper.config.FfprobeBinPath)
 	if err != nil {
 		return ffmpeg.ParseFfmpegError(err)
 	}
 
-	// TODO Consider revising how we select the stream
 	streams := metadata.GetStreams()
+	if len(streams) == 0 {
+		return errors.New("ffprobe reported no streams for file")
+	}
+
+	// Prefer the first video stream, falling back to the first stream if
+	// ffprobe did not report the stream types
 	stream := streams[0]
+	for _, s := range streams {
+		if s.GetCodecType() == "video" {
+			stream = s
+			break
+		}
+	}
+
 	width := stream.GetWidth()
 	height := stream.GetHeight()
 
 	output.FrameW = &width
 	output.FrameH = &height
+	output.VideoCodec = stream.GetCodecName()
 	output.Runtime = metadata.GetFormat().GetDuration()
+	if bitrate, err := strconv.ParseInt(metadata.GetFormat().GetBitRate(), 10, 64); err == nil {
+		output.Bitrate = &bitrate
+	}
+	if info, err := os.Stat(path); err == nil {
+		size := info.Size()
+		output.Size = &size
+	}
 
 	return nil
 }
@@ -1,7 +1,10 @@
 package media
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -24,23 +27,60 @@ type (
 		Title     string
 	}
 
+	// Metadata contains the descriptive information about some media which
+	// is sourced from TMDB. TMDB does not provide all of this information for
+	// every type of media, in which case the zero value is stored.
+	Metadata struct {
+		Overview         string  `db:"overview"`
+		Tagline          string  `db:"tagline"`
+		OriginalTitle    string  `db:"original_title"`
+		OriginalLanguage string  `db:"original_language"`
+		Status           string  `db:"status"`
+		VoteAverage      float64 `db:"vote_average"`
+		VoteCount        int     `db:"vote_count"`
+	}
+
+	// Artwork contains the IDs of the images (held in the image cache) which
+	// are associated with some media. For episodes, the backdrop is the episode still.
+	Artwork struct {
+		PosterImage   *string `db:"poster_image"`
+		BackdropImage *string `db:"backdrop_image"`
+	}
+
 	// Media represents the form of both movies and episodes inside the database. It is only after checking the
 	// type of the Media row that we can determine whether the row represents a movie or an episode.
 	media struct {
 		Model
 		Watchable
+		Metadata
+		Artwork
 		Type          string     `db:"type"`
 		EpisodeNumber *int       `db:"episode_number"` // Nullable
 		SeasonID      *uuid.UUID `db:"season_id"`      // Nullable
+		CollectionID  *uuid.UUID `db:"collection_id"`  // Nullable
 	}
 
 	// Watchable represents the union of properties that we expect to see
 	// populated on all watchable media (movie/episode). Media containers,
 	// such as a series/season are not required to contain this information.
+	//
+	// The source files of the media are stored separately, see MediaFile.
 	Watchable struct {
 		MediaResolution
-		SourcePath string `db:"source_path"`
-		Adult      bool   `db:"adult"`
+		Adult bool `db:"adult"`
+
+		// ContentRating is the certification of the media (e.g. PG-13) as reported by TMDB, and
+		// ContentRatingAge is the minimum age of the audience that certification is suitable for. Both
+		// are nil if the media is unrated. Episodes inherit the content rating of their series.
+		ContentRating    *string `db:"content_rating"`
+		ContentRatingAge *int    `db:"content_rating_age"`
+
+		// Runtime is the runtime of the media (in minutes) as reported by TMDB
+		Runtime int `db:"runtime"`
+
+		// ReleaseDate is the date the movie was released, or the date the
+		// episode first aired. Nil if unknown.
+		ReleaseDate *time.Time `db:"release_date"`
 	}
 
 	MediaResolution struct {
@@ -53,8 +93,11 @@ type (
 	// Additionally, a series is related to many seasons.
 	Season struct {
 		Model
-		SeasonNumber int       `db:"season_number"`
-		SeriesID     uuid.UUID `db:"series_id"`
+		Artwork
+		SeasonNumber int        `db:"season_number"`
+		SeriesID     uuid.UUID  `db:"series_id"`
+		Overview     string     `db:"overview"`
+		AirDate      *time.Time `db:"air_date"`
 	}
 
 	Genre struct {
@@ -67,7 +110,12 @@ type (
 	// are not contained within this model.
 	Series struct {
 		Model
-		Genres []*Genre
+		Metadata
+		Artwork
+		FirstAirDate *time.Time `db:"first_air_date"`
+		LastAirDate  *time.Time `db:"last_air_date"`
+		Genres       []*Genre
+		Credits      []*MediaCredit
 	}
 
 	// SeriesStub is used to package information about a series which doesn't map one-to-one with
@@ -100,14 +148,26 @@ type (
 	Episode struct {
 		Model
 		Watchable
+		Metadata
+		Artwork
 		SeasonID      uuid.UUID `db:"season_id"`
 		EpisodeNumber int       `db:"episode_number"`
+		Credits       []*MediaCredit
 	}
 
 	Movie struct {
 		Model
 		Watchable
-		Genres []*Genre
+		Metadata
+		Artwork
+		CollectionID *uuid.UUID `db:"collection_id"`
+		Genres       []*Genre
+		Credits      []*MediaCredit
+
+		// Collection is the collection this movie belongs to, and is only
+		// populated when saving a newly ingested movie. When reading a movie
+		// from the database, use the CollectionID instead.
+		Collection *Collection `db:"-"`
 	}
 )
 
@@ -125,19 +185,40 @@ const (
 	MediaEpisodeClause = "AND type='episode'"
 )
 
+const pgUniqueViolationCode = "23505"
+
+// ErrTmdbIDConflict is returned when attempting to change the TMDB ID of some
+// media to a TMDB ID which is already in use by other media.
+var ErrTmdbIDConflict = errors.New("tmdb id is already in use by other media")
+
+// ContinuingSeriesStatuses are the TMDB series statuses which indicate
+// that new episodes of the series may still be released.
+var ContinuingSeriesStatuses = []string{"Returning Series", "In Production", "Planned", "Pilot"}
+
 type MediaListResult struct {
-	Series *SeriesStub
-	Movie  *Movie
+	Series     *SeriesStub
+	Movie      *Movie
+	Collection *CollectionStub
 }
 
-func (result *MediaListResult) IsMovie() bool  { return result.Movie != nil && result.Series == nil }
-func (result *MediaListResult) IsSeries() bool { return result.Movie == nil && result.Series != nil }
+func (result *MediaListResult) IsMovie() bool {
+	return result.Movie != nil && result.Series == nil && result.Collection == nil
+}
+
+func (result *MediaListResult) IsSeries() bool {
+	return result.Movie == nil && result.Series != nil && result.Collection == nil
+}
+
+func (result *MediaListResult) IsCollection() bool {
+	return result.Movie == nil && result.Series == nil && result.Collection != nil
+}
 
 type MediaListType string
 
 const (
-	MovieType  MediaListType = "movie"
-	SeriesType MediaListType = "series"
+	MovieType      MediaListType = "movie"
+	SeriesType     MediaListType = "series"
+	CollectionType MediaListType = "collection"
 )
 
 type MediaListOrderColumn string
@@ -157,7 +238,12 @@ type MediaListOrderBy struct {
 	Descending bool
 }
 
-type Store struct{ mediaGenreStore }
+type Store struct {
+	mediaGenreStore
+	mediaCreditStore
+	mediaCollectionStore
+	mediaFileStore
+}
 
 // SaveMovie upserts the provided Movie model to the database. Existing models
 // to update are found using the 'TmdbId' as this is expected to be a stable
@@ -167,12 +253,25 @@ type Store struct{ mediaGenreStore }
 func (store *Store) SaveMovie(db database.Queryable, movie *Movie) error {
 	var updatedMovie Movie
 	if err := db.QueryRowx(`
-		INSERT INTO media(id, type, tmdb_id, title, adult, source_path, created_at, updated_at)
-		VALUES($1, $2, $3, $4, $5, $6, current_timestamp, current_timestamp)
+		INSERT INTO media(
+			id, type, tmdb_id, title, adult, content_rating, content_rating_age, runtime, release_date, overview, tagline,
+			original_title, original_language, status, vote_average, vote_count, poster_image, backdrop_image, collection_id, created_at, updated_at
+		)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, current_timestamp, current_timestamp)
 		ON CONFLICT(tmdb_id, type) DO UPDATE
-			SET (updated_at, title, adult, source_path) = (current_timestamp, EXCLUDED.title, EXCLUDED.adult, EXCLUDED.source_path)
-		RETURNING id, tmdb_id, title, adult, source_path, created_at, updated_at;
-	`, movie.ID, "movie", movie.TmdbID, movie.Title, movie.Adult, movie.SourcePath).StructScan(&updatedMovie); err != nil {
+			SET (
+				updated_at, title, adult, content_rating, content_rating_age, runtime, release_date, overview, tagline,
+				original_title, original_language, status, vote_average, vote_count, poster_image, backdrop_image, collection_id
+			) = (
+				current_timestamp, EXCLUDED.title, EXCLUDED.adult, EXCLUDED.content_rating, EXCLUDED.content_rating_age, EXCLUDED.runtime,
+				EXCLUDED.release_date, EXCLUDED.overview, EXCLUDED.tagline, EXCLUDED.original_title, EXCLUDED.original_language, EXCLUDED.status,
+				EXCLUDED.vote_average, EXCLUDED.vote_count,
+				COALESCE(EXCLUDED.poster_image, media.poster_image), COALESCE(EXCLUDED.backdrop_image, media.backdrop_image), EXCLUDED.collection_id
+			)
+		RETURNING id, tmdb_id, title, adult, created_at, updated_at;
+	`, movie.ID, "movie", movie.TmdbID, movie.Title, movie.Adult, movie.ContentRating, movie.ContentRatingAge, movie.Runtime, movie.ReleaseDate,
+		movie.Overview, movie.Tagline, movie.OriginalTitle, movie.OriginalLanguage, movie.Status, movie.VoteAverage, movie.VoteCount, movie.PosterImage,
+		movie.BackdropImage, movie.CollectionID).StructScan(&updatedMovie); err != nil {
 		return err
 	}
 
@@ -190,12 +289,23 @@ func (store *Store) SaveMovie(db database.Queryable, movie *Movie) error {
 func (store *Store) SaveSeries(db database.Queryable, series *Series) error {
 	var updatedSeries Series
 	if err := db.QueryRowx(`
-		INSERT INTO series(id, tmdb_id, title, created_at, updated_at)
-		VALUES($1, $2, $3, current_timestamp, current_timestamp)
+		INSERT INTO series(
+			id, tmdb_id, title, overview, tagline, original_title, original_language, status,
+			vote_average, vote_count, first_air_date, last_air_date, poster_image, backdrop_image, created_at, updated_at
+		)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, current_timestamp, current_timestamp)
 		ON CONFLICT(tmdb_id) DO UPDATE
-			SET (title, updated_at) = (EXCLUDED.title, current_timestamp)
+			SET (
+				title, overview, tagline, original_title, original_language, status,
+				vote_average, vote_count, first_air_date, last_air_date, poster_image, backdrop_image, updated_at
+			) = (
+				EXCLUDED.title, EXCLUDED.overview, EXCLUDED.tagline, EXCLUDED.original_title, EXCLUDED.original_language, EXCLUDED.status,
+				EXCLUDED.vote_average, EXCLUDED.vote_count, EXCLUDED.first_air_date, EXCLUDED.last_air_date,
+				COALESCE(EXCLUDED.poster_image, series.poster_image), COALESCE(EXCLUDED.backdrop_image, series.backdrop_image), current_timestamp
+			)
 		RETURNING *
-	`, series.ID, series.TmdbID, series.Title).StructScan(&updatedSeries); err != nil {
+	`, series.ID, series.TmdbID, series.Title, series.Overview, series.Tagline, series.OriginalTitle, series.OriginalLanguage, series.Status,
+		series.VoteAverage, series.VoteCount, series.FirstAirDate, series.LastAirDate, series.PosterImage, series.BackdropImage).StructScan(&updatedSeries); err != nil {
 		return err
 	}
 
@@ -213,12 +323,14 @@ func (store *Store) SaveSeries(db database.Queryable, series *Series) error {
 func (store *Store) SaveSeason(db database.Queryable, season *Season) error {
 	var updatedSeason Season
 	if err := db.QueryRowx(`
-		INSERT INTO season(id, tmdb_id, season_number, title, series_id, created_at, updated_at)
-		VALUES($1, $2, $3, $4, $5, current_timestamp, current_timestamp)
+		INSERT INTO season(id, tmdb_id, season_number, title, series_id, overview, air_date, poster_image, backdrop_image, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, current_timestamp, current_timestamp)
 		ON CONFLICT(tmdb_id) DO UPDATE
-			SET (season_number, title, series_id, updated_at) = (EXCLUDED.season_number, EXCLUDED.title, EXCLUDED.series_id, current_timestamp)
+			SET (season_number, title, series_id, overview, air_date, poster_image, backdrop_image, updated_at) =
+				(EXCLUDED.season_number, EXCLUDED.title, EXCLUDED.series_id, EXCLUDED.overview, EXCLUDED.air_date,
+				 COALESCE(EXCLUDED.poster_image, season.poster_image), COALESCE(EXCLUDED.backdrop_image, season.backdrop_image), current_timestamp)
 		RETURNING *
-	`, season.ID, season.TmdbID, season.SeasonNumber, season.Title, season.SeriesID).StructScan(&updatedSeason); err != nil {
+	`, season.ID, season.TmdbID, season.SeasonNumber, season.Title, season.SeriesID, season.Overview, season.AirDate, season.PosterImage, season.BackdropImage).StructScan(&updatedSeason); err != nil {
 		return err
 	}
 
@@ -237,13 +349,24 @@ func (store *Store) SaveSeason(db database.Queryable, season *Season) error {
 func (store *Store) SaveEpisode(db database.Queryable, episode *Episode) error {
 	var updatedEpisode Episode
 	if err := db.QueryRowx(`
-		INSERT INTO media(id, type, tmdb_id, episode_number, title, source_path, season_id, adult, created_at, updated_at)
-		VALUES($1, $2, $3, $4, $5, $6, $7, $8, current_timestamp, current_timestamp)
+		INSERT INTO media(
+			id, type, tmdb_id, episode_number, title, season_id, adult, content_rating, content_rating_age, runtime, release_date,
+			overview, vote_average, vote_count, poster_image, backdrop_image, created_at, updated_at
+		)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, current_timestamp, current_timestamp)
 		ON CONFLICT(tmdb_id, type) DO UPDATE
-			SET (episode_number, title, source_path, season_id, updated_at, adult) =
-				(EXCLUDED.episode_number, EXCLUDED.title, EXCLUDED.source_path, EXCLUDED.season_id, current_timestamp, EXCLUDED.adult)
-		RETURNING id, tmdb_id, episode_number, title, source_path, season_id, adult, created_at, updated_at;
-	`, episode.ID, "episode", episode.TmdbID, episode.EpisodeNumber, episode.Title, episode.SourcePath, episode.SeasonID, episode.Adult).StructScan(&updatedEpisode); err != nil {
+			SET (
+				episode_number, title, season_id, updated_at, adult, content_rating, content_rating_age, runtime, release_date, overview,
+				vote_average, vote_count, poster_image, backdrop_image
+			) = (
+				EXCLUDED.episode_number, EXCLUDED.title, EXCLUDED.season_id, current_timestamp, EXCLUDED.adult, EXCLUDED.content_rating,
+				EXCLUDED.content_rating_age, EXCLUDED.runtime, EXCLUDED.release_date, EXCLUDED.overview, EXCLUDED.vote_average, EXCLUDED.vote_count,
+				COALESCE(EXCLUDED.poster_image, media.poster_image), COALESCE(EXCLUDED.backdrop_image, media.backdrop_image)
+			)
+		RETURNING id, tmdb_id, episode_number, title, season_id, adult, created_at, updated_at;
+	`, episode.ID, "episode", episode.TmdbID, episode.EpisodeNumber, episode.Title, episode.SeasonID, episode.Adult, episode.ContentRating,
+		episode.ContentRatingAge, episode.Runtime, episode.ReleaseDate, episode.Overview, episode.VoteAverage, episode.VoteCount, episode.PosterImage,
+		episode.BackdropImage).StructScan(&updatedEpisode); err != nil {
 		return err
 	}
 
@@ -254,6 +377,46 @@ func (store *Store) SaveEpisode(db database.Queryable, episode *Episode) error {
 	return nil
 }
 
+// UpdateMediaTmdbID changes the TMDB ID of the movie/episode with the ID provided. This is used
+// when re-matching existing media, so that a subsequent save of the media (which upserts based on
+// the TMDB ID) updates the existing row rather than inserting a new one.
+//
+// NB: This query will FAIL if another movie/episode already has the TMDB ID provided.
+func (store *Store) UpdateMediaTmdbID(db database.Queryable, mediaID uuid.UUID, tmdbID string) error {
+	res, err := db.Exec(`UPDATE media SET tmdb_id=$1, updated_at=current_timestamp WHERE id=$2`, tmdbID, mediaID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolationCode {
+			return ErrTmdbIDConflict
+		}
+
+		return fmt.Errorf("failed to update TMDB ID of media %s: %w", mediaID, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update TMDB ID of media %s: %w", mediaID, err)
+	} else if affected == 0 {
+		return fmt.Errorf("failed to update TMDB ID of media %s: %w", mediaID, sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// ListSeriesForRefresh returns the series whose metadata is likely to be out of date. This
+// includes all series which TMDB considers to be continuing, as well as any series which has
+// aired since the time provided.
+func (store *Store) ListSeriesForRefresh(db database.Queryable, airedSince time.Time) ([]*Series, error) {
+	var dest []*Series
+	if err := db.Select(&dest, `
+		SELECT * FROM series
+		WHERE status = ANY($1) OR last_air_date >= $2
+		ORDER BY updated_at ASC`, pq.Array(ContinuingSeriesStatuses), airedSince); err != nil {
+		return nil, fmt.Errorf("failed to select series for refresh: %w", err)
+	}
+
+	return dest, nil
+}
+
 // GetMedia is a convinience method for requesting either a Movie
 // or an Episode. The ID provided is used to lookup both, and whichever
 // query is successful is used to populate a media Container.
@@ -324,18 +487,28 @@ func (ord *MediaListOrderBy) String() string {
 	return fmt.Sprintf("%s %s", ord.Column, dir)
 }
 
-func getMediaListCte(includeTypes []MediaListType) string {
+func getMediaListCte(includeTypes []MediaListType, collapseCollections bool) string {
 	movieEnabledClause := "AND false"
 	seriesAllowedClause := "WHERE false"
+	collectionAllowedClause := "WHERE false"
 	for _, v := range includeTypes {
 		switch v {
 		case MovieType:
 			movieEnabledClause = ""
 		case SeriesType:
 			seriesAllowedClause = ""
+		case CollectionType:
+			collectionAllowedClause = ""
 		}
 	}
 
+	// When collapsing, movies which belong to a collection are omitted from the results in
+	// favour of the collection itself. If collections are not being listed, then there is
+	// nothing to collapse the movies in to, and so they're listed as normal.
+	if collapseCollections && slices.Contains(includeTypes, CollectionType) {
+		movieEnabledClause += " AND collection_id IS NULL"
+	}
+
 	getCoalescedGenresSQL := func(assocTableName string, tableName string, tableColumn string) string {
 		template := `
 			SELECT COALESCE(JSONB_AGG(DISTINCT genre.*) FILTER (WHERE genre.id IS NOT NULL), '[]')
@@ -349,10 +522,11 @@ func getMediaListCte(includeTypes []MediaListType) string {
 	}
 
 	return fmt.Sprintf(`
-		WITH joinedMedia(type, id, title, tmdb_id, created_at, updated_at, series_season_count, genres) AS (
+		WITH joinedMedia(type, id, title, tmdb_id, created_at, updated_at, poster_image, series_season_count, collection_movie_count, genres) AS (
 			SELECT 
-				'movie' AS type, id, title, tmdb_id, created_at, updated_at,
+				'movie' AS type, id, title, tmdb_id, created_at, updated_at, poster_image,
 				0, -- season_count forced to zero for movies (it's ignored when reading result rows)
+				0, -- movie_count forced to zero for movies (it's ignored when reading result rows)
 				(%s) -- coalesced genre clause for movies
 			FROM media
 			WHERE type='movie' %s -- movieEnabledClause
@@ -360,26 +534,52 @@ func getMediaListCte(includeTypes []MediaListType) string {
 			UNION
 
 			SELECT 
-				'series' AS type, id, title, tmdb_id, created_at, updated_at,
+				'series' AS type, id, title, tmdb_id, created_at, updated_at, poster_image,
 				(SELECT COUNT(*) FROM season WHERE season.series_id = series.id),
+				0, -- movie_count forced to zero for series (it's ignored when reading result rows)
 				(%s) -- coalesced genres clause for series
 			FROM series
 			%s -- seriesAllowedClause
+
+			UNION
+
+			SELECT
+				'collection' AS type, id, title, tmdb_id, created_at, updated_at, poster_image,
+				0, -- season_count forced to zero for collections (it's ignored when reading result rows)
+				(SELECT COUNT(*) FROM media WHERE media.collection_id = collection.id),
+				( -- coalesced genres of all movies in the collection
+					SELECT COALESCE(JSONB_AGG(DISTINCT genre.*) FILTER (WHERE genre.id IS NOT NULL), '[]')
+					FROM media
+					INNER JOIN movie_genres mg
+					ON mg.movie_id = media.id
+					INNER JOIN genre
+					ON genre.id = mg.genre_id
+					WHERE media.collection_id = collection.id
+				)
+			FROM collection
+			%s -- collectionAllowedClause
 		)
 		`,
 		getCoalescedGenresSQL("movie_genres", "media", "movie_id"),
 		movieEnabledClause,
 		getCoalescedGenresSQL("series_genres", "series", "series_id"),
-		seriesAllowedClause)
+		seriesAllowedClause,
+		collectionAllowedClause)
 }
 
-// ListMedia allows for series/movies to be listed (controllable using allowedTypes). The query also
+// ListMedia allows for series/movies/collections to be listed (controllable using allowedTypes). The query also
 // allows for an offset/limit to be provided, facilitating simple paging of the results.
 //   - titleFilter -> only returns results where their title is 'LIKE' the one provided
 //   - allowedTypes -> defaults to movies and series
+//   - collapseCollections -> if true, movies which belong to a collection are replaced by their collection. Only
+//     applies if collections are included in the allowedTypes
 //   - allowedGenres -> defaults to no filtering (any/all genres), if any genre IDs are provided then only
 //     media which is associated with ALL of the genres specified
+//   - allowedPeople -> defaults to no filtering, if any person IDs are provided then only media which credits
+//     ALL of the people specified is returned. A series (or collection) is considered to credit a person if any of it's episodes (or movies) do.
 //   - orderBy -> defaults to updated_at in ascending order
+//   - accessFilter -> defaults to no filtering (nil), if provided then only accessible media is returned. A series (or
+//     collection) is considered accessible if any of it's episodes (or movies) are.
 //   - offset -> defaults to 0
 //   - limit -> default to 15, maximum 100
 func (store *Store) ListMedia(
@@ -387,14 +587,17 @@ func (store *Store) ListMedia(
 	titleFilter string,
 	allowedTypes []MediaListType,
 	allowedGenres []int,
+	allowedPeople []uuid.UUID,
+	collapseCollections bool,
 	orderBy []MediaListOrderBy,
+	accessFilter *AccessFilter,
 	offset int,
 	limit int,
 ) ([]*MediaListResult, error) {
 	if len(allowedTypes) == 0 {
 		allowedTypes = []MediaListType{"movie", "series"}
 	}
-	cte := getMediaListCte(allowedTypes)
+	cte := getMediaListCte(allowedTypes, collapseCollections)
 	q := sq.Select("*").From("joinedMedia").Prefix(cte)
 
 	// Optional genre filtering
@@ -408,6 +611,32 @@ func (store *Store) ListMedia(
 			pq.Array(allowedGenres))
 	}
 
+	// Optional person filtering
+	for _, personID := range allowedPeople {
+		q = q.Where(`
+			joinedMedia.id IN (
+				SELECT credit.media_id FROM credit WHERE credit.person_id = ? AND credit.media_id IS NOT NULL
+				UNION
+				SELECT credit.series_id FROM credit WHERE credit.person_id = ? AND credit.series_id IS NOT NULL
+				UNION
+				SELECT season.series_id FROM credit
+				INNER JOIN media ON media.id = credit.media_id
+				INNER JOIN season ON season.id = media.season_id
+				WHERE credit.person_id = ?
+				UNION
+				SELECT media.collection_id FROM credit
+				INNER JOIN media ON media.id = credit.media_id
+				WHERE credit.person_id = ? AND media.collection_id IS NOT NULL
+			)`,
+			personID, personID, personID, personID)
+	}
+
+	// Optional access filtering
+	if accessFilter != nil {
+		condition, args := accessFilter.listCondition()
+		q = q.Where(condition, args...)
+	}
+
 	// Optional title filtering
 	trimmedTitleFilter := strings.TrimSpace(titleFilter)
 	if len(trimmedTitleFilter) > 0 {
@@ -442,7 +671,9 @@ func (store *Store) ListMedia(
 		TmdbID      string                        `db:"tmdb_id"`
 		CreatedAt   time.Time                     `db:"created_at"`
 		UpdatedAt   time.Time                     `db:"updated_at"`
+		PosterImage *string                       `db:"poster_image"`
 		SeasonCount int                           `db:"series_season_count"`
+		MovieCount  int                           `db:"collection_movie_count"`
 		MediaType   string                        `db:"type"`
 		Genres      database.JSONColumn[[]*Genre] `db:"genres"`
 	}
@@ -454,13 +685,16 @@ func (store *Store) ListMedia(
 	out := make([]*MediaListResult, len(results))
 	for k, v := range results {
 		model := Model{ID: v.ID, TmdbID: v.TmdbID, CreatedAt: v.CreatedAt, UpdatedAt: v.UpdatedAt, Title: v.Title}
+		artwork := Artwork{PosterImage: v.PosterImage}
 		switch v.MediaType {
 		case "movie":
-			out[k] = &MediaListResult{Movie: &Movie{Model: model, Genres: *v.Genres.Get()}}
+			out[k] = &MediaListResult{Movie: &Movie{Model: model, Artwork: artwork, Genres: *v.Genres.Get()}}
 		case "series":
-			out[k] = &MediaListResult{Series: &SeriesStub{Series: &Series{Model: model, Genres: *v.Genres.Get()}, SeasonCount: v.SeasonCount}}
+			out[k] = &MediaListResult{Series: &SeriesStub{Series: &Series{Model: model, Artwork: artwork, Genres: *v.Genres.Get()}, SeasonCount: v.SeasonCount}}
+		case "collection":
+			out[k] = &MediaListResult{Collection: &CollectionStub{Collection: &Collection{Model: model, Artwork: artwork}, MovieCount: v.MovieCount, Genres: *v.Genres.Get()}}
 		default:
-			return nil, fmt.Errorf("type of list result %v is illegal. Expected 'movie' or 'series', found '%s'", v, v.MediaType)
+			return nil, fmt.Errorf("type of list result %v is illegal. Expected 'movie', 'series' or 'collection', found '%s'", v, v.MediaType)
 		}
 	}
 
@@ -648,7 +882,7 @@ func (store *Store) GetEpisodeWithTmdbID(db database.Queryable, tmdbID string) (
 // to media that is currently known to Thea by polling the database.
 func (store *Store) GetAllSourcePaths(db *sqlx.DB) ([]string, error) {
 	var paths []string
-	if err := db.Select(&paths, `SELECT source_path FROM media`); err != nil {
+	if err := db.Select(&paths, `SELECT source_path FROM media_file`); err != nil {
 		return nil, err
 	}
 
@@ -720,10 +954,7 @@ func queryRowMovie(db database.Queryable, table string, col string, val any) (*M
 		return nil, fmt.Errorf("media query for an episode returned malformed data expected ('movie', nil, nil), found (%v, %v, %v)", r.Type, r.EpisodeNumber, r.SeasonID)
 	}
 
-	return &Movie{
-		Model:     r.Model,
-		Watchable: r.Watchable,
-	}, nil
+	return mediaToMovie(r), nil
 }
 
 // queryRowEpisode extracts a Media row from the database and ensures that the row returned represents
@@ -756,10 +987,22 @@ func queryRow[T any](db database.Queryable, table string, col string, val any, a
 	return &dest, nil
 }
 
+func mediaToMovie(m *media) *Movie {
+	return &Movie{
+		Model:        m.Model,
+		Watchable:    m.Watchable,
+		Metadata:     m.Metadata,
+		Artwork:      m.Artwork,
+		CollectionID: m.CollectionID,
+	}
+}
+
 func mediaToEpisode(m *media) *Episode {
 	return &Episode{
 		Model:         m.Model,
 		Watchable:     m.Watchable,
+		Metadata:      m.Metadata,
+		Artwork:       m.Artwork,
 		SeasonID:      *m.SeasonID,
 		EpisodeNumber: *m.EpisodeNumber,
 	}
@@ -0,0 +1,117 @@
+package media
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+type (
+	// Collection represents a group of related movies (such as a franchise), as
+	// sourced from TMDB. A collection 'has many' movies.
+	Collection struct {
+		Model
+		Artwork
+	}
+
+	// CollectionStub is used to package information about a collection which doesn't
+	// map one-to-one with it's database representation.
+	//
+	// NB: this struct does not represent a table which exists in the DB, it is purely used to package
+	// query results that arise from joining multiple tables together.
+	CollectionStub struct {
+		*Collection
+		MovieCount int
+
+		// Genres is the union of the genres of all movies in the collection. This is
+		// only populated when the stub is returned as part of a media list.
+		Genres []*Genre
+	}
+
+	// InflatedCollection is a Collection along with all of the movies
+	// which belong to it, ordered by their release date.
+	InflatedCollection struct {
+		*Collection
+		Movies []*Movie
+	}
+
+	mediaCollectionStore struct{}
+)
+
+const CollectionTable = "collection"
+
+// SaveCollection upserts the provided Collection model to the database. Existing models
+// are found using the 'TmdbId' as this is expected to be a stable identifier.
+//
+// NOTE: the ID of the collection may be UPDATED to match existing DB entry (if any).
+func (store *mediaCollectionStore) SaveCollection(db database.Queryable, collection *Collection) error {
+	var updatedCollection Collection
+	if err := db.QueryRowx(`
+		INSERT INTO collection(id, tmdb_id, title, poster_image, backdrop_image, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5, current_timestamp, current_timestamp)
+		ON CONFLICT(tmdb_id) DO UPDATE
+			SET (updated_at, title, poster_image, backdrop_image) = (
+				current_timestamp, EXCLUDED.title,
+				COALESCE(EXCLUDED.poster_image, collection.poster_image), COALESCE(EXCLUDED.backdrop_image, collection.backdrop_image)
+			)
+		RETURNING *
+	`, collection.ID, collection.TmdbID, collection.Title, collection.PosterImage, collection.BackdropImage).StructScan(&updatedCollection); err != nil {
+		return fmt.Errorf("failed to save collection %s: %w", collection.TmdbID, err)
+	}
+
+	collection.ID = updatedCollection.ID
+	return nil
+}
+
+// GetCollection searches for an existing collection with the Thea PK ID provided.
+func (store *mediaCollectionStore) GetCollection(db database.Queryable, collectionID uuid.UUID) (*Collection, error) {
+	return queryRow[Collection](db, CollectionTable, IDCol, collectionID, "")
+}
+
+// ListCollections returns all collections, along with the number of movies in each collection. If an
+// access filter is provided, only collections containing at least one accessible movie are returned.
+func (store *mediaCollectionStore) ListCollections(db database.Queryable, accessFilter *AccessFilter) ([]*CollectionStub, error) {
+	where, args := "TRUE", []any{}
+	if accessFilter != nil {
+		where, args = accessFilter.existsCondition("", "media.collection_id = collection.id")
+	}
+
+	var results []struct {
+		Collection
+		MovieCount int `db:"movie_count"`
+	}
+	if err := db.Select(&results, db.Rebind(`
+		SELECT collection.*, (SELECT COUNT(*) FROM media WHERE media.collection_id = collection.id) AS movie_count
+		FROM collection
+		WHERE `+where+`
+		ORDER BY collection.title`), args...); err != nil {
+		return nil, fmt.Errorf("failed to select all collections: %w", err)
+	}
+
+	out := make([]*CollectionStub, len(results))
+	for k := range results {
+		out[k] = &CollectionStub{Collection: &results[k].Collection, MovieCount: results[k].MovieCount}
+	}
+
+	return out, nil
+}
+
+// GetMoviesInCollection returns all the movies which belong to the collection provided, ordered
+// by their release date. Movies with an unknown release date are placed last.
+func (store *mediaCollectionStore) GetMoviesInCollection(db database.Queryable, collectionID uuid.UUID) ([]*Movie, error) {
+	var dest []*media
+	if err := db.Select(&dest, `
+		SELECT * FROM media
+		WHERE collection_id=$1 AND type='movie'
+		ORDER BY release_date ASC NULLS LAST, title`, collectionID); err != nil {
+		return nil, fmt.Errorf("failed to select movies for collection %s: %w", collectionID, err)
+	}
+
+	out := make([]*Movie, len(dest))
+	for k, v := range dest {
+		out[k] = mediaToMovie(v)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,227 @@
+package media
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+	"github.com/lib/pq"
+)
+
+type (
+	CreditRole string
+
+	// Person represents a cast or crew member, as sourced from TMDB. A person
+	// is related to media via credits.
+	Person struct {
+		ID                 uuid.UUID `db:"id"`
+		TmdbID             string    `db:"tmdb_id"`
+		CreatedAt          time.Time `db:"created_at"`
+		UpdatedAt          time.Time `db:"updated_at"`
+		Name               string    `db:"name"`
+		KnownForDepartment string    `db:"known_for_department"`
+	}
+
+	// Credit contains the information about a persons involvement in some media. For cast
+	// credits the character and order will be populated, and for crew credits the job
+	// and department will be populated.
+	Credit struct {
+		ID         uuid.UUID  `db:"id"`
+		Role       CreditRole `db:"role"`
+		Character  string     `db:"character"`
+		Job        string     `db:"job"`
+		Department string     `db:"department"`
+		Order      *int       `db:"credit_order"`
+	}
+
+	// MediaCredit is a credit for some media, including the person that
+	// the credit belongs to.
+	MediaCredit struct {
+		Credit
+		Person Person `db:"person"`
+	}
+
+	// PersonCredit is a credit for a person, including basic information
+	// about the media that the credit belongs to.
+	//
+	// NB: this struct does not represent a table which exists in the DB, it is purely used to package
+	// query results that arise from joining multiple tables together.
+	PersonCredit struct {
+		Credit
+		MediaType  string    `db:"media_type"`
+		MediaID    uuid.UUID `db:"media_id"`
+		MediaTitle string    `db:"media_title"`
+	}
+
+	mediaCreditStore struct{}
+)
+
+const (
+	CastCreditRole CreditRole = "cast"
+	CrewCreditRole CreditRole = "crew"
+
+	// selectMediaCreditsSQL is the base query for selecting credits along with their person. The
+	// caller is expected to append a WHERE clause to this query.
+	selectMediaCreditsSQL = `
+		SELECT
+			credit.id, credit.role, credit.character, credit.job, credit.department, credit.credit_order,
+			person.id AS "person.id", person.tmdb_id AS "person.tmdb_id", person.created_at AS "person.created_at",
+			person.updated_at AS "person.updated_at", person.name AS "person.name",
+			person.known_for_department AS "person.known_for_department"
+		FROM credit
+		INNER JOIN person
+			ON person.id = credit.person_id`
+)
+
+// SaveMediaCredits replaces the credits associated with the movie/episode provided, upserting
+// the people referenced by the credits as needed.
+func (store *mediaCreditStore) SaveMediaCredits(db database.Queryable, mediaID uuid.UUID, credits []*MediaCredit) error {
+	return store.saveCredits(db, "media_id", mediaID, credits)
+}
+
+// SaveSeriesCredits replaces the credits associated with the series provided, upserting
+// the people referenced by the credits as needed.
+func (store *mediaCreditStore) SaveSeriesCredits(db database.Queryable, seriesID uuid.UUID, credits []*MediaCredit) error {
+	return store.saveCredits(db, "series_id", seriesID, credits)
+}
+
+// GetCreditsForMedia returns all the credits for the movie or episode with the ID provided, ordered
+// such that cast credits appear first (in their TMDB billing order).
+func (store *mediaCreditStore) GetCreditsForMedia(db database.Queryable, mediaID uuid.UUID) ([]*MediaCredit, error) {
+	var dest []*MediaCredit
+	if err := db.Select(&dest, selectMediaCreditsSQL+` WHERE credit.media_id=$1 ORDER BY credit.role, credit.credit_order, person.name`, mediaID); err != nil {
+		return nil, fmt.Errorf("failed to select credits for media %s: %w", mediaID, err)
+	}
+
+	return dest, nil
+}
+
+// GetCreditsForSeries returns all the credits for the series with the ID provided, ordered
+// such that cast credits appear first (in their TMDB billing order).
+func (store *mediaCreditStore) GetCreditsForSeries(db database.Queryable, seriesID uuid.UUID) ([]*MediaCredit, error) {
+	var dest []*MediaCredit
+	if err := db.Select(&dest, selectMediaCreditsSQL+` WHERE credit.series_id=$1 ORDER BY credit.role, credit.credit_order, person.name`, seriesID); err != nil {
+		return nil, fmt.Errorf("failed to select credits for series %s: %w", seriesID, err)
+	}
+
+	return dest, nil
+}
+
+// GetPerson searches for an existing person with the Thea PK ID provided.
+func (store *mediaCreditStore) GetPerson(db database.Queryable, personID uuid.UUID) (*Person, error) {
+	return queryRow[Person](db, "person", IDCol, personID, "")
+}
+
+// GetCreditsForPerson returns all the credits for the person with the ID provided, including
+// basic information about the movie, episode or series that each credit belongs to.
+func (store *mediaCreditStore) GetCreditsForPerson(db database.Queryable, personID uuid.UUID) ([]*PersonCredit, error) {
+	var dest []*PersonCredit
+	if err := db.Select(&dest, `
+		SELECT
+			credit.id, credit.role, credit.character, credit.job, credit.department, credit.credit_order,
+			COALESCE(media.type::TEXT, 'series') AS media_type,
+			COALESCE(media.id, series.id) AS media_id,
+			COALESCE(media.title, series.title) AS media_title
+		FROM credit
+		LEFT JOIN media
+			ON media.id = credit.media_id
+		LEFT JOIN series
+			ON series.id = credit.series_id
+		WHERE credit.person_id=$1
+		ORDER BY media_title, credit.role`, personID); err != nil {
+		return nil, fmt.Errorf("failed to select credits for person %s: %w", personID, err)
+	}
+
+	return dest, nil
+}
+
+// saveCredits upserts the people referenced by the credits provided, before replacing
+// all credits owned by the media/series (determined by the ownerColumn and ownerID) with
+// the credits provided.
+func (store *mediaCreditStore) saveCredits(db database.Queryable, ownerColumn string, ownerID uuid.UUID, credits []*MediaCredit) error {
+	if _, err := db.Exec(fmt.Sprintf(`DELETE FROM credit WHERE %s=$1`, ownerColumn), ownerID); err != nil {
+		return fmt.Errorf("failed to delete existing credits for %s: %w", ownerID, err)
+	}
+
+	if len(credits) == 0 {
+		return nil
+	}
+
+	personIDs, err := store.savePeople(db, credits)
+	if err != nil {
+		return err
+	}
+
+	type creditRow struct {
+		Credit
+		PersonID uuid.UUID  `db:"person_id"`
+		MediaID  *uuid.UUID `db:"media_id"`
+		SeriesID *uuid.UUID `db:"series_id"`
+	}
+
+	rows := make([]creditRow, len(credits))
+	for k, v := range credits {
+		row := creditRow{Credit: v.Credit, PersonID: personIDs[v.Person.TmdbID]}
+		row.ID = uuid.New()
+		if ownerColumn == "series_id" {
+			row.SeriesID = &ownerID
+		} else {
+			row.MediaID = &ownerID
+		}
+
+		rows[k] = row
+	}
+
+	if _, err := db.NamedExec(`
+		INSERT INTO credit(id, person_id, media_id, series_id, role, character, job, department, credit_order)
+		VALUES(:id, :person_id, :media_id, :series_id, :role, :character, :job, :department, :credit_order)
+	`, rows); err != nil {
+		return fmt.Errorf("failed to insert credits for %s: %w", ownerID, err)
+	}
+
+	return nil
+}
+
+// savePeople upserts all the people referenced by the credits provided, and returns
+// a mapping of each persons TMDB ID to their Thea ID.
+func (store *mediaCreditStore) savePeople(db database.Queryable, credits []*MediaCredit) (map[string]uuid.UUID, error) {
+	// A person may be credited multiple times for the same media (e.g. as a director and writer). Postgres
+	// will reject an upsert which affects the same row twice, so de-duplicate the people first.
+	seen := make(map[string]struct{}, len(credits))
+	people := make([]Person, 0, len(credits))
+	tmdbIDs := make([]string, 0, len(credits))
+	for _, v := range credits {
+		if _, ok := seen[v.Person.TmdbID]; ok {
+			continue
+		}
+
+		seen[v.Person.TmdbID] = struct{}{}
+		people = append(people, v.Person)
+		tmdbIDs = append(tmdbIDs, v.Person.TmdbID)
+	}
+
+	if _, err := db.NamedExec(`
+		INSERT INTO person(id, tmdb_id, name, known_for_department, created_at, updated_at)
+		VALUES(:id, :tmdb_id, :name, :known_for_department, current_timestamp, current_timestamp)
+		ON CONFLICT(tmdb_id) DO UPDATE
+			SET (name, known_for_department, updated_at) = (EXCLUDED.name, EXCLUDED.known_for_department, current_timestamp)
+	`, people); err != nil {
+		return nil, fmt.Errorf("failed to upsert people: %w", err)
+	}
+
+	var saved []struct {
+		ID     uuid.UUID `db:"id"`
+		TmdbID string    `db:"tmdb_id"`
+	}
+	if err := db.Select(&saved, `SELECT id, tmdb_id FROM person WHERE tmdb_id = ANY($1)`, pq.Array(tmdbIDs)); err != nil {
+		return nil, fmt.Errorf("failed to select saved people: %w", err)
+	}
+
+	output := make(map[string]uuid.UUID, len(saved))
+	for _, v := range saved {
+		output[v.TmdbID] = v.ID
+	}
+
+	return output, nil
+}
@@ -0,0 +1,205 @@
+package media
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+type (
+	// MediaFile is a source file for a movie or episode. Media may have many
+	// files, allowing multiple versions of the same media (such as a Director's Cut,
+	// or a 4K and 1080p copy) to be stored. A movie/episode 'has many' media files.
+	//
+	// The stream information (resolution, codec, etc) is probed from the file
+	// when it is ingested, and may be nil for files which predate the probing.
+	MediaFile struct {
+		ID         uuid.UUID `db:"id"`
+		CreatedAt  time.Time `db:"created_at"`
+		UpdatedAt  time.Time `db:"updated_at"`
+		MediaID    uuid.UUID `db:"media_id"`
+		SourcePath string    `db:"source_path"`
+
+		// Label is an optional user-provided label for this
+		// version of the media (e.g. "Director's Cut")
+		Label *string `db:"label"`
+
+		Width      *int    `db:"width"`
+		Height     *int    `db:"height"`
+		VideoCodec *string `db:"video_codec"`
+		Bitrate    *int64  `db:"bitrate"`
+		Duration   *string `db:"duration"`
+		Size       *int64  `db:"size"`
+
+		// ContentHash is a partial hash of the content of the source
+		// file, allowing the file to be identified if it's moved. See HashFile.
+		ContentHash *string `db:"content_hash"`
+	}
+
+	mediaFileStore struct{}
+)
+
+const MediaFileTable = "media_file"
+
+// NewMediaFile constructs a MediaFile for the media specified, using the stream information
+// scraped from the file.
+func NewMediaFile(mediaID uuid.UUID, metadata *FileMediaMetadata) *MediaFile {
+	file := &MediaFile{
+		ID:          uuid.New(),
+		MediaID:     mediaID,
+		SourcePath:  metadata.Path,
+		Width:       metadata.FrameW,
+		Height:      metadata.FrameH,
+		Bitrate:     metadata.Bitrate,
+		Size:        metadata.Size,
+		ContentHash: metadata.ContentHash,
+	}
+	if metadata.VideoCodec != "" {
+		file.VideoCodec = &metadata.VideoCodec
+	}
+	if metadata.Runtime != "" {
+		file.Duration = &metadata.Runtime
+	}
+
+	return file
+}
+
+// DisplayLabel returns a human readable label for this file. The user-provided
+// label is used if available, otherwise a label is derived from the resolution
+// and codec of the file (e.g. "4K HEVC"). If no stream information is available, the
+// name of the source file is used.
+func (file *MediaFile) DisplayLabel() string {
+	if file.Label != nil && *file.Label != "" {
+		return *file.Label
+	}
+
+	parts := make([]string, 0, 2)
+	if file.Height != nil && *file.Height > 0 {
+		if *file.Height >= 2160 {
+			parts = append(parts, "4K")
+		} else {
+			parts = append(parts, fmt.Sprintf("%dp", *file.Height))
+		}
+	}
+	if file.VideoCodec != nil && *file.VideoCodec != "" {
+		parts = append(parts, strings.ToUpper(*file.VideoCodec))
+	}
+
+	if len(parts) == 0 {
+		return filepath.Base(file.SourcePath)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// SaveMediaFile upserts the provided MediaFile to the database. Existing media files are
+// found using the source path. If an existing file is found, it is re-assigned to the media
+// specified by the model and it's stream information is updated.
+//
+// NOTE: the ID of the media file may be UPDATED to match existing DB entry (if any).
+func (store *mediaFileStore) SaveMediaFile(db database.Queryable, file *MediaFile) error {
+	var updatedFile MediaFile
+	if err := db.QueryRowx(`
+		INSERT INTO media_file(id, media_id, source_path, label, width, height, video_codec, bitrate, duration, size, content_hash, created_at, updated_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, current_timestamp, current_timestamp)
+		ON CONFLICT(source_path) DO UPDATE
+			SET (updated_at, media_id, label, width, height, video_codec, bitrate, duration, size, content_hash) = (
+				current_timestamp, EXCLUDED.media_id, COALESCE(EXCLUDED.label, media_file.label),
+				EXCLUDED.width, EXCLUDED.height, EXCLUDED.video_codec, EXCLUDED.bitrate, EXCLUDED.duration, EXCLUDED.size, EXCLUDED.content_hash
+			)
+		RETURNING *
+	`, file.ID, file.MediaID, file.SourcePath, file.Label, file.Width, file.Height, file.VideoCodec, file.Bitrate, file.Duration, file.Size, file.ContentHash).StructScan(&updatedFile); err != nil {
+		return fmt.Errorf("failed to save media file %s: %w", file.SourcePath, err)
+	}
+
+	*file = updatedFile
+	return nil
+}
+
+// ReplaceMediaFileSource updates the existing media file (identified by the ID of the model provided)
+// to use the source path and stream information of the model. The ID of the file (and therefore
+// any references to it) are preserved.
+func (store *mediaFileStore) ReplaceMediaFileSource(db database.Queryable, file *MediaFile) error {
+	var updatedFile MediaFile
+	if err := db.QueryRowx(`
+		UPDATE media_file
+		SET (updated_at, source_path, width, height, video_codec, bitrate, duration, size, content_hash) = (current_timestamp, $2, $3, $4, $5, $6, $7, $8, $9)
+		WHERE id=$1
+		RETURNING *
+	`, file.ID, file.SourcePath, file.Width, file.Height, file.VideoCodec, file.Bitrate, file.Duration, file.Size, file.ContentHash).StructScan(&updatedFile); err != nil {
+		return fmt.Errorf("failed to replace source of media file %s: %w", file.ID, err)
+	}
+
+	*file = updatedFile
+	return nil
+}
+
+// UpdateMediaFileSourcePath changes the source path of the media file with the ID provided, without
+// altering it's stream information. This is intended for files which have been moved (rather than replaced).
+func (store *mediaFileStore) UpdateMediaFileSourcePath(db database.Queryable, fileID uuid.UUID, path string) error {
+	if _, err := db.Exec(`UPDATE media_file SET (updated_at, source_path) = (current_timestamp, $2) WHERE id=$1`, fileID, path); err != nil {
+		return fmt.Errorf("failed to update source path of media file %s: %w", fileID, err)
+	}
+
+	return nil
+}
+
+// UpdateMediaFileContentHash sets the content hash and size of the media file with the ID
+// provided. This is intended for files which were ingested before their content was hashed.
+func (store *mediaFileStore) UpdateMediaFileContentHash(db database.Queryable, fileID uuid.UUID, hash string, size int64) error {
+	if _, err := db.Exec(`UPDATE media_file SET (updated_at, content_hash, size) = (current_timestamp, $2, $3) WHERE id=$1`, fileID, hash, size); err != nil {
+		return fmt.Errorf("failed to update content hash of media file %s: %w", fileID, err)
+	}
+
+	return nil
+}
+
+// GetMediaFileWithContentHash searches for an existing media file with the content hash provided.
+func (store *mediaFileStore) GetMediaFileWithContentHash(db database.Queryable, hash string) (*MediaFile, error) {
+	return queryRow[MediaFile](db, MediaFileTable, "content_hash", hash, "")
+}
+
+// ListMediaFiles returns all media files known to Thea.
+func (store *mediaFileStore) ListMediaFiles(db database.Queryable) ([]*MediaFile, error) {
+	var dest []*MediaFile
+	if err := db.Select(&dest, `SELECT * FROM media_file ORDER BY created_at`); err != nil {
+		return nil, fmt.Errorf("failed to select all media files: %w", err)
+	}
+
+	return dest, nil
+}
+
+// UpdateMediaFileLabel sets the label of the media file with the ID provided. A nil
+// label clears any existing label.
+func (store *mediaFileStore) UpdateMediaFileLabel(db database.Queryable, fileID uuid.UUID, label *string) (*MediaFile, error) {
+	var updatedFile MediaFile
+	if err := db.QueryRowx(`
+		UPDATE media_file SET (updated_at, label) = (current_timestamp, $2)
+		WHERE id=$1
+		RETURNING *
+	`, fileID, label).StructScan(&updatedFile); err != nil {
+		return nil, fmt.Errorf("failed to update label of media file %s: %w", fileID, err)
+	}
+
+	return &updatedFile, nil
+}
+
+// GetMediaFile searches for an existing media file with the Thea PK ID provided.
+func (store *mediaFileStore) GetMediaFile(db database.Queryable, fileID uuid.UUID) (*MediaFile, error) {
+	return queryRow[MediaFile](db, MediaFileTable, IDCol, fileID, "")
+}
+
+// GetFilesForMedia returns all the media files associated with the movie/episode
+// with the ID provided, oldest first.
+func (store *mediaFileStore) GetFilesForMedia(db database.Queryable, mediaID uuid.UUID) ([]*MediaFile, error) {
+	var dest []*MediaFile
+	if err := db.Select(&dest, `SELECT * FROM media_file WHERE media_id=$1 ORDER BY created_at`, mediaID); err != nil {
+		return nil, fmt.Errorf("failed to select media files for media %s: %w", mediaID, err)
+	}
+
+	return dest, nil
+}
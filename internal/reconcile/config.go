@@ -0,0 +1,34 @@
+package reconcile
+
+import "time"
+
+// Config contains configuration options that allow customization
+// of how Thea reconciles it's database against the file system.
+type Config struct {
+	// The ReconcileService will periodically check for missing
+	// source files, missing transcodes and orphaned transcode
+	// files. A value of zero disables this check, however
+	// reconciliation may still be requested on-demand.
+	CheckIntervalHours int `toml:"check_interval_hours" env-default:"24"`
+
+	// Additional directories which are searched when attempting to relocate
+	// a missing source file. The ingestion directory is always searched.
+	LibraryPaths []string `toml:"library_paths"`
+
+	// When enabled, a missing source file will be updated to point to the
+	// relocated file, if exactly one file with the same name, size and content
+	// hash is found in the library directories.
+	RelocateMissingSources bool `toml:"relocate_missing_sources" env-default:"true"`
+
+	// When enabled, transcodes whose output file no longer
+	// exists will be removed from the database.
+	RemoveMissingTranscodes bool `toml:"remove_missing_transcodes" env-default:"false"`
+
+	// When enabled, files in the transcode output directory which do
+	// not belong to any known transcode will be deleted.
+	RemoveOrphanedFiles bool `toml:"remove_orphaned_files" env-default:"false"`
+}
+
+func (config *Config) CheckIntervalDuration() time.Duration {
+	return time.Duration(config.CheckIntervalHours) * time.Hour
+}
@@ -0,0 +1,395 @@
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/event"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/internal/transcode"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+var log = logger.Get("ReconcileServ")
+
+type (
+	DataStore interface {
+		ListMediaFiles() ([]*media.MediaFile, error)
+		UpdateMediaFileSourcePath(fileID uuid.UUID, path string) error
+		UpdateMediaFileContentHash(fileID uuid.UUID, hash string, size int64) error
+		GetAllTranscodes() ([]*transcode.Transcode, error)
+		DeleteTranscode(transcodeID uuid.UUID) error
+	}
+
+	transcodeService interface {
+		AllTasks() []*transcode.TranscodeTask
+	}
+
+	// Report describes the differences found between Thea's database and the
+	// file system during a reconciliation, and any fixes which were applied.
+	Report struct {
+		StartedAt         time.Time
+		CompletedAt       time.Time
+		MissingSources    []*MissingSource
+		MissingTranscodes []*MissingTranscode
+		OrphanedFiles     []*OrphanedFile
+	}
+
+	// MissingSource is a media file whose source no longer exists. Candidates contains
+	// the paths of any files in the library directories which may be the source file
+	// after it was moved. If the source was relocated, RelocatedTo will be set.
+	MissingSource struct {
+		MediaFileID uuid.UUID
+		MediaID     uuid.UUID
+		Path        string
+		Candidates  []string
+		RelocatedTo *string
+	}
+
+	// MissingTranscode is a completed transcode whose output file no longer exists.
+	MissingTranscode struct {
+		TranscodeID uuid.UUID
+		MediaID     uuid.UUID
+		Path        string
+		Removed     bool
+	}
+
+	// OrphanedFile is a file in the transcode output directory which does
+	// not belong to any completed (or in-progress) transcode.
+	OrphanedFile struct {
+		Path    string
+		Size    int64
+		Removed bool
+	}
+
+	// reconcileService finds where Thea's database and the file system have diverged,
+	// typically due to files being moved or deleted outside of Thea. Specifically, this
+	// service finds:
+	//   - Media files whose source is missing (which it will attempt to relocate)
+	//   - Transcodes whose output file is missing
+	//   - Files in the transcode output directory which have no associated transcode
+	//
+	// Reconciliation runs periodically, and can also be requested on-demand. The
+	// fixes applied automatically are controlled by the Config.
+	reconcileService struct {
+		*sync.Mutex
+		config           Config
+		libraryPaths     []string
+		outputPath       string
+		store            DataStore
+		transcodeService transcodeService
+		eventBus         event.EventDispatcher
+		lastReport       *Report
+	}
+)
+
+func New(config Config, ingestPath string, outputPath string, store DataStore, transcodeService transcodeService, eventBus event.EventDispatcher) *reconcileService {
+	return &reconcileService{
+		Mutex:            &sync.Mutex{},
+		config:           config,
+		libraryPaths:     append([]string{ingestPath}, config.LibraryPaths...),
+		outputPath:       outputPath,
+		store:            store,
+		transcodeService: transcodeService,
+		eventBus:         eventBus,
+	}
+}
+
+// Run will periodically reconcile the database against the file system until the
+// context provided is cancelled. If the periodic reconciliation is disabled, this method
+// simply blocks until the context is cancelled.
+func (service *reconcileService) Run(ctx context.Context) error {
+	if service.config.CheckIntervalHours <= 0 {
+		log.Emit(logger.WARNING, "Scheduled reconciliation is disabled\n")
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(service.config.CheckIntervalDuration())
+	defer ticker.Stop()
+
+	log.Emit(logger.NEW, "Reconcile service started (interval=%s)\n", service.config.CheckIntervalDuration())
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := service.Reconcile(); err != nil {
+				log.Emit(logger.ERROR, "Scheduled reconciliation failed: %v\n", err)
+			}
+		case <-ctx.Done():
+			log.Emit(logger.STOP, "Reconcile service closed\n")
+			return nil
+		}
+	}
+}
+
+// LastReport returns the report produced by the most recent reconciliation, or
+// nil if no reconciliation has been performed since Thea started.
+func (service *reconcileService) LastReport() *Report {
+	service.Lock()
+	defer service.Unlock()
+
+	return service.lastReport
+}
+
+// Reconcile compares the database against the file system, applying any fixes
+// enabled by the Config, and returns a report of the problems found. Only one
+// reconciliation may run at a time; concurrent calls will wait for the ongoing reconciliation.
+func (service *reconcileService) Reconcile() (*Report, error) {
+	service.Lock()
+	defer service.Unlock()
+
+	report := &Report{StartedAt: time.Now()}
+	log.Emit(logger.INFO, "Starting reconciliation\n")
+
+	missingSources, err := service.reconcileSources()
+	if err != nil {
+		return nil, err
+	}
+
+	// In-progress tasks are snapshot before the completed transcodes are fetched, so that a
+	// task which completes in between is present in the latter (rather than in neither)
+	tasks := service.transcodeService.AllTasks()
+	transcodes, err := service.store.GetAllTranscodes()
+	if err != nil {
+		return nil, err
+	}
+
+	report.MissingSources = missingSources
+	report.MissingTranscodes = service.reconcileTranscodes(transcodes)
+	report.OrphanedFiles = service.reconcileOutputDirectory(transcodes, tasks, report.StartedAt)
+	report.CompletedAt = time.Now()
+
+	log.Emit(logger.SUCCESS, "Reconciliation complete: %d missing sources, %d missing transcodes, %d orphaned files\n",
+		len(report.MissingSources), len(report.MissingTranscodes), len(report.OrphanedFiles))
+	service.lastReport = report
+	return report, nil
+}
+
+// reconcileSources finds all media files whose source no longer exists. For each, the library
+// directories are searched for files with the same name, size and content hash. If exactly one candidate
+// is found, and relocation is enabled, the media file is updated to use the candidate.
+//
+// Media files which exist, but were ingested before their content was hashed, are hashed.
+func (service *reconcileService) reconcileSources() ([]*MissingSource, error) {
+	files, err := service.store.ListMediaFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	knownSources := make(map[string]struct{}, len(files))
+	missingFiles := make([]*media.MediaFile, 0)
+	for _, file := range files {
+		knownSources[file.SourcePath] = struct{}{}
+		if _, err := os.Stat(file.SourcePath); errors.Is(err, fs.ErrNotExist) {
+			missingFiles = append(missingFiles, file)
+		} else if err == nil && file.ContentHash == nil {
+			service.hashMediaFile(file)
+		}
+	}
+
+	missing := make([]*MissingSource, 0, len(missingFiles))
+	if len(missingFiles) == 0 {
+		return missing, nil
+	}
+
+	libraryIndex := service.indexLibrary(knownSources)
+	for _, file := range missingFiles {
+		source := &MissingSource{
+			MediaFileID: file.ID,
+			MediaID:     file.MediaID,
+			Path:        file.SourcePath,
+			Candidates:  make([]string, 0),
+		}
+
+		for _, candidate := range libraryIndex[filepath.Base(file.SourcePath)] {
+			if isRelocationCandidate(file, candidate) {
+				source.Candidates = append(source.Candidates, candidate.path)
+			}
+		}
+
+		if service.config.RelocateMissingSources && len(source.Candidates) == 1 {
+			relocatedPath := source.Candidates[0]
+			if err := service.store.UpdateMediaFileSourcePath(file.ID, relocatedPath); err != nil {
+				log.Emit(logger.ERROR, "Failed to relocate source of media file %s to '%s': %v\n", file.ID, relocatedPath, err)
+			} else {
+				log.Emit(logger.SUCCESS, "Relocated missing source '%s' of media %s to '%s'\n", file.SourcePath, file.MediaID, relocatedPath)
+				source.RelocatedTo = &relocatedPath
+				service.eventBus.Dispatch(event.UpdateMediaEvent, file.MediaID)
+			}
+		} else {
+			log.Emit(logger.WARNING, "Source '%s' of media %s is missing (%d relocation candidates found)\n", file.SourcePath, file.MediaID, len(source.Candidates))
+		}
+
+		missing = append(missing, source)
+	}
+
+	return missing, nil
+}
+
+// hashMediaFile computes and stores the content hash of the media file provided.
+func (service *reconcileService) hashMediaFile(file *media.MediaFile) {
+	hash, size, err := media.HashFile(file.SourcePath)
+	if err != nil {
+		log.Warnf("Failed to hash source '%s' of media file %s: %v\n", file.SourcePath, file.ID, err)
+		return
+	}
+
+	if err := service.store.UpdateMediaFileContentHash(file.ID, hash, size); err != nil {
+		log.Warnf("Failed to store content hash of media file %s: %v\n", file.ID, err)
+	}
+}
+
+// isRelocationCandidate returns true if the library file provided may be the missing source of the
+// media file provided. The size (and content hash) of the file must match, if they're known.
+func isRelocationCandidate(file *media.MediaFile, candidate libraryFile) bool {
+	if file.Size != nil && *file.Size != candidate.size {
+		return false
+	}
+	if file.ContentHash == nil {
+		return true
+	}
+
+	hash, _, err := media.HashFile(candidate.path)
+	if err != nil {
+		log.Warnf("Failed to hash relocation candidate '%s': %v\n", candidate.path, err)
+		return false
+	}
+
+	return hash == *file.ContentHash
+}
+
+type libraryFile struct {
+	path string
+	size int64
+}
+
+// indexLibrary walks the library directories, returning all the files found (which are not
+// already the source of a media file), grouped by their file name.
+func (service *reconcileService) indexLibrary(knownSources map[string]struct{}) map[string][]libraryFile {
+	index := make(map[string][]libraryFile)
+	for _, root := range service.libraryPaths {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Warnf("Failed to read '%s' during library scan: %v\n", path, err)
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if _, ok := knownSources[path]; ok {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+
+			name := filepath.Base(path)
+			index[name] = append(index[name], libraryFile{path: path, size: info.Size()})
+			return nil
+		})
+		if err != nil {
+			log.Warnf("Failed to scan library directory '%s': %v\n", root, err)
+		}
+	}
+
+	return index
+}
+
+// reconcileTranscodes finds all transcodes whose output file no longer exists, removing
+// them if enabled.
+func (service *reconcileService) reconcileTranscodes(transcodes []*transcode.Transcode) []*MissingTranscode {
+	missing := make([]*MissingTranscode, 0)
+	for _, t := range transcodes {
+		if _, err := os.Stat(t.MediaPath); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		log.Emit(logger.WARNING, "Output '%s' of transcode %s is missing\n", t.MediaPath, t.ID)
+		result := &MissingTranscode{TranscodeID: t.ID, MediaID: t.MediaID, Path: t.MediaPath}
+		if service.config.RemoveMissingTranscodes {
+			if err := service.store.DeleteTranscode(t.ID); err != nil {
+				log.Emit(logger.ERROR, "Failed to remove missing transcode %s: %v\n", t.ID, err)
+			} else {
+				result.Removed = true
+				service.eventBus.Dispatch(event.UpdateMediaEvent, t.MediaID)
+			}
+		}
+
+		missing = append(missing, result)
+	}
+
+	return missing
+}
+
+// reconcileOutputDirectory finds all files in the transcode output directory which do not belong
+// to a completed or in-progress transcode, deleting them if enabled. Files modified after the
+// reconciliation started are ignored, as they may belong to a transcode which started since.
+func (service *reconcileService) reconcileOutputDirectory(transcodes []*transcode.Transcode, tasks []*transcode.TranscodeTask, startedAt time.Time) []*OrphanedFile {
+	expectedPaths := make(map[string]struct{}, len(transcodes)+len(tasks))
+	for _, t := range transcodes {
+		expectedPaths[filepath.Clean(t.MediaPath)] = struct{}{}
+	}
+	for _, task := range tasks {
+		expectedPaths[filepath.Clean(task.OutputPath())] = struct{}{}
+	}
+
+	orphaned := make([]*OrphanedFile, 0)
+	err := filepath.WalkDir(service.outputPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Warnf("Failed to read '%s' during output directory scan: %v\n", path, err)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if _, ok := expectedPaths[filepath.Clean(path)]; ok {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.ModTime().After(startedAt) {
+			return nil
+		}
+
+		orphaned = append(orphaned, &OrphanedFile{Path: path, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		log.Warnf("Failed to scan transcode output directory '%s': %v\n", service.outputPath, err)
+	}
+
+	if !service.config.RemoveOrphanedFiles {
+		return orphaned
+	}
+
+	for _, file := range orphaned {
+		if err := os.Remove(file.Path); err != nil {
+			log.Warnf("Failed to remove orphaned file '%s': %v\n", file.Path, err)
+			continue
+		}
+
+		file.Removed = true
+		service.removeEmptyParents(filepath.Dir(file.Path))
+	}
+
+	return orphaned
+}
+
+// removeEmptyParents removes the directory provided, and it's parents, if
+// they are empty. The transcode output directory itself is never removed.
+func (service *reconcileService) removeEmptyParents(dir string) {
+	root := filepath.Clean(service.outputPath)
+	for dir = filepath.Clean(dir); dir != root && len(dir) > len(root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package reconcile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hbomb79/Thea/internal/transcode"
+)
+
+func TestReconcileOutputDirectory(t *testing.T) {
+	outputDir := t.TempDir()
+	startedAt := time.Now()
+
+	write := func(name string, modTime time.Time) string {
+		path := filepath.Join(outputDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+
+		return path
+	}
+
+	completed := write("media/completed.mp4", startedAt.Add(-time.Hour))
+	orphaned := write("orphaned/orphaned.mp4", startedAt.Add(-time.Hour))
+	recent := write("media/recent.mp4", startedAt.Add(time.Second))
+
+	service := New(Config{RemoveOrphanedFiles: true}, "", outputDir, nil, nil, nil)
+	result := service.reconcileOutputDirectory([]*transcode.Transcode{{MediaPath: completed}}, nil, startedAt)
+
+	if len(result) != 1 || result[0].Path != orphaned || !result[0].Removed {
+		t.Fatalf("expected only '%s' to be reported and removed as orphaned, got %v", orphaned, result)
+	}
+	if _, err := os.Stat(filepath.Dir(orphaned)); !os.IsNotExist(err) {
+		t.Errorf("expected empty parent directory of orphaned file to be removed")
+	}
+	for _, path := range []string{completed, recent} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected '%s' to be kept: %v", path, err)
+		}
+	}
+}
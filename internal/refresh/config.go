@@ -0,0 +1,26 @@
+package refresh
+
+import "time"
+
+// Config contains configuration options that allow
+// customization of how Thea refreshes the metadata of existing media.
+type Config struct {
+	// The RefreshService will periodically refresh the metadata of
+	// series which are likely to have changed (continuing series, or
+	// series which have recently aired). A value of zero disables
+	// the scheduled refresh.
+	IntervalHours int `toml:"interval_hours" env-default:"24"`
+
+	// Series which have aired an episode within this many days are
+	// included in the scheduled refresh, even if TMDB reports that
+	// the series has ended.
+	RecentlyAiredDays int `toml:"recently_aired_days" env-default:"30"`
+}
+
+func (config *Config) IntervalDuration() time.Duration {
+	return time.Duration(config.IntervalHours) * time.Hour
+}
+
+func (config *Config) RecentlyAiredDuration() time.Duration {
+	return time.Duration(config.RecentlyAiredDays) * time.Hour * 24
+}
@@ -0,0 +1,382 @@
+package refresh
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/artwork"
+	"github.com/hbomb79/Thea/internal/event"
+	"github.com/hbomb79/Thea/internal/http/tmdb"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+var log = logger.Get("RefreshServ")
+
+type (
+	searcher interface {
+		GetSeason(seriesID string, seasonNumber int) (*tmdb.Season, error)
+		GetSeries(seriesID string) (*tmdb.Series, error)
+		GetEpisode(seriesID string, seasonNumber int, episodeNumber int) (*tmdb.Episode, error)
+		GetMovie(movieID string) (*tmdb.Movie, error)
+	}
+
+	DataStore interface {
+		GetMovie(movieID uuid.UUID) (*media.Movie, error)
+		GetEpisode(episodeID uuid.UUID) (*media.Episode, error)
+		GetSeason(seasonID uuid.UUID) (*media.Season, error)
+		GetSeries(seriesID uuid.UUID) (*media.Series, error)
+		GetSeasonsForSeries(seriesID uuid.UUID) ([]*media.Season, error)
+		GetEpisodesForSeason(seasonID uuid.UUID) ([]*media.Episode, error)
+		ListSeriesForRefresh(airedSince time.Time) ([]*media.Series, error)
+		SaveMovie(movie *media.Movie) error
+		SaveEpisode(episode *media.Episode, season *media.Season, series *media.Series) error
+		RematchMovie(movie *media.Movie) error
+		RematchEpisode(episode *media.Episode, season *media.Season, series *media.Series) error
+	}
+
+	// refreshService is responsible for updating the TMDB metadata of media
+	// which has already been ingested. Refreshes can be requested manually (e.g. via the API),
+	// and the service will also periodically refresh series which are likely to have changed.
+	//
+	// Existing media can also be 're-matched' to a different TMDB entry, which updates the existing
+	// media in-place (preserving it's ID, source path and transcodes).
+	refreshService struct {
+		config       Config
+		searcher     searcher
+		artworkCache artwork.Importer
+		store        DataStore
+		eventBus     event.EventDispatcher
+	}
+
+	// seriesContext contains the refreshed series model which is shared by all of the
+	// seasons in a series, so that it (and it's artwork) need only be fetched from TMDB once.
+	seriesContext struct {
+		seriesTmdbID string
+		tmdbSeries   *tmdb.Series
+		series       *media.Series
+	}
+
+	// seasonContext contains the refreshed season and series models which are shared by
+	// all of the episodes in a season, so that they need only be fetched from TMDB once.
+	seasonContext struct {
+		*seriesContext
+		seasonNumber int
+		season       *media.Season
+	}
+)
+
+// New constructs a new refresh service. The searcher provided should bypass any
+// caching of TMDB responses, else the refreshed metadata may be stale.
+func New(config Config, searcher searcher, artworkCache artwork.Importer, store DataStore, eventBus event.EventDispatcher) *refreshService {
+	return &refreshService{
+		config:       config,
+		searcher:     searcher,
+		artworkCache: artworkCache,
+		store:        store,
+		eventBus:     eventBus,
+	}
+}
+
+// Run will periodically refresh the metadata of continuing and recently aired series until
+// the context provided is cancelled. If the scheduled refresh is disabled, this method
+// simply blocks until the context is cancelled.
+func (service *refreshService) Run(ctx context.Context) error {
+	if service.config.IntervalHours <= 0 {
+		log.Emit(logger.WARNING, "Scheduled metadata refresh is disabled\n")
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(service.config.IntervalDuration())
+	defer ticker.Stop()
+
+	log.Emit(logger.NEW, "Refresh service started (interval=%s)\n", service.config.IntervalDuration())
+	for {
+		select {
+		case <-ticker.C:
+			service.refreshOutdatedSeries()
+		case <-ctx.Done():
+			log.Emit(logger.STOP, "Refresh service closed\n")
+			return nil
+		}
+	}
+}
+
+// RefreshMovie re-fetches the TMDB metadata for the movie with the ID provided.
+func (service *refreshService) RefreshMovie(movieID uuid.UUID) error {
+	movie, err := service.store.GetMovie(movieID)
+	if err != nil {
+		return err
+	}
+
+	return service.updateMovie(movie, movie.TmdbID, false)
+}
+
+// RematchMovie changes the TMDB entry that the movie with the ID provided is
+// associated with, and refreshes the movie's metadata using the new TMDB entry.
+func (service *refreshService) RematchMovie(movieID uuid.UUID, tmdbID string) error {
+	movie, err := service.store.GetMovie(movieID)
+	if err != nil {
+		return err
+	}
+
+	return service.updateMovie(movie, tmdbID, true)
+}
+
+// RefreshSeries re-fetches the TMDB metadata for the series with the ID
+// provided, as well as ALL of it's seasons and episodes.
+func (service *refreshService) RefreshSeries(seriesID uuid.UUID) error {
+	series, err := service.store.GetSeries(seriesID)
+	if err != nil {
+		return err
+	}
+
+	seasons, err := service.store.GetSeasonsForSeries(seriesID)
+	if err != nil {
+		return err
+	} else if len(seasons) == 0 {
+		return nil
+	}
+
+	seriesCtx, err := service.fetchSeriesContext(series.TmdbID)
+	if err != nil {
+		return err
+	}
+
+	for _, season := range seasons {
+		if err := service.refreshSeason(seriesCtx, season); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RefreshSeason re-fetches the TMDB metadata for the season with the ID provided,
+// as well as ALL of it's episodes. The series the season belongs to will also
+// be refreshed.
+func (service *refreshService) RefreshSeason(seasonID uuid.UUID) error {
+	season, err := service.store.GetSeason(seasonID)
+	if err != nil {
+		return err
+	}
+
+	series, err := service.store.GetSeries(season.SeriesID)
+	if err != nil {
+		return err
+	}
+
+	seriesCtx, err := service.fetchSeriesContext(series.TmdbID)
+	if err != nil {
+		return err
+	}
+
+	return service.refreshSeason(seriesCtx, season)
+}
+
+// RefreshEpisode re-fetches the TMDB metadata for the episode with the ID provided. The
+// season and series the episode belongs to will also be refreshed.
+func (service *refreshService) RefreshEpisode(episodeID uuid.UUID) error {
+	episode, err := service.store.GetEpisode(episodeID)
+	if err != nil {
+		return err
+	}
+
+	season, err := service.store.GetSeason(episode.SeasonID)
+	if err != nil {
+		return err
+	}
+
+	series, err := service.store.GetSeries(season.SeriesID)
+	if err != nil {
+		return err
+	}
+
+	seriesCtx, err := service.fetchSeriesContext(series.TmdbID)
+	if err != nil {
+		return err
+	}
+
+	seasonCtx, err := service.fetchSeasonContext(seriesCtx, season.SeasonNumber)
+	if err != nil {
+		return err
+	}
+
+	return service.updateEpisode(episode, seasonCtx, episode.EpisodeNumber, false)
+}
+
+// RematchEpisode changes the TMDB entry that the episode with the ID provided is associated
+// with. As TMDB identifies episodes by their series, season number and episode number, all
+// three are required. If the episode is moved to a different season/series, then the
+// season/series is created as required.
+func (service *refreshService) RematchEpisode(episodeID uuid.UUID, seriesTmdbID string, seasonNumber int, episodeNumber int) error {
+	episode, err := service.store.GetEpisode(episodeID)
+	if err != nil {
+		return err
+	}
+
+	seriesCtx, err := service.fetchSeriesContext(seriesTmdbID)
+	if err != nil {
+		return err
+	}
+
+	seasonCtx, err := service.fetchSeasonContext(seriesCtx, seasonNumber)
+	if err != nil {
+		return err
+	}
+
+	return service.updateEpisode(episode, seasonCtx, episodeNumber, true)
+}
+
+// refreshOutdatedSeries refreshes all series which are continuing, or which
+// have recently aired. Failure to refresh a series is logged, but does not prevent
+// the remaining series from being refreshed.
+func (service *refreshService) refreshOutdatedSeries() {
+	airedSince := time.Now().Add(-service.config.RecentlyAiredDuration())
+	series, err := service.store.ListSeriesForRefresh(airedSince)
+	if err != nil {
+		log.Errorf("Failed to find series for scheduled refresh: %v\n", err)
+		return
+	}
+
+	log.Emit(logger.INFO, "Performing scheduled metadata refresh of %d series\n", len(series))
+	for _, s := range series {
+		if err := service.RefreshSeries(s.ID); err != nil {
+			log.Warnf("Scheduled refresh of series %s (%s) failed: %v\n", s.ID, s.Title, err)
+		}
+	}
+}
+
+func (service *refreshService) refreshSeason(seriesCtx *seriesContext, season *media.Season) error {
+	episodes, err := service.store.GetEpisodesForSeason(season.ID)
+	if err != nil {
+		return err
+	}
+
+	seasonCtx, err := service.fetchSeasonContext(seriesCtx, season.SeasonNumber)
+	if err != nil {
+		return err
+	}
+
+	for _, episode := range episodes {
+		if err := service.updateEpisode(episode, seasonCtx, episode.EpisodeNumber, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateMovie fetches the TMDB movie with the ID provided, and uses it to update the existing movie. If
+// rematch is true, the existing movie is re-linked to the TMDB ID provided.
+func (service *refreshService) updateMovie(existing *media.Movie, tmdbID string, rematch bool) error {
+	movie, err := service.searcher.GetMovie(tmdbID)
+	if err != nil {
+		return err
+	}
+
+	mov := tmdb.TmdbMovieToMedia(movie, watchableToMetadata(&existing.Watchable))
+	mov.ID = existing.ID
+	mov.PosterImage = artwork.Import(service.artworkCache, tmdb.ImageURL(movie.PosterPath))
+	mov.BackdropImage = artwork.Import(service.artworkCache, tmdb.ImageURL(movie.BackdropPath))
+	if mov.Collection != nil {
+		mov.Collection.PosterImage = artwork.Import(service.artworkCache, tmdb.ImageURL(movie.Collection.PosterPath))
+		mov.Collection.BackdropImage = artwork.Import(service.artworkCache, tmdb.ImageURL(movie.Collection.BackdropPath))
+	}
+
+	if rematch {
+		err = service.store.RematchMovie(mov)
+	} else {
+		err = service.store.SaveMovie(mov)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save refreshed movie %s: %w", existing.ID, err)
+	}
+
+	log.Emit(logger.SUCCESS, "Refreshed metadata for movie %s (tmdb_id=%s)\n", mov.ID, mov.TmdbID)
+	service.eventBus.Dispatch(event.UpdateMediaEvent, mov.ID)
+	return nil
+}
+
+// fetchSeriesContext fetches the TMDB series provided, and converts it
+// to a media model (including it's artwork).
+func (service *refreshService) fetchSeriesContext(seriesTmdbID string) (*seriesContext, error) {
+	series, err := service.searcher.GetSeries(seriesTmdbID)
+	if err != nil {
+		return nil, err
+	}
+
+	ser := tmdb.TmdbSeriesToMedia(series)
+	ser.PosterImage = artwork.Import(service.artworkCache, tmdb.ImageURL(series.PosterPath))
+	ser.BackdropImage = artwork.Import(service.artworkCache, tmdb.ImageURL(series.BackdropPath))
+
+	return &seriesContext{
+		seriesTmdbID: seriesTmdbID,
+		tmdbSeries:   series,
+		series:       ser,
+	}, nil
+}
+
+// fetchSeasonContext fetches the TMDB season provided (of the series described by
+// the series context), and converts it to a media model (including it's artwork).
+func (service *refreshService) fetchSeasonContext(seriesCtx *seriesContext, seasonNumber int) (*seasonContext, error) {
+	season, err := service.searcher.GetSeason(seriesCtx.seriesTmdbID, seasonNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	seas := tmdb.TmdbSeasonToMedia(season)
+	seas.PosterImage = artwork.Import(service.artworkCache, tmdb.ImageURL(season.PosterPath))
+
+	return &seasonContext{
+		seriesContext: seriesCtx,
+		seasonNumber:  seasonNumber,
+		season:        seas,
+	}, nil
+}
+
+// updateEpisode fetches the TMDB episode with the episode number provided (from the season described
+// by the season context), and uses it to update the existing episode. If rematch is true, the existing
+// episode is re-linked to the new TMDB episode.
+func (service *refreshService) updateEpisode(existing *media.Episode, seasonCtx *seasonContext, episodeNumber int, rematch bool) error {
+	episode, err := service.searcher.GetEpisode(seasonCtx.seriesTmdbID, seasonCtx.seasonNumber, episodeNumber)
+	if err != nil {
+		return err
+	}
+
+	metadata := watchableToMetadata(&existing.Watchable)
+	metadata.Episodic = true
+	metadata.SeasonNumber = seasonCtx.seasonNumber
+	metadata.EpisodeNumber = episodeNumber
+
+	ep := tmdb.TmdbEpisodeToMedia(episode, seasonCtx.tmdbSeries, metadata)
+	ep.ID = existing.ID
+	ep.BackdropImage = artwork.Import(service.artworkCache, tmdb.ImageURL(episode.StillPath))
+
+	if rematch {
+		err = service.store.RematchEpisode(ep, seasonCtx.season, seasonCtx.series)
+	} else {
+		err = service.store.SaveEpisode(ep, seasonCtx.season, seasonCtx.series)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save refreshed episode %s: %w", existing.ID, err)
+	}
+
+	log.Emit(logger.SUCCESS, "Refreshed metadata for episode %s (tmdb_id=%s)\n", ep.ID, ep.TmdbID)
+	service.eventBus.Dispatch(event.UpdateMediaEvent, ep.ID)
+	return nil
+}
+
+// watchableToMetadata constructs file metadata using the information stored
+// about some existing media, so that the resolution of the media is preserved
+// when converting the refreshed TMDB information to a media model.
+func watchableToMetadata(watchable *media.Watchable) *media.FileMediaMetadata {
+	width, height := watchable.Width, watchable.Height
+	return &media.FileMediaMetadata{
+		FrameW: &width,
+		FrameH: &height,
+	}
+}
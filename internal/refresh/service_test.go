@@ -0,0 +1,102 @@
+package refresh
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/event"
+	"github.com/hbomb79/Thea/internal/http/tmdb"
+	"github.com/hbomb79/Thea/internal/media"
+)
+
+// fakeSearcher returns placeholder TMDB entries, counting the
+// number of times each series is fetched.
+type fakeSearcher struct {
+	searcher
+	seriesFetches map[string]int
+}
+
+func (searcher *fakeSearcher) GetSeries(seriesID string) (*tmdb.Series, error) {
+	searcher.seriesFetches[seriesID]++
+	return &tmdb.Series{ID: json.Number(seriesID), Name: "Series", PosterPath: "/series.jpg"}, nil
+}
+
+func (searcher *fakeSearcher) GetSeason(seriesID string, seasonNumber int) (*tmdb.Season, error) {
+	return &tmdb.Season{ID: json.Number(fmt.Sprintf("%s%d", seriesID, seasonNumber)), SeasonNumber: seasonNumber}, nil
+}
+
+func (searcher *fakeSearcher) GetEpisode(seriesID string, seasonNumber int, episodeNumber int) (*tmdb.Episode, error) {
+	return &tmdb.Episode{ID: json.Number(fmt.Sprintf("%s%d%d", seriesID, seasonNumber, episodeNumber))}, nil
+}
+
+// fakeStore contains a single series, whose seasons each contain a single episode.
+type fakeStore struct {
+	DataStore
+	series   *media.Series
+	seasons  []*media.Season
+	episodes map[uuid.UUID][]*media.Episode
+	saved    []*media.Episode
+}
+
+func newFakeStore(seasonCount int) *fakeStore {
+	series := &media.Series{Model: media.Model{ID: uuid.New(), TmdbID: "100"}}
+	store := &fakeStore{series: series, episodes: make(map[uuid.UUID][]*media.Episode)}
+	for i := 1; i <= seasonCount; i++ {
+		season := &media.Season{Model: media.Model{ID: uuid.New()}, SeasonNumber: i, SeriesID: series.ID}
+		store.seasons = append(store.seasons, season)
+		store.episodes[season.ID] = []*media.Episode{{Model: media.Model{ID: uuid.New()}, EpisodeNumber: 1, SeasonID: season.ID}}
+	}
+
+	return store
+}
+
+func (store *fakeStore) GetSeries(_ uuid.UUID) (*media.Series, error) { return store.series, nil }
+func (store *fakeStore) GetSeasonsForSeries(_ uuid.UUID) ([]*media.Season, error) {
+	return store.seasons, nil
+}
+
+func (store *fakeStore) GetEpisodesForSeason(seasonID uuid.UUID) ([]*media.Episode, error) {
+	return store.episodes[seasonID], nil
+}
+
+func (store *fakeStore) SaveEpisode(episode *media.Episode, _ *media.Season, _ *media.Series) error {
+	store.saved = append(store.saved, episode)
+	return nil
+}
+
+// fakeImporter counts the number of artwork imports for each URL.
+type fakeImporter struct{ imports map[string]int }
+
+func (importer *fakeImporter) ImportFromURL(url string) (string, error) {
+	importer.imports[url]++
+	return "image", nil
+}
+
+func (importer *fakeImporter) ImportFromFile(_ string) (string, error) { return "image", nil }
+
+type fakeEventBus struct{}
+
+func (fakeEventBus) Dispatch(_ event.Event, _ event.Payload) {}
+
+func TestRefreshSeries_FetchesSeriesOnce(t *testing.T) {
+	store := newFakeStore(3)
+	searcher := &fakeSearcher{seriesFetches: make(map[string]int)}
+	importer := &fakeImporter{imports: make(map[string]int)}
+	service := New(Config{}, searcher, importer, store, fakeEventBus{})
+
+	if err := service.RefreshSeries(store.series.ID); err != nil {
+		t.Fatalf("failed to refresh series: %v", err)
+	}
+
+	if len(store.saved) != 3 {
+		t.Errorf("expected all 3 episodes to be refreshed, got %d", len(store.saved))
+	}
+	if n := searcher.seriesFetches["100"]; n != 1 {
+		t.Errorf("expected series to be fetched from TMDB once, got %d", n)
+	}
+	if n := importer.imports[tmdb.ImageURL("/series.jpg")]; n != 1 {
+		t.Errorf("expected series artwork to be imported once, got %d", n)
+	}
+}
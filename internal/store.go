@@ -1,16 +1,24 @@
 package internal
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/audit"
 	"github.com/hbomb79/Thea/internal/database"
+	"github.com/hbomb79/Thea/internal/download"
 	"github.com/hbomb79/Thea/internal/event"
 	"github.com/hbomb79/Thea/internal/ffmpeg"
+	"github.com/hbomb79/Thea/internal/ingest"
 	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/internal/token"
 	"github.com/hbomb79/Thea/internal/transcode"
+	"github.com/hbomb79/Thea/internal/upload"
 	"github.com/hbomb79/Thea/internal/user"
 	"github.com/hbomb79/Thea/internal/workflow"
 	"github.com/hbomb79/Thea/internal/workflow/match"
@@ -44,10 +52,15 @@ type (
 		workflowStore  *workflow.Store
 		targetStore    *ffmpeg.Store
 		userStore      *user.Store
+		uploadStore    *upload.Store
+		downloadStore  *download.Store
+		ingestStore    *ingest.Store
+		tokenStore     *token.Store
+		auditStore     *audit.Store
 	}
 )
 
-func newStoreOrchestrator(db database.Manager, eventBus event.EventDispatcher) (*storeOrchestrator, error) {
+func newStoreOrchestrator(db database.Manager, eventBus event.EventDispatcher, hashConfig user.HashConfig) (*storeOrchestrator, error) {
 	if db.GetSqlxDB() == nil {
 		return nil, ErrDatabaseNotConnected
 	}
@@ -59,7 +72,12 @@ func newStoreOrchestrator(db database.Manager, eventBus event.EventDispatcher) (
 		transcodeStore: &transcode.Store{},
 		workflowStore:  &workflow.Store{},
 		targetStore:    &ffmpeg.Store{},
-		userStore:      user.NewStore(),
+		userStore:      user.NewStore(hashConfig),
+		uploadStore:    &upload.Store{},
+		downloadStore:  &download.Store{},
+		ingestStore:    &ingest.Store{},
+		tokenStore:     &token.Store{},
+		auditStore:     &audit.Store{},
 	}, nil
 }
 
@@ -91,6 +109,10 @@ func (orchestrator *storeOrchestrator) GetMovie(movieID uuid.UUID) (*media.Movie
 	return movie, nil
 }
 
+func (orchestrator *storeOrchestrator) GetMovieWithTmdbID(tmdbID string) (*media.Movie, error) {
+	return orchestrator.mediaStore.GetMovieWithTmdbID(orchestrator.db.GetSqlxDB(), tmdbID)
+}
+
 func (orchestrator *storeOrchestrator) GetEpisode(episodeID uuid.UUID) (*media.Episode, error) {
 	return orchestrator.mediaStore.GetEpisode(orchestrator.db.GetSqlxDB(), episodeID)
 }
@@ -119,23 +141,92 @@ func (orchestrator *storeOrchestrator) GetAllMediaSourcePaths() ([]string, error
 	return orchestrator.mediaStore.GetAllSourcePaths(orchestrator.db.GetSqlxDB())
 }
 
-// SaveMovie transactionally saves the given Movie model and it's genre
-// information to the database.
+func (orchestrator *storeOrchestrator) SaveMediaFile(file *media.MediaFile) error {
+	return orchestrator.mediaStore.SaveMediaFile(orchestrator.db.GetSqlxDB(), file)
+}
+
+func (orchestrator *storeOrchestrator) ReplaceMediaFileSource(file *media.MediaFile) error {
+	return orchestrator.mediaStore.ReplaceMediaFileSource(orchestrator.db.GetSqlxDB(), file)
+}
+
+func (orchestrator *storeOrchestrator) UpdateMediaFileSourcePath(fileID uuid.UUID, path string) error {
+	return orchestrator.mediaStore.UpdateMediaFileSourcePath(orchestrator.db.GetSqlxDB(), fileID, path)
+}
+
+func (orchestrator *storeOrchestrator) UpdateMediaFileContentHash(fileID uuid.UUID, hash string, size int64) error {
+	return orchestrator.mediaStore.UpdateMediaFileContentHash(orchestrator.db.GetSqlxDB(), fileID, hash, size)
+}
+
+func (orchestrator *storeOrchestrator) GetMediaFileWithContentHash(hash string) (*media.MediaFile, error) {
+	return orchestrator.mediaStore.GetMediaFileWithContentHash(orchestrator.db.GetSqlxDB(), hash)
+}
+
+func (orchestrator *storeOrchestrator) ListMediaFiles() ([]*media.MediaFile, error) {
+	return orchestrator.mediaStore.ListMediaFiles(orchestrator.db.GetSqlxDB())
+}
+
+func (orchestrator *storeOrchestrator) UpdateMediaFileLabel(fileID uuid.UUID, label *string) (*media.MediaFile, error) {
+	return orchestrator.mediaStore.UpdateMediaFileLabel(orchestrator.db.GetSqlxDB(), fileID, label)
+}
+
+func (orchestrator *storeOrchestrator) GetMediaFile(fileID uuid.UUID) (*media.MediaFile, error) {
+	return orchestrator.mediaStore.GetMediaFile(orchestrator.db.GetSqlxDB(), fileID)
+}
+
+func (orchestrator *storeOrchestrator) GetFilesForMedia(mediaID uuid.UUID) ([]*media.MediaFile, error) {
+	return orchestrator.mediaStore.GetFilesForMedia(orchestrator.db.GetSqlxDB(), mediaID)
+}
+
+// SaveMovie transactionally saves the given Movie model and it's genre, credit
+// and collection information to the database.
 func (orchestrator *storeOrchestrator) SaveMovie(movie *media.Movie) error {
 	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
-		if err := orchestrator.mediaStore.SaveMovie(tx, movie); err != nil {
+		return orchestrator.saveMovie(tx, movie)
+	})
+}
+
+// RematchMovie transactionally changes the TMDB ID of the existing movie (identified by the
+// ID of the model provided) to the TMDB ID of the model, before saving the model. As the movie
+// row is updated in-place, it's transcodes are preserved.
+func (orchestrator *storeOrchestrator) RematchMovie(movie *media.Movie) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		log.Verbosef("Re-matching movie_id=%s to tmdb_id=%s\n", movie.ID, movie.TmdbID)
+		if err := orchestrator.mediaStore.UpdateMediaTmdbID(tx, movie.ID, movie.TmdbID); err != nil {
 			return err
 		}
 
-		log.Verbosef("Saving genres %v\n", movie.Genres)
-		genres, err := orchestrator.mediaStore.SaveGenres(tx, movie.Genres)
-		if err != nil {
+		return orchestrator.saveMovie(tx, movie)
+	})
+}
+
+func (orchestrator *storeOrchestrator) saveMovie(tx *sqlx.Tx, movie *media.Movie) error {
+	movie.CollectionID = nil
+	if movie.Collection != nil {
+		log.Verbosef("Saving collection %#v\n", movie.Collection)
+		if err := orchestrator.mediaStore.SaveCollection(tx, movie.Collection); err != nil {
 			return err
 		}
 
-		log.Verbosef("Saving genres assocations %v for movie_id=%s\n", genres, movie.ID)
-		return orchestrator.mediaStore.SaveMovieGenreAssociations(tx, movie.ID, genres)
-	})
+		movie.CollectionID = &movie.Collection.ID
+	}
+
+	if err := orchestrator.mediaStore.SaveMovie(tx, movie); err != nil {
+		return err
+	}
+
+	log.Verbosef("Saving genres %v\n", movie.Genres)
+	genres, err := orchestrator.mediaStore.SaveGenres(tx, movie.Genres)
+	if err != nil {
+		return err
+	}
+
+	log.Verbosef("Saving genres assocations %v for movie_id=%s\n", genres, movie.ID)
+	if err := orchestrator.mediaStore.SaveMovieGenreAssociations(tx, movie.ID, genres); err != nil {
+		return err
+	}
+
+	log.Verbosef("Saving %d credits for movie_id=%s\n", len(movie.Credits), movie.ID)
+	return orchestrator.mediaStore.SaveMediaCredits(tx, movie.ID, movie.Credits)
 }
 
 // SaveEpisode transactionally saves the episode provided, as well as the season and series
@@ -146,6 +237,17 @@ func (orchestrator *storeOrchestrator) SaveMovie(movie *media.Movie) error {
 // Note: If the season/series are not provided, and the FK-constraint of the episode cannot
 // be fulfilled because of this, then the save will fail. It is recommended to supply all parameters.
 func (orchestrator *storeOrchestrator) SaveEpisode(episode *media.Episode, season *media.Season, series *media.Series) error {
+	return orchestrator.saveEpisode(episode, season, series, false)
+}
+
+// RematchEpisode behaves the same as SaveEpisode, however the TMDB ID of the existing episode (identified
+// by the ID of the episode model provided) is first changed to the TMDB ID of the model. As the episode
+// row is updated in-place, it's transcodes are preserved.
+func (orchestrator *storeOrchestrator) RematchEpisode(episode *media.Episode, season *media.Season, series *media.Series) error {
+	return orchestrator.saveEpisode(episode, season, series, true)
+}
+
+func (orchestrator *storeOrchestrator) saveEpisode(episode *media.Episode, season *media.Season, series *media.Series, rematch bool) error {
 	// Store old PK/FKs so we can rollback on transaction failure
 	episodeID := episode.ID
 	seasonID := season.ID
@@ -170,15 +272,32 @@ func (orchestrator *storeOrchestrator) SaveEpisode(episode *media.Episode, seaso
 			return err
 		}
 
+		log.Verbosef("Saving %d credits for series_id=%s\n", len(series.Credits), series.ID)
+		if err := orchestrator.mediaStore.SaveSeriesCredits(tx, series.ID, series.Credits); err != nil {
+			return err
+		}
+
 		log.Verbosef("Saving season %#v with series_id=%s\n", season, series.ID)
 		season.SeriesID = series.ID
 		if err := orchestrator.mediaStore.SaveSeason(tx, season); err != nil {
 			return err
 		}
 
+		if rematch {
+			log.Verbosef("Re-matching episode_id=%s to tmdb_id=%s\n", episode.ID, episode.TmdbID)
+			if err := orchestrator.mediaStore.UpdateMediaTmdbID(tx, episode.ID, episode.TmdbID); err != nil {
+				return err
+			}
+		}
+
 		log.Verbosef("Saving episode %#v with season_id=%s\n", episode, seasonID)
 		episode.SeasonID = season.ID
-		return orchestrator.mediaStore.SaveEpisode(tx, episode)
+		if err := orchestrator.mediaStore.SaveEpisode(tx, episode); err != nil {
+			return err
+		}
+
+		log.Verbosef("Saving %d credits for episode_id=%s\n", len(episode.Credits), episode.ID)
+		return orchestrator.mediaStore.SaveMediaCredits(tx, episode.ID, episode.Credits)
 	}); err != nil {
 		log.Warnf(
 			"Episode save failed, rolling back model keys (epID=%s, epFK=%s, seasonID=%s, seasonFK=%s, seriesID=%s)",
@@ -213,11 +332,90 @@ func (orchestrator *storeOrchestrator) ListMedia(
 	includeTypes []media.MediaListType,
 	titleFilter string,
 	includeGenres []int,
+	includePeople []uuid.UUID,
+	collapseCollections bool,
 	orderBy []media.MediaListOrderBy,
+	accessFilter *media.AccessFilter,
 	offset int,
 	limit int,
 ) ([]*media.MediaListResult, error) {
-	return orchestrator.mediaStore.ListMedia(orchestrator.db.GetSqlxDB(), titleFilter, includeTypes, includeGenres, orderBy, offset, limit)
+	return orchestrator.mediaStore.ListMedia(orchestrator.db.GetSqlxDB(), titleFilter, includeTypes, includeGenres, includePeople, collapseCollections, orderBy, accessFilter, offset, limit)
+}
+
+func (orchestrator *storeOrchestrator) ListCollections(accessFilter *media.AccessFilter) ([]*media.CollectionStub, error) {
+	return orchestrator.mediaStore.ListCollections(orchestrator.db.GetSqlxDB(), accessFilter)
+}
+
+// IsMediaAccessible returns true if the movie/episode with the ID
+// provided is accessible according to the access filter provided.
+func (orchestrator *storeOrchestrator) IsMediaAccessible(mediaID uuid.UUID, accessFilter *media.AccessFilter) (bool, error) {
+	accessible, err := orchestrator.mediaStore.FilterAccessibleMedia(orchestrator.db.GetSqlxDB(), accessFilter, []uuid.UUID{mediaID})
+	return len(accessible) > 0, err
+}
+
+// IsSeriesAccessible returns true if the series with the ID provided has
+// any episodes which are accessible according to the access filter provided.
+func (orchestrator *storeOrchestrator) IsSeriesAccessible(seriesID uuid.UUID, accessFilter *media.AccessFilter) (bool, error) {
+	accessible, err := orchestrator.mediaStore.FilterAccessibleSeries(orchestrator.db.GetSqlxDB(), accessFilter, []uuid.UUID{seriesID})
+	return len(accessible) > 0, err
+}
+
+func (orchestrator *storeOrchestrator) FilterAccessibleMedia(mediaIDs []uuid.UUID, accessFilter *media.AccessFilter) ([]uuid.UUID, error) {
+	return orchestrator.mediaStore.FilterAccessibleMedia(orchestrator.db.GetSqlxDB(), accessFilter, mediaIDs)
+}
+
+func (orchestrator *storeOrchestrator) FilterAccessibleSeries(seriesIDs []uuid.UUID, accessFilter *media.AccessFilter) ([]uuid.UUID, error) {
+	return orchestrator.mediaStore.FilterAccessibleSeries(orchestrator.db.GetSqlxDB(), accessFilter, seriesIDs)
+}
+
+// GetInflatedCollection returns the collection with the ID provided, along with all of the
+// movies which belong to it. If an access filter is provided, inaccessible movies are omitted, and
+// sql.ErrNoRows is returned if none of the movies in the collection are accessible.
+func (orchestrator *storeOrchestrator) GetInflatedCollection(collectionID uuid.UUID, accessFilter *media.AccessFilter) (*media.InflatedCollection, error) {
+	var inflated *media.InflatedCollection
+	if err := orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		collection, err := orchestrator.mediaStore.GetCollection(tx, collectionID)
+		if err != nil {
+			return err
+		}
+
+		movies, err := orchestrator.mediaStore.GetMoviesInCollection(tx, collectionID)
+		if err != nil {
+			return err
+		}
+
+		if accessFilter != nil {
+			movies, err = filterAccessible(tx, orchestrator.mediaStore, accessFilter, movies, func(m *media.Movie) uuid.UUID { return m.ID })
+			if err != nil {
+				return err
+			} else if len(movies) == 0 {
+				return sql.ErrNoRows
+			}
+		}
+
+		inflated = &media.InflatedCollection{Collection: collection, Movies: movies}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to fetch inflated collection: %w", err)
+	}
+
+	return inflated, nil
+}
+
+func (orchestrator *storeOrchestrator) GetCreditsForMedia(mediaID uuid.UUID) ([]*media.MediaCredit, error) {
+	return orchestrator.mediaStore.GetCreditsForMedia(orchestrator.db.GetSqlxDB(), mediaID)
+}
+
+func (orchestrator *storeOrchestrator) GetCreditsForSeries(seriesID uuid.UUID) ([]*media.MediaCredit, error) {
+	return orchestrator.mediaStore.GetCreditsForSeries(orchestrator.db.GetSqlxDB(), seriesID)
+}
+
+func (orchestrator *storeOrchestrator) GetPerson(personID uuid.UUID) (*media.Person, error) {
+	return orchestrator.mediaStore.GetPerson(orchestrator.db.GetSqlxDB(), personID)
+}
+
+func (orchestrator *storeOrchestrator) GetCreditsForPerson(personID uuid.UUID) ([]*media.PersonCredit, error) {
+	return orchestrator.mediaStore.GetCreditsForPerson(orchestrator.db.GetSqlxDB(), personID)
 }
 
 func (orchestrator *storeOrchestrator) CountSeasonsInSeries(seriesIDs []uuid.UUID) (map[uuid.UUID]int, error) {
@@ -237,6 +435,14 @@ func (orchestrator *storeOrchestrator) GetEpisodesForSeries(seriesID uuid.UUID)
 	return []*media.Episode{}, nil
 }
 
+func (orchestrator *storeOrchestrator) GetSeasonsForSeries(seriesID uuid.UUID) ([]*media.Season, error) {
+	return orchestrator.mediaStore.GetSeasonsForSeries(orchestrator.db.GetSqlxDB(), seriesID)
+}
+
+func (orchestrator *storeOrchestrator) ListSeriesForRefresh(airedSince time.Time) ([]*media.Series, error) {
+	return orchestrator.mediaStore.ListSeriesForRefresh(orchestrator.db.GetSqlxDB(), airedSince)
+}
+
 func (orchestrator *storeOrchestrator) GetEpisodesForSeason(seasonID uuid.UUID) ([]*media.Episode, error) {
 	episodes, err := orchestrator.mediaStore.GetEpisodesForSeasons(orchestrator.db.GetSqlxDB(), []uuid.UUID{seasonID})
 	if err != nil {
@@ -250,7 +456,10 @@ func (orchestrator *storeOrchestrator) GetEpisodesForSeason(seasonID uuid.UUID)
 	return []*media.Episode{}, nil
 }
 
-func (orchestrator *storeOrchestrator) GetInflatedSeries(seriesID uuid.UUID) (*media.InflatedSeries, error) {
+// GetInflatedSeries returns the series with the ID provided, along with all of it's seasons and episodes. If
+// an access filter is provided, inaccessible episodes (and seasons without any accessible episodes) are
+// omitted, and sql.ErrNoRows is returned if none of the episodes in the series are accessible.
+func (orchestrator *storeOrchestrator) GetInflatedSeries(seriesID uuid.UUID, accessFilter *media.AccessFilter) (*media.InflatedSeries, error) {
 	wrap := func(err error) error {
 		return fmt.Errorf("failed to fetch inflated series: %w", err)
 	}
@@ -287,10 +496,23 @@ func (orchestrator *storeOrchestrator) GetInflatedSeries(seriesID uuid.UUID) (*m
 		}
 
 		// Package the results in to the InflatedSeries
-		inflatedSeasons := make([]*media.InflatedSeason, len(seasons))
-		for k, v := range seasons {
+		inflatedSeasons := make([]*media.InflatedSeason, 0, len(seasons))
+		for _, v := range seasons {
 			eps := episodes[v.ID]
-			inflatedSeasons[k] = &media.InflatedSeason{Season: v, Episodes: eps}
+			if accessFilter != nil {
+				eps, err = filterAccessible(tx, orchestrator.mediaStore, accessFilter, eps, func(e *media.Episode) uuid.UUID { return e.ID })
+				if err != nil {
+					return err
+				} else if len(eps) == 0 {
+					continue
+				}
+			}
+
+			inflatedSeasons = append(inflatedSeasons, &media.InflatedSeason{Season: v, Episodes: eps})
+		}
+
+		if accessFilter != nil && len(inflatedSeasons) == 0 {
+			return sql.ErrNoRows
 		}
 
 		inflated = &media.InflatedSeries{
@@ -305,6 +527,22 @@ func (orchestrator *storeOrchestrator) GetInflatedSeries(seriesID uuid.UUID) (*m
 	return inflated, nil
 }
 
+// filterAccessible returns the items provided which are accessible according to the
+// access filter provided, preserving their order. Each item must be a movie or episode.
+func filterAccessible[T any](db database.Queryable, store *media.Store, accessFilter *media.AccessFilter, items []T, idFn func(T) uuid.UUID) ([]T, error) {
+	ids := make([]uuid.UUID, len(items))
+	for k, v := range items {
+		ids[k] = idFn(v)
+	}
+
+	accessible, err := store.FilterAccessibleMedia(db, accessFilter, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(items, func(item T) bool { return !slices.Contains(accessible, idFn(item)) }), nil
+}
+
 // Transactionally lists all series in the DB, and then submits a second query to fetch the number of seasons
 // associated with the series we found. This information is then packaged inside the SeriesStub struct.
 func (orchestrator *storeOrchestrator) ListSeriesStubs() ([]*media.SeriesStub, error) {
@@ -544,17 +782,53 @@ func (orchestrator *storeOrchestrator) DeleteTranscodesForMedias(mediaIDs []uuid
 		return err
 	}
 
+	removeTranscodeFiles(paths)
+	return nil
+}
+
+// DeleteTranscodesForMediaFile deletes all transcodes of the media file
+// with the ID provided, cleaning up the transcoded files from the file system.
+func (orchestrator *storeOrchestrator) DeleteTranscodesForMediaFile(fileID uuid.UUID) error {
+	paths, err := orchestrator.transcodeStore.DeleteForMediaFile(orchestrator.db.GetSqlxDB(), fileID)
+	if err != nil {
+		return err
+	}
+
+	removeTranscodeFiles(paths)
+	return nil
+}
+
+func (orchestrator *storeOrchestrator) GetForMediaFileAndTarget(fileID uuid.UUID, targetID uuid.UUID) (*transcode.Transcode, error) {
+	return orchestrator.transcodeStore.GetForMediaFileAndTarget(orchestrator.db.GetSqlxDB(), fileID, targetID)
+}
+
+func removeTranscodeFiles(paths []string) {
 	for _, path := range paths {
 		if err := os.Remove(path); err != nil {
 			log.Warnf("Cleanup of transcode at path '%s' failed: %v\n", path, err)
 		}
 	}
+}
 
-	return nil
+// Audit
+
+func (orchestrator *storeOrchestrator) RecordAuditEntry(entry *audit.Entry) error {
+	return orchestrator.auditStore.Record(orchestrator.db.GetSqlxDB(), entry)
 }
 
-func (orchestrator *storeOrchestrator) GetForMediaAndTarget(mediaID uuid.UUID, targetID uuid.UUID) (*transcode.Transcode, error) {
-	return orchestrator.transcodeStore.GetForMediaAndTarget(orchestrator.db.GetSqlxDB(), mediaID, targetID)
+func (orchestrator *storeOrchestrator) ListAuditEntries(filter audit.Filter) ([]*audit.Entry, error) {
+	return orchestrator.auditStore.List(orchestrator.db.GetSqlxDB(), filter)
+}
+
+func (orchestrator *storeOrchestrator) DeleteAuditEntriesBefore(before time.Time) (int64, error) {
+	var removed int64
+	err := orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		var err error
+		removed, err = orchestrator.auditStore.DeleteBefore(tx, before)
+		return err
+	})
+
+	return removed, err
 }
 
 // Targets
@@ -581,22 +855,38 @@ func (orchestrator *storeOrchestrator) DeleteTarget(id uuid.UUID) {
 
 // User Management
 
+// GetUserWithUsernameAndPassword returns the user with the username and password provided. If the
+// password of the user was hashed using outdated parameters, it is transparently rehashed.
 func (orchestrator *storeOrchestrator) GetUserWithUsernameAndPassword(username []byte, password []byte) (*user.User, error) {
-	return orchestrator.userStore.GetWithUsernameAndPassword(orchestrator.db.GetSqlxDB(), username, password)
+	db := orchestrator.db.GetSqlxDB()
+	usr, err := orchestrator.userStore.GetWithUsernameAndPassword(db, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if orchestrator.userStore.PasswordNeedsRehash(usr) {
+		if err := orchestrator.userStore.RehashPassword(db, usr.ID, password); err != nil {
+			log.Warnf("Failed to rehash password of user %s: %v\n", usr.ID, err)
+		} else {
+			log.Infof("Rehashed password of user %s using updated parameters\n", usr.ID)
+		}
+	}
+
+	return usr, nil
 }
 
 func (orchestrator *storeOrchestrator) GetUserWithID(id uuid.UUID) (*user.User, error) {
 	return orchestrator.userStore.GetWithID(orchestrator.db.GetSqlxDB(), id)
 }
 
-func (orchestrator *storeOrchestrator) CreateUser(username []byte, password []byte, permissions ...string) (*user.User, error) {
+func (orchestrator *storeOrchestrator) CreateUser(username []byte, password []byte, passwordChangeRequired bool, permissions ...string) (*user.User, error) {
 	if len(permissions) == 0 {
-		return orchestrator.userStore.Create(orchestrator.db.GetSqlxDB(), username, password)
+		return orchestrator.userStore.Create(orchestrator.db.GetSqlxDB(), username, password, passwordChangeRequired)
 	}
 
 	var outputUser *user.User
 	if err := orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
-		user, err := orchestrator.userStore.Create(tx, username, password)
+		user, err := orchestrator.userStore.Create(tx, username, password, passwordChangeRequired)
 		if err != nil {
 			return err
 		}
@@ -610,6 +900,153 @@ func (orchestrator *storeOrchestrator) CreateUser(username []byte, password []by
 	return outputUser, nil
 }
 
+// DeleteUser transactionally removes the user with the ID provided, along with
+// their permissions.
+func (orchestrator *storeOrchestrator) DeleteUser(userID uuid.UUID) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		if err := orchestrator.userStore.DropUserPermissions(tx, userID); err != nil {
+			return err
+		}
+
+		return orchestrator.userStore.Delete(tx, userID)
+	})
+}
+
+func (orchestrator *storeOrchestrator) RenameUser(userID uuid.UUID, username []byte) error {
+	return orchestrator.userStore.Rename(orchestrator.db.GetSqlxDB(), userID, username)
+}
+
+func (orchestrator *storeOrchestrator) VerifyUserPassword(userID uuid.UUID, password []byte) error {
+	return orchestrator.userStore.VerifyPassword(orchestrator.db.GetSqlxDB(), userID, password)
+}
+
+func (orchestrator *storeOrchestrator) UpdateUserPassword(userID uuid.UUID, password []byte, passwordChangeRequired bool) error {
+	return orchestrator.userStore.UpdatePassword(orchestrator.db.GetSqlxDB(), userID, password, passwordChangeRequired)
+}
+
+func (orchestrator *storeOrchestrator) GetUserWithUsername(username []byte) (*user.User, error) {
+	return orchestrator.userStore.GetWithUsername(orchestrator.db.GetSqlxDB(), username)
+}
+
+func (orchestrator *storeOrchestrator) GetUserWithIdentity(issuer string, subject string) (*user.User, error) {
+	return orchestrator.userStore.GetWithIdentity(orchestrator.db.GetSqlxDB(), issuer, subject)
+}
+
+func (orchestrator *storeOrchestrator) LinkUserIdentity(userID uuid.UUID, issuer string, subject string) error {
+	return orchestrator.userStore.LinkIdentity(orchestrator.db.GetSqlxDB(), userID, issuer, subject)
+}
+
+// CreateUserWithIdentity transactionally creates a new user, and links the
+// external identity provided to the new user.
+func (orchestrator *storeOrchestrator) CreateUserWithIdentity(username []byte, password []byte, issuer string, subject string) (*user.User, error) {
+	var outputUser *user.User
+	if err := orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		user, err := orchestrator.userStore.Create(tx, username, password, false)
+		if err != nil {
+			return err
+		}
+
+		outputUser = user
+		return orchestrator.userStore.LinkIdentity(tx, user.ID, issuer, subject)
+	}); err != nil {
+		return nil, err
+	}
+
+	return outputUser, nil
+}
+
+// RecordFailedLogin transactionally records the failed login provided, and (unless the login failed
+// because the user is already locked) increments the failed login count of the user, locking the user
+// if the maximum number of failed logins allowed by the policy has been reached.
+func (orchestrator *storeOrchestrator) RecordFailedLogin(attempt *user.FailedLogin, policy user.LoginPolicy) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		if attempt.Reason != user.FailedLoginUserLocked {
+			userID, lockedUntil, err := orchestrator.userStore.RecordFailedLogin(tx, []byte(attempt.Username), policy)
+			if err != nil {
+				return err
+			}
+
+			attempt.UserID = userID
+			if lockedUntil != nil {
+				log.Warnf("User %s has been locked until %s due to too many failed logins\n", *userID, lockedUntil.Format(time.RFC3339))
+			}
+		} else if usr, err := orchestrator.userStore.GetWithUsername(tx, []byte(attempt.Username)); err == nil {
+			attempt.UserID = &usr.ID
+		}
+
+		return orchestrator.userStore.SaveFailedLogin(tx, attempt)
+	})
+}
+
+func (orchestrator *storeOrchestrator) ListFailedLogins(userID *uuid.UUID, limit uint64) ([]*user.FailedLogin, error) {
+	return orchestrator.userStore.ListFailedLogins(orchestrator.db.GetSqlxDB(), userID, limit)
+}
+
+func (orchestrator *storeOrchestrator) UnlockUser(userID uuid.UUID) error {
+	return orchestrator.userStore.Unlock(orchestrator.db.GetSqlxDB(), userID)
+}
+
+func (orchestrator *storeOrchestrator) BeginTOTPEnrolment(userID uuid.UUID, secret []byte) error {
+	return orchestrator.userStore.SaveTOTPEnrolment(orchestrator.db.GetSqlxDB(), userID, secret)
+}
+
+// ConfirmTOTPEnrolment transactionally confirms the pending TOTP enrolment of the user, and
+// generates their recovery codes. The permissions version of the users sessions is incremented, as
+// the tokens of the user may be restricted due to them not having enrolled.
+func (orchestrator *storeOrchestrator) ConfirmTOTPEnrolment(userID uuid.UUID, code string) ([]string, error) {
+	var recoveryCodes []string
+	if err := orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		if err := orchestrator.userStore.ConfirmTOTPEnrolment(tx, userID, code); err != nil {
+			return err
+		}
+
+		codes, err := orchestrator.userStore.ReplaceRecoveryCodes(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		recoveryCodes = codes
+		return orchestrator.tokenStore.IncrementSessionPermissionsVersions(tx, []uuid.UUID{userID})
+	}); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func (orchestrator *storeOrchestrator) VerifyMFACode(userID uuid.UUID, code string) error {
+	return orchestrator.userStore.VerifyMFACode(orchestrator.db.GetSqlxDB(), userID, code)
+}
+
+func (orchestrator *storeOrchestrator) RegenerateRecoveryCodes(userID uuid.UUID) ([]string, error) {
+	var recoveryCodes []string
+	if err := orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		codes, err := orchestrator.userStore.ReplaceRecoveryCodes(tx, userID)
+		recoveryCodes = codes
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func (orchestrator *storeOrchestrator) CountUnusedRecoveryCodes(userID uuid.UUID) (int, error) {
+	return orchestrator.userStore.CountUnusedRecoveryCodes(orchestrator.db.GetSqlxDB(), userID)
+}
+
+// DeleteUserMFA transactionally removes the TOTP enrolment and recovery codes
+// of the user, incrementing the permissions version of the users sessions.
+func (orchestrator *storeOrchestrator) DeleteUserMFA(userID uuid.UUID) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		if err := orchestrator.userStore.DeleteMFA(tx, userID); err != nil {
+			return err
+		}
+
+		return orchestrator.tokenStore.IncrementSessionPermissionsVersions(tx, []uuid.UUID{userID})
+	})
+}
+
 func (orchestrator *storeOrchestrator) ListUsers() ([]*user.User, error) {
 	return orchestrator.userStore.List(orchestrator.db.GetSqlxDB())
 }
@@ -622,8 +1059,31 @@ func (orchestrator *storeOrchestrator) RecordUserRefresh(userID uuid.UUID) error
 	return orchestrator.userStore.RecordRefresh(orchestrator.db.GetSqlxDB(), userID)
 }
 
+// UpdateUserAccessRestrictions transactionally replaces the access restrictions of the
+// user, incrementing the permissions version of the users sessions (as the restrictions
+// of the user are embedded within their access tokens).
+func (orchestrator *storeOrchestrator) UpdateUserAccessRestrictions(userID uuid.UUID, restrictions user.AccessRestrictions) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		if err := orchestrator.userStore.UpdateAccessRestrictions(tx, userID, restrictions); err != nil {
+			return err
+		}
+
+		return orchestrator.tokenStore.IncrementSessionPermissionsVersions(tx, []uuid.UUID{userID})
+	})
+}
+
+func (orchestrator *storeOrchestrator) ListUserDirectPermissions(userID uuid.UUID) ([]string, error) {
+	return orchestrator.userStore.ListDirectPermissions(orchestrator.db.GetSqlxDB(), userID)
+}
+
 func (orchestrator *storeOrchestrator) UpdateUserPermissions(userID uuid.UUID, newPermissions []string) error {
-	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error { return orchestrator.updateUserPermissionsQuery(tx, userID, newPermissions) })
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		if err := orchestrator.updateUserPermissionsQuery(tx, userID, newPermissions); err != nil {
+			return err
+		}
+
+		return orchestrator.tokenStore.IncrementSessionPermissionsVersions(tx, []uuid.UUID{userID})
+	})
 }
 
 func (orchestrator *storeOrchestrator) updateUserPermissionsQuery(tx *sqlx.Tx, userID uuid.UUID, newPermissions []string) error {
@@ -636,15 +1096,11 @@ func (orchestrator *storeOrchestrator) updateUserPermissionsQuery(tx *sqlx.Tx, u
 	}
 
 	if len(newPermissions) > 0 {
-		perms, err := orchestrator.userStore.GetPermissionsByLabel(tx, newPermissions)
+		perms, err := orchestrator.getPermissionsByLabelQuery(tx, newPermissions)
 		if err != nil {
 			return err
 		}
 
-		if len(perms) != len(newPermissions) {
-			return errors.New("permissions provided are invalid")
-		}
-
 		if err := orchestrator.userStore.InsertUserPermissions(tx, userID, perms); err != nil {
 			return err
 		}
@@ -653,6 +1109,290 @@ func (orchestrator *storeOrchestrator) updateUserPermissionsQuery(tx *sqlx.Tx, u
 	return nil
 }
 
+// UpdateUserRoles transactionally replaces the roles of the user with the roles provided.
+func (orchestrator *storeOrchestrator) UpdateUserRoles(userID uuid.UUID, roleIDs []uuid.UUID) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		if err := orchestrator.userStore.DropUserRoles(tx, userID); err != nil {
+			return err
+		}
+
+		if err := orchestrator.userStore.RecordUpdate(tx, userID); err != nil {
+			return err
+		}
+
+		if len(roleIDs) > 0 {
+			if err := orchestrator.userStore.InsertUserRoles(tx, userID, roleIDs); err != nil {
+				return err
+			}
+		}
+
+		return orchestrator.tokenStore.IncrementSessionPermissionsVersions(tx, []uuid.UUID{userID})
+	})
+}
+
+func (orchestrator *storeOrchestrator) ListRoles() ([]*user.Role, error) {
+	return orchestrator.userStore.ListRoles(orchestrator.db.GetSqlxDB())
+}
+
+func (orchestrator *storeOrchestrator) GetRole(roleID uuid.UUID) (*user.Role, error) {
+	return orchestrator.userStore.GetRole(orchestrator.db.GetSqlxDB(), roleID)
+}
+
+// CreateRole transactionally creates a new role with the label and permissions provided.
+func (orchestrator *storeOrchestrator) CreateRole(label string, permissions []string) (*user.Role, error) {
+	var roleID uuid.UUID
+	if err := orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		role, err := orchestrator.userStore.CreateRole(tx, label)
+		if err != nil {
+			return err
+		}
+
+		roleID = role.ID
+		return orchestrator.updateRolePermissionsQuery(tx, role.ID, permissions)
+	}); err != nil {
+		return nil, err
+	}
+
+	return orchestrator.GetRole(roleID)
+}
+
+// UpdateRole transactionally updates an existing role using the optional parameters
+// provided. If a param is `nil` then the corresponding value of the role is NOT changed. The
+// sessions of all users with this role are required to refresh their tokens, so that the
+// permissions in their tokens reflect the new permissions of the role.
+//
+// Returns ErrRoleBuiltIn if the role is a built-in role.
+func (orchestrator *storeOrchestrator) UpdateRole(roleID uuid.UUID, newLabel *string, newPermissions *[]string) (*user.Role, error) {
+	if err := orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		role, err := orchestrator.userStore.GetRole(tx, roleID)
+		if err != nil {
+			return err
+		}
+		if role.BuiltIn {
+			return user.ErrRoleBuiltIn
+		}
+
+		if newLabel != nil {
+			if err := orchestrator.userStore.RenameRole(tx, roleID, *newLabel); err != nil {
+				return err
+			}
+		}
+
+		if newPermissions != nil {
+			if err := orchestrator.updateRolePermissionsQuery(tx, roleID, *newPermissions); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return orchestrator.GetRole(roleID)
+}
+
+// DeleteRole transactionally deletes the role provided, removing it from all users
+// (who are required to refresh their tokens).
+//
+// Returns ErrRoleBuiltIn if the role is a built-in role.
+func (orchestrator *storeOrchestrator) DeleteRole(roleID uuid.UUID) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		role, err := orchestrator.userStore.GetRole(tx, roleID)
+		if err != nil {
+			return err
+		}
+		if role.BuiltIn {
+			return user.ErrRoleBuiltIn
+		}
+
+		userIDs, err := orchestrator.userStore.ListUserIDsWithRole(tx, roleID)
+		if err != nil {
+			return err
+		}
+
+		if err := orchestrator.userStore.DeleteRole(tx, roleID); err != nil {
+			return err
+		}
+
+		return orchestrator.tokenStore.IncrementSessionPermissionsVersions(tx, userIDs)
+	})
+}
+
+// updateRolePermissionsQuery replaces the permissions of the role with those provided, and
+// increments the permissions version of the sessions of all users with the role.
+func (orchestrator *storeOrchestrator) updateRolePermissionsQuery(tx *sqlx.Tx, roleID uuid.UUID, newPermissions []string) error {
+	if err := orchestrator.userStore.DropRolePermissions(tx, roleID); err != nil {
+		return err
+	}
+
+	if err := orchestrator.userStore.RecordRoleUpdate(tx, roleID); err != nil {
+		return err
+	}
+
+	if len(newPermissions) > 0 {
+		perms, err := orchestrator.getPermissionsByLabelQuery(tx, newPermissions)
+		if err != nil {
+			return err
+		}
+
+		if err := orchestrator.userStore.InsertRolePermissions(tx, roleID, perms); err != nil {
+			return err
+		}
+	}
+
+	userIDs, err := orchestrator.userStore.ListUserIDsWithRole(tx, roleID)
+	if err != nil {
+		return err
+	}
+
+	return orchestrator.tokenStore.IncrementSessionPermissionsVersions(tx, userIDs)
+}
+
+// getPermissionsByLabelQuery returns the permissions with the labels
+// provided, returning an error if any of the permissions do not exist.
+func (orchestrator *storeOrchestrator) getPermissionsByLabelQuery(tx *sqlx.Tx, labels []string) ([]user.Permission, error) {
+	perms, err := orchestrator.userStore.GetPermissionsByLabel(tx, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(perms) != len(labels) {
+		return nil, errors.New("permissions provided are invalid")
+	}
+
+	return perms, nil
+}
+
+func (orchestrator *storeOrchestrator) SaveUpload(upload *upload.Upload) error {
+	return orchestrator.uploadStore.SaveUpload(orchestrator.db.GetSqlxDB(), upload)
+}
+
+func (orchestrator *storeOrchestrator) GetUpload(uploadID uuid.UUID, userID uuid.UUID) (*upload.Upload, error) {
+	return orchestrator.uploadStore.GetUpload(orchestrator.db.GetSqlxDB(), uploadID, userID)
+}
+
+func (orchestrator *storeOrchestrator) ListUploadsForUser(userID uuid.UUID) ([]*upload.Upload, error) {
+	return orchestrator.uploadStore.ListUploadsForUser(orchestrator.db.GetSqlxDB(), userID)
+}
+
+func (orchestrator *storeOrchestrator) ListUploadsUpdatedBefore(before time.Time) ([]*upload.Upload, error) {
+	return orchestrator.uploadStore.ListUploadsUpdatedBefore(orchestrator.db.GetSqlxDB(), before)
+}
+
+func (orchestrator *storeOrchestrator) TouchUpload(uploadID uuid.UUID) error {
+	return orchestrator.uploadStore.TouchUpload(orchestrator.db.GetSqlxDB(), uploadID)
+}
+
+func (orchestrator *storeOrchestrator) DeleteUpload(uploadID uuid.UUID) error {
+	return orchestrator.uploadStore.DeleteUpload(orchestrator.db.GetSqlxDB(), uploadID)
+}
+
+func (orchestrator *storeOrchestrator) SaveDownload(download *download.Download) error {
+	return orchestrator.downloadStore.SaveDownload(orchestrator.db.GetSqlxDB(), download)
+}
+
+func (orchestrator *storeOrchestrator) UpdateDownload(download *download.Download) error {
+	return orchestrator.downloadStore.UpdateDownload(orchestrator.db.GetSqlxDB(), download)
+}
+
+func (orchestrator *storeOrchestrator) ListDownloads() ([]*download.Download, error) {
+	return orchestrator.downloadStore.ListDownloads(orchestrator.db.GetSqlxDB())
+}
+
+func (orchestrator *storeOrchestrator) DeleteDownload(downloadID uuid.UUID) error {
+	return orchestrator.downloadStore.DeleteDownload(orchestrator.db.GetSqlxDB(), downloadID)
+}
+
+func (orchestrator *storeOrchestrator) SaveTitleRule(rule *ingest.TitleRule) error {
+	return orchestrator.ingestStore.SaveTitleRule(orchestrator.db.GetSqlxDB(), rule)
+}
+
+func (orchestrator *storeOrchestrator) GetTitleRule(title string, episodic bool) (*ingest.TitleRule, error) {
+	return orchestrator.ingestStore.GetTitleRule(orchestrator.db.GetSqlxDB(), title, episodic)
+}
+
+func (orchestrator *storeOrchestrator) ListTitleRules() ([]*ingest.TitleRule, error) {
+	return orchestrator.ingestStore.ListTitleRules(orchestrator.db.GetSqlxDB())
+}
+
+func (orchestrator *storeOrchestrator) DeleteTitleRule(ruleID uuid.UUID) error {
+	return orchestrator.ingestStore.DeleteTitleRule(orchestrator.db.GetSqlxDB(), ruleID)
+}
+
+// SaveSigningKey saves the new signing key provided, retiring any
+// existing keys for the same type of token.
+func (orchestrator *storeOrchestrator) SaveSigningKey(key *token.SigningKey) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		return orchestrator.tokenStore.SaveSigningKey(tx, key)
+	})
+}
+
+func (orchestrator *storeOrchestrator) ListSigningKeys() ([]*token.SigningKey, error) {
+	return orchestrator.tokenStore.ListSigningKeys(orchestrator.db.GetSqlxDB())
+}
+
+func (orchestrator *storeOrchestrator) DeleteSigningKeysRetiredBefore(tokenType token.Type, before time.Time) error {
+	return orchestrator.tokenStore.DeleteSigningKeysRetiredBefore(orchestrator.db.GetSqlxDB(), tokenType, before)
+}
+
+func (orchestrator *storeOrchestrator) SaveSession(session *token.Session) error {
+	return orchestrator.tokenStore.SaveSession(orchestrator.db.GetSqlxDB(), session)
+}
+
+func (orchestrator *storeOrchestrator) GetSession(sessionID uuid.UUID) (*token.Session, error) {
+	return orchestrator.tokenStore.GetSession(orchestrator.db.GetSqlxDB(), sessionID)
+}
+
+func (orchestrator *storeOrchestrator) ListActiveSessionsForUser(userID uuid.UUID) ([]*token.Session, error) {
+	return orchestrator.tokenStore.ListActiveSessionsForUser(orchestrator.db.GetSqlxDB(), userID)
+}
+
+func (orchestrator *storeOrchestrator) RotateSessionRefreshToken(sessionID uuid.UUID, existingTokenID uuid.UUID, newTokenID uuid.UUID, expiresAt time.Time, client token.Client) (bool, error) {
+	return orchestrator.tokenStore.RotateSessionRefreshToken(orchestrator.db.GetSqlxDB(), sessionID, existingTokenID, newTokenID, expiresAt, client)
+}
+
+func (orchestrator *storeOrchestrator) RevokeSession(sessionID uuid.UUID) error {
+	return orchestrator.tokenStore.RevokeSession(orchestrator.db.GetSqlxDB(), sessionID)
+}
+
+func (orchestrator *storeOrchestrator) RevokeSessionsForUser(userID uuid.UUID) error {
+	return orchestrator.tokenStore.RevokeSessionsForUser(orchestrator.db.GetSqlxDB(), userID)
+}
+
+func (orchestrator *storeOrchestrator) DeleteSessionsInactiveBefore(before time.Time) error {
+	return orchestrator.tokenStore.DeleteSessionsInactiveBefore(orchestrator.db.GetSqlxDB(), before)
+}
+
+// SaveAPIKey transactionally saves the new API key provided, along with it's permissions.
+func (orchestrator *storeOrchestrator) SaveAPIKey(key *token.APIKey) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error { return orchestrator.tokenStore.SaveAPIKey(tx, key) })
+}
+
+func (orchestrator *storeOrchestrator) GetAPIKey(keyID uuid.UUID) (*token.APIKey, error) {
+	return orchestrator.tokenStore.GetAPIKey(orchestrator.db.GetSqlxDB(), keyID)
+}
+
+func (orchestrator *storeOrchestrator) GetAPIKeyWithHash(hash []byte) (*token.APIKey, error) {
+	return orchestrator.tokenStore.GetAPIKeyWithHash(orchestrator.db.GetSqlxDB(), hash)
+}
+
+func (orchestrator *storeOrchestrator) ListAPIKeysForUser(userID uuid.UUID) ([]*token.APIKey, error) {
+	return orchestrator.tokenStore.ListAPIKeysForUser(orchestrator.db.GetSqlxDB(), userID)
+}
+
+func (orchestrator *storeOrchestrator) RevokeAPIKey(keyID uuid.UUID) error {
+	return orchestrator.tokenStore.RevokeAPIKey(orchestrator.db.GetSqlxDB(), keyID)
+}
+
+func (orchestrator *storeOrchestrator) RevokeAPIKeysForUser(userID uuid.UUID) error {
+	return orchestrator.tokenStore.RevokeAPIKeysForUser(orchestrator.db.GetSqlxDB(), userID)
+}
+
+func (orchestrator *storeOrchestrator) RecordAPIKeyUsage(keyID uuid.UUID) error {
+	return orchestrator.tokenStore.RecordAPIKeyUsage(orchestrator.db.GetSqlxDB(), keyID)
+}
+
 func (orchestrator *storeOrchestrator) anyOutstandingPermissions(permissions ...string) (bool, error) {
 	query, args, err := sqlx.In(`SELECT label FROM permissions WHERE label NOT IN(?)`, permissions)
 	if err != nil {
@@ -673,6 +1413,33 @@ func (orchestrator *storeOrchestrator) anyOutstandingPermissions(permissions ...
 	return false, nil
 }
 
+// syncBuiltInRoles creates the roles provided (as built-in roles) if they do not already
+// exist, and ensures that the permissions of each role match the permissions provided.
+func (orchestrator *storeOrchestrator) syncBuiltInRoles(roles map[string][]string) error {
+	return orchestrator.db.WrapTx(func(tx *sqlx.Tx) error {
+		for label, permissions := range roles {
+			role, err := orchestrator.userStore.SaveBuiltInRole(tx, label)
+			if err != nil {
+				return err
+			}
+
+			existing, desired := slices.Clone(role.Permissions), slices.Clone(permissions)
+			slices.Sort(existing)
+			slices.Sort(desired)
+			if slices.Equal(existing, desired) {
+				continue
+			}
+
+			log.Infof("Updating permissions of built-in role %s\n", label)
+			if err := orchestrator.updateRolePermissionsQuery(tx, role.ID, permissions); err != nil {
+				return fmt.Errorf("failed to update permissions of built-in role %s: %w", label, err)
+			}
+		}
+
+		return nil
+	})
+}
+
 func (orchestrator *storeOrchestrator) createPermissions(permissions ...string) error {
 	type p struct {
 		ID    uuid.UUID `db:"id"`
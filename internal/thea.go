@@ -4,18 +4,27 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"path/filepath"
 	"runtime/debug"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/hbomb79/Thea/internal/api"
+	"github.com/hbomb79/Thea/internal/artwork"
+	"github.com/hbomb79/Thea/internal/audit"
+	"github.com/hbomb79/Thea/internal/completeness"
 	"github.com/hbomb79/Thea/internal/database"
+	"github.com/hbomb79/Thea/internal/download"
 	"github.com/hbomb79/Thea/internal/event"
 	"github.com/hbomb79/Thea/internal/http/tmdb"
 	"github.com/hbomb79/Thea/internal/ingest"
 	"github.com/hbomb79/Thea/internal/media"
+	"github.com/hbomb79/Thea/internal/reconcile"
+	"github.com/hbomb79/Thea/internal/refresh"
 	"github.com/hbomb79/Thea/internal/transcode"
+	"github.com/hbomb79/Thea/internal/upload"
 	"github.com/hbomb79/Thea/internal/user/permissions"
 	"github.com/hbomb79/Thea/pkg/docker"
 	"github.com/hbomb79/Thea/pkg/logger"
@@ -35,19 +44,23 @@ type (
 		BroadcastWorkflowUpdate(workflowID uuid.UUID) error
 		BroadcastMediaUpdate(mediaID uuid.UUID) error
 		BroadcastIngestUpdate(ingestID uuid.UUID) error
+		BroadcastMissingEpisode(seriesID uuid.UUID) error
+		BroadcastDownloadUpdate(downloadID uuid.UUID) error
+		BroadcastDownloadProgressUpdate(downloadID uuid.UUID) error
 	}
 
 	TranscodeService interface {
 		RunnableService
-		NewTask(mediaID uuid.UUID, targetID uuid.UUID) error
+		NewTask(mediaID uuid.UUID, fileID *uuid.UUID, targetID uuid.UUID) error
 		CancelTask(taskID uuid.UUID) error
 		AllTasks() []*transcode.TranscodeTask
 		Task(taskID uuid.UUID) *transcode.TranscodeTask
 		PauseTask(taskID uuid.UUID) error
 		ResumeTask(taskID uuid.UUID) error
-		ActiveTaskForMediaAndTarget(mediaID uuid.UUID, targetID uuid.UUID) *transcode.TranscodeTask
+		ActiveTaskForMediaFileAndTarget(fileID uuid.UUID, targetID uuid.UUID) *transcode.TranscodeTask
 		ActiveTasksForMedia(mediaID uuid.UUID) []*transcode.TranscodeTask
 		CancelTasksForMedia(mediaID uuid.UUID)
+		CancelTasksForMediaFile(fileID uuid.UUID)
 	}
 
 	IngestService interface {
@@ -56,7 +69,60 @@ type (
 		GetIngest(ingestID uuid.UUID) *ingest.IngestItem
 		GetAllIngests() []*ingest.IngestItem
 		DiscoverNewFiles()
-		ResolveTroubledIngest(itemID uuid.UUID, method ingest.ResolutionType, context map[string]string) error
+		ResolveTroubledIngest(itemID uuid.UUID, method ingest.ResolutionType, context map[string]string, remember bool) error
+		ResolveTroubledIngests(filter ingest.TroubleFilter, method ingest.ResolutionType, context map[string]string, remember bool) ([]uuid.UUID, []uuid.UUID, error)
+		ListTitleRules() ([]*ingest.TitleRule, error)
+		DeleteTitleRule(ruleID uuid.UUID) error
+		IngestFile(path string, fileName string, overrideTmdbID *string) (*ingest.IngestItem, error)
+		IngestPath(path string, hints ingest.IngestHints) ([]*ingest.IngestItem, error)
+	}
+
+	RefreshService interface {
+		RunnableService
+		RefreshMovie(movieID uuid.UUID) error
+		RefreshSeries(seriesID uuid.UUID) error
+		RefreshSeason(seasonID uuid.UUID) error
+		RefreshEpisode(episodeID uuid.UUID) error
+		RematchMovie(movieID uuid.UUID, tmdbID string) error
+		RematchEpisode(episodeID uuid.UUID, seriesTmdbID string, seasonNumber int, episodeNumber int) error
+	}
+
+	CompletenessService interface {
+		RunnableService
+		GetSeriesCompleteness(seriesID uuid.UUID, includeSpecials bool) (*completeness.SeriesCompleteness, error)
+		ListSeriesCompleteness(includeSpecials bool) ([]*completeness.SeriesCompleteness, error)
+	}
+
+	ReconcileService interface {
+		RunnableService
+		Reconcile() (*reconcile.Report, error)
+		LastReport() *reconcile.Report
+	}
+
+	UploadService interface {
+		RunnableService
+		CreateUpload(userID uuid.UUID, fileName string, size int64, checksum string, tmdbID *string) (*upload.Upload, error)
+		GetUpload(uploadID uuid.UUID, userID uuid.UUID) (*upload.Upload, error)
+		ListUploads(userID uuid.UUID) ([]*upload.Upload, error)
+		WriteChunk(uploadID uuid.UUID, userID uuid.UUID, offset int64, content io.Reader) (*upload.Upload, error)
+		AbortUpload(uploadID uuid.UUID, userID uuid.UUID) error
+	}
+
+	DownloadService interface {
+		RunnableService
+		CreateDownload(url string, fileName *string, checksum *string, tmdbID *string) (*download.Download, error)
+		GetDownload(downloadID uuid.UUID) *download.Download
+		GetAllDownloads() []*download.Download
+		GetProgress(downloadID uuid.UUID) *download.Progress
+		PauseDownload(downloadID uuid.UUID) error
+		ResumeDownload(downloadID uuid.UUID) error
+		CancelDownload(downloadID uuid.UUID) error
+	}
+
+	AuditService interface {
+		RunnableService
+		Record(entry *audit.Entry) error
+		ListEntries(filter audit.Filter) ([]*audit.Entry, error)
 	}
 )
 
@@ -76,9 +142,15 @@ type theaImpl struct {
 	activityService   *activityService
 	config            TheaConfig
 
-	restGateway      RestGateway
-	ingestService    IngestService
-	transcodeService TranscodeService
+	restGateway         RestGateway
+	ingestService       IngestService
+	transcodeService    TranscodeService
+	refreshService      RefreshService
+	completenessService CompletenessService
+	reconcileService    ReconcileService
+	uploadService       UploadService
+	downloadService     DownloadService
+	auditService        AuditService
 }
 
 func New(config TheaConfig) *theaImpl {
@@ -121,7 +193,7 @@ func (thea *theaImpl) Run(parent context.Context) error {
 		return fmt.Errorf("failed to initialise connection to DB: %w", err)
 	}
 
-	store, err := newStoreOrchestrator(db, thea.eventBus)
+	store, err := newStoreOrchestrator(db, thea.eventBus, thea.config.PasswordHashing)
 	if err != nil {
 		return fmt.Errorf("failed to construct data orchestrator: %w", err)
 	}
@@ -129,16 +201,21 @@ func (thea *theaImpl) Run(parent context.Context) error {
 	if err := thea.syncDBPermissions(); err != nil {
 		return fmt.Errorf("failed to sync db permissions: %w", err)
 	}
+	if err := thea.storeOrchestrator.syncBuiltInRoles(permissions.BuiltInRoles()); err != nil {
+		return fmt.Errorf("failed to sync built-in roles: %w", err)
+	}
 	if err := thea.createInitialUserIfNonePresent(); err != nil {
 		return fmt.Errorf("failed to create initial user: %w", err)
 	}
 
-	searcher := tmdb.NewSearcher(tmdb.Config{APIKey: thea.config.OmdbKey})
+	tmdbConfig := thea.config.Tmdb
+	tmdbConfig.APIKey = thea.config.OmdbKey
+	tmdbConfig.CacheDir = filepath.Join(thea.config.GetCacheDir(), "tmdb")
+	searcher := tmdb.NewSearcher(tmdbConfig)
 	scraper := media.NewScraper(media.ScraperConfig{FfprobeBinPath: thea.config.Format.FfprobeBinaryPath})
-	if serv, err := ingest.New(thea.config.IngestService, searcher, scraper, thea.storeOrchestrator, thea.eventBus); err == nil {
-		thea.ingestService = serv
-	} else {
-		return fmt.Errorf("failed to construct ingestion service due to error: %w", err)
+	artworkCache, err := artwork.NewCache(filepath.Join(thea.config.GetCacheDir(), "images"))
+	if err != nil {
+		return fmt.Errorf("failed to construct artwork cache: %w", err)
 	}
 
 	if serv, err := transcode.New(thea.config.Format, thea.eventBus, thea.storeOrchestrator); err == nil {
@@ -147,13 +224,50 @@ func (thea *theaImpl) Run(parent context.Context) error {
 		return fmt.Errorf("failed to construct transcode service due to error: %w", err)
 	}
 
-	thea.restGateway = api.NewRestGateway(&thea.config.RestConfig, thea.ingestService, thea.transcodeService, thea.storeOrchestrator)
+	if serv, err := ingest.New(thea.config.IngestService, searcher, scraper, artworkCache, thea.transcodeService, thea.storeOrchestrator, thea.eventBus); err == nil {
+		thea.ingestService = serv
+	} else {
+		return fmt.Errorf("failed to construct ingestion service due to error: %w", err)
+	}
+
+	thea.refreshService = refresh.New(thea.config.Refresh, searcher.Uncached(), artworkCache, thea.storeOrchestrator, thea.eventBus)
+	thea.completenessService = completeness.New(thea.config.Completeness, searcher, thea.storeOrchestrator, thea.eventBus)
+	thea.reconcileService = reconcile.New(thea.config.Reconcile, thea.config.IngestService.GetIngestPath(), thea.config.Format.OutputPath, thea.storeOrchestrator, thea.transcodeService, thea.eventBus)
+
+	uploadConfig := thea.config.Upload
+	if uploadConfig.StagingPath == "" {
+		uploadConfig.StagingPath = filepath.Join(thea.config.GetCacheDir(), "uploads")
+	}
+	if serv, err := upload.New(uploadConfig, thea.storeOrchestrator, thea.ingestService); err == nil {
+		thea.uploadService = serv
+	} else {
+		return fmt.Errorf("failed to construct upload service due to error: %w", err)
+	}
+
+	downloadConfig := thea.config.Download
+	if downloadConfig.StagingPath == "" {
+		downloadConfig.StagingPath = filepath.Join(thea.config.GetCacheDir(), "downloads")
+	}
+	if serv, err := download.New(downloadConfig, thea.storeOrchestrator, thea.ingestService, thea.eventBus); err == nil {
+		thea.downloadService = serv
+	} else {
+		return fmt.Errorf("failed to construct download service due to error: %w", err)
+	}
+
+	thea.auditService = audit.New(thea.config.Audit, thea.storeOrchestrator)
+	thea.restGateway = api.NewRestGateway(&thea.config.RestConfig, thea.ingestService, thea.transcodeService, thea.refreshService, thea.completenessService, thea.reconcileService, thea.uploadService, thea.downloadService, thea.auditService, artworkCache, thea.storeOrchestrator)
 	thea.activityService = newActivityService(thea.restGateway, thea.eventBus)
 
 	wg := &sync.WaitGroup{}
-	wg.Add(4)
+	wg.Add(10)
 	go thea.spawnService(ctx, wg, thea.ingestService, "ingest-service", crashHandler)
 	go thea.spawnService(ctx, wg, thea.transcodeService, "transcode-service", crashHandler)
+	go thea.spawnService(ctx, wg, thea.refreshService, "refresh-service", crashHandler)
+	go thea.spawnService(ctx, wg, thea.completenessService, "completeness-service", crashHandler)
+	go thea.spawnService(ctx, wg, thea.reconcileService, "reconcile-service", crashHandler)
+	go thea.spawnService(ctx, wg, thea.uploadService, "upload-service", crashHandler)
+	go thea.spawnService(ctx, wg, thea.downloadService, "download-service", crashHandler)
+	go thea.spawnService(ctx, wg, thea.auditService, "audit-service", crashHandler)
 	go thea.spawnService(ctx, wg, thea.restGateway, "rest-gateway", crashHandler)
 	go thea.spawnService(ctx, wg, thea.activityService, "activity-service", crashHandler)
 	log.Emit(logger.SUCCESS, "Thea services spawned! [CTRL+C to stop]\n")
@@ -231,7 +345,9 @@ func (thea *theaImpl) createInitialUserIfNonePresent() error {
 		return nil
 	}
 
-	log.Emit(logger.NEW, "No existing users found, creating initial user [username='admin', password=REDACTED {refer to your configuration}]\n")
-	_, err = thea.storeOrchestrator.CreateUser([]byte("admin"), []byte("admin"), permissions.All()...)
+	// The initial user must change their password when they first login, as
+	// the credentials of this user are well-known.
+	log.Emit(logger.NEW, "No existing users found, creating initial user [username='admin', password=REDACTED {refer to your configuration}]. This password must be changed on first login\n")
+	_, err = thea.storeOrchestrator.CreateUser([]byte("admin"), []byte("admin"), true, permissions.All()...)
 	return err
 }
@@ -0,0 +1,92 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+const (
+	// APIKeyPrefix is prepended to all API keys, to make them easily identifiable
+	APIKeyPrefix = "thea_"
+
+	apiKeySecretLength = 32 // 256 bits
+
+	// apiKeyDisplayPrefixLength is the number of characters of the key (including the
+	// APIKeyPrefix) which are stored, so that users can identify their keys
+	apiKeyDisplayPrefixLength = len(APIKeyPrefix) + 6
+)
+
+type (
+	// APIKey is a long-lived credential which authenticates requests as the owning user, restricted
+	// to the permissions the key is scoped to. The key itself is never stored, only a hash of it.
+	APIKey struct {
+		ID         uuid.UUID  `db:"id"`
+		UserID     uuid.UUID  `db:"user_id"`
+		CreatedAt  time.Time  `db:"created_at"`
+		Label      string     `db:"label"`
+		Prefix     string     `db:"prefix"`
+		Hash       []byte     `db:"hash" json:"-"`
+		ExpiresAt  *time.Time `db:"expires_at"`
+		LastUsedAt *time.Time `db:"last_used_at"`
+		RevokedAt  *time.Time `db:"revoked_at"`
+
+		// Permissions are the permissions the key is scoped to. Requests authenticated using
+		// this key only have the permissions in this set which the user has.
+		Permissions []string `db:"-"`
+	}
+
+	apiKeyModel struct {
+		APIKey
+		Permissions database.JSONColumn[[]string] `db:"permissions"`
+	}
+)
+
+// NewAPIKey generates a new random API key for the user provided, returning the
+// model of the key (to be saved), and the key itself (which is not saved).
+func NewAPIKey(userID uuid.UUID, label string, permissions []string, expiresAt *time.Time) (*APIKey, string, error) {
+	secret := make([]byte, apiKeySecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+
+	// Remove any duplicated permissions
+	permissions = slices.Clone(permissions)
+	slices.Sort(permissions)
+	permissions = slices.Compact(permissions)
+
+	key := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return &APIKey{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Label:       label,
+		Prefix:      key[:apiKeyDisplayPrefixLength],
+		Hash:        HashAPIKey(key),
+		ExpiresAt:   expiresAt,
+		Permissions: permissions,
+	}, key, nil
+}
+
+// HashAPIKey returns the hash of the API key provided. As API keys are high-entropy
+// random values, a fast hash is sufficient (unlike passwords).
+func HashAPIKey(key string) []byte {
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+// IsActive returns true if the key has not been revoked and has not expired.
+func (key *APIKey) IsActive() bool {
+	return key.RevokedAt == nil && (key.ExpiresAt == nil || time.Now().Before(*key.ExpiresAt))
+}
+
+func apiKeyModelToAPIKey(model *apiKeyModel) *APIKey {
+	key := model.APIKey
+	key.Permissions = *model.Permissions.Get()
+	return &key
+}
@@ -0,0 +1,41 @@
+package token
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// Session represents a login of a user, from which the auth and refresh tokens
+	// for the user are issued. Refresh tokens are single-use: each refresh issues a new
+	// refresh token (whose ID replaces the RefreshTokenID of the session), and any
+	// attempt to use a previous refresh token revokes the entire session.
+	Session struct {
+		ID             uuid.UUID  `db:"id"`
+		UserID         uuid.UUID  `db:"user_id"`
+		CreatedAt      time.Time  `db:"created_at"`
+		LastUsedAt     time.Time  `db:"last_used_at"`
+		ExpiresAt      time.Time  `db:"expires_at"`
+		RevokedAt      *time.Time `db:"revoked_at"`
+		RefreshTokenID uuid.UUID  `db:"refresh_token_id"`
+
+		// PermissionsVersion is incremented whenever the effective permissions of the
+		// user change. Auth tokens issued for an older version must be refreshed.
+		PermissionsVersion int `db:"permissions_version"`
+		Client
+	}
+
+	// Client contains information about the client which a
+	// session was created by/last used by.
+	Client struct {
+		Device    *string `db:"device"`
+		UserAgent *string `db:"user_agent"`
+		IPAddress *string `db:"ip_address"`
+	}
+)
+
+// IsActive returns true if the session has not been revoked and has not expired.
+func (session *Session) IsActive() bool {
+	return session.RevokedAt == nil && time.Now().Before(session.ExpiresAt)
+}
@@ -0,0 +1,55 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+const (
+	// SecretLength is the length (in bytes) of the
+	// secrets generated for new signing keys.
+	SecretLength = 64 // 512 bits
+
+	keyIDLength = 8
+)
+
+type (
+	// Type is the type of JWT a signing key is used to sign. Each
+	// type of token uses separate keys.
+	Type string
+
+	// SigningKey is a secret used to sign (and verify) JWTs. Only the most recently
+	// created key of each token type is used for signing, older keys are retired
+	// but can still be used to verify tokens until they are removed.
+	SigningKey struct {
+		ID        string     `db:"id"`
+		CreatedAt time.Time  `db:"created_at"`
+		TokenType Type       `db:"token_type"`
+		Secret    []byte     `db:"secret" json:"-"`
+		RetiredAt *time.Time `db:"retired_at"`
+	}
+)
+
+const (
+	Auth         Type = "auth"
+	Refresh      Type = "refresh"
+	MFAChallenge Type = "mfa_challenge"
+)
+
+// NewSigningKey generates a new signing key, with a random ID and
+// secret, for signing tokens of the type provided.
+func NewSigningKey(tokenType Type) (*SigningKey, error) {
+	id := make([]byte, keyIDLength)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate signing key ID: %w", err)
+	}
+
+	secret := make([]byte, SecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate signing key secret: %w", err)
+	}
+
+	return &SigningKey{ID: hex.EncodeToString(id), TokenType: tokenType, Secret: secret}, nil
+}
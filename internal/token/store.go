@@ -0,0 +1,286 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+	"github.com/lib/pq"
+)
+
+var ErrAPIKeyPermissionsInvalid = errors.New("permissions provided are invalid")
+
+type Store struct{}
+
+// SaveSigningKey saves the new signing key provided, and retires all other
+// signing keys of the same token type.
+func (store *Store) SaveSigningKey(db database.Queryable, key *SigningKey) error {
+	if _, err := db.Exec(`
+		UPDATE jwt_signing_key
+		SET retired_at=current_timestamp
+		WHERE token_type=$1 AND retired_at IS NULL`,
+		key.TokenType,
+	); err != nil {
+		return fmt.Errorf("failed to retire existing %s signing keys: %w", key.TokenType, err)
+	}
+
+	var saved SigningKey
+	if err := db.QueryRowx(`
+		INSERT INTO jwt_signing_key(id, created_at, token_type, secret, retired_at)
+		VALUES($1, current_timestamp, $2, $3, NULL)
+		RETURNING *`,
+		key.ID, key.TokenType, key.Secret,
+	).StructScan(&saved); err != nil {
+		return fmt.Errorf("failed to save %s signing key %s: %w", key.TokenType, key.ID, err)
+	}
+
+	*key = saved
+	return nil
+}
+
+// ListSigningKeys returns all signing keys, with the most recently created first.
+func (store *Store) ListSigningKeys(db database.Queryable) ([]*SigningKey, error) {
+	var dest []*SigningKey
+	if err := db.Select(&dest, `SELECT * FROM jwt_signing_key ORDER BY created_at DESC`); err != nil {
+		return nil, fmt.Errorf("failed to select signing keys: %w", err)
+	}
+
+	return dest, nil
+}
+
+// DeleteSigningKeysRetiredBefore deletes all signing keys of the token type provided
+// which were retired before the time provided.
+func (store *Store) DeleteSigningKeysRetiredBefore(db database.Queryable, tokenType Type, before time.Time) error {
+	if _, err := db.Exec(`DELETE FROM jwt_signing_key WHERE token_type=$1 AND retired_at < $2`, tokenType, before); err != nil {
+		return fmt.Errorf("failed to delete retired %s signing keys: %w", tokenType, err)
+	}
+
+	return nil
+}
+
+func (store *Store) SaveSession(db database.Queryable, session *Session) error {
+	var saved Session
+	if err := db.QueryRowx(`
+		INSERT INTO sessions(id, user_id, created_at, last_used_at, expires_at, revoked_at, refresh_token_id, device, user_agent, ip_address)
+		VALUES($1, $2, current_timestamp, current_timestamp, $3, NULL, $4, $5, $6, $7)
+		RETURNING *`,
+		session.ID, session.UserID, session.ExpiresAt, session.RefreshTokenID, session.Device, session.UserAgent, session.IPAddress,
+	).StructScan(&saved); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", session.ID, err)
+	}
+
+	*session = saved
+	return nil
+}
+
+func (store *Store) GetSession(db database.Queryable, sessionID uuid.UUID) (*Session, error) {
+	var dest Session
+	if err := db.Get(&dest, `SELECT * FROM sessions WHERE id=$1`, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to find session %s: %w", sessionID, err)
+	}
+
+	return &dest, nil
+}
+
+// ListActiveSessionsForUser returns all the sessions for the user provided which have not
+// been revoked or expired, with the most recently used first.
+func (store *Store) ListActiveSessionsForUser(db database.Queryable, userID uuid.UUID) ([]*Session, error) {
+	var dest []*Session
+	if err := db.Select(&dest, `
+		SELECT * FROM sessions
+		WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > current_timestamp
+		ORDER BY last_used_at DESC`,
+		userID,
+	); err != nil {
+		return nil, fmt.Errorf("failed to select sessions for user %s: %w", userID, err)
+	}
+
+	return dest, nil
+}
+
+// RotateSessionRefreshToken replaces the refresh token ID of the session provided with the new
+// ID, IF and ONLY IF the current refresh token ID of the session matches the existing ID provided
+// and the session is active. The expiry and client of the session are also updated. Returns
+// false if the session was not updated.
+func (store *Store) RotateSessionRefreshToken(db database.Queryable, sessionID uuid.UUID, existingTokenID uuid.UUID, newTokenID uuid.UUID, expiresAt time.Time, client Client) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE sessions
+		SET (refresh_token_id, last_used_at, expires_at, user_agent, ip_address) = ($3, current_timestamp, $4, $5, $6)
+		WHERE id=$1 AND refresh_token_id=$2 AND revoked_at IS NULL AND expires_at > current_timestamp`,
+		sessionID, existingTokenID, newTokenID, expiresAt, client.UserAgent, client.IPAddress,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token for session %s: %w", sessionID, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token for session %s: %w", sessionID, err)
+	}
+
+	return affected == 1, nil
+}
+
+func (store *Store) RevokeSession(db database.Queryable, sessionID uuid.UUID) error {
+	if _, err := db.Exec(`UPDATE sessions SET revoked_at=current_timestamp WHERE id=$1 AND revoked_at IS NULL`, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session %s: %w", sessionID, err)
+	}
+
+	return nil
+}
+
+func (store *Store) RevokeSessionsForUser(db database.Queryable, userID uuid.UUID) error {
+	if _, err := db.Exec(`UPDATE sessions SET revoked_at=current_timestamp WHERE user_id=$1 AND revoked_at IS NULL`, userID); err != nil {
+		return fmt.Errorf("failed to revoke sessions for user %s: %w", userID, err)
+	}
+
+	return nil
+}
+
+// IncrementSessionPermissionsVersions increments the permissions version of all active sessions
+// belonging to the users provided, which forces these sessions to refresh their auth tokens (so
+// the tokens contain the current permissions of the user).
+func (store *Store) IncrementSessionPermissionsVersions(db database.Queryable, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	if _, err := db.Exec(`
+		UPDATE sessions SET permissions_version = permissions_version + 1
+		WHERE user_id = ANY($1) AND revoked_at IS NULL AND expires_at > current_timestamp`,
+		pq.Array(userIDs),
+	); err != nil {
+		return fmt.Errorf("failed to increment permissions version of sessions: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteSessionsInactiveBefore deletes all sessions which expired, or were
+// revoked, before the time provided.
+func (store *Store) DeleteSessionsInactiveBefore(db database.Queryable, before time.Time) error {
+	if _, err := db.Exec(`DELETE FROM sessions WHERE expires_at < $1 OR revoked_at < $1`, before); err != nil {
+		return fmt.Errorf("failed to delete inactive sessions: %w", err)
+	}
+
+	return nil
+}
+
+// SaveAPIKey inserts the new API key provided, along with the permissions it is scoped
+// to. Returns ErrAPIKeyPermissionsInvalid if any of the permissions do not exist.
+//
+// NB: This should be called within a transaction, so that the key is not saved if
+// it's permissions cannot be.
+func (store *Store) SaveAPIKey(db database.Queryable, key *APIKey) error {
+	if _, err := db.Exec(`
+		INSERT INTO api_keys(id, user_id, created_at, label, prefix, hash, expires_at, last_used_at, revoked_at)
+		VALUES($1, $2, current_timestamp, $3, $4, $5, $6, NULL, NULL)`,
+		key.ID, key.UserID, key.Label, key.Prefix, key.Hash, key.ExpiresAt,
+	); err != nil {
+		return fmt.Errorf("failed to save API key %s: %w", key.ID, err)
+	}
+
+	if len(key.Permissions) > 0 {
+		res, err := db.Exec(`
+			INSERT INTO api_keys_permissions(api_key_id, permission_id)
+			SELECT $1, id FROM permissions WHERE label = ANY($2)`,
+			key.ID, pq.Array(key.Permissions),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save permissions of API key %s: %w", key.ID, err)
+		}
+
+		if affected, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to save permissions of API key %s: %w", key.ID, err)
+		} else if affected != int64(len(key.Permissions)) {
+			return ErrAPIKeyPermissionsInvalid
+		}
+	}
+
+	saved, err := store.GetAPIKey(db, key.ID)
+	if err != nil {
+		return err
+	}
+
+	*key = *saved
+	return nil
+}
+
+func (store *Store) GetAPIKey(db database.Queryable, keyID uuid.UUID) (*APIKey, error) {
+	return store.getAPIKeyWhere(db, "api_keys.id=$1", keyID)
+}
+
+// GetAPIKeyWithHash returns the API key with the hash provided (see HashAPIKey).
+func (store *Store) GetAPIKeyWithHash(db database.Queryable, hash []byte) (*APIKey, error) {
+	return store.getAPIKeyWhere(db, "api_keys.hash=$1", hash)
+}
+
+// ListAPIKeysForUser returns all the API keys of the user provided which have
+// not been revoked (including expired keys), with the most recently created first.
+func (store *Store) ListAPIKeysForUser(db database.Queryable, userID uuid.UUID) ([]*APIKey, error) {
+	var dest []*apiKeyModel
+	if err := db.Select(&dest, selectAPIKeyQuery(`api_keys.user_id=$1 AND api_keys.revoked_at IS NULL`)+` ORDER BY api_keys.created_at DESC`, userID); err != nil {
+		return nil, fmt.Errorf("failed to select API keys for user %s: %w", userID, err)
+	}
+
+	keys := make([]*APIKey, len(dest))
+	for k, v := range dest {
+		keys[k] = apiKeyModelToAPIKey(v)
+	}
+
+	return keys, nil
+}
+
+func (store *Store) RevokeAPIKey(db database.Queryable, keyID uuid.UUID) error {
+	if _, err := db.Exec(`UPDATE api_keys SET revoked_at=current_timestamp WHERE id=$1 AND revoked_at IS NULL`, keyID); err != nil {
+		return fmt.Errorf("failed to revoke API key %s: %w", keyID, err)
+	}
+
+	return nil
+}
+
+// RevokeAPIKeysForUser revokes all of the API keys belonging to the user provided.
+func (store *Store) RevokeAPIKeysForUser(db database.Queryable, userID uuid.UUID) error {
+	if _, err := db.Exec(`UPDATE api_keys SET revoked_at=current_timestamp WHERE user_id=$1 AND revoked_at IS NULL`, userID); err != nil {
+		return fmt.Errorf("failed to revoke API keys for user %s: %w", userID, err)
+	}
+
+	return nil
+}
+
+// RecordAPIKeyUsage updates the last used timestamp of the API key provided. To avoid
+// a write for every request, the timestamp is only updated once per minute.
+func (store *Store) RecordAPIKeyUsage(db database.Queryable, keyID uuid.UUID) error {
+	if _, err := db.Exec(`
+		UPDATE api_keys SET last_used_at=current_timestamp
+		WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < current_timestamp - INTERVAL '1 minute')`,
+		keyID,
+	); err != nil {
+		return fmt.Errorf("failed to record usage of API key %s: %w", keyID, err)
+	}
+
+	return nil
+}
+
+func (store *Store) getAPIKeyWhere(db database.Queryable, pred string, args ...any) (*APIKey, error) {
+	var dest apiKeyModel
+	if err := db.Get(&dest, selectAPIKeyQuery(pred), args...); err != nil {
+		return nil, fmt.Errorf("failed to find API key: %w", err)
+	}
+
+	return apiKeyModelToAPIKey(&dest), nil
+}
+
+// selectAPIKeyQuery returns a query which selects the API keys matching the predicate
+// provided, along with a JSON array of the labels of the permissions of each key.
+func selectAPIKeyQuery(pred string) string {
+	return `
+		SELECT api_keys.*, COALESCE(JSONB_AGG(permissions.label) FILTER (WHERE permissions.id IS NOT NULL), '[]') AS permissions
+		FROM api_keys
+		LEFT JOIN api_keys_permissions ON api_keys_permissions.api_key_id = api_keys.id
+		LEFT JOIN permissions ON permissions.id = api_keys_permissions.permission_id
+		WHERE ` + pred + `
+		GROUP BY api_keys.id`
+}
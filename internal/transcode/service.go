@@ -25,8 +25,10 @@ type (
 		SaveTranscode(task *TranscodeTask) error
 		GetAllWorkflows() []*workflow.Workflow
 		GetMedia(mediaID uuid.UUID) *media.Container
+		GetFilesForMedia(mediaID uuid.UUID) ([]*media.MediaFile, error)
+		GetMediaFile(fileID uuid.UUID) (*media.MediaFile, error)
 		GetTarget(targetID uuid.UUID) *ffmpeg.Target
-		GetForMediaAndTarget(mediaID uuid.UUID, targetID uuid.UUID) (*Transcode, error)
+		GetForMediaFileAndTarget(fileID uuid.UUID, targetID uuid.UUID) (*Transcode, error)
 	}
 
 	// transcodeService is Thea's solution to pre-transcoding of user media.
@@ -77,7 +79,7 @@ func New(config Config, eventBus event.EventCoordinator, dataStore DataStore) (*
 // will wait for it's running transcode tasks to cancel.
 func (service *transcodeService) Run(ctx context.Context) error {
 	eventChannel := make(event.HandlerChannel, 100)
-	service.eventBus.RegisterHandlerChannel(eventChannel, event.NewMediaEvent, event.DeleteMediaEvent)
+	service.eventBus.RegisterHandlerChannel(eventChannel, event.NewMediaEvent, event.ReplaceMediaEvent, event.DeleteMediaEvent)
 
 	for {
 		select {
@@ -95,6 +97,14 @@ func (service *transcodeService) Run(ctx context.Context) error {
 				} else {
 					log.Emit(logger.ERROR, "failed to extract UUID from %s event (payload %#v)\n", message.Event, message.Payload)
 				}
+			case event.ReplaceMediaEvent:
+				if mediaID, ok := message.Payload.(uuid.UUID); ok {
+					log.Emit(logger.DEBUG, "source of media with ID %s replaced, cancelling any ongoing transcodes and re-running workflows\n", mediaID)
+					service.CancelTasksForMedia(mediaID)
+					service.createWorkflowTasksForMedia(mediaID)
+				} else {
+					log.Emit(logger.ERROR, "failed to extract UUID from %s event (payload %#v)\n", message.Event, message.Payload)
+				}
 			case event.DeleteMediaEvent:
 				if mediaID, ok := message.Payload.(uuid.UUID); ok {
 					log.Emit(logger.DEBUG, "media with ID %s deleted, cancelling any ongoing transcodes\n", mediaID)
@@ -160,12 +170,34 @@ func (service *transcodeService) CancelTasksForMedia(mediaID uuid.UUID) {
 	}
 }
 
-// TaskForMediaAndTarget searches through all the tasks in this service and looks for one
-// which was created for the media and target matching the IDs provided. If no such task exists
+// CancelTasksForMediaFile finds and cancels any active transcodes for the media file ID provided.
+// This function acquires the service mutex to ensure no tasks for this file are added
+// while this process is occurring.
+func (service *transcodeService) CancelTasksForMediaFile(fileID uuid.UUID) {
+	service.Lock()
+	defer service.Unlock()
+
+	toDelete := make([]uuid.UUID, 0)
+	for _, t := range service.tasks {
+		if t.Media().File.ID == fileID {
+			toDelete = append(toDelete, t.ID())
+		}
+	}
+
+	log.Debugf("Cancelling all tasks for media file %s (tasks: %v)\n", fileID, toDelete)
+	for _, id := range toDelete {
+		if err := service.CancelTask(id); err != nil {
+			log.Warnf("Cancellation of task %s failed with error: %s\n", id, err)
+		}
+	}
+}
+
+// ActiveTaskForMediaFileAndTarget searches through all the tasks in this service and looks for one
+// which was created for the media file and target matching the IDs provided. If no such task exists
 // then nil is returned.
-func (service *transcodeService) ActiveTaskForMediaAndTarget(mediaID uuid.UUID, targetID uuid.UUID) *TranscodeTask {
+func (service *transcodeService) ActiveTaskForMediaFileAndTarget(fileID uuid.UUID, targetID uuid.UUID) *TranscodeTask {
 	for _, t := range service.tasks {
-		if t.media.ID() == mediaID && t.target.ID == targetID {
+		if t.media.File.ID == fileID && t.target.ID == targetID {
 			return t
 		}
 	}
@@ -173,22 +205,37 @@ func (service *transcodeService) ActiveTaskForMediaAndTarget(mediaID uuid.UUID,
 	return nil
 }
 
-// NewTask fetches the media and target corresponding to the IDs provided and attempts to spawn
-// a task using the result.
-// If the media/target fail to be retrieved, or if a transcode task for the
-// media+target already exists, an error is returned.
-func (service *transcodeService) NewTask(mediaID uuid.UUID, targetID uuid.UUID) error {
-	media := service.dataStore.GetMedia(mediaID)
-	if media == nil {
+// NewTask fetches the media, media file and target corresponding to the IDs provided and attempts to spawn
+// a task using the result. If no file ID is provided, the oldest file of the media is transcoded.
+// If the media/file/target fail to be retrieved, or if a transcode task for the
+// file+target already exists, an error is returned.
+func (service *transcodeService) NewTask(mediaID uuid.UUID, fileID *uuid.UUID, targetID uuid.UUID) error {
+	container := service.dataStore.GetMedia(mediaID)
+	if container == nil {
 		return fmt.Errorf("media %s not found", mediaID)
 	}
 
+	var file *media.MediaFile
+	if fileID != nil {
+		found, err := service.dataStore.GetMediaFile(*fileID)
+		if err != nil || found.MediaID != mediaID {
+			return fmt.Errorf("media file %s not found for media %s", *fileID, mediaID)
+		}
+		file = found
+	} else {
+		files, err := service.dataStore.GetFilesForMedia(mediaID)
+		if err != nil || len(files) == 0 {
+			return fmt.Errorf("media %s has no files", mediaID)
+		}
+		file = files[0]
+	}
+
 	target := service.dataStore.GetTarget(targetID)
 	if target == nil {
 		return fmt.Errorf("target %s not found", targetID)
 	}
 
-	return service.spawnFfmpegTarget(media, target)
+	return service.spawnFfmpegTarget(container.WithFile(file), target)
 }
 
 // CancelTask will find the transcode task with the ID provided and cancel it. If the task
@@ -345,45 +392,61 @@ func (service *transcodeService) handleTaskUpdate(taskID uuid.UUID) {
 }
 
 // createWorkflowTasksForMedia takes a media ID, and queries the Ffmpeg Store for a workflow
-// matching the media provided. The first workflow to be found as eligible will see the associatted
-// tasks be created, managed and monitored by this service.
+// matching each of the files of the media provided. For each file, the first workflow to be found
+// as eligible will see the associatted tasks be created, managed and monitored by this service.
 func (service *transcodeService) createWorkflowTasksForMedia(mediaID uuid.UUID) {
-	media := service.dataStore.GetMedia(mediaID)
+	container := service.dataStore.GetMedia(mediaID)
+	if container == nil {
+		log.Emit(logger.ERROR, "failed to create workflow tasks for media %s: media not found\n", mediaID)
+		return
+	}
+
+	files, err := service.dataStore.GetFilesForMedia(mediaID)
+	if err != nil {
+		log.Emit(logger.ERROR, "failed to create workflow tasks for media %s: %v\n", mediaID, err)
+		return
+	}
+
 	workflows := service.dataStore.GetAllWorkflows()
+	for _, file := range files {
+		service.createWorkflowTasksForFile(container.WithFile(file), workflows)
+	}
+}
 
+func (service *transcodeService) createWorkflowTasksForFile(media *media.Container, workflows []*workflow.Workflow) {
 	for _, workflow := range workflows {
 		if workflow.IsMediaEligible(media) {
 			for _, target := range workflow.Targets {
 				if err := service.spawnFfmpegTarget(media, target); err != nil {
-					log.Emit(logger.ERROR, "failed to spawn ffmpeg target %s for media %s: %v\n", target, media.ID(), err)
+					log.Emit(logger.ERROR, "failed to spawn ffmpeg target %s for media %s (file %s): %v\n", target, media.ID(), media.File.ID, err)
 				}
 			}
 
-			log.Emit(logger.NEW, "Media %s met the conditions of workflow %v... Automated transcodes queued\n", mediaID, workflow)
+			log.Emit(logger.NEW, "Media %s (file %s) met the conditions of workflow %v... Automated transcodes queued\n", media.ID(), media.File.ID, workflow)
 			return
 		}
 	}
 
 	// TODO: Maybe we create some sort of a notification or something about not being able to find an eligible
 	//		 workflow? I could see that being useful.
-	log.Emit(logger.DEBUG, "Media %s did not meet the conditions of any known workflows. No automated transcoding will occur\n", mediaID)
+	log.Emit(logger.DEBUG, "Media %s (file %s) did not meet the conditions of any known workflows. No automated transcoding will occur\n", media.ID(), media.File.ID)
 }
 
-// spawnFfmpegTarget will create a new transcode task assigned to the media and target provided,
+// spawnFfmpegTarget will create a new transcode task assigned to the media (and it's file) and target provided,
 // and add the task to the services queue in an 'IDLE' state.
-// An error is returned if a task for this media+target already exists, whether completed (in DB) or active
+// An error is returned if a task for this file+target already exists, whether completed (in DB) or active
 // Note: This function does not START the transcoding, it only creates the task and adds it to the
 // processing queue.
 func (service *transcodeService) spawnFfmpegTarget(m *media.Container, target *ffmpeg.Target) error {
 	service.Lock()
 	defer service.Unlock()
 
-	if existing := service.ActiveTaskForMediaAndTarget(m.ID(), target.ID); existing != nil {
-		return fmt.Errorf("an active task for media %s and target %s already exists", m.ID(), target.ID)
+	if existing := service.ActiveTaskForMediaFileAndTarget(m.File.ID, target.ID); existing != nil {
+		return fmt.Errorf("an active task for media file %s and target %s already exists", m.File.ID, target.ID)
 	}
 
-	if existing, _ := service.dataStore.GetForMediaAndTarget(m.ID(), target.ID); existing != nil {
-		return fmt.Errorf("a completed task for media %s and target %s already exists", m.ID(), target.ID)
+	if existing, _ := service.dataStore.GetForMediaFileAndTarget(m.File.ID, target.ID); existing != nil {
+		return fmt.Errorf("a completed task for media file %s and target %s already exists", m.File.ID, target.ID)
 	}
 
 	newTask, err := NewTranscodeTask(m, target, ffmpeg.Config{
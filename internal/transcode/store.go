@@ -16,10 +16,11 @@ type (
 	Store struct{}
 
 	Transcode struct {
-		ID        uuid.UUID `db:"id"`
-		MediaID   uuid.UUID `db:"media_id"`
-		TargetID  uuid.UUID `db:"transcode_target_id"`
-		MediaPath string    `db:"path"`
+		ID          uuid.UUID `db:"id"`
+		MediaID     uuid.UUID `db:"media_id"`
+		MediaFileID uuid.UUID `db:"media_file_id"`
+		TargetID    uuid.UUID `db:"transcode_target_id"`
+		MediaPath   string    `db:"path"`
 	}
 )
 
@@ -28,9 +29,9 @@ type (
 func (store *Store) SaveTranscode(db database.Queryable, task *TranscodeTask) error {
 	// TODO timestamp columns (created_at, updated_at)
 	if _, err := db.Exec(`
-		INSERT INTO media_transcodes(id, media_id, transcode_target_id, path)
-		VALUES ($1, $2, $3, $4)`,
-		task.id, task.media.ID(), task.target.ID, task.OutputPath(),
+		INSERT INTO media_transcodes(id, media_id, media_file_id, transcode_target_id, path)
+		VALUES ($1, $2, $3, $4, $5)`,
+		task.id, task.media.ID(), task.media.File.ID, task.target.ID, task.OutputPath(),
 	); err != nil {
 		return fmt.Errorf("failed to create transcode row: %w", err)
 	}
@@ -82,20 +83,34 @@ func (store *Store) Delete(db database.Queryable, id uuid.UUID) (string, error)
 	return result, nil
 }
 
-func (store *Store) GetForMediaAndTarget(db database.Queryable, mediaID uuid.UUID, targetID uuid.UUID) (*Transcode, error) {
+// GetForMediaFileAndTarget returns the completed transcode of the media file
+// with the ID provided, for the target with the ID provided.
+func (store *Store) GetForMediaFileAndTarget(db database.Queryable, fileID uuid.UUID, targetID uuid.UUID) (*Transcode, error) {
 	dest := &Transcode{}
 	if err := db.Get(dest, `
 		SELECT * FROM media_transcodes
-		WHERE media_id=$1
+		WHERE media_file_id=$1
 		  AND transcode_target_id=$2`,
-		mediaID, targetID,
+		fileID, targetID,
 	); err != nil {
-		return nil, fmt.Errorf("failed to find transcode for media %s and target %s: %w", mediaID, targetID, err)
+		return nil, fmt.Errorf("failed to find transcode for media file %s and target %s: %w", fileID, targetID, err)
 	}
 
 	return dest, nil
 }
 
+// DeleteForMediaFile deletes all media transcode rows associated with the
+// media file ID provided. The paths of the deleted media transcodes are
+// returned to allow for file-system cleanup.
+func (store *Store) DeleteForMediaFile(db database.Queryable, fileID uuid.UUID) ([]string, error) {
+	var result []string
+	if err := db.Select(&result, `DELETE FROM media_transcodes WHERE media_file_id=$1 RETURNING path`, fileID); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 // DeleteForMedias deletes all media transcode row associated
 // with any of the given media IDs. The paths of the deleted media
 // transcodes are returned to allow for file-system cleanup.
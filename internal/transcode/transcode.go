@@ -60,7 +60,11 @@ type TranscodeTask struct {
 }
 
 func NewTranscodeTask(m *media.Container, t *ffmpeg.Target, config ffmpeg.Config) (*TranscodeTask, error) {
-	dir := filepath.Join(config.GetOutputBaseDirectory(), m.ID().String(), t.ID.String())
+	if m.File == nil {
+		return nil, ErrMediaSourceNotFound
+	}
+
+	dir := filepath.Join(config.GetOutputBaseDirectory(), m.ID().String(), m.File.ID.String(), t.ID.String())
 	if err := os.MkdirAll(filepath.Dir(dir), 0o777); err != nil {
 		log.Errorf("Failed to create required directories (%s) for transcoding output: %v\n", filepath.Dir(dir), err)
 		return nil, ErrPathDirectoryCreation
@@ -0,0 +1,24 @@
+package upload
+
+import "time"
+
+// Config contains configuration options that allow
+// customization of how Thea accepts uploaded media.
+type Config struct {
+	// The directory that in-progress uploads are staged in. Once
+	// complete, uploads are moved to the ingestion directory. If not
+	// provided, a directory inside of Thea's cache directory is used.
+	StagingPath string `toml:"staging_dir" env:"UPLOAD_STAGING_DIR"`
+
+	// Uploads which have not received any content for this many
+	// hours are considered abandoned, and are removed.
+	ExpiryHours int `toml:"expiry_hours" env-default:"24"`
+
+	// The maximum size of an upload, in megabytes. A value of
+	// zero allows uploads of any size.
+	MaximumSizeMegabytes int64 `toml:"max_size_mb" env-default:"0"`
+}
+
+func (config *Config) ExpiryDuration() time.Duration {
+	return time.Duration(config.ExpiryHours) * time.Hour
+}
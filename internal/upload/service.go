@@ -0,0 +1,335 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/ingest"
+	"github.com/hbomb79/Thea/pkg/logger"
+)
+
+var (
+	log = logger.Get("UploadServ")
+
+	ErrInvalidFileName   = errors.New("upload file name is not valid")
+	ErrInvalidSize       = errors.New("upload size is not valid")
+	ErrInvalidChecksum   = errors.New("upload checksum must be a hex-encoded SHA-256 digest")
+	ErrOffsetMismatch    = errors.New("offset does not match the offset of the upload")
+	ErrSizeExceeded      = errors.New("content exceeds the size of the upload")
+	ErrChecksumMismatch  = errors.New("checksum of uploaded content does not match the checksum of the upload")
+	ErrUploadTooLarge    = errors.New("upload size exceeds the maximum permitted size")
+	ErrUploadIncomplete  = errors.New("upload is not yet complete")
+	ErrUploadInProgress  = errors.New("content for this upload is already being received")
+	errUploadStagingFail = errors.New("failed to access staged upload content")
+)
+
+const checkIntervalDuration = time.Hour
+
+type (
+	DataStore interface {
+		SaveUpload(upload *Upload) error
+		GetUpload(uploadID uuid.UUID, userID uuid.UUID) (*Upload, error)
+		ListUploadsForUser(userID uuid.UUID) ([]*Upload, error)
+		ListUploadsUpdatedBefore(before time.Time) ([]*Upload, error)
+		TouchUpload(uploadID uuid.UUID) error
+		DeleteUpload(uploadID uuid.UUID) error
+	}
+
+	ingester interface {
+		IngestFile(path string, fileName string, overrideTmdbID *string) (*ingest.IngestItem, error)
+	}
+
+	// uploadService accepts resumable uploads of media, allowing users to add media
+	// to Thea without access to the servers file system. Uploads are created with the expected
+	// size and checksum of the file, and the content is then sent in one or more chunks, each
+	// specifying the offset it begins at. If an upload is interrupted, the client can fetch the
+	// upload to find the offset to resume from.
+	//
+	// Once all content is received, the size and checksum are verified before the file
+	// is handed to the ingest service.
+	uploadService struct {
+		config   Config
+		store    DataStore
+		ingester ingester
+
+		// activeUploads tracks which uploads are currently receiving content, as
+		// only one chunk may be written to an upload at a time.
+		activeUploads sync.Map
+	}
+)
+
+func New(config Config, store DataStore, ingester ingester) (*uploadService, error) {
+	if err := os.MkdirAll(config.StagingPath, os.ModeDir|os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create upload staging directory: %w", err)
+	}
+
+	return &uploadService{config: config, store: store, ingester: ingester}, nil
+}
+
+// Run periodically removes abandoned uploads until the context provided is cancelled.
+func (service *uploadService) Run(ctx context.Context) error {
+	ticker := time.NewTicker(checkIntervalDuration)
+	defer ticker.Stop()
+
+	service.removeExpiredUploads()
+	for {
+		select {
+		case <-ticker.C:
+			service.removeExpiredUploads()
+		case <-ctx.Done():
+			log.Emit(logger.STOP, "Upload service closed\n")
+			return nil
+		}
+	}
+}
+
+// CreateUpload creates a new upload for the user specified, which content can then be written
+// to using WriteChunk. The checksum must be the hex-encoded SHA-256 digest of the complete file.
+func (service *uploadService) CreateUpload(userID uuid.UUID, fileName string, size int64, checksum string, tmdbID *string) (*Upload, error) {
+	if fileName == "" || fileName != filepath.Base(fileName) || fileName == "." || fileName == ".." {
+		return nil, fmt.Errorf("%w: '%s'", ErrInvalidFileName, fileName)
+	}
+	if size <= 0 {
+		return nil, ErrInvalidSize
+	}
+	if maxSize := service.config.MaximumSizeMegabytes * 1024 * 1024; maxSize > 0 && size > maxSize {
+		return nil, ErrUploadTooLarge
+	}
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		return nil, ErrInvalidChecksum
+	}
+
+	upload := &Upload{
+		ID:       uuid.New(),
+		UserID:   userID,
+		FileName: fileName,
+		Size:     size,
+		Checksum: strings.ToLower(checksum),
+		TmdbID:   tmdbID,
+	}
+
+	if err := os.WriteFile(service.stagingPath(upload.ID), []byte{}, 0o644); err != nil {
+		return nil, fmt.Errorf("%w: %w", errUploadStagingFail, err)
+	}
+	if err := service.store.SaveUpload(upload); err != nil {
+		_ = os.Remove(service.stagingPath(upload.ID))
+		return nil, err
+	}
+
+	log.Emit(logger.NEW, "Created upload %s of '%s' (%d bytes) for user %s\n", upload.ID, fileName, size, userID)
+	return service.GetUpload(upload.ID, userID)
+}
+
+// GetUpload returns the upload with the ID provided (created by the user specified), including
+// the offset of the content received so far.
+func (service *uploadService) GetUpload(uploadID uuid.UUID, userID uuid.UUID) (*Upload, error) {
+	upload, err := service.store.GetUpload(uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := service.populateOffset(upload); err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+// ListUploads returns all the uploads created by the user specified.
+func (service *uploadService) ListUploads(userID uuid.UUID) ([]*Upload, error) {
+	uploads, err := service.store.ListUploadsForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, upload := range uploads {
+		if err := service.populateOffset(upload); err != nil {
+			return nil, err
+		}
+	}
+
+	return uploads, nil
+}
+
+// WriteChunk writes the content provided to the upload with the ID provided (which must have been
+// created by the user specified). The offset must match the current offset of the upload. If the
+// chunk completes the upload, the checksum of the upload is verified and the file is handed to
+// the ingest service (see Upload.IngestID). If the checksum does not match, the content of the
+// upload is discarded so that it can be uploaded again.
+func (service *uploadService) WriteChunk(uploadID uuid.UUID, userID uuid.UUID, offset int64, content io.Reader) (*Upload, error) {
+	if _, loaded := service.activeUploads.LoadOrStore(uploadID, struct{}{}); loaded {
+		return nil, ErrUploadInProgress
+	}
+	defer service.activeUploads.Delete(uploadID)
+
+	upload, err := service.GetUpload(uploadID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Offset != offset {
+		return nil, fmt.Errorf("%w: expected offset %d", ErrOffsetMismatch, upload.Offset)
+	}
+
+	if err := service.appendContent(upload, content); err != nil {
+		return nil, err
+	}
+	if err := service.store.TouchUpload(upload.ID); err != nil {
+		return nil, err
+	}
+
+	if upload.Offset < upload.Size {
+		return upload, nil
+	}
+
+	return service.completeUpload(upload)
+}
+
+// AbortUpload removes the upload with the ID provided (created by the user specified), discarding
+// any content received.
+func (service *uploadService) AbortUpload(uploadID uuid.UUID, userID uuid.UUID) error {
+	if _, err := service.store.GetUpload(uploadID, userID); err != nil {
+		return err
+	}
+
+	log.Emit(logger.INFO, "Aborting upload %s\n", uploadID)
+	return service.removeUpload(uploadID)
+}
+
+// appendContent appends the content provided to the staged content of the upload, updating the
+// offset of the upload. If the content would exceed the size of the upload, the content
+// is rejected and the staged content is restored to it's previous size.
+func (service *uploadService) appendContent(upload *Upload, content io.Reader) error {
+	file, err := os.OpenFile(service.stagingPath(upload.ID), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUploadStagingFail, err)
+	}
+	defer file.Close()
+
+	remaining := upload.Size - upload.Offset
+	written, err := io.Copy(file, io.LimitReader(content, remaining+1))
+	if err == nil && written > remaining {
+		err = ErrSizeExceeded
+	}
+	if err != nil {
+		if truncErr := file.Truncate(upload.Offset); truncErr != nil {
+			log.Errorf("Failed to restore staged content of upload %s after failed write: %v\n", upload.ID, truncErr)
+		}
+
+		return err
+	}
+
+	upload.Offset += written
+	return nil
+}
+
+// completeUpload verifies the size and checksum of the staged content of the upload, and if
+// valid, hands the file to the ingest service.
+func (service *uploadService) completeUpload(upload *Upload) (*Upload, error) {
+	path := service.stagingPath(upload.ID)
+	if upload.Offset != upload.Size {
+		return nil, ErrUploadIncomplete
+	}
+
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUploadStagingFail, err)
+	}
+	if checksum != upload.Checksum {
+		log.Warnf("Checksum of upload %s (%s) does not match expected checksum (%s), discarding content\n", upload.ID, checksum, upload.Checksum)
+		if err := os.Truncate(path, 0); err != nil {
+			return nil, fmt.Errorf("%w: %w", errUploadStagingFail, err)
+		}
+
+		return nil, ErrChecksumMismatch
+	}
+
+	item, err := service.ingester.IngestFile(path, upload.FileName, upload.TmdbID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Emit(logger.SUCCESS, "Upload %s complete, queued for ingestion as %s\n", upload.ID, item)
+	if err := service.store.DeleteUpload(upload.ID); err != nil {
+		log.Warnf("Failed to remove completed upload %s: %v\n", upload.ID, err)
+	}
+
+	upload.IngestID = &item.ID
+	return upload, nil
+}
+
+func (service *uploadService) removeExpiredUploads() {
+	if service.config.ExpiryHours <= 0 {
+		return
+	}
+
+	expired, err := service.store.ListUploadsUpdatedBefore(time.Now().Add(-service.config.ExpiryDuration()))
+	if err != nil {
+		log.Errorf("Failed to query for expired uploads: %v\n", err)
+		return
+	}
+
+	for _, upload := range expired {
+		if _, active := service.activeUploads.Load(upload.ID); active {
+			continue
+		}
+
+		log.Emit(logger.INFO, "Removing abandoned upload %s of '%s'\n", upload.ID, upload.FileName)
+		if err := service.removeUpload(upload.ID); err != nil {
+			log.Warnf("Failed to remove abandoned upload %s: %v\n", upload.ID, err)
+		}
+	}
+}
+
+func (service *uploadService) removeUpload(uploadID uuid.UUID) error {
+	if err := service.store.DeleteUpload(uploadID); err != nil {
+		return err
+	}
+
+	if err := os.Remove(service.stagingPath(uploadID)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Warnf("Cleanup of staged content for upload %s failed: %v\n", uploadID, err)
+	}
+
+	return nil
+}
+
+// populateOffset sets the offset of the upload provided to the size of it's staged content.
+func (service *uploadService) populateOffset(upload *Upload) error {
+	info, err := os.Stat(service.stagingPath(upload.ID))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUploadStagingFail, err)
+	}
+
+	upload.Offset = info.Size()
+	return nil
+}
+
+func (service *uploadService) stagingPath(uploadID uuid.UUID) string {
+	return filepath.Join(service.config.StagingPath, uploadID.String())
+}
+
+// fileChecksum returns the hex-encoded SHA-256 digest of the file at the path provided.
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
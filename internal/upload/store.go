@@ -0,0 +1,95 @@
+package upload
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+type (
+	Store struct{}
+
+	// Upload is a (resumable) upload of a file which is to be ingested
+	// once complete. The content of the upload is staged on disk, the
+	// amount of content received so far is the Offset of the upload.
+	Upload struct {
+		ID        uuid.UUID `db:"id"`
+		CreatedAt time.Time `db:"created_at"`
+		UpdatedAt time.Time `db:"updated_at"`
+		UserID    uuid.UUID `db:"user_id"`
+		FileName  string    `db:"file_name"`
+		Size      int64     `db:"size"`
+		Checksum  string    `db:"checksum"`
+
+		// TmdbID optionally specifies the TMDB ID of the movie (or the series, for
+		// episodes) that the upload is for, which skips searching TMDB during ingestion.
+		TmdbID *string `db:"tmdb_id"`
+
+		Offset int64 `db:"-"`
+
+		// IngestID is populated once the upload is complete, and has been queued for ingestion.
+		IngestID *uuid.UUID `db:"-"`
+	}
+)
+
+func (store *Store) SaveUpload(db database.Queryable, upload *Upload) error {
+	if _, err := db.Exec(`
+		INSERT INTO ingest_upload(id, created_at, updated_at, user_id, file_name, size, checksum, tmdb_id)
+		VALUES($1, current_timestamp, current_timestamp, $2, $3, $4, $5, $6)`,
+		upload.ID, upload.UserID, upload.FileName, upload.Size, upload.Checksum, upload.TmdbID,
+	); err != nil {
+		return fmt.Errorf("failed to create upload row: %w", err)
+	}
+
+	return nil
+}
+
+// GetUpload returns the upload with the ID provided, which was created by the user specified.
+func (store *Store) GetUpload(db database.Queryable, uploadID uuid.UUID, userID uuid.UUID) (*Upload, error) {
+	var dest Upload
+	if err := db.Get(&dest, `SELECT * FROM ingest_upload WHERE id=$1 AND user_id=$2`, uploadID, userID); err != nil {
+		return nil, fmt.Errorf("failed to find upload %s: %w", uploadID, err)
+	}
+
+	return &dest, nil
+}
+
+// ListUploadsForUser returns all the uploads created by the user specified, oldest first.
+func (store *Store) ListUploadsForUser(db database.Queryable, userID uuid.UUID) ([]*Upload, error) {
+	var dest []*Upload
+	if err := db.Select(&dest, `SELECT * FROM ingest_upload WHERE user_id=$1 ORDER BY created_at`, userID); err != nil {
+		return nil, fmt.Errorf("failed to select uploads for user %s: %w", userID, err)
+	}
+
+	return dest, nil
+}
+
+// ListUploadsUpdatedBefore returns all uploads which have not been updated since the time provided.
+func (store *Store) ListUploadsUpdatedBefore(db database.Queryable, before time.Time) ([]*Upload, error) {
+	var dest []*Upload
+	if err := db.Select(&dest, `SELECT * FROM ingest_upload WHERE updated_at < $1`, before); err != nil {
+		return nil, fmt.Errorf("failed to select expired uploads: %w", err)
+	}
+
+	return dest, nil
+}
+
+// TouchUpload sets the updated_at timestamp of the upload with the ID provided to
+// now, indicating that content was received (and so the upload has not been abandoned).
+func (store *Store) TouchUpload(db database.Queryable, uploadID uuid.UUID) error {
+	if _, err := db.Exec(`UPDATE ingest_upload SET updated_at=current_timestamp WHERE id=$1`, uploadID); err != nil {
+		return fmt.Errorf("failed to update upload %s: %w", uploadID, err)
+	}
+
+	return nil
+}
+
+func (store *Store) DeleteUpload(db database.Queryable, uploadID uuid.UUID) error {
+	if _, err := db.Exec(`DELETE FROM ingest_upload WHERE id=$1`, uploadID); err != nil {
+		return fmt.Errorf("failed to delete upload %s: %w", uploadID, err)
+	}
+
+	return nil
+}
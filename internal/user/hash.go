@@ -1,14 +1,26 @@
 package user
 
 import (
-	"bytes"
 	"crypto/rand"
+	"crypto/subtle"
 	"errors"
 
 	"golang.org/x/crypto/argon2"
 )
 
 type (
+	// HashConfig contains the argon2id parameters used to hash passwords. The parameters
+	// used for each password are stored alongside the hash, so these can be changed
+	// freely: existing passwords are rehashed using the new parameters when
+	// the user next logs in.
+	HashConfig struct {
+		Time       uint32 `toml:"time" env-default:"3"`
+		MemoryKiB  uint32 `toml:"memory_kib" env-default:"65536"`
+		Threads    uint8  `toml:"threads" env-default:"2"`
+		KeyLength  uint32 `toml:"key_length" env-default:"32"`
+		SaltLength uint32 `toml:"salt_length" env-default:"16"`
+	}
+
 	argonHasher struct {
 		time    uint32
 		memory  uint32
@@ -17,9 +29,19 @@ type (
 		saltLen uint32
 	}
 
+	// hashParams are the argon2id parameters used to generate a hash, which must
+	// be known in order to compare a password against the hash. The key length
+	// is not included, as it is the length of the hash itself.
+	hashParams struct {
+		Time    uint32 `db:"password_time"`
+		Memory  uint32 `db:"password_memory"`
+		Threads uint8  `db:"password_threads"`
+	}
+
 	hashAndSalt struct {
-		hash []byte
-		salt []byte
+		hash   []byte
+		salt   []byte
+		params hashParams
 	}
 )
 
@@ -41,22 +63,33 @@ func (a *argonHasher) GenerateHash(password, salt []byte) (*hashAndSalt, error)
 		return nil, err
 	}
 	hash := argon2.IDKey(password, salt, a.time, a.memory, a.threads, a.keyLen)
-	return &hashAndSalt{hash, salt}, nil
+	return &hashAndSalt{hash, salt, a.params()}, nil
 }
 
-// Compare generated hash with store hash.
-func (a *argonHasher) Compare(hash, salt, password []byte) error {
-	hashSalt, err := a.GenerateHash(password, salt)
-	if err != nil {
-		return err
+// Compare generated hash with store hash. The hash of the password is
+// generated using the parameters the stored hash was generated with.
+func (a *argonHasher) Compare(hash, salt, password []byte, params hashParams) error {
+	if len(hash) == 0 || params.Time == 0 || params.Threads == 0 {
+		return errors.New("stored hash is invalid")
 	}
 
-	if !bytes.Equal(hash, hashSalt.hash) {
+	candidate := argon2.IDKey(password, salt, params.Time, params.Memory, params.Threads, uint32(len(hash)))
+	if subtle.ConstantTimeCompare(hash, candidate) != 1 {
 		return errors.New("hash doesn't match")
 	}
 	return nil
 }
 
+// NeedsRehash returns true if the stored hash was not
+// generated using the current parameters of the hasher.
+func (a *argonHasher) NeedsRehash(hash, salt []byte, params hashParams) bool {
+	return params != a.params() || uint32(len(hash)) != a.keyLen || uint32(len(salt)) != a.saltLen
+}
+
+func (a *argonHasher) params() hashParams {
+	return hashParams{Time: a.time, Memory: a.memory, Threads: a.threads}
+}
+
 // randomSecret generates a random byte slice of the
 // requested length. This is used to create random
 // salts for the hashing of passwords.
@@ -0,0 +1,62 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+var ErrIdentityLinked = errors.New("identity is already linked to a user")
+
+// GetWithIdentity returns the user which the external identity (the issuer and
+// subject of an OpenID Connect identity provider) has been linked to.
+func (store *Store) GetWithIdentity(db database.Queryable, issuer string, subject string) (*User, error) {
+	query, args, err := selectUserBuilder().
+		InnerJoin("user_identities ON user_identities.user_id = users.id").
+		Where("user_identities.issuer=? AND user_identities.subject=?", issuer, subject).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct select user query: %w", err)
+	}
+
+	var user userModel
+	if err := db.Get(&user, db.Rebind(query), args...); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return userModelToUser(&user), nil
+}
+
+func (store *Store) GetWithUsername(db database.Queryable, username []byte) (*User, error) {
+	query, args, err := selectUserBuilder().Where("users.username=?", username).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct select user query: %w", err)
+	}
+
+	var user userModel
+	if err := db.Get(&user, db.Rebind(query), args...); err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return userModelToUser(&user), nil
+}
+
+// LinkIdentity links the external identity provided to the user, allowing the
+// user to login via the identity provider. An identity can only be linked
+// to a single user, however a user may have many identities.
+func (store *Store) LinkIdentity(db database.Queryable, userID uuid.UUID, issuer string, subject string) error {
+	if _, err := db.Exec(`
+		INSERT INTO user_identities(user_id, issuer, subject, created_at)
+		VALUES ($1, $2, $3, current_timestamp)
+	`, userID, issuer, subject); err != nil {
+		if isUniqueViolation(err) {
+			return ErrIdentityLinked
+		}
+
+		return fmt.Errorf("failed to link identity to user %s: %w", userID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package user
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+const (
+	FailedLoginInvalidCredentials FailedLoginReason = "invalid_credentials"
+	FailedLoginInvalidMFACode     FailedLoginReason = "invalid_mfa_code"
+	FailedLoginUserLocked         FailedLoginReason = "user_locked"
+)
+
+type (
+	// LoginPolicy contains the configuration used to protect against
+	// brute-force attacks against the passwords of users.
+	LoginPolicy struct {
+		// Once this many consecutive logins have failed for a single IP address (or for
+		// a single username), further attempts are delayed exponentially (starting at one
+		// second, and doubling with each failure) up to the maximum delay.
+		ThrottleThreshold       int `toml:"throttle_threshold" env-default:"3"`
+		ThrottleMaxDelaySeconds int `toml:"throttle_max_delay_seconds" env-default:"300"`
+
+		// Once this many consecutive logins have failed for a user, the user is locked
+		// (and cannot login, even with the correct password) for the lockout duration. A
+		// value of zero disables lockout. Administrators can unlock users early.
+		MaxFailedAttempts int `toml:"max_failed_attempts" env-default:"10"`
+		LockoutMinutes    int `toml:"lockout_minutes" env-default:"15"`
+	}
+
+	FailedLoginReason string
+
+	// FailedLogin is an audit record of a failed login attempt. The
+	// UserID is only set if the username matched an existing user.
+	FailedLogin struct {
+		ID        uuid.UUID         `db:"id"`
+		CreatedAt time.Time         `db:"created_at"`
+		Username  string            `db:"username"`
+		UserID    *uuid.UUID        `db:"user_id"`
+		IPAddress *string           `db:"ip_address"`
+		UserAgent *string           `db:"user_agent"`
+		Reason    FailedLoginReason `db:"reason"`
+	}
+
+	// lockoutState is the subset of a user which tracks their failed logins.
+	lockoutState struct {
+		ID               uuid.UUID  `db:"id"`
+		FailedLoginCount int        `db:"failed_login_count"`
+		LockedUntil      *time.Time `db:"locked_until"`
+	}
+)
+
+// RecordFailedLogin increments the number of consecutive failed logins for the user with the
+// username provided (if any). If the user has now reached the maximum number of failed logins
+// allowed by the policy, the user is locked and their failed login count is reset. The ID of the
+// user is returned (nil if no user exists with the username), along with the time until which
+// the user is locked (nil if the user is not locked). A policy with a MaxFailedAttempts of zero never locks users.
+//
+// NB: This must be called within a transaction, as the row of the user is locked until it has been updated.
+func (store *Store) RecordFailedLogin(db database.Queryable, username []byte, policy LoginPolicy) (*uuid.UUID, *time.Time, error) {
+	var result lockoutState
+	if err := db.Get(&result, `SELECT id, failed_login_count, locked_until FROM users WHERE username=$1 FOR UPDATE`, username); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, nil
+		}
+
+		return nil, nil, fmt.Errorf("failed to record failed login for %s: %w", username, err)
+	}
+
+	now := time.Now()
+	failedLoginCount, lockedUntil := policy.recordFailure(result.FailedLoginCount, result.LockedUntil, now)
+	if _, err := db.Exec(`UPDATE users SET failed_login_count=$2, locked_until=$3 WHERE id=$1`, result.ID, failedLoginCount, lockedUntil); err != nil {
+		return nil, nil, fmt.Errorf("failed to record failed login for %s: %w", username, err)
+	}
+
+	if lockedUntil != nil && lockedUntil.After(now) {
+		return &result.ID, lockedUntil, nil
+	}
+
+	return &result.ID, nil, nil
+}
+
+// recordFailure returns the failed login count, and the time until which the user is locked, after
+// a further failed login by a user with the count and lock provided. Once the count reaches the maximum
+// number of failed logins allowed, the user is locked for the lockout duration and the count is reset.
+func (policy LoginPolicy) recordFailure(failedLoginCount int, lockedUntil *time.Time, now time.Time) (int, *time.Time) {
+	failedLoginCount++
+	if policy.MaxFailedAttempts <= 0 || failedLoginCount < policy.MaxFailedAttempts {
+		return failedLoginCount, lockedUntil
+	}
+
+	until := now.Add(time.Duration(policy.LockoutMinutes) * time.Minute)
+	return 0, &until
+}
+
+func (store *Store) SaveFailedLogin(db database.Queryable, attempt *FailedLogin) error {
+	_, err := db.NamedExec(`
+		INSERT INTO failed_logins(id, created_at, username, user_id, ip_address, user_agent, reason)
+		VALUES (:id, :created_at, :username, :user_id, :ip_address, :user_agent, :reason)
+	`, attempt)
+	return err
+}
+
+// ListFailedLogins returns the most recent failed logins (newest first), optionally
+// filtered to only those which attempted to login as the user with the ID provided.
+func (store *Store) ListFailedLogins(db database.Queryable, userID *uuid.UUID, limit uint64) ([]*FailedLogin, error) {
+	builder := squirrel.Select("*").From("failed_logins").OrderBy("created_at DESC").Limit(limit)
+	if userID != nil {
+		builder = builder.Where("user_id=?", *userID)
+	}
+
+	query, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct list failed logins query: %w", err)
+	}
+
+	var results []*FailedLogin
+	if err := db.Select(&results, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Unlock removes any lock on the user, and resets their count of failed logins.
+func (store *Store) Unlock(db database.Queryable, userID uuid.UUID) error {
+	res, err := db.Exec(`UPDATE users SET failed_login_count=0, locked_until=NULL, updated_at=current_timestamp WHERE id=$1`, userID)
+	return checkUserAffected(res, err, userID)
+}
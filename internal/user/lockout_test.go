@@ -0,0 +1,160 @@
+package user
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+)
+
+// fakeLockoutDB is an in-memory stand-in for the users table, implementing
+// only the queries used by RecordFailedLogin.
+type fakeLockoutDB struct {
+	database.Queryable
+	id               uuid.UUID
+	username         string
+	failedLoginCount int
+	lockedUntil      *time.Time
+}
+
+func (db *fakeLockoutDB) Get(dest interface{}, query string, args ...interface{}) error {
+	if !strings.Contains(query, "FROM users") || string(args[0].([]byte)) != db.username {
+		return sql.ErrNoRows
+	}
+
+	result := dest.(*lockoutState)
+	result.ID, result.FailedLoginCount, result.LockedUntil = db.id, db.failedLoginCount, db.lockedUntil
+	return nil
+}
+
+func (db *fakeLockoutDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if !strings.Contains(query, "UPDATE users SET failed_login_count") || args[0].(uuid.UUID) != db.id {
+		return nil, errors.New("unexpected query")
+	}
+
+	db.failedLoginCount, db.lockedUntil = args[1].(int), args[2].(*time.Time)
+	return driver.RowsAffected(1), nil
+}
+
+func TestLoginPolicy_RecordFailure(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	policy := LoginPolicy{MaxFailedAttempts: 3, LockoutMinutes: 15}
+
+	tests := []struct {
+		name                string
+		policy              LoginPolicy
+		failedLoginCount    int
+		lockedUntil         *time.Time
+		expectedCount       int
+		expectedLockedUntil *time.Time
+	}{
+		{"first failure", policy, 0, nil, 1, nil},
+		{"below threshold", policy, 1, nil, 2, nil},
+		{"reaches threshold", policy, 2, nil, 0, ptr(now.Add(15 * time.Minute))},
+		{"expired lock is retained below threshold", policy, 0, &expired, 1, &expired},
+		{"expired lock is replaced at threshold", policy, 2, &expired, 0, ptr(now.Add(15 * time.Minute))},
+		{"lockout disabled", LoginPolicy{MaxFailedAttempts: 0, LockoutMinutes: 15}, 100, nil, 101, nil},
+		{"single attempt allowed", LoginPolicy{MaxFailedAttempts: 1, LockoutMinutes: 5}, 0, nil, 0, ptr(now.Add(5 * time.Minute))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			count, lockedUntil := test.policy.recordFailure(test.failedLoginCount, test.lockedUntil, now)
+			if count != test.expectedCount {
+				t.Errorf("expected failed login count %d, got %d", test.expectedCount, count)
+			}
+
+			if (lockedUntil == nil) != (test.expectedLockedUntil == nil) || (lockedUntil != nil && !lockedUntil.Equal(*test.expectedLockedUntil)) {
+				t.Errorf("expected locked until %v, got %v", test.expectedLockedUntil, lockedUntil)
+			}
+		})
+	}
+}
+
+func TestRecordFailedLogin_LocksAtThreshold(t *testing.T) {
+	db := &fakeLockoutDB{id: uuid.New(), username: "alice"}
+	policy := LoginPolicy{MaxFailedAttempts: 3, LockoutMinutes: 15}
+	store := &Store{}
+
+	for attempt := 1; attempt < policy.MaxFailedAttempts; attempt++ {
+		id, lockedUntil, err := store.RecordFailedLogin(db, []byte("alice"), policy)
+		if err != nil {
+			t.Fatalf("attempt %d: unexpected error %v", attempt, err)
+		}
+		if id == nil || *id != db.id {
+			t.Fatalf("attempt %d: expected user ID %s, got %v", attempt, db.id, id)
+		}
+		if lockedUntil != nil {
+			t.Fatalf("attempt %d: expected user to not be locked, but locked until %s", attempt, lockedUntil)
+		}
+	}
+
+	before := time.Now()
+	_, lockedUntil, err := store.RecordFailedLogin(db, []byte("alice"), policy)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if lockedUntil == nil || lockedUntil.Before(before.Add(15*time.Minute)) || lockedUntil.After(time.Now().Add(15*time.Minute)) {
+		t.Fatalf("expected user to be locked for 15 minutes, got %v", lockedUntil)
+	}
+	if db.failedLoginCount != 0 {
+		t.Errorf("expected failed login count to be reset once locked, got %d", db.failedLoginCount)
+	}
+	if usr := (&userBase{LockedUntil: db.lockedUntil}); !usr.IsLocked() {
+		t.Errorf("expected user to be locked")
+	}
+}
+
+func TestRecordFailedLogin_ExpiredLock(t *testing.T) {
+	expired := time.Now().Add(-time.Minute)
+	db := &fakeLockoutDB{id: uuid.New(), username: "alice", lockedUntil: &expired}
+
+	_, lockedUntil, err := (&Store{}).RecordFailedLogin(db, []byte("alice"), LoginPolicy{MaxFailedAttempts: 3, LockoutMinutes: 15})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if lockedUntil != nil {
+		t.Errorf("expected expired lock to be ignored, got locked until %s", lockedUntil)
+	}
+	if db.failedLoginCount != 1 {
+		t.Errorf("expected failed login count of 1, got %d", db.failedLoginCount)
+	}
+}
+
+func TestRecordFailedLogin_UnknownUser(t *testing.T) {
+	db := &fakeLockoutDB{id: uuid.New(), username: "alice"}
+
+	id, lockedUntil, err := (&Store{}).RecordFailedLogin(db, []byte("bob"), LoginPolicy{MaxFailedAttempts: 1, LockoutMinutes: 15})
+	if err != nil || id != nil || lockedUntil != nil {
+		t.Errorf("expected no user, lock or error, got (%v, %v, %v)", id, lockedUntil, err)
+	}
+}
+
+func TestUserIsLocked(t *testing.T) {
+	past, future := time.Now().Add(-time.Second), time.Now().Add(time.Minute)
+	tests := []struct {
+		name        string
+		lockedUntil *time.Time
+		expected    bool
+	}{
+		{"never locked", nil, false},
+		{"lock expired", &past, false},
+		{"lock active", &future, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (&userBase{LockedUntil: test.lockedUntil}).IsLocked(); got != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,272 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+	"github.com/hbomb79/Thea/pkg/totp"
+)
+
+const (
+	recoveryCodeCount = 10
+
+	// The alphabet used for recovery codes, which excludes characters which
+	// are easily confused (0/o, 1/l/i). Each code is two groups of five characters.
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 10
+
+	// The number of steps either side of the current step for
+	// which TOTP codes are accepted, allowing for clock drift.
+	totpSkew = 1
+)
+
+var (
+	ErrMFANotEnrolled     = errors.New("user has not enrolled in two-factor authentication")
+	ErrMFAAlreadyEnrolled = errors.New("user has already enrolled in two-factor authentication")
+	ErrMFACodeInvalid     = errors.New("two-factor authentication code is invalid")
+)
+
+type (
+	// MFAPolicy determines which users are required to enrol in two-factor authentication. Users
+	// which are required to enrol, but have not yet done so, are restricted to the endpoints
+	// which require no permissions (which includes the enrolment endpoints).
+	MFAPolicy struct {
+		// Users which hold any of these permissions (directly, or via a role) must enrol
+		RequiredForPermissions []string `toml:"required_for_permissions"`
+	}
+
+	// TOTP is the time-based one-time password enrolment of a user. The
+	// enrolment is only active once it has been confirmed.
+	TOTP struct {
+		UserID       uuid.UUID  `db:"user_id"`
+		Secret       []byte     `db:"secret" json:"-"`
+		CreatedAt    time.Time  `db:"created_at"`
+		ConfirmedAt  *time.Time `db:"confirmed_at"`
+		LastUsedStep int64      `db:"last_used_step"`
+	}
+)
+
+// Requires returns true if the policy requires a user with the
+// permissions provided to enrol in two-factor authentication.
+func (policy *MFAPolicy) Requires(permissions []string) bool {
+	return slices.ContainsFunc(policy.RequiredForPermissions, func(p string) bool { return slices.Contains(permissions, p) })
+}
+
+// SaveTOTPEnrolment begins the TOTP enrolment of the user, replacing any existing
+// unconfirmed enrolment. If the user has a confirmed enrolment, ErrMFAAlreadyEnrolled is returned.
+func (store *Store) SaveTOTPEnrolment(db database.Queryable, userID uuid.UUID, secret []byte) error {
+	res, err := db.Exec(`
+		INSERT INTO users_totp(user_id, secret, created_at, confirmed_at, last_used_step)
+		VALUES ($1, $2, current_timestamp, NULL, 0)
+		ON CONFLICT(user_id) DO UPDATE
+			SET secret=EXCLUDED.secret, created_at=EXCLUDED.created_at, last_used_step=0
+			WHERE users_totp.confirmed_at IS NULL
+	`, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP enrolment for user %s: %w", userID, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to save TOTP enrolment for user %s: %w", userID, err)
+	} else if affected == 0 {
+		return ErrMFAAlreadyEnrolled
+	}
+
+	return nil
+}
+
+func (store *Store) GetTOTP(db database.Queryable, userID uuid.UUID) (*TOTP, error) {
+	var enrolment TOTP
+	if err := db.Get(&enrolment, `SELECT * FROM users_totp WHERE user_id=$1`, userID); err != nil {
+		return nil, ErrMFANotEnrolled
+	}
+
+	return &enrolment, nil
+}
+
+// ConfirmTOTPEnrolment completes the pending TOTP enrolment of the user, if the code provided
+// is valid for the secret of the enrolment. The step of the code is recorded, so that it cannot
+// be used again.
+func (store *Store) ConfirmTOTPEnrolment(db database.Queryable, userID uuid.UUID, code string) error {
+	enrolment, err := store.GetTOTP(db, userID)
+	if err != nil {
+		return err
+	} else if enrolment.ConfirmedAt != nil {
+		return ErrMFAAlreadyEnrolled
+	}
+
+	step, ok := totp.Validate(enrolment.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrMFACodeInvalid
+	}
+
+	res, err := db.Exec(`
+		UPDATE users_totp SET confirmed_at=current_timestamp, last_used_step=$2
+		WHERE user_id=$1 AND confirmed_at IS NULL
+	`, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to confirm TOTP enrolment for user %s: %w", userID, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to confirm TOTP enrolment for user %s: %w", userID, err)
+	} else if affected == 0 {
+		return ErrMFAAlreadyEnrolled
+	}
+
+	return nil
+}
+
+// VerifyMFACode checks the code provided against the confirmed TOTP enrolment of the user. If the
+// code is not a valid TOTP code, it is checked against the unused recovery codes of the user. Each
+// code can only be used once; ErrMFACodeInvalid is returned if the code is invalid (or has been used).
+func (store *Store) VerifyMFACode(db database.Queryable, userID uuid.UUID, code string) error {
+	enrolment, err := store.GetTOTP(db, userID)
+	if err != nil || enrolment.ConfirmedAt == nil {
+		return ErrMFANotEnrolled
+	}
+
+	if step, ok := totp.Validate(enrolment.Secret, code, time.Now(), totpSkew); ok {
+		if !enrolment.acceptsStep(step) {
+			return ErrMFACodeInvalid
+		}
+
+		// Only record the code if it's still newer than the last accepted
+		// code, which guards against concurrent use of the same code
+		res, err := db.Exec(`UPDATE users_totp SET last_used_step=$2 WHERE user_id=$1 AND last_used_step < $2`, userID, step)
+		if err != nil {
+			return fmt.Errorf("failed to record TOTP usage for user %s: %w", userID, err)
+		}
+
+		if affected, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to record TOTP usage for user %s: %w", userID, err)
+		} else if affected == 0 {
+			return ErrMFACodeInvalid
+		}
+
+		return nil
+	}
+
+	res, err := db.Exec(`
+		UPDATE users_recovery_codes SET used_at=current_timestamp
+		WHERE user_id=$1 AND hash=$2 AND used_at IS NULL
+	`, userID, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to record recovery code usage for user %s: %w", userID, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to record recovery code usage for user %s: %w", userID, err)
+	} else if affected == 0 {
+		return ErrMFACodeInvalid
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes generates new recovery codes for the user, replacing all
+// existing recovery codes. The codes are returned, and must be shown to the user as
+// they cannot be retrieved again.
+func (store *Store) ReplaceRecoveryCodes(db database.Queryable, userID uuid.UUID) ([]string, error) {
+	if _, err := db.Exec(`DELETE FROM users_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to drop recovery codes for user %s: %w", userID, err)
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := db.Exec(`
+			INSERT INTO users_recovery_codes(id, user_id, hash, created_at, used_at)
+			VALUES ($1, $2, $3, current_timestamp, NULL)
+		`, uuid.New(), userID, hashRecoveryCode(code)); err != nil {
+			return nil, fmt.Errorf("failed to save recovery code for user %s: %w", userID, err)
+		}
+
+		codes[i] = code
+	}
+
+	return codes, nil
+}
+
+func (store *Store) CountUnusedRecoveryCodes(db database.Queryable, userID uuid.UUID) (int, error) {
+	var count int
+	if err := db.Get(&count, `SELECT COUNT(*) FROM users_recovery_codes WHERE user_id=$1 AND used_at IS NULL`, userID); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes for user %s: %w", userID, err)
+	}
+
+	return count, nil
+}
+
+// DeleteMFA removes the TOTP enrolment, and the recovery codes, of the user.
+func (store *Store) DeleteMFA(db database.Queryable, userID uuid.UUID) error {
+	if _, err := db.Exec(`DELETE FROM users_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return fmt.Errorf("failed to drop recovery codes for user %s: %w", userID, err)
+	}
+
+	res, err := db.Exec(`DELETE FROM users_totp WHERE user_id=$1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to drop TOTP enrolment for user %s: %w", userID, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to drop TOTP enrolment for user %s: %w", userID, err)
+	} else if affected == 0 {
+		return ErrMFANotEnrolled
+	}
+
+	return nil
+}
+
+// acceptsStep returns true if a TOTP code generated for the step provided can be accepted, which
+// is only the case if the step is newer than that of the last accepted code. This prevents a code
+// (or any older code within the skew window) from being replayed once a code has been used.
+func (enrolment *TOTP) acceptsStep(step int64) bool {
+	return step > enrolment.LastUsedStep
+}
+
+// newRecoveryCode generates a random recovery code, formatted as two
+// groups of five characters separated by a hyphen (e.g. 'k7mq2-xv9dr').
+func newRecoveryCode() (string, error) {
+	raw := make([]byte, recoveryCodeLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+
+	var code strings.Builder
+	for i, b := range raw {
+		if i == recoveryCodeLength/2 {
+			code.WriteByte('-')
+		}
+
+		// NB: The modulo bias here is negligible given the length of the code
+		code.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+
+	return code.String(), nil
+}
+
+// hashRecoveryCode normalises the recovery code provided (ignoring case,
+// hyphens and whitespace) and returns the SHA-256 hash of the result.
+func hashRecoveryCode(code string) []byte {
+	normalised := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+
+	hash := sha256.Sum256([]byte(normalised))
+	return hash[:]
+}
@@ -0,0 +1,214 @@
+package user
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+	"github.com/hbomb79/Thea/pkg/totp"
+)
+
+// fakeMFADB is an in-memory stand-in for the users_totp and users_recovery_codes tables,
+// implementing only the queries used by VerifyMFACode.
+type fakeMFADB struct {
+	database.Queryable
+	enrolment     *TOTP
+	recoveryCodes map[string]bool // keyed by hash, true once used
+}
+
+func newFakeMFADB(t *testing.T, enrolment *TOTP, recoveryCodes ...string) *fakeMFADB {
+	t.Helper()
+
+	db := &fakeMFADB{enrolment: enrolment, recoveryCodes: make(map[string]bool)}
+	for _, code := range recoveryCodes {
+		db.recoveryCodes[string(hashRecoveryCode(code))] = false
+	}
+
+	return db
+}
+
+func (db *fakeMFADB) Get(dest interface{}, query string, args ...interface{}) error {
+	if db.enrolment == nil || !strings.Contains(query, "users_totp") {
+		return sql.ErrNoRows
+	}
+
+	*dest.(*TOTP) = *db.enrolment
+	return nil
+}
+
+func (db *fakeMFADB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	switch {
+	case strings.Contains(query, "UPDATE users_totp SET last_used_step"):
+		step := args[1].(int64)
+		if step <= db.enrolment.LastUsedStep {
+			return driver.RowsAffected(0), nil
+		}
+
+		db.enrolment.LastUsedStep = step
+		return driver.RowsAffected(1), nil
+	case strings.Contains(query, "UPDATE users_recovery_codes SET used_at"):
+		hash := string(args[1].([]byte))
+		if used, ok := db.recoveryCodes[hash]; !ok || used {
+			return driver.RowsAffected(0), nil
+		}
+
+		db.recoveryCodes[hash] = true
+		return driver.RowsAffected(1), nil
+	}
+
+	return nil, errors.New("unexpected query")
+}
+
+func confirmedEnrolment(secret []byte, lastUsedStep int64) *TOTP {
+	confirmedAt := time.Now()
+	return &TOTP{UserID: uuid.New(), Secret: secret, ConfirmedAt: &confirmedAt, LastUsedStep: lastUsedStep}
+}
+
+// currentStep returns the current TOTP step, first waiting for the next step if the current
+// step is about to end (so that the step does not change while the test is running).
+func currentStep() int64 {
+	now := time.Now()
+	stepEnd := time.Unix((totp.Step(now)+1)*int64(totp.Period.Seconds()), 0)
+	if remaining := stepEnd.Sub(now); remaining < time.Second {
+		time.Sleep(remaining)
+	}
+
+	return totp.Step(time.Now())
+}
+
+func TestVerifyMFACode_TOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	current := currentStep()
+
+	tests := []struct {
+		name         string
+		lastUsedStep int64
+		step         int64
+		expectedErr  error
+	}{
+		{"current step", 0, current, nil},
+		{"previous step within skew", 0, current - 1, nil},
+		{"next step within skew", 0, current + 1, nil},
+		{"step outside skew", 0, current - totpSkew - 1, ErrMFACodeInvalid},
+		{"step already used", current, current, ErrMFACodeInvalid},
+		{"step older than last used step", current, current - 1, ErrMFACodeInvalid},
+		{"step newer than last used step", current - 1, current, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db := newFakeMFADB(t, confirmedEnrolment(secret, test.lastUsedStep))
+			err := (&Store{}).VerifyMFACode(db, db.enrolment.UserID, totp.Code(secret, test.step))
+			if !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected error %v, got %v", test.expectedErr, err)
+			}
+
+			if err == nil && db.enrolment.LastUsedStep != test.step {
+				t.Errorf("expected last used step to be recorded as %d, got %d", test.step, db.enrolment.LastUsedStep)
+			}
+		})
+	}
+}
+
+func TestVerifyMFACode_TOTPReplay(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	db := newFakeMFADB(t, confirmedEnrolment(secret, 0))
+	code := totp.Code(secret, currentStep())
+
+	store := &Store{}
+	if err := store.VerifyMFACode(db, db.enrolment.UserID, code); err != nil {
+		t.Fatalf("expected first use of code to succeed, got %v", err)
+	}
+	if err := store.VerifyMFACode(db, db.enrolment.UserID, code); !errors.Is(err, ErrMFACodeInvalid) {
+		t.Fatalf("expected reuse of code to fail with %v, got %v", ErrMFACodeInvalid, err)
+	}
+}
+
+func TestVerifyMFACode_NotEnrolled(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	code := totp.Code(secret, currentStep())
+
+	unconfirmed := confirmedEnrolment(secret, 0)
+	unconfirmed.ConfirmedAt = nil
+
+	for name, enrolment := range map[string]*TOTP{"no enrolment": nil, "unconfirmed enrolment": unconfirmed} {
+		t.Run(name, func(t *testing.T) {
+			db := newFakeMFADB(t, enrolment)
+			if err := (&Store{}).VerifyMFACode(db, uuid.New(), code); !errors.Is(err, ErrMFANotEnrolled) {
+				t.Fatalf("expected error %v, got %v", ErrMFANotEnrolled, err)
+			}
+		})
+	}
+}
+
+func TestVerifyMFACode_RecoveryCodes(t *testing.T) {
+	const recoveryCode = "k7mq2-xv9dr"
+	db := newFakeMFADB(t, confirmedEnrolment([]byte("12345678901234567890"), 0), recoveryCode, "abcde-fghjk")
+
+	store := &Store{}
+	if err := store.VerifyMFACode(db, db.enrolment.UserID, recoveryCode); err != nil {
+		t.Fatalf("expected recovery code to be accepted, got %v", err)
+	}
+	if err := store.VerifyMFACode(db, db.enrolment.UserID, recoveryCode); !errors.Is(err, ErrMFACodeInvalid) {
+		t.Fatalf("expected reuse of recovery code to fail with %v, got %v", ErrMFACodeInvalid, err)
+	}
+	if err := store.VerifyMFACode(db, db.enrolment.UserID, "zzzzz-zzzzz"); !errors.Is(err, ErrMFACodeInvalid) {
+		t.Fatalf("expected unknown recovery code to fail with %v, got %v", ErrMFACodeInvalid, err)
+	}
+
+	// Using one code must not consume the others
+	if err := store.VerifyMFACode(db, db.enrolment.UserID, "ABCDE FGHJK"); err != nil {
+		t.Fatalf("expected other recovery code to be accepted, got %v", err)
+	}
+}
+
+func TestHashRecoveryCode_Normalisation(t *testing.T) {
+	expected := hashRecoveryCode("k7mq2-xv9dr")
+	tests := []string{
+		"k7mq2-xv9dr",
+		"K7MQ2-XV9DR",
+		"k7mq2xv9dr",
+		"k7mq2 xv9dr",
+		"  k7mq2-xv9dr\n",
+		"k7-mq2-xv-9dr",
+	}
+
+	for _, code := range tests {
+		if got := hashRecoveryCode(code); !bytes.Equal(got, expected) {
+			t.Errorf("expected %q to normalise to the same hash as k7mq2-xv9dr", code)
+		}
+	}
+
+	for _, code := range []string{"k7mq2-xv9dq", "k7mq2-xv9d", "k7mq2_xv9dr"} {
+		if got := hashRecoveryCode(code); bytes.Equal(got, expected) {
+			t.Errorf("expected %q to hash differently to k7mq2-xv9dr", code)
+		}
+	}
+}
+
+func TestNewRecoveryCode(t *testing.T) {
+	format := regexp.MustCompile(`^[` + recoveryCodeAlphabet + `]{5}-[` + recoveryCodeAlphabet + `]{5}$`)
+
+	seen := make(map[string]struct{})
+	for i := 0; i < 100; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			t.Fatalf("failed to generate recovery code: %v", err)
+		}
+
+		if !format.MatchString(code) {
+			t.Errorf("recovery code %q does not match the expected format", code)
+		}
+		if _, ok := seen[code]; ok {
+			t.Errorf("recovery code %q was generated more than once", code)
+		}
+		seen[code] = struct{}{}
+	}
+}
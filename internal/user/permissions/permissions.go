@@ -2,16 +2,25 @@ package permissions
 
 const (
 	AccessIngestsPermission          string = "ingest:access"
+	CreateIngestsPermission          string = "ingest:create"
 	ResolveTroubledIngestsPermission string = "ingest:modify"
 	DeleteIngestsPermission          string = "ingest:delete"
 	PollNewIngestsPermission         string = "ingest:poll"
+	UploadIngestsPermission          string = "ingest:upload"
 
 	AccessMediaPermission           string = "media:access"
 	DeleteMediaPermission           string = "media:delete"
+	RefreshMediaPermission          string = "media:refresh"
+	EditMediaPermission             string = "media:modify"
 	StreamTranscodedMediaPermission string = "media:stream.pre"
 	StreamSourceMediaPermission     string = "media:stream.source"
 	StreamOnTheFlyMediaPermission   string = "media:stream.otf"
 
+	CreateDownloadPermission string = "download:create"
+	AccessDownloadPermission string = "download:access"
+	ModifyDownloadPermission string = "download:modify"
+	DeleteDownloadPermission string = "download:delete"
+
 	CreateTranscodePermission string = "transcode:create"
 	AccessTranscodePermission string = "transcode:access"
 	ModifyTranscodePermission string = "transcode:modify"
@@ -31,19 +40,37 @@ const (
 	AccessUserPermission          string = "user:access"
 	EditUserPermissionsPermission string = "user:modify"
 	DeleteUserPermission          string = "user:delete"
+
+	CreateRolePermission string = "role:create"
+	AccessRolePermission string = "role:access"
+	EditRolePermission   string = "role:modify"
+	DeleteRolePermission string = "role:delete"
+
+	AccessSigningKeysPermission string = "signing-key:access"
+	RotateSigningKeysPermission string = "signing-key:rotate"
+
+	AccessAuditLogPermission string = "audit:access"
 )
 
 func All() []string {
 	return []string{
 		AccessIngestsPermission,
+		CreateIngestsPermission,
 		ResolveTroubledIngestsPermission,
 		DeleteIngestsPermission,
 		PollNewIngestsPermission,
+		UploadIngestsPermission,
 		AccessMediaPermission,
 		DeleteMediaPermission,
+		RefreshMediaPermission,
+		EditMediaPermission,
 		StreamTranscodedMediaPermission,
 		StreamSourceMediaPermission,
 		StreamOnTheFlyMediaPermission,
+		CreateDownloadPermission,
+		AccessDownloadPermission,
+		ModifyDownloadPermission,
+		DeleteDownloadPermission,
 		CreateTranscodePermission,
 		AccessTranscodePermission,
 		ModifyTranscodePermission,
@@ -60,6 +87,13 @@ func All() []string {
 		AccessUserPermission,
 		EditUserPermissionsPermission,
 		DeleteUserPermission,
+		CreateRolePermission,
+		AccessRolePermission,
+		EditRolePermission,
+		DeleteRolePermission,
+		AccessSigningKeysPermission,
+		RotateSigningKeysPermission,
+		AccessAuditLogPermission,
 	}
 }
 
@@ -0,0 +1,53 @@
+package permissions
+
+const (
+	AdminRole   string = "Admin"
+	CuratorRole string = "Curator"
+	ViewerRole  string = "Viewer"
+)
+
+// BuiltInRoles returns the roles which Thea seeds at startup, mapped to
+// the permissions of each role. The permissions of built-in roles are
+// kept in sync with this definition, and cannot be changed by users.
+func BuiltInRoles() map[string][]string {
+	return map[string][]string{
+		// Admins are able to do everything
+		AdminRole: All(),
+
+		// Curators manage the media library (ingestion, downloads,
+		// transcoding, etc), but cannot manage users or Thea's configuration
+		CuratorRole: {
+			AccessIngestsPermission,
+			CreateIngestsPermission,
+			ResolveTroubledIngestsPermission,
+			DeleteIngestsPermission,
+			PollNewIngestsPermission,
+			UploadIngestsPermission,
+			AccessMediaPermission,
+			DeleteMediaPermission,
+			RefreshMediaPermission,
+			EditMediaPermission,
+			StreamTranscodedMediaPermission,
+			StreamSourceMediaPermission,
+			StreamOnTheFlyMediaPermission,
+			CreateDownloadPermission,
+			AccessDownloadPermission,
+			ModifyDownloadPermission,
+			DeleteDownloadPermission,
+			CreateTranscodePermission,
+			AccessTranscodePermission,
+			ModifyTranscodePermission,
+			DeleteTranscodePermission,
+			AccessTargetPermission,
+			AccessWorkflowPermission,
+		},
+
+		// Viewers are only able to browse and stream media
+		ViewerRole: {
+			AccessMediaPermission,
+			StreamTranscodedMediaPermission,
+			StreamSourceMediaPermission,
+			StreamOnTheFlyMediaPermission,
+		},
+	}
+}
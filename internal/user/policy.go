@@ -0,0 +1,63 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var ErrPasswordPolicyViolation = errors.New("password does not satisfy password policy")
+
+// PasswordPolicy contains the requirements that passwords must satisfy
+// when users are created, or when the password of a user is changed.
+type PasswordPolicy struct {
+	// The minimum and maximum number of characters a password
+	// may contain. A maximum of zero allows passwords of any length.
+	MinLength int `toml:"min_length" env-default:"8"`
+	MaxLength int `toml:"max_length" env-default:"256"`
+
+	RequireUppercase bool `toml:"require_uppercase" env-default:"false"`
+	RequireLowercase bool `toml:"require_lowercase" env-default:"false"`
+	RequireDigit     bool `toml:"require_digit" env-default:"false"`
+	RequireSymbol    bool `toml:"require_symbol" env-default:"false"`
+
+	// Disallows passwords which contain the username of the user (ignoring case).
+	DisallowUsername bool `toml:"disallow_username" env-default:"true"`
+}
+
+// Validate checks the password provided against the policy, returning
+// an error describing the first unmet requirement (wrapping ErrPasswordPolicyViolation).
+func (policy *PasswordPolicy) Validate(username string, rawPassword []byte) error {
+	password := string(rawPassword)
+	length := len([]rune(password))
+	if length < policy.MinLength {
+		return fmt.Errorf("%w: must contain at least %d characters", ErrPasswordPolicyViolation, policy.MinLength)
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		return fmt.Errorf("%w: must contain at most %d characters", ErrPasswordPolicyViolation, policy.MaxLength)
+	}
+
+	if policy.RequireUppercase && !strings.ContainsFunc(password, unicode.IsUpper) {
+		return fmt.Errorf("%w: must contain an uppercase letter", ErrPasswordPolicyViolation)
+	}
+	if policy.RequireLowercase && !strings.ContainsFunc(password, unicode.IsLower) {
+		return fmt.Errorf("%w: must contain a lowercase letter", ErrPasswordPolicyViolation)
+	}
+	if policy.RequireDigit && !strings.ContainsFunc(password, unicode.IsDigit) {
+		return fmt.Errorf("%w: must contain a digit", ErrPasswordPolicyViolation)
+	}
+	if policy.RequireSymbol && !strings.ContainsFunc(password, isSymbol) {
+		return fmt.Errorf("%w: must contain a symbol", ErrPasswordPolicyViolation)
+	}
+
+	if policy.DisallowUsername && username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return fmt.Errorf("%w: must not contain the username", ErrPasswordPolicyViolation)
+	}
+
+	return nil
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+	"github.com/hbomb79/Thea/internal/media"
+	"github.com/lib/pq"
+)
+
+// AccessRestrictions restrict the media which is visible to a user. Note that the JSON
+// representation of this type is embedded in the access tokens of the user, and so must
+// distinguish between a nil AllowedLibraries (all libraries) and an empty one (no libraries).
+type AccessRestrictions struct {
+	// AllowedLibraries are the library directories the user may access media from. A
+	// nil value allows access to all libraries.
+	AllowedLibraries pq.StringArray `db:"allowed_libraries" json:"allowed_libraries"`
+
+	// MaxContentRating is the maximum content rating age of the media the user
+	// may access. Unrated media is inaccessible if this is set.
+	MaxContentRating *int `db:"max_content_rating" json:"max_content_rating,omitempty"`
+
+	// HideAdultContent causes adult media to be inaccessible to the user
+	HideAdultContent bool `db:"hide_adult_content" json:"hide_adult_content,omitempty"`
+}
+
+// IsRestricted returns true if these restrictions restrict access to any media.
+func (restrictions *AccessRestrictions) IsRestricted() bool {
+	return restrictions.AllowedLibraries != nil || restrictions.MaxContentRating != nil || restrictions.HideAdultContent
+}
+
+// MediaFilter returns the media access filter for these restrictions, or
+// nil if these restrictions do not restrict access to any media.
+func (restrictions *AccessRestrictions) MediaFilter() *media.AccessFilter {
+	if restrictions == nil || !restrictions.IsRestricted() {
+		return nil
+	}
+
+	return &media.AccessFilter{
+		AllowedLibraries: restrictions.AllowedLibraries,
+		MaxContentRating: restrictions.MaxContentRating,
+		HideAdult:        restrictions.HideAdultContent,
+	}
+}
+
+// UpdateAccessRestrictions replaces the access restrictions of the user with the ID provided.
+func (store *Store) UpdateAccessRestrictions(db database.Queryable, userID uuid.UUID, restrictions AccessRestrictions) error {
+	res, err := db.Exec(`
+		UPDATE users
+		SET allowed_libraries=$1, max_content_rating=$2, hide_adult_content=$3, updated_at=current_timestamp
+		WHERE id=$4
+	`, restrictions.AllowedLibraries, restrictions.MaxContentRating, restrictions.HideAdultContent, userID)
+	return checkUserAffected(res, err, userID)
+}
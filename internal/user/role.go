@@ -0,0 +1,229 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/hbomb79/Thea/internal/database"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	ErrRoleNotFound   = errors.New("role does not exist")
+	ErrRoleLabelTaken = errors.New("label is already in use by another role")
+	ErrRoleBuiltIn    = errors.New("built-in roles cannot be modified")
+)
+
+type (
+	roleBase struct {
+		ID        uuid.UUID `db:"id"`
+		Label     string    `db:"label"`
+		CreatedAt time.Time `db:"created_at"`
+		UpdatedAt time.Time `db:"updated_at"`
+
+		// BuiltIn roles are seeded by Thea at startup,
+		// and cannot be modified or deleted by users.
+		BuiltIn bool `db:"built_in"`
+	}
+
+	roleModel struct {
+		roleBase
+		Permissions database.JSONColumn[[]string] `db:"permissions"`
+	}
+
+	// Role is a named set of permissions which can be assigned to users. The
+	// effective permissions of a user include the permissions of all of their roles.
+	Role struct {
+		roleBase
+		Permissions []string
+	}
+)
+
+func (store *Store) ListRoles(db database.Queryable) ([]*Role, error) {
+	query, args, err := selectRoleBuilder().OrderBy("roles.label").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct list roles query: %w", err)
+	}
+
+	var results []roleModel
+	if err := db.Select(&results, query, args...); err != nil {
+		return nil, err
+	}
+
+	output := make([]*Role, len(results))
+	for i := range results {
+		output[i] = roleModelToRole(&results[i])
+	}
+
+	return output, nil
+}
+
+func (store *Store) GetRole(db database.Queryable, roleID uuid.UUID) (*Role, error) {
+	return store.getRoleWhere(db, squirrel.Eq{"roles.id": roleID})
+}
+
+func (store *Store) GetRoleWithLabel(db database.Queryable, label string) (*Role, error) {
+	return store.getRoleWhere(db, squirrel.Eq{"roles.label": label})
+}
+
+// CreateRole inserts a new role with the label provided. Returns ErrRoleLabelTaken
+// if a role already exists with this label.
+func (store *Store) CreateRole(db database.Queryable, label string) (*Role, error) {
+	var role roleBase
+	if err := db.Get(&role, `
+		INSERT INTO roles(id, created_at, updated_at, label, built_in)
+		VALUES ($1, current_timestamp, current_timestamp, $2, FALSE)
+		RETURNING *
+	`, uuid.New(), label); err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrRoleLabelTaken
+		}
+
+		return nil, fmt.Errorf("failed to insert new role: %w", err)
+	}
+
+	return &Role{role, []string{}}, nil
+}
+
+// SaveBuiltInRole upserts a built-in role with the label provided, returning
+// the role (including it's existing permissions).
+func (store *Store) SaveBuiltInRole(db database.Queryable, label string) (*Role, error) {
+	if _, err := db.Exec(`
+		INSERT INTO roles(id, created_at, updated_at, label, built_in)
+		VALUES ($1, current_timestamp, current_timestamp, $2, TRUE)
+		ON CONFLICT(label) DO UPDATE SET built_in=TRUE
+	`, uuid.New(), label); err != nil {
+		return nil, fmt.Errorf("failed to save built-in role %s: %w", label, err)
+	}
+
+	return store.GetRoleWithLabel(db, label)
+}
+
+func (store *Store) RenameRole(db database.Queryable, roleID uuid.UUID, label string) error {
+	res, err := db.Exec(`UPDATE roles SET label=$1, updated_at=current_timestamp WHERE id=$2`, label, roleID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrRoleLabelTaken
+		}
+
+		return fmt.Errorf("failed to rename role %s: %w", roleID, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to rename role %s: %w", roleID, err)
+	} else if affected == 0 {
+		return ErrRoleNotFound
+	}
+
+	return nil
+}
+
+// DeleteRole deletes the role provided, which also removes
+// the role (and it's permissions) from all users.
+func (store *Store) DeleteRole(db database.Queryable, roleID uuid.UUID) error {
+	if _, err := db.Exec(`DELETE FROM roles WHERE id=$1`, roleID); err != nil {
+		return fmt.Errorf("failed to delete role %s: %w", roleID, err)
+	}
+
+	return nil
+}
+
+func (store *Store) DropRolePermissions(db database.Queryable, roleID uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM roles_permissions WHERE role_id=$1`, roleID)
+	return err
+}
+
+func (store *Store) InsertRolePermissions(db database.Queryable, roleID uuid.UUID, permissions []Permission) error {
+	_, err := db.NamedExec(`
+		INSERT INTO roles_permissions(role_id, permission_id)
+		VALUES('`+roleID.String()+`', :id)
+		ON CONFLICT(role_id, permission_id) DO NOTHING
+	`, permissions)
+	return err
+}
+
+func (store *Store) RecordRoleUpdate(db database.Queryable, roleID uuid.UUID) error {
+	_, err := db.Exec(`UPDATE roles SET updated_at=current_timestamp WHERE id=$1`, roleID)
+	return err
+}
+
+// ListUserIDsWithRole returns the IDs of all the users which have the role provided.
+func (store *Store) ListUserIDsWithRole(db database.Queryable, roleID uuid.UUID) ([]uuid.UUID, error) {
+	var userIDs []uuid.UUID
+	if err := db.Select(&userIDs, `SELECT user_id FROM users_roles WHERE role_id=$1`, roleID); err != nil {
+		return nil, fmt.Errorf("failed to select users with role %s: %w", roleID, err)
+	}
+
+	return userIDs, nil
+}
+
+func (store *Store) DropUserRoles(db database.Queryable, userID uuid.UUID) error {
+	_, err := db.Exec(`DELETE FROM users_roles WHERE user_id=$1`, userID)
+	return err
+}
+
+// InsertUserRoles assigns the roles provided to the user. Returns ErrRoleNotFound
+// if any of the roles provided do not exist.
+func (store *Store) InsertUserRoles(db database.Queryable, userID uuid.UUID, roleIDs []uuid.UUID) error {
+	query, args, err := sqlx.In(`SELECT COUNT(*) FROM roles WHERE id IN (?)`, roleIDs)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err := db.Get(&count, db.Rebind(query), args...); err != nil {
+		return err
+	} else if count != len(roleIDs) {
+		return ErrRoleNotFound
+	}
+
+	type userRole struct {
+		UserID uuid.UUID `db:"user_id"`
+		RoleID uuid.UUID `db:"role_id"`
+	}
+
+	rows := make([]userRole, len(roleIDs))
+	for k, v := range roleIDs {
+		rows[k] = userRole{userID, v}
+	}
+
+	_, err = db.NamedExec(`
+		INSERT INTO users_roles(user_id, role_id)
+		VALUES(:user_id, :role_id)
+		ON CONFLICT(user_id, role_id) DO NOTHING
+	`, rows)
+	return err
+}
+
+func (store *Store) getRoleWhere(db database.Queryable, pred squirrel.Eq) (*Role, error) {
+	query, args, err := selectRoleBuilder().Where(pred).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct select role query: %w", err)
+	}
+
+	var role roleModel
+	if err := db.Get(&role, db.Rebind(query), args...); err != nil {
+		return nil, ErrRoleNotFound
+	}
+
+	return roleModelToRole(&role), nil
+}
+
+func selectRoleBuilder() squirrel.SelectBuilder {
+	return squirrel.
+		Select("roles.*", "COALESCE(JSONB_AGG(DISTINCT permissions.label) FILTER (WHERE permissions.id IS NOT NULL), '[]') AS permissions").
+		From("roles").
+		LeftJoin("roles_permissions ON roles_permissions.role_id = roles.id").
+		LeftJoin("permissions ON permissions.id = roles_permissions.permission_id").
+		GroupBy("roles.id")
+}
+
+func roleModelToRole(model *roleModel) *Role {
+	return &Role{
+		roleBase:    model.roleBase,
+		Permissions: *model.Permissions.Get(),
+	}
+}
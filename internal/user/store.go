@@ -1,6 +1,7 @@
 package user
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"time"
@@ -9,9 +10,17 @@ import (
 	"github.com/google/uuid"
 	"github.com/hbomb79/Thea/internal/database"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
-var ErrUserNotFound = errors.New("user does not exist")
+const pgUniqueViolationCode = "23505"
+
+var (
+	ErrUserNotFound      = errors.New("user does not exist")
+	ErrUsernameTaken     = errors.New("username is already in use by another user")
+	ErrPasswordIncorrect = errors.New("password is incorrect")
+	ErrUserLocked        = errors.New("user is locked due to too many failed logins")
+)
 
 type (
 	userBase struct {
@@ -23,16 +32,33 @@ type (
 		UpdatedAt      time.Time  `db:"updated_at"`
 		LastLoginAt    *time.Time `db:"last_login"`
 		LastRefreshAt  *time.Time `db:"last_refresh"`
+
+		// PasswordChangeRequired indicates that the user must change their
+		// password before they're able to use Thea.
+		PasswordChangeRequired bool `db:"password_change_required"`
+
+		// The argon2 parameters the password of the user was hashed with
+		hashParams `json:"-"`
+
+		// FailedLoginCount is the number of consecutive failed logins for the user. Once
+		// too many logins have failed, the user is locked until LockedUntil has passed.
+		FailedLoginCount int        `db:"failed_login_count"`
+		LockedUntil      *time.Time `db:"locked_until"`
+
+		// AccessRestrictions restrict the media which is visible to the user
+		AccessRestrictions
 	}
 
 	// userModel is a combination of the users table columns, combined with
-	// a JSON representation of the coalesced permission rows which are
+	// a JSON representation of the coalesced permission (and role) rows which are
 	// joined in to the query. We use a separate struct as part of
 	// the public API of this store to hide the use of the JsonColumn container
 	// to prevent against breakages if we change this in the future.
 	userModel struct {
 		userBase
 		Permissions database.JSONColumn[[]string] `db:"permissions"`
+		Roles       database.JSONColumn[[]string] `db:"roles"`
+		MFAEnabled  bool                          `db:"mfa_enabled"`
 	}
 
 	// User is the external/public API for the user model. It uses a special
@@ -40,7 +66,17 @@ type (
 	// operations to be performed against the set of permissions.
 	User struct {
 		userBase
+
+		// Permissions are the effective permissions of the user, which is the union of the
+		// permissions assigned directly to the user, and the permissions of all of their roles.
 		Permissions []string
+
+		// Roles are the labels of the roles assigned to the user
+		Roles []string
+
+		// MFAEnabled is true if the user has a confirmed TOTP enrolment, and
+		// so must provide a TOTP (or recovery) code in order to login.
+		MFAEnabled bool
 	}
 
 	Store struct {
@@ -48,14 +84,13 @@ type (
 	}
 )
 
-func NewStore() *Store {
+func NewStore(config HashConfig) *Store {
 	return &Store{
-		// TODO figure out the best values for this
-		newArgon2IdHasher(1, 64, 64*1024, 1, 128),
+		newArgon2IdHasher(config.Time, config.SaltLength, config.MemoryKiB, config.Threads, config.KeyLength),
 	}
 }
 
-func (store *Store) Create(db database.Queryable, username []byte, rawPassword []byte) (*User, error) {
+func (store *Store) Create(db database.Queryable, username []byte, rawPassword []byte, passwordChangeRequired bool) (*User, error) {
 	hash, err := store.hasher.GenerateHash(rawPassword, []byte{})
 	if err != nil {
 		return nil, fmt.Errorf("provided password is invalid: %w", err)
@@ -63,14 +98,18 @@ func (store *Store) Create(db database.Queryable, username []byte, rawPassword [
 
 	var user userBase
 	if err := db.Get(&user, `
-		INSERT INTO users(id, username, password, salt, created_at, updated_at, last_login, last_refresh)
-		VALUES ($1, $2, $3, $4, current_timestamp, current_timestamp, NULL, NULL)
+		INSERT INTO users(id, username, password, salt, created_at, updated_at, last_login, last_refresh, password_change_required, password_time, password_memory, password_threads)
+		VALUES ($1, $2, $3, $4, current_timestamp, current_timestamp, NULL, NULL, $5, $6, $7, $8)
 		RETURNING *
-	`, uuid.New(), username, hash.hash, hash.salt); err != nil {
+	`, uuid.New(), username, hash.hash, hash.salt, passwordChangeRequired, hash.params.Time, hash.params.Memory, hash.params.Threads); err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrUsernameTaken
+		}
+
 		return nil, fmt.Errorf("failed to insert new user: %w", err)
 	}
 
-	return &User{user, []string{}}, nil
+	return &User{user, []string{}, []string{}, false}, nil
 }
 
 func (store *Store) List(db database.Queryable) ([]*User, error) {
@@ -95,7 +134,8 @@ func (store *Store) List(db database.Queryable) ([]*User, error) {
 // GetWithUsernameAndPassword finds a user with the matching
 // username and returns it IF and ONLY IF the raw (unhashed) password
 // provided is able to be hashed with the same salt as was used with
-// the existing user (if any), and the hashes MATCH.
+// the existing user (if any), and the hashes MATCH. If the user
+// is currently locked, ErrUserLocked is returned (without checking the password).
 func (store *Store) GetWithUsernameAndPassword(db database.Queryable, username []byte, rawPassword []byte) (*User, error) {
 	query, args, err := selectUserBuilder().Where("users.username=?", username).ToSql()
 	if err != nil {
@@ -107,7 +147,11 @@ func (store *Store) GetWithUsernameAndPassword(db database.Queryable, username [
 		return nil, fmt.Errorf("failed to find user with username %s: %w", username, err)
 	}
 
-	if err := store.hasher.Compare(user.HashedPassword, user.HashSalt, rawPassword); err != nil {
+	if user.IsLocked() {
+		return nil, fmt.Errorf("user %s cannot login: %w", username, ErrUserLocked)
+	}
+
+	if err := store.hasher.Compare(user.HashedPassword, user.HashSalt, rawPassword, user.hashParams); err != nil {
 		return nil, fmt.Errorf("password supplied for user %s is invalid: %w", username, err)
 	}
 
@@ -128,13 +172,84 @@ func (store *Store) GetWithID(db database.Queryable, id uuid.UUID) (*User, error
 	return userModelToUser(&user), nil
 }
 
+// VerifyPassword returns ErrPasswordIncorrect if the raw (unhashed) password
+// provided does not match the password of the user with the ID provided.
+func (store *Store) VerifyPassword(db database.Queryable, userID uuid.UUID, rawPassword []byte) error {
+	var user userBase
+	if err := db.Get(&user, `SELECT * FROM users WHERE id=$1`, userID); err != nil {
+		return ErrUserNotFound
+	}
+
+	if err := store.hasher.Compare(user.HashedPassword, user.HashSalt, rawPassword, user.hashParams); err != nil {
+		return ErrPasswordIncorrect
+	}
+
+	return nil
+}
+
+// UpdatePassword hashes the raw password provided (using a new salt) and stores
+// it against the user with the ID provided, along with whether the user
+// must change this password before they're able to use Thea.
+func (store *Store) UpdatePassword(db database.Queryable, userID uuid.UUID, rawPassword []byte, passwordChangeRequired bool) error {
+	hash, err := store.hasher.GenerateHash(rawPassword, []byte{})
+	if err != nil {
+		return fmt.Errorf("provided password is invalid: %w", err)
+	}
+
+	res, err := db.Exec(`
+		UPDATE users
+		SET password=$1, salt=$2, password_time=$3, password_memory=$4, password_threads=$5, password_change_required=$6, updated_at=current_timestamp
+		WHERE id=$7
+	`, hash.hash, hash.salt, hash.params.Time, hash.params.Memory, hash.params.Threads, passwordChangeRequired, userID)
+	return checkUserAffected(res, err, userID)
+}
+
+// PasswordNeedsRehash returns true if the password of the user provided was
+// hashed using different parameters to those currently configured.
+func (store *Store) PasswordNeedsRehash(user *User) bool {
+	return store.hasher.NeedsRehash(user.HashedPassword, user.HashSalt, user.hashParams)
+}
+
+// RehashPassword hashes the raw password provided using the currently configured
+// parameters, and stores it against the user. Unlike UpdatePassword, this is
+// not considered a change of the password of the user.
+func (store *Store) RehashPassword(db database.Queryable, userID uuid.UUID, rawPassword []byte) error {
+	hash, err := store.hasher.GenerateHash(rawPassword, []byte{})
+	if err != nil {
+		return fmt.Errorf("provided password is invalid: %w", err)
+	}
+
+	res, err := db.Exec(`
+		UPDATE users
+		SET password=$1, salt=$2, password_time=$3, password_memory=$4, password_threads=$5
+		WHERE id=$6
+	`, hash.hash, hash.salt, hash.params.Time, hash.params.Memory, hash.params.Threads, userID)
+	return checkUserAffected(res, err, userID)
+}
+
+func (store *Store) Rename(db database.Queryable, userID uuid.UUID, username []byte) error {
+	res, err := db.Exec(`UPDATE users SET username=$1, updated_at=current_timestamp WHERE id=$2`, username, userID)
+	if err != nil && isUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
+
+	return checkUserAffected(res, err, userID)
+}
+
+// Delete removes the user with the ID provided. The permissions of the
+// user must be dropped before the user can be deleted (see DropUserPermissions).
+func (store *Store) Delete(db database.Queryable, userID uuid.UUID) error {
+	res, err := db.Exec(`DELETE FROM users WHERE id=$1`, userID)
+	return checkUserAffected(res, err, userID)
+}
+
 func (store *Store) RecordUpdate(db database.Queryable, userID uuid.UUID) error {
 	_, err := db.Exec(`UPDATE users SET updated_at=current_timestamp WHERE id = $1`, userID)
 	return err
 }
 
 func (store *Store) RecordLogin(db database.Queryable, userID uuid.UUID) error {
-	_, err := db.Exec(`UPDATE users SET last_login=current_timestamp WHERE id = $1`, userID)
+	_, err := db.Exec(`UPDATE users SET last_login=current_timestamp, failed_login_count=0 WHERE id = $1`, userID)
 	return err
 }
 
@@ -148,6 +263,21 @@ func (store *Store) DropUserPermissions(db database.Queryable, userID uuid.UUID)
 	return err
 }
 
+// ListDirectPermissions returns the labels of the permissions assigned directly to the
+// user (i.e. excluding those the user has via their roles).
+func (store *Store) ListDirectPermissions(db database.Queryable, userID uuid.UUID) ([]string, error) {
+	var labels []string
+	if err := db.Select(&labels, `
+		SELECT permissions.label FROM users_permissions
+		INNER JOIN permissions
+			ON permissions.id = users_permissions.permission_id
+		WHERE users_permissions.user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to list direct permissions of user %s: %w", userID, err)
+	}
+
+	return labels, nil
+}
+
 type Permission struct {
 	ID    uuid.UUID `db:"id"`
 	Label string    `db:"label"`
@@ -176,18 +306,61 @@ func (store *Store) InsertUserPermissions(db database.Queryable, userID uuid.UUI
 	return err
 }
 
+// selectUserBuilder selects users, along with their effective permissions (the union
+// of the permissions assigned directly to the user, and those of their roles), the
+// labels of their roles, and whether they have enrolled in two-factor authentication.
 func selectUserBuilder() squirrel.SelectBuilder {
 	return squirrel.
-		Select("users.*", "COALESCE(JSONB_AGG(DISTINCT permissions.label) FILTER (WHERE permissions.id IS NOT NULL), '[]') AS permissions").
+		Select(
+			"users.*",
+			"COALESCE(JSONB_AGG(DISTINCT permissions.label) FILTER (WHERE permissions.id IS NOT NULL), '[]') AS permissions",
+			"COALESCE(JSONB_AGG(DISTINCT roles.label) FILTER (WHERE roles.id IS NOT NULL), '[]') AS roles",
+			"EXISTS(SELECT 1 FROM users_totp WHERE users_totp.user_id = users.id AND users_totp.confirmed_at IS NOT NULL) AS mfa_enabled",
+		).
 		From("users").
-		LeftJoin("users_permissions ON users_permissions.user_id = users.id").
-		LeftJoin("permissions ON permissions.id = users_permissions.permission_id").
+		LeftJoin(`(
+			SELECT user_id, permission_id FROM users_permissions
+			UNION
+			SELECT users_roles.user_id, roles_permissions.permission_id FROM users_roles
+			INNER JOIN roles_permissions ON roles_permissions.role_id = users_roles.role_id
+		) AS effective_permissions ON effective_permissions.user_id = users.id`).
+		LeftJoin("permissions ON permissions.id = effective_permissions.permission_id").
+		LeftJoin("users_roles ON users_roles.user_id = users.id").
+		LeftJoin("roles ON roles.id = users_roles.role_id").
 		GroupBy("users.id")
 }
 
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolationCode
+}
+
+// checkUserAffected is a helper for queries which modify a single user. It returns
+// ErrUserNotFound if the query succeeded, but no user was affected.
+func checkUserAffected(res sql.Result, err error, userID uuid.UUID) error {
+	if err != nil {
+		return fmt.Errorf("failed to update user %s: %w", userID, err)
+	}
+
+	if affected, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update user %s: %w", userID, err)
+	} else if affected == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// IsLocked returns true if the user is currently locked due to too many failed logins.
+func (user *userBase) IsLocked() bool {
+	return user.LockedUntil != nil && user.LockedUntil.After(time.Now())
+}
+
 func userModelToUser(model *userModel) *User {
 	return &User{
 		userBase:    model.userBase,
 		Permissions: *model.Permissions.Get(),
+		Roles:       *model.Roles.Get(),
+		MFAEnabled:  model.MFAEnabled,
 	}
 }
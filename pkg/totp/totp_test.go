@@ -0,0 +1,151 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the (ASCII) secret used by the test vectors of RFC 4226 and RFC 6238.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode_RFC4226Vectors(t *testing.T) {
+	// Appendix D of RFC 4226, where the counter is the step
+	expected := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	for counter, code := range expected {
+		if got := Code(rfcSecret, int64(counter)); got != code {
+			t.Errorf("counter %d: expected %s, got %s", counter, code, got)
+		}
+	}
+}
+
+func TestCode_RFC6238Vectors(t *testing.T) {
+	// Appendix B of RFC 6238 (SHA1). The RFC uses 8 digit codes, of which
+	// 6 digit codes are the last 6 digits.
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		step := Step(time.Unix(test.unix, 0))
+		if got := Code(rfcSecret, step); got != test.code {
+			t.Errorf("time %d: expected %s, got %s", test.unix, test.code, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name         string
+		code         string
+		skew         int
+		expectedStep int64
+		expectedOk   bool
+	}{
+		{"current step", Code(rfcSecret, current), 1, current, true},
+		{"whitespace is ignored", " " + Code(rfcSecret, current) + "\n", 1, current, true},
+		{"previous step within skew", Code(rfcSecret, current-1), 1, current - 1, true},
+		{"next step within skew", Code(rfcSecret, current+1), 1, current + 1, true},
+		{"previous step outside skew", Code(rfcSecret, current-2), 1, 0, false},
+		{"next step outside skew", Code(rfcSecret, current+2), 1, 0, false},
+		{"previous step without skew", Code(rfcSecret, current-1), 0, 0, false},
+		{"wider skew", Code(rfcSecret, current-2), 2, current - 2, true},
+		{"wrong code", "000000", 1, 0, false},
+		{"too short", Code(rfcSecret, current)[:5], 1, 0, false},
+		{"too long", Code(rfcSecret, current) + "0", 1, 0, false},
+		{"empty", "", 1, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, test.code, now, test.skew)
+			if ok != test.expectedOk || step != test.expectedStep {
+				t.Errorf("expected (%d, %v), got (%d, %v)", test.expectedStep, test.expectedOk, step, ok)
+			}
+		})
+	}
+}
+
+func TestValidate_WrongSecret(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code := Code([]byte("another secret value"), Step(now))
+	if _, ok := Validate(rfcSecret, code, now, 1); ok {
+		t.Errorf("expected code for another secret to be rejected")
+	}
+}
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		unix int64
+		step int64
+	}{
+		{0, 0},
+		{29, 0},
+		{30, 1},
+		{59, 1},
+		{60, 2},
+	}
+
+	for _, test := range tests {
+		if got := Step(time.Unix(test.unix, 0)); got != test.step {
+			t.Errorf("time %d: expected step %d, got %d", test.unix, test.step, got)
+		}
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(ProvisioningURI("Thea", "alice", rfcSecret))
+	if err != nil {
+		t.Fatalf("failed to parse provisioning URI: %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Thea:alice" {
+		t.Errorf("unexpected provisioning URI %s", uri)
+	}
+
+	expected := map[string]string{
+		"secret":    "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer":    "Thea",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for key, value := range expected {
+		if got := uri.Query().Get(key); got != value {
+			t.Errorf("expected %s=%s, got %s", key, value, got)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	b, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+
+	if len(a) != SecretLength || len(b) != SecretLength {
+		t.Errorf("expected secrets of length %d, got %d and %d", SecretLength, len(a), len(b))
+	}
+	if string(a) == string(b) {
+		t.Errorf("expected generated secrets to differ")
+	}
+}